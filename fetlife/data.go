@@ -1,9 +1,21 @@
 package fetlife
 
 import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
 	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/rs/zerolog/log"
 )
@@ -24,74 +36,493 @@ type PrivateNoteRecord struct {
 	PrivateNote string
 }
 
+// timestampLayouts are the layouts of the timestamps in FetLife exports, newest exports first
+var timestampLayouts = []string{
+	"2006-01-02 15:04:05 MST",
+	"2006-01-02 15:04:05 -0700",
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// ParseTimestamp parses a timestamp of a FetLife export, like "2023-02-15 14:22:10 UTC".  Timestamps without a time
+// zone are UTC.
+func ParseTimestamp(timestamp string) (time.Time, error) {
+	timestamp = strings.TrimSpace(timestamp)
+	for _, layout := range timestampLayouts {
+		if parsed, err := time.Parse(layout, timestamp); err == nil {
+			return parsed, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unknown timestamp format %q", timestamp)
+}
+
+// Updated returns when the user was blocked or the block was last changed: updated_at, or created_at when that's
+// empty
+func (record BlockedRecord) Updated() (time.Time, error) {
+	return updated(record.UpdatedAt, record.CreatedAt)
+}
+
+// Updated returns when the note was last changed: updated_at, or created_at when that's empty
+func (record PrivateNoteRecord) Updated() (time.Time, error) {
+	return updated(record.UpdatedAt, record.CreatedAt)
+}
+
+// updated parses updatedAt, falling back to createdAt when it's empty
+func updated(updatedAt, createdAt string) (time.Time, error) {
+	if strings.TrimSpace(updatedAt) == "" {
+		return ParseTimestamp(createdAt)
+	}
+	return ParseTimestamp(updatedAt)
+}
+
+// FriendRecord represents a friend entry from friends.txt
+type FriendRecord struct {
+	UserID    string
+	CreatedAt string
+	Nickname  string
+}
+
+// FollowRecord represents a follower entry from followers.csv or a following entry from followings.csv
+type FollowRecord struct {
+	UserID    string
+	CreatedAt string
+	Nickname  string
+}
+
+// MessageRecord represents a message from conversations.txt.  MemberID is the other member of the conversation, Sender
+// the nickname of whoever sent the message.
+type MessageRecord struct {
+	MemberID  string
+	CreatedAt string
+	Sender    string
+	Body      string
+}
+
+// ReadOption changes how the data files are read
+type ReadOption func(*readOptions)
+
+type readOptions struct {
+	lenient bool
+}
+
+// Lenient skips the check of the header row, for files with unexpected column names that still have the columns in
+// the expected order
+func Lenient() ReadOption {
+	return func(options *readOptions) {
+		options.lenient = true
+	}
+}
+
+// The header rows of the data files
+var (
+	blockedsHeader      = []string{"blocked_user_id", "created_at", "updated_at", "blocked_nickname"}
+	privateNotesHeader  = []string{"member_id", "created_at", "updated_at", "private_note"}
+	friendsHeader       = []string{"friend_user_id", "created_at", "friend_nickname"}
+	followsHeader       = []string{"user_id", "created_at", "nickname"}
+	conversationsHeader = []string{"member_id", "created_at", "sender", "body"}
+)
+
 // ReadBlockeds reads and parses the blockeds.txt file from the specified data directory
-func ReadBlockeds(dataDir string) ([]BlockedRecord, error) {
-	path := filepath.Join(dataDir, "blockeds.txt")
-	file, err := os.Open(path)
+func ReadBlockeds(dataDir string, options ...ReadOption) ([]BlockedRecord, error) {
+	var blockeds []BlockedRecord
+	err := StreamBlockeds(dataDir, func(blocked BlockedRecord) error {
+		blockeds = append(blockeds, blocked)
+		return nil
+	}, options...)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
+	return blockeds, nil
+}
 
-	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
+// ReadBlockedsFromReader reads and parses blocked users in the format of blockeds.txt from r, which may be gzip
+// compressed
+func ReadBlockedsFromReader(r io.Reader, options ...ReadOption) ([]BlockedRecord, error) {
+	var blockeds []BlockedRecord
+	err := streamReader(r, "blockeds.txt", blockedsHeader, options, blockedRow(func(blocked BlockedRecord) error {
+		blockeds = append(blockeds, blocked)
+		return nil
+	}))
 	if err != nil {
 		return nil, err
 	}
+	return blockeds, nil
+}
 
-	var blockeds []BlockedRecord
-	for i, record := range records {
-		if i == 0 {
-			// Skip header
-			continue
-		}
+// StreamBlockeds reads the blockeds.txt file from the specified data directory a row at a time, calling fn with each
+// record, so the file doesn't have to fit in memory.  Reading stops at the first error of fn, which is returned.
+func StreamBlockeds(dataDir string, fn func(BlockedRecord) error, options ...ReadOption) error {
+	return streamRecords(dataDir, "blockeds.txt", blockedsHeader, options, blockedRow(fn))
+}
+
+// blockedRow turns the rows of blockeds.txt into records for fn
+func blockedRow(fn func(BlockedRecord) error) func(line int, record []string) error {
+	return func(line int, record []string) error {
 		if len(record) < 4 {
-			log.Warn().Int("line", i+1).Msg("Skipping invalid blocked record")
-			continue
+			log.Warn().Int("line", line).Msg("Skipping invalid blocked record")
+			return nil
 		}
-		blockeds = append(blockeds, BlockedRecord{
+		return fn(BlockedRecord{
 			UserID:    record[0],
 			CreatedAt: record[1],
 			UpdatedAt: record[2],
 			Nickname:  record[3],
 		})
 	}
-
-	return blockeds, nil
 }
 
 // ReadPrivateNotes reads and parses the private_notes.txt file from the specified data directory
-func ReadPrivateNotes(dataDir string) ([]PrivateNoteRecord, error) {
-	path := filepath.Join(dataDir, "private_notes.txt")
-	file, err := os.Open(path)
+func ReadPrivateNotes(dataDir string, options ...ReadOption) ([]PrivateNoteRecord, error) {
+	var notes []PrivateNoteRecord
+	err := StreamPrivateNotes(dataDir, func(note PrivateNoteRecord) error {
+		notes = append(notes, note)
+		return nil
+	}, options...)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
+	return notes, nil
+}
 
-	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
+// ReadPrivateNotesFromReader reads and parses private notes in the format of private_notes.txt from r, which may be
+// gzip compressed
+func ReadPrivateNotesFromReader(r io.Reader, options ...ReadOption) ([]PrivateNoteRecord, error) {
+	var notes []PrivateNoteRecord
+	err := streamReader(r, "private_notes.txt", privateNotesHeader, options, privateNoteRow(func(note PrivateNoteRecord) error {
+		notes = append(notes, note)
+		return nil
+	}))
 	if err != nil {
 		return nil, err
 	}
+	return notes, nil
+}
 
-	var notes []PrivateNoteRecord
-	for i, record := range records {
-		if i == 0 {
-			// Skip header
-			continue
-		}
+// StreamPrivateNotes reads the private_notes.txt file from the specified data directory a row at a time, calling fn
+// with each record.  Reading stops at the first error of fn, which is returned.
+func StreamPrivateNotes(dataDir string, fn func(PrivateNoteRecord) error, options ...ReadOption) error {
+	return streamRecords(dataDir, "private_notes.txt", privateNotesHeader, options, privateNoteRow(fn))
+}
+
+// privateNoteRow turns the rows of private_notes.txt into records for fn
+func privateNoteRow(fn func(PrivateNoteRecord) error) func(line int, record []string) error {
+	return func(line int, record []string) error {
 		if len(record) < 4 {
-			log.Warn().Int("line", i+1).Msg("Skipping invalid private note record")
-			continue
+			log.Warn().Int("line", line).Msg("Skipping invalid private note record")
+			return nil
 		}
-		notes = append(notes, PrivateNoteRecord{
+		return fn(PrivateNoteRecord{
 			MemberID:    record[0],
 			CreatedAt:   record[1],
 			UpdatedAt:   record[2],
 			PrivateNote: record[3],
 		})
 	}
+}
+
+// ReadFriends reads and parses the friends.txt file from the specified data directory
+func ReadFriends(dataDir string, options ...ReadOption) ([]FriendRecord, error) {
+	records, err := readRecords(dataDir, "friends.txt", friendsHeader, options)
+	if err != nil {
+		return nil, err
+	}
 
-	return notes, nil
+	var friends []FriendRecord
+	for i, record := range records {
+		if len(record) < 3 {
+			log.Warn().Int("line", i+2).Msg("Skipping invalid friend record")
+			continue
+		}
+		friends = append(friends, FriendRecord{
+			UserID:    record[0],
+			CreatedAt: record[1],
+			Nickname:  record[2],
+		})
+	}
+
+	return friends, nil
+}
+
+// ReadFollowers reads and parses the followers.csv file from the specified data directory
+func ReadFollowers(dataDir string, options ...ReadOption) ([]FollowRecord, error) {
+	return readFollows(dataDir, "followers.csv", options)
+}
+
+// ReadFollowings reads and parses the followings.csv file from the specified data directory
+func ReadFollowings(dataDir string, options ...ReadOption) ([]FollowRecord, error) {
+	return readFollows(dataDir, "followings.csv", options)
+}
+
+func readFollows(dataDir, name string, options []ReadOption) ([]FollowRecord, error) {
+	records, err := readRecords(dataDir, name, followsHeader, options)
+	if err != nil {
+		return nil, err
+	}
+
+	var follows []FollowRecord
+	for i, record := range records {
+		if len(record) < 3 {
+			log.Warn().Int("line", i+2).Str("file", name).Msg("Skipping invalid follow record")
+			continue
+		}
+		follows = append(follows, FollowRecord{
+			UserID:    record[0],
+			CreatedAt: record[1],
+			Nickname:  record[2],
+		})
+	}
+
+	return follows, nil
+}
+
+// ReadConversations reads and parses the conversations.txt file from the specified data directory
+func ReadConversations(dataDir string, options ...ReadOption) ([]MessageRecord, error) {
+	records, err := readRecords(dataDir, "conversations.txt", conversationsHeader, options)
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []MessageRecord
+	for i, record := range records {
+		if len(record) < 4 {
+			log.Warn().Int("line", i+2).Msg("Skipping invalid message record")
+			continue
+		}
+		messages = append(messages, MessageRecord{
+			MemberID:  record[0],
+			CreatedAt: record[1],
+			Sender:    record[2],
+			Body:      record[3],
+		})
+	}
+
+	return messages, nil
+}
+
+// IsArchive reports whether dataDir is a zip archive of the export instead of a directory
+func IsArchive(dataDir string) bool {
+	if !strings.EqualFold(filepath.Ext(dataDir), ".zip") {
+		return false
+	}
+	info, err := os.Stat(dataDir)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// readRecords reads the CSV file name of the export and checks its header row, which isn't returned
+func readRecords(dataDir, name string, header []string, options []ReadOption) ([][]string, error) {
+	var records [][]string
+	err := streamRecords(dataDir, name, header, options, func(_ int, record []string) error {
+		records = append(records, slices.Clone(record))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// streamRecords reads the CSV file name of the export a row at a time, checks its header row and calls fn with the
+// line number and columns of every other row.  Reading stops at the first error of fn, which is returned.
+func streamRecords(dataDir, name string, header []string, options []ReadOption, fn func(line int, record []string) error) error {
+	file, source, err := openDataFile(dataDir, name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return streamReader(file, source, header, options, fn)
+}
+
+// streamReader reads CSV rows from r like streamRecords, decompressing r first when it's gzip compressed.  source names
+// r in errors.
+func streamReader(r io.Reader, source string, header []string, options []ReadOption, fn func(line int, record []string) error) error {
+	var opts readOptions
+	for _, option := range options {
+		option(&opts)
+	}
+
+	r, err := decompress(r)
+	if err != nil {
+		return fmt.Errorf("%s: %w", source, err)
+	}
+
+	reader := csv.NewReader(r)
+	// Rows with missing columns are skipped with a warning instead of failing the whole file
+	reader.FieldsPerRecord = -1
+	// The columns of a row aren't kept after fn returns, so the reader can reuse them
+	reader.ReuseRecord = true
+
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if row == 1 {
+			if !opts.lenient {
+				if err := validateHeaders(record, header); err != nil {
+					return fmt.Errorf("%s: %w", source, err)
+				}
+			}
+			continue
+		}
+		line, _ := reader.FieldPos(0)
+		if err := fn(line, record); err != nil {
+			return err
+		}
+	}
+}
+
+// DataFileSize returns the size of the file name of the export, uncompressed when dataDir is a zip archive.  For a
+// gzip compressed name.gz it's the uncompressed size recorded at the end of the file.
+func DataFileSize(dataDir, name string) (int64, error) {
+	if !IsArchive(dataDir) {
+		filePath := filepath.Join(dataDir, name)
+		info, err := os.Stat(filePath)
+		if errors.Is(err, os.ErrNotExist) {
+			filePath += gzipSuffix
+			info, err = os.Stat(filePath)
+		}
+		if err != nil {
+			return 0, err
+		}
+		if strings.HasSuffix(filePath, gzipSuffix) {
+			return gzipSize(filePath, info.Size())
+		}
+		return info.Size(), nil
+	}
+
+	archive, err := zip.OpenReader(dataDir)
+	if err != nil {
+		return 0, err
+	}
+	defer archive.Close()
+	if entry := archiveEntry(archive, name); entry != nil {
+		return int64(entry.UncompressedSize64), nil
+	}
+	return 0, fmt.Errorf("%s not found in %s: %w", name, dataDir, os.ErrNotExist)
+}
+
+// gzipSize returns the uncompressed size of the gzip file at filePath, which is size bytes long, from the last four
+// bytes of the file.  The size is only exact for files smaller than 4 GiB once uncompressed.
+func gzipSize(filePath string, size int64) (int64, error) {
+	if size < 4 {
+		return size, nil
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	var trailer [4]byte
+	if _, err := file.ReadAt(trailer[:], size-4); err != nil {
+		return 0, err
+	}
+	return int64(binary.LittleEndian.Uint32(trailer[:])), nil
+}
+
+// openDataFile opens the file name of the export in dataDir, or name.gz when the export only has that, and returns
+// it with its path for errors.  When dataDir is a zip archive the file is read from the archive without extracting
+// it, from whatever folder of the archive it's in.
+func openDataFile(dataDir, name string) (io.ReadCloser, string, error) {
+	if !IsArchive(dataDir) {
+		filePath := filepath.Join(dataDir, name)
+		file, err := os.Open(filePath)
+		if errors.Is(err, os.ErrNotExist) {
+			if gzipFile, gzipErr := os.Open(filePath + gzipSuffix); gzipErr == nil {
+				return gzipFile, filePath + gzipSuffix, nil
+			}
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		return file, filePath, nil
+	}
+
+	archive, err := zip.OpenReader(dataDir)
+	if err != nil {
+		return nil, "", err
+	}
+	entry := archiveEntry(archive, name)
+	if entry == nil {
+		archive.Close()
+		return nil, "", fmt.Errorf("%s not found in %s: %w", name, dataDir, os.ErrNotExist)
+	}
+	file, err := entry.Open()
+	if err != nil {
+		archive.Close()
+		return nil, "", err
+	}
+	return &archiveFile{ReadCloser: file, archive: archive}, filepath.Join(dataDir, entry.Name), nil
+}
+
+// archiveEntry returns the file name of the zip archive in any of its folders, or name.gz when the archive only has
+// that, or nil
+func archiveEntry(archive *zip.ReadCloser, name string) *zip.File {
+	var compressed *zip.File
+	for _, entry := range archive.File {
+		if entry.FileInfo().IsDir() {
+			continue
+		}
+		switch path.Base(entry.Name) {
+		case name:
+			return entry
+		case name + gzipSuffix:
+			if compressed == nil {
+				compressed = entry
+			}
+		}
+	}
+	return compressed
+}
+
+// gzipSuffix is the extension of a gzip compressed data file, like blockeds.txt.gz
+const gzipSuffix = ".gz"
+
+// gzipMagic are the first bytes of every gzip file
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// decompress returns a reader of the content of r, decompressed when it starts like a gzip file, so compressed data
+// files are read whatever their name
+func decompress(r io.Reader) (io.Reader, error) {
+	buffered := bufio.NewReader(r)
+	magic, err := buffered.Peek(len(gzipMagic))
+	if err != nil || !bytes.Equal(magic, gzipMagic) {
+		// Errors are returned again by the next read
+		return buffered, nil
+	}
+	return gzip.NewReader(buffered)
+}
+
+// archiveFile is a file read from a zip archive, which closes the archive with the file
+type archiveFile struct {
+	io.ReadCloser
+	archive *zip.ReadCloser
+}
+
+func (file *archiveFile) Close() error {
+	err := file.ReadCloser.Close()
+	if archiveErr := file.archive.Close(); err == nil {
+		err = archiveErr
+	}
+	return err
+}
+
+// validateHeaders checks that the header row starts with the expected columns.  Extra columns at the end are allowed.
+func validateHeaders(actual, expected []string) error {
+	for i, column := range expected {
+		if i >= len(actual) {
+			return fmt.Errorf("missing header %q at column %d", column, i)
+		}
+		// Files saved by spreadsheet programs can start with a byte order mark
+		name := strings.TrimSpace(strings.TrimPrefix(actual[i], "\ufeff"))
+		if name != column {
+			return fmt.Errorf("unexpected header %q at column %d, expected %q", name, i, column)
+		}
+	}
+	return nil
 }
@@ -0,0 +1,47 @@
+package fetlife
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimestamp(t *testing.T) {
+	tests := []struct {
+		timestamp string
+		expected  time.Time
+	}{
+		{"2023-02-15 14:22:10 UTC", time.Date(2023, 2, 15, 14, 22, 10, 0, time.UTC)},
+		{"2023-02-15 14:22:10 +0100", time.Date(2023, 2, 15, 13, 22, 10, 0, time.UTC)},
+		{"2023-02-15T14:22:10Z", time.Date(2023, 2, 15, 14, 22, 10, 0, time.UTC)},
+		{"2023-02-15 14:22:10", time.Date(2023, 2, 15, 14, 22, 10, 0, time.UTC)},
+		{" 2023-02-15 ", time.Date(2023, 2, 15, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		parsed, err := ParseTimestamp(tt.timestamp)
+		if err != nil {
+			t.Errorf("Failed to parse %q: %v", tt.timestamp, err)
+			continue
+		}
+		if !parsed.Equal(tt.expected) {
+			t.Errorf("Expected %q to be %v, got %v", tt.timestamp, tt.expected, parsed)
+		}
+	}
+
+	for _, timestamp := range []string{"", "15/02/2023", "2023-02-30"} {
+		if _, err := ParseTimestamp(timestamp); err == nil {
+			t.Errorf("Expected an error for %q", timestamp)
+		}
+	}
+}
+
+func TestUpdated(t *testing.T) {
+	// updated_at is used, created_at when it's empty
+	record := BlockedRecord{CreatedAt: "2024-01-01", UpdatedAt: "2024-02-01"}
+	if updated, err := record.Updated(); err != nil || !updated.Equal(time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected updated_at, got %v, %v", updated, err)
+	}
+	note := PrivateNoteRecord{CreatedAt: "2024-01-01", UpdatedAt: " "}
+	if updated, err := note.Updated(); err != nil || !updated.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected created_at, got %v, %v", updated, err)
+	}
+}
@@ -0,0 +1,122 @@
+package fetlife
+
+import (
+	"errors"
+	"os"
+	"slices"
+	"time"
+)
+
+// ExportUpdated returns the newest updated_at of the blocked users and private notes of the export in dataDir, which
+// dates the export.  Missing files and timestamps that can't be parsed are left out, so an export without any is the
+// zero time.  The files are streamed, so large exports aren't held in memory.
+func ExportUpdated(dataDir string, options ...ReadOption) (time.Time, error) {
+	var newest time.Time
+	keep := func(updated time.Time, err error) error {
+		if err == nil && updated.After(newest) {
+			newest = updated
+		}
+		return nil
+	}
+
+	err := StreamBlockeds(dataDir, func(record BlockedRecord) error { return keep(record.Updated()) }, options...)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return time.Time{}, err
+	}
+	err = StreamPrivateNotes(dataDir, func(record PrivateNoteRecord) error { return keep(record.Updated()) }, options...)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return time.Time{}, err
+	}
+	return newest, nil
+}
+
+// OrderExports returns the indexes of dataDirs from the oldest to the newest export by ExportUpdated, the order the
+// merge functions take the exports in.  Exports of the same time keep the order they're given in.
+func OrderExports(dataDirs []string, options ...ReadOption) ([]int, error) {
+	updated := make([]time.Time, len(dataDirs))
+	order := make([]int, len(dataDirs))
+	for i, dataDir := range dataDirs {
+		var err error
+		if updated[i], err = ExportUpdated(dataDir, options...); err != nil {
+			return nil, err
+		}
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return updated[a].Compare(updated[b])
+	})
+	return order, nil
+}
+
+// MergeRecords merges the records read from several exports, given from the oldest to the newest, by user ID.  Each
+// user's records are taken from the newest export that has records for the user, so they're never mixed from
+// different exports.  The records keep the order of their exports.  counts holds the number of records kept from each
+// export.
+func MergeRecords[T any](exports [][]T, userID func(T) string) (merged []T, counts []int) {
+	counts = make([]int, len(exports))
+	if len(exports) == 1 {
+		counts[0] = len(exports[0])
+		return exports[0], counts
+	}
+
+	// The newest export with records for each user
+	sources := make(map[string]int)
+	for i, records := range exports {
+		for _, record := range records {
+			sources[userID(record)] = i
+		}
+	}
+
+	for i, records := range exports {
+		for _, record := range records {
+			if sources[userID(record)] == i {
+				merged = append(merged, record)
+				counts[i]++
+			}
+		}
+	}
+	return merged, counts
+}
+
+// MergeLists merges the records read from several exports, given from the oldest to the newest, of a file that lists
+// the users as they were when the export was made, like blockeds.txt.  A user the newest export doesn't have was
+// removed from the list since the older ones, like a user who was unblocked, so only the records of the newest export
+// are kept.  counts holds the number of records kept from each export.
+func MergeLists[T any](exports [][]T) (merged []T, counts []int) {
+	counts = make([]int, len(exports))
+	if len(exports) == 0 {
+		return nil, counts
+	}
+	newest := len(exports) - 1
+	counts[newest] = len(exports[newest])
+	return exports[newest], counts
+}
+
+// MergeBlockeds merges the blocked users of several exports with MergeLists, so users unblocked since an older export
+// aren't blocked anymore
+func MergeBlockeds(exports ...[]BlockedRecord) ([]BlockedRecord, []int) {
+	return MergeLists(exports)
+}
+
+// MergePrivateNotes merges the private notes of several exports with MergeRecords
+func MergePrivateNotes(exports ...[]PrivateNoteRecord) ([]PrivateNoteRecord, []int) {
+	return MergeRecords(exports, func(r PrivateNoteRecord) string { return r.MemberID })
+}
+
+// MergeFriends merges the friends of several exports with MergeLists, so users unfriended since an older export aren't
+// friends anymore
+func MergeFriends(exports ...[]FriendRecord) ([]FriendRecord, []int) {
+	return MergeLists(exports)
+}
+
+// MergeFollows merges the followers or followings of several exports with MergeLists, so follows that ended since an
+// older export are left out
+func MergeFollows(exports ...[]FollowRecord) ([]FollowRecord, []int) {
+	return MergeLists(exports)
+}
+
+// MergeConversations merges the messages of several exports with MergeRecords, keeping each member's conversation
+// from the newest export with messages of the member
+func MergeConversations(exports ...[]MessageRecord) ([]MessageRecord, []int) {
+	return MergeRecords(exports, func(r MessageRecord) string { return r.MemberID })
+}
@@ -0,0 +1,120 @@
+package fetlife
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestMergeRecords(t *testing.T) {
+	older := []PrivateNoteRecord{
+		{MemberID: "11111", PrivateNote: "Old note"},
+		{MemberID: "22222", PrivateNote: "Only in the older export"},
+		{MemberID: "11111", PrivateNote: "Second old note"},
+	}
+	newer := []PrivateNoteRecord{
+		{MemberID: "33333", PrivateNote: "Only in the newer export"},
+		{MemberID: "11111", PrivateNote: "New note"},
+	}
+
+	// Each user's records come from the newest export that has the user, in the order of the exports
+	merged, counts := MergePrivateNotes(older, newer)
+	expected := []PrivateNoteRecord{older[1], newer[0], newer[1]}
+	if !slices.Equal(merged, expected) {
+		t.Errorf("Expected %v, got %v", expected, merged)
+	}
+	if !slices.Equal(counts, []int{1, 2}) {
+		t.Errorf("Expected counts [1 2], got %v", counts)
+	}
+
+	// A single export is kept as it is
+	merged, counts = MergePrivateNotes(older)
+	if !slices.Equal(merged, older) || !slices.Equal(counts, []int{3}) {
+		t.Errorf("Expected the single export with counts [3], got %v with %v", merged, counts)
+	}
+
+	// All of a user's messages come from one export
+	messages, counts := MergeConversations(
+		[]MessageRecord{{MemberID: "11111", Body: "Hi"}, {MemberID: "11111", Body: "Bye"}},
+		[]MessageRecord{{MemberID: "11111", Body: "Hi again"}},
+	)
+	if len(messages) != 1 || messages[0].Body != "Hi again" || !slices.Equal(counts, []int{0, 1}) {
+		t.Errorf("Expected the message of the newer export, got %v with counts %v", messages, counts)
+	}
+}
+
+func TestMergeLists(t *testing.T) {
+	older := []BlockedRecord{{UserID: "11111", Nickname: "Dave"}, {UserID: "22222", Nickname: "Erin"}}
+	newer := []BlockedRecord{{UserID: "22222", Nickname: "Erin"}, {UserID: "33333", Nickname: "Frank"}}
+
+	// Dave was unblocked since the older export, so he isn't blocked anymore
+	merged, counts := MergeBlockeds(older, newer)
+	if !slices.Equal(merged, newer) {
+		t.Errorf("Expected the blocked users of the newest export %v, got %v", newer, merged)
+	}
+	if !slices.Equal(counts, []int{0, 2}) {
+		t.Errorf("Expected counts [0 2], got %v", counts)
+	}
+
+	// An empty newest export unblocked everyone
+	merged, counts = MergeBlockeds(older, nil)
+	if len(merged) != 0 || !slices.Equal(counts, []int{0, 0}) {
+		t.Errorf("Expected no blocked users, got %v with counts %v", merged, counts)
+	}
+
+	merged, counts = MergeBlockeds()
+	if merged != nil || len(counts) != 0 {
+		t.Errorf("Expected nothing to merge, got %v with counts %v", merged, counts)
+	}
+}
+
+func TestOrderExports(t *testing.T) {
+	writeExport := func(blockeds, notes string) string {
+		dataDir := t.TempDir()
+		files := map[string]string{
+			"blockeds.txt":      "blocked_user_id,created_at,updated_at,blocked_nickname\n" + blockeds,
+			"private_notes.txt": "member_id,created_at,updated_at,private_note\n" + notes,
+		}
+		for name, content := range files {
+			if err := os.WriteFile(filepath.Join(dataDir, name), []byte(content), 0644); err != nil {
+				t.Fatalf("Failed to write %s: %v", name, err)
+			}
+		}
+		return dataDir
+	}
+
+	// The newer export only has a newer note, and its blockeds are older
+	older := writeExport("11111,2024-01-01,2024-01-02,Dave\n", "22222,2024-01-01,,Old note\n")
+	newer := writeExport("11111,2023-12-01,2023-12-01,Dave\n", "22222,2024-01-01,2024-03-01,New note\n")
+	undated := writeExport("", "")
+
+	updated, err := ExportUpdated(newer)
+	if err != nil {
+		t.Fatalf("Failed to date export: %v", err)
+	}
+	if expected := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC); !updated.Equal(expected) {
+		t.Errorf("Expected %v, got %v", expected, updated)
+	}
+
+	order, err := OrderExports([]string{newer, older, undated})
+	if err != nil {
+		t.Fatalf("Failed to order exports: %v", err)
+	}
+	if !slices.Equal(order, []int{2, 1, 0}) {
+		t.Errorf("Expected order [2 1 0], got %v", order)
+	}
+
+	// Exports of the same time keep their order, and a missing file doesn't date an export
+	if err := os.Remove(filepath.Join(undated, "private_notes.txt")); err != nil {
+		t.Fatal(err)
+	}
+	order, err = OrderExports([]string{older, newer, older, undated})
+	if err != nil {
+		t.Fatalf("Failed to order exports: %v", err)
+	}
+	if !slices.Equal(order, []int{3, 0, 2, 1}) {
+		t.Errorf("Expected order [3 0 2 1], got %v", order)
+	}
+}
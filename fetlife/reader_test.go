@@ -0,0 +1,179 @@
+package fetlife
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const testBlockeds = "blocked_user_id,created_at,updated_at,blocked_nickname\n" +
+	"11111,2024-01-01,2024-01-02,Dave\n" +
+	"22222,2024-02-01,,Erin\n"
+
+var testBlockedRecords = []BlockedRecord{
+	{UserID: "11111", CreatedAt: "2024-01-01", UpdatedAt: "2024-01-02", Nickname: "Dave"},
+	{UserID: "22222", CreatedAt: "2024-02-01", Nickname: "Erin"},
+}
+
+// gzipped returns content compressed with gzip
+func gzipped(t *testing.T, content string) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	if _, err := writer.Write([]byte(content)); err != nil {
+		t.Fatalf("Failed to compress: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Failed to compress: %v", err)
+	}
+	return buffer.Bytes()
+}
+
+func TestDecompress(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []byte
+	}{
+		{name: "plain", input: []byte(testBlockeds)},
+		{name: "gzip", input: gzipped(t, testBlockeds)},
+		{name: "empty", input: nil},
+		{name: "shorter than the magic", input: []byte{0x1f}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := decompress(bytes.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("Failed to decompress: %v", err)
+			}
+			content, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("Failed to read: %v", err)
+			}
+			expected := string(tt.input)
+			if tt.name == "gzip" {
+				expected = testBlockeds
+			}
+			if string(content) != expected {
+				t.Errorf("Expected %q, got %q", expected, content)
+			}
+		})
+	}
+
+	// A file that starts like gzip but isn't fails
+	if _, err := decompress(bytes.NewReader([]byte{0x1f, 0x8b, 'n', 'o', 't'})); err == nil {
+		t.Error("Expected an error for a broken gzip header")
+	}
+}
+
+func TestReadBlockedsFromReader(t *testing.T) {
+	for name, input := range map[string][]byte{
+		"plain": []byte(testBlockeds),
+		"gzip":  gzipped(t, testBlockeds),
+	} {
+		blockeds, err := ReadBlockedsFromReader(bytes.NewReader(input))
+		if err != nil {
+			t.Fatalf("Failed to read %s blockeds: %v", name, err)
+		}
+		if !slices.Equal(blockeds, testBlockedRecords) {
+			t.Errorf("Expected %v from %s blockeds, got %v", testBlockedRecords, name, blockeds)
+		}
+	}
+
+	// Rows with missing columns are skipped
+	blockeds, err := ReadBlockedsFromReader(strings.NewReader(testBlockeds + "33333,2024-03-01\n"))
+	if err != nil {
+		t.Fatalf("Failed to read blockeds: %v", err)
+	}
+	if !slices.Equal(blockeds, testBlockedRecords) {
+		t.Errorf("Expected %v, got %v", testBlockedRecords, blockeds)
+	}
+
+	// An unexpected header fails, unless reading leniently
+	renamed := strings.Replace(testBlockeds, "blocked_user_id", "user_id", 1)
+	if _, err := ReadBlockedsFromReader(strings.NewReader(renamed)); err == nil || !strings.Contains(err.Error(), "blockeds.txt") {
+		t.Errorf("Expected a header error naming blockeds.txt, got %v", err)
+	}
+	if blockeds, err := ReadBlockedsFromReader(strings.NewReader(renamed), Lenient()); err != nil || len(blockeds) != 2 {
+		t.Errorf("Expected 2 blocked users read leniently, got %v, %v", blockeds, err)
+	}
+
+	// A truncated gzip stream fails
+	compressed := gzipped(t, testBlockeds)
+	if _, err := ReadBlockedsFromReader(bytes.NewReader(compressed[:len(compressed)/2])); err == nil {
+		t.Error("Expected an error for a truncated gzip stream")
+	}
+}
+
+func TestReadBlockeds_GzipFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content []byte
+	}{
+		{name: "compressed", file: "blockeds.txt.gz", content: gzipped(t, testBlockeds)},
+		// A .gz file that isn't compressed is read as it is
+		{name: "not gzip", file: "blockeds.txt.gz", content: []byte(testBlockeds)},
+		// A compressed file is decompressed whatever its name
+		{name: "compressed without .gz", file: "blockeds.txt", content: gzipped(t, testBlockeds)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataDir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dataDir, tt.file), tt.content, 0644); err != nil {
+				t.Fatalf("Failed to write %s: %v", tt.file, err)
+			}
+			blockeds, err := ReadBlockeds(dataDir)
+			if err != nil {
+				t.Fatalf("Failed to read blockeds: %v", err)
+			}
+			if !slices.Equal(blockeds, testBlockedRecords) {
+				t.Errorf("Expected %v, got %v", testBlockedRecords, blockeds)
+			}
+		})
+	}
+
+	// Without either file the error is the one of the plain file
+	_, err := ReadBlockeds(t.TempDir())
+	if !errors.Is(err, os.ErrNotExist) || !strings.Contains(err.Error(), "blockeds.txt") {
+		t.Errorf("Expected blockeds.txt not to exist, got %v", err)
+	}
+}
+
+func TestStreamBlockeds(t *testing.T) {
+	dataDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dataDir, "blockeds.txt"), []byte(testBlockeds), 0644); err != nil {
+		t.Fatalf("Failed to write blockeds.txt: %v", err)
+	}
+
+	var blockeds []BlockedRecord
+	err := StreamBlockeds(dataDir, func(blocked BlockedRecord) error {
+		blockeds = append(blockeds, blocked)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to stream blockeds: %v", err)
+	}
+	if !slices.Equal(blockeds, testBlockedRecords) {
+		t.Errorf("Expected %v, got %v", testBlockedRecords, blockeds)
+	}
+
+	// Streaming stops at the first error of fn, which is returned
+	stop := errors.New("stop")
+	count := 0
+	err = StreamBlockeds(dataDir, func(BlockedRecord) error {
+		count++
+		return stop
+	})
+	if !errors.Is(err, stop) {
+		t.Errorf("Expected the error of fn, got %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected streaming to stop after 1 record, got %d", count)
+	}
+}
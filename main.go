@@ -2,9 +2,11 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 
+	"github.com/alecthomas/kong"
 	"github.com/rs/zerolog/log"
 	"github.com/woodysmith1912/fetlife-data-tools/program"
 )
@@ -26,6 +28,10 @@ func main() {
 	// This ends up calling options.Run()
 	if err := kctx.Run(&options); err != nil {
 		log.Err(err).Msg("Program failed")
+		var exitCoder kong.ExitCoder
+		if errors.As(err, &exitCoder) {
+			os.Exit(exitCoder.ExitCode())
+		}
 		os.Exit(1)
 	}
 }
@@ -1,17 +1,41 @@
 package obsidian
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/rs/zerolog/log"
 	"gopkg.in/yaml.v3"
 )
 
 type Vault struct {
 	Path string
-	// Pages is a list of all of the pages in the vault
+	// Pages is a list of all of the pages in the vault.  Use Add, Rename and Delete to change it so the title index
+	// stays up to date, or call Reindex after changing it directly.
 	Pages []*Page
+
+	// titles indexes the pages by title and titlesCI by lowercased title.  Titles are only unique within a folder, so
+	// a title can have several pages.
+	titles   map[string][]*Page
+	titlesCI map[string][]*Page
+
+	// mu guards Pages and the title index in the methods that find, add, rename, move and delete pages, so those can
+	// be called from several goroutines at once
+	mu sync.RWMutex
 }
 
 // Color is an HTML color code
@@ -34,11 +58,56 @@ type Page struct {
 	WebBadgeColor Color
 	// WebMessage is taken from the `web-message` metadata and will be displayed by the Obsidian plugin in the browser
 	WebMessage string
+	// BlockedDate is taken from the `blocked-date` metadata and records when the person was blocked
+	BlockedDate string
+	// BlockedAt is taken from the `blocked-at` metadata and holds the created_at of the user's blocked record as
+	// exported
+	BlockedAt string
+	// FriendDate is taken from the `friend-date` metadata and records when the person became a friend
+	FriendDate string
+	// NoteCreated is taken from the `note-created` metadata and records when the private note was first written
+	NoteCreated string
+	// NoteUpdated is taken from the `note-updated` metadata and records when the private note last changed
+	NoteUpdated string
+	// CreatedAt is taken from the `created-at` metadata and records when the page was created by a sync, in RFC 3339
+	// format
+	CreatedAt string
+	// SyncedAt is taken from the `synced-at` metadata and records when a sync last changed the page, in RFC 3339 format
+	SyncedAt string
+	// CustomFields holds the metadata of every other key, like `met-at` from the user's own templates, so saving the
+	// page keeps them.  They are written back after the known field they followed, as they were written while their
+	// value is unchanged; new ones go after the known fields, sorted by key.
+	CustomFields map[string]interface{}
 	// FilePath is the absolute path to the markdown file
 	FilePath string
 	// Content is the markdown content (body) of the page, excluding frontmatter
 	Content string
+	// savedContent is Content as it was loaded or last saved, to tell whether the body was changed
+	savedContent string
+	// customNodes holds the YAML of the custom fields as they were loaded
+	customNodes map[string]customNode
+}
+
+// customNode is a custom field as it was loaded, so saving the page writes it back where and as it was written
+type customNode struct {
+	key, value *yaml.Node
+	// after is the known field the custom field followed, empty when no known field came before it
+	after string
+	// index is the position of the field in the frontmatter
+	index int
+}
+
+// PageSummary is the metadata of a page without its content, suitable for marshalling to JSON
+type PageSummary struct {
+	Title         string   `json:"title"`
+	Folder        string   `json:"folder"`
+	URL           string   `json:"url,omitempty"`
+	Tags          []string `json:"tags,omitempty"`
+	Aliases       []string `json:"aliases,omitempty"`
+	WebBadgeColor Color    `json:"web-badge-color,omitempty"`
+	WebMessage    string   `json:"web-message,omitempty"`
 }
+
 type Person struct {
 	Page
 }
@@ -49,10 +118,50 @@ func NewVault(path string) *Vault {
 	}
 }
 
+// PageError is the error of a page that couldn't be loaded, like one with malformed frontmatter
+type PageError struct {
+	FilePath string
+	Err      error
+}
+
+func (err *PageError) Error() string {
+	return fmt.Sprintf("%s: %v", err.FilePath, err.Err)
+}
+
+func (err *PageError) Unwrap() error {
+	return err.Err
+}
+
 // Load loads all of the pages in the vault
 func (vault *Vault) Load() error {
-	// Iterate all of the markdown files in the vault and load them into the vault
-	return filepath.WalkDir(vault.Path, func(path string, d os.DirEntry, err error) error {
+	return vault.LoadConcurrent(context.Background(), runtime.NumCPU())
+}
+
+// LoadConcurrent loads all of the pages in the vault like Load, parsing up to workers files at a time.  The pages are
+// added in the order of their paths whatever the number of workers.  Loading stops when ctx is done.
+func (vault *Vault) LoadConcurrent(ctx context.Context, workers int) error {
+	return vault.load(ctx, workers, func(err *PageError) error {
+		return err.Err
+	})
+}
+
+// LoadValid loads all of the pages in the vault like Load, but skips the pages that can't be loaded and returns their
+// errors instead of stopping at the first one
+func (vault *Vault) LoadValid() ([]*PageError, error) {
+	var invalid []*PageError
+	err := vault.load(context.Background(), runtime.NumCPU(), func(err *PageError) error {
+		invalid = append(invalid, err)
+		return nil
+	})
+	return invalid, err
+}
+
+// load loads the pages in the vault on up to workers goroutines, handing the error of every page that can't be loaded
+// to invalid in the order of their paths.  Loading stops when invalid returns an error.
+func (vault *Vault) load(ctx context.Context, workers int, invalid func(err *PageError) error) error {
+	// Collect all of the markdown files in the vault first, WalkDir visits them in lexical order
+	var paths []string
+	err := filepath.WalkDir(vault.Path, func(path string, d os.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
@@ -61,16 +170,72 @@ func (vault *Vault) Load() error {
 		if d.IsDir() || !strings.HasSuffix(path, ".md") {
 			return nil
 		}
+		paths = append(paths, path)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
 
-		// Load the page
-		page, err := loadPage(path, vault.Path)
-		if err != nil {
-			return err
+	// Each worker parses the files it takes from indexes into its slot of results, so they keep the order of paths
+	type result struct {
+		page *Page
+		err  error
+	}
+	results := make([]result, len(paths))
+	indexes := make(chan int, len(paths))
+	for i := range paths {
+		indexes <- i
+	}
+	close(indexes)
+
+	errs := make(chan error, 1)
+	var wg sync.WaitGroup
+	for range max(1, min(workers, len(paths))) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if err := ctx.Err(); err != nil {
+					select {
+					case errs <- err:
+					default:
+					}
+					return
+				}
+				page, err := loadPage(paths[i], vault.Path)
+				results[i] = result{page: page, err: err}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	if err := <-errs; err != nil {
+		return err
+	}
+
+	for i, result := range results {
+		if result.err != nil {
+			if err := invalid(&PageError{FilePath: paths[i], Err: result.err}); err != nil {
+				return err
+			}
+			continue
 		}
+		vault.Add(result.page)
+	}
 
-		vault.Pages = append(vault.Pages, page)
-		return nil
-	})
+	duplicates := vault.FindDuplicates()
+	for _, url := range slices.Sorted(maps.Keys(duplicates)) {
+		var files []string
+		for _, page := range duplicates[url] {
+			files = append(files, filepath.ToSlash(filepath.Join(page.Folder, page.Title+".md")))
+		}
+		log.Warn().
+			Str("url", url).
+			Strs("pages", files).
+			Msg("Several pages link to the same FetLife profile")
+	}
+	return nil
 }
 
 // LoadPage loads a single page from a markdown file (exported for use in other packages)
@@ -86,65 +251,102 @@ func loadPage(filePath string, vaultPath string) (*Page, error) {
 		return nil, err
 	}
 
+	return ParsePage(content, filePath, vaultPath)
+}
+
+// ParsePage parses markdown content as if it had been loaded from filePath, without touching the disk
+func ParsePage(content []byte, filePath string, vaultPath string) (*Page, error) {
 	// Parse frontmatter
 	page := &Page{FilePath: filePath}
 	contentStr := string(content)
 
-	// Check if file has frontmatter (starts with ---)
-	if strings.HasPrefix(contentStr, "---\n") {
-		// Find the end of frontmatter
-		endIdx := strings.Index(contentStr[4:], "---\n")
-		if endIdx != -1 {
-			frontmatter := contentStr[4 : endIdx+4]
-			// Store the markdown content (everything after the closing ---)
-			page.Content = contentStr[endIdx+8:]
-
-			// Parse YAML frontmatter
-			var metadata map[string]interface{}
-			if err := yaml.Unmarshal([]byte(frontmatter), &metadata); err != nil {
+	// Store the markdown content (everything after the closing ---), or the entire content without frontmatter
+	frontmatter, _, body, ok := splitFrontmatter(contentStr)
+	page.Content = body
+	page.savedContent = body
+	if ok {
+		// Parse YAML frontmatter, keeping its nodes for the custom fields
+		var document yaml.Node
+		if err := yaml.Unmarshal([]byte(frontmatter), &document); err != nil {
+			return nil, err
+		}
+		var metadata map[string]interface{}
+		if len(document.Content) > 0 {
+			if err := document.Content[0].Decode(&metadata); err != nil {
 				return nil, err
 			}
+			page.customNodes = customNodes(document.Content[0])
+		}
 
-			// Extract metadata fields
-			if tags, ok := metadata["tags"].([]interface{}); ok {
-				for _, tag := range tags {
-					if tagStr, ok := tag.(string); ok {
-						page.Tags = append(page.Tags, tagStr)
-					}
+		// Extract metadata fields
+		if tags, ok := metadata["tags"].([]interface{}); ok {
+			for _, tag := range tags {
+				if tagStr, ok := tag.(string); ok {
+					page.Tags = append(page.Tags, tagStr)
 				}
 			}
+		}
 
-			if aliases, ok := metadata["aliases"].([]interface{}); ok {
-				for _, alias := range aliases {
-					if aliasStr, ok := alias.(string); ok {
-						page.Aliases = append(page.Aliases, aliasStr)
-					}
+		if aliases, ok := metadata["aliases"].([]interface{}); ok {
+			for _, alias := range aliases {
+				if aliasStr, ok := alias.(string); ok {
+					page.Aliases = append(page.Aliases, aliasStr)
 				}
 			}
+		}
 
-			if url, ok := metadata["url"].(string); ok {
-				page.Url = url
-			}
+		if url, ok := metadata["url"].(string); ok {
+			page.Url = url
+		}
 
-			if urlAliases, ok := metadata["url-aliases"].([]interface{}); ok {
-				for _, urlAlias := range urlAliases {
-					if urlAliasStr, ok := urlAlias.(string); ok {
-						page.UrlAliases = append(page.UrlAliases, urlAliasStr)
-					}
+		if urlAliases, ok := metadata["url-aliases"].([]interface{}); ok {
+			for _, urlAlias := range urlAliases {
+				if urlAliasStr, ok := urlAlias.(string); ok {
+					page.UrlAliases = append(page.UrlAliases, urlAliasStr)
 				}
 			}
+		}
 
-			if webBadgeColor, ok := metadata["web-badge-color"].(string); ok {
-				page.WebBadgeColor = Color(webBadgeColor)
-			}
+		if webBadgeColor, ok := metadata["web-badge-color"].(string); ok {
+			page.WebBadgeColor = Color(webBadgeColor)
+		}
 
-			if webMessage, ok := metadata["web-message"].(string); ok {
-				page.WebMessage = webMessage
+		if webMessage, ok := metadata["web-message"].(string); ok {
+			page.WebMessage = webMessage
+		}
+
+		if blockedDate, ok := metadata["blocked-date"].(string); ok {
+			page.BlockedDate = blockedDate
+		}
+
+		if blockedAt, ok := metadata["blocked-at"].(string); ok {
+			page.BlockedAt = blockedAt
+		}
+
+		if friendDate, ok := metadata["friend-date"].(string); ok {
+			page.FriendDate = friendDate
+		}
+
+		if noteCreated, ok := metadata["note-created"].(string); ok {
+			page.NoteCreated = noteCreated
+		}
+
+		if noteUpdated, ok := metadata["note-updated"].(string); ok {
+			page.NoteUpdated = noteUpdated
+		}
+
+		page.CreatedAt = timestamp(metadata["created-at"])
+		page.SyncedAt = timestamp(metadata["synced-at"])
+
+		for key, value := range metadata {
+			if slices.Contains(knownFields, key) {
+				continue
+			}
+			if page.CustomFields == nil {
+				page.CustomFields = make(map[string]interface{})
 			}
+			page.CustomFields[key] = value
 		}
-	} else {
-		// No frontmatter, store entire content
-		page.Content = contentStr
 	}
 
 	// Extract title from filename (without .md extension)
@@ -161,86 +363,917 @@ func loadPage(filePath string, vaultPath string) (*Page, error) {
 	return page, nil
 }
 
-// Save writes the page back to disk with updated metadata
+// splitFrontmatter splits file content into its YAML frontmatter, the closing --- line and the body after it.  The
+// frontmatter starts with a --- line and ends at the next line that is only ---, which can be the last line without a
+// newline.  ok is false when the content doesn't start with frontmatter, and body is then the entire content.
+func splitFrontmatter(content string) (frontmatter, closing, body string, ok bool) {
+	if !strings.HasPrefix(content, "---\n") {
+		return "", "", content, false
+	}
+	rest := content[4:]
+	for offset := 0; offset < len(rest); {
+		line, _, found := strings.Cut(rest[offset:], "\n")
+		if line == "---" {
+			closing = line
+			if found {
+				closing += "\n"
+			}
+			return rest[:offset], closing, rest[offset+len(closing):], true
+		}
+		if !found {
+			break
+		}
+		offset += len(line) + 1
+	}
+	return "", "", content, false
+}
+
+// timestamp returns a metadata value written as an RFC 3339 timestamp, which YAML parses as a time when it isn't quoted
+func timestamp(value interface{}) string {
+	switch value := value.(type) {
+	case string:
+		return value
+	case time.Time:
+		return value.Format(time.RFC3339)
+	}
+	return ""
+}
+
+// customNodes returns the custom fields of a frontmatter mapping with the known field each one follows.  Fields with
+// aliases are left out, since the anchors they refer to may not be written back.
+func customNodes(mapping *yaml.Node) map[string]customNode {
+	if mapping.Kind != yaml.MappingNode {
+		return nil
+	}
+	nodes := make(map[string]customNode)
+	after := ""
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		key, value := mapping.Content[i], mapping.Content[i+1]
+		if slices.Contains(knownFields, key.Value) {
+			after = key.Value
+			continue
+		}
+		if !hasAlias(value) {
+			nodes[key.Value] = customNode{key: key, value: value, after: after, index: i}
+		}
+	}
+	return nodes
+}
+
+// hasAlias tells whether a YAML node or any node in it is an alias
+func hasAlias(node *yaml.Node) bool {
+	return node.Kind == yaml.AliasNode || slices.ContainsFunc(node.Content, hasAlias)
+}
+
+// knownFields are the metadata keys with a field of their own in Page
+var knownFields = []string{
+	"tags", "aliases", "url", "url-aliases", "web-badge-color", "web-message", "blocked-date", "blocked-at",
+	"friend-date", "note-created", "note-updated", "created-at", "synced-at",
+}
+
+// Save writes the page back to disk with updated metadata.  A file that already has the rendered content isn't
+// written, so its modification time stays the same.  The file is replaced atomically, so a sync that is killed while
+// saving never leaves a half written page.
 func (page *Page) Save() error {
-	// Build metadata map
-	metadata := make(map[string]interface{})
+	fileContent, err := page.Render()
+	if err != nil {
+		return err
+	}
+	if current, err := os.ReadFile(page.FilePath); err == nil && bytes.Equal(current, fileContent) {
+		page.savedContent = page.Content
+		return nil
+	}
+
+	if err := writeFileAtomic(page.FilePath, func(file io.Writer) error {
+		_, err := file.Write(fileContent)
+		return err
+	}); err != nil {
+		return err
+	}
+	page.savedContent = page.Content
+	return nil
+}
+
+// SaveFrontmatterOnly writes the page's metadata into its file and keeps every byte after the closing --- as it is on
+// disk, so the body is never reformatted.  Changes to Content aren't saved; a page whose file doesn't exist yet is
+// saved in full.
+func (page *Page) SaveFrontmatterOnly() error {
+	current, err := os.ReadFile(page.FilePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return page.Save()
+	}
+	if err != nil {
+		return err
+	}
+	fileContent, err := page.SpliceFrontmatter(current)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(current, fileContent) {
+		return nil
+	}
+
+	return writeFileAtomic(page.FilePath, func(file io.Writer) error {
+		_, err := file.Write(fileContent)
+		return err
+	})
+}
+
+// SpliceFrontmatter returns file content with its frontmatter replaced by the page's metadata, keeping the closing ---
+// line and everything after it byte for byte.  Content without frontmatter gets the page's metadata in front of it.
+func (page *Page) SpliceFrontmatter(content []byte) ([]byte, error) {
+	frontmatter, err := page.renderFrontmatter()
+	if err != nil {
+		return nil, err
+	}
+	_, closing, body, ok := splitFrontmatter(string(content))
+	if ok && frontmatter != "" {
+		return []byte(strings.TrimSuffix(frontmatter, "---\n") + closing + body), nil
+	}
+	return []byte(frontmatter + body), nil
+}
+
+// ContentChanged reports whether Content was changed since the page was loaded or last saved
+func (page *Page) ContentChanged() bool {
+	return page.Content != page.savedContent
+}
+
+// writeFileAtomic writes a file with write into a temporary file in the same directory and renames it over path, so
+// path has either its old or its new content, never part of it, even after a crash.  An existing file keeps its
+// permissions, a new one gets 0644.  When path is a symlink the file it points to is written and the link is kept.
+func writeFileAtomic(path string, write func(io.Writer) error) error {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tempPath := temp.Name()
+	if err := write(temp); err != nil {
+		temp.Close()
+		os.Remove(tempPath)
+		return err
+	}
+	// The content is on disk before the rename makes it the file's
+	if err := temp.Sync(); err != nil {
+		temp.Close()
+		os.Remove(tempPath)
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	if err := os.Chmod(tempPath, mode); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// WriteFile writes data to path atomically like Page.Save does, for files of the vault that aren't saved through a
+// loaded page.  An existing file keeps its permissions.
+func WriteFile(path string, data []byte) error {
+	return writeFileAtomic(path, func(file io.Writer) error {
+		_, err := file.Write(data)
+		return err
+	})
+}
+
+// syncDir flushes a directory to disk, so a file renamed into it stays renamed after a crash.  Windows can't sync
+// directories, and doesn't need to.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	file, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
 
-	// Add fields to metadata if they have values
-	if len(page.Tags) > 0 {
-		metadata["tags"] = page.Tags
+// IsDirty reports whether saving the page would change its file, because the page was changed since it was loaded or
+// the file doesn't exist.  A page that can't be rendered or read is dirty too, so Save reports the error.
+func (page *Page) IsDirty() bool {
+	fileContent, err := page.Render()
+	if err != nil {
+		return true
 	}
+	current, err := os.ReadFile(page.FilePath)
+	return err != nil || !bytes.Equal(current, fileContent)
+}
 
-	if len(page.Aliases) > 0 {
-		metadata["aliases"] = page.Aliases
+// Render returns the markdown file content for the page, frontmatter followed by the page content
+func (page *Page) Render() ([]byte, error) {
+	frontmatter, err := page.renderFrontmatter()
+	if err != nil {
+		return nil, err
 	}
 
-	if page.Url != "" {
-		metadata["url"] = page.Url
+	// The content should start with a newline when there's frontmatter
+	return []byte(frontmatter + page.Content), nil
+}
+
+// renderFrontmatter returns the page's metadata as a YAML frontmatter block between --- lines, or an empty string when
+// the page has no metadata
+func (page *Page) renderFrontmatter() (string, error) {
+	frontmatter, err := page.frontmatterNode()
+	if err != nil {
+		return "", err
+	}
+	if len(frontmatter.Content) == 0 {
+		return "", nil
 	}
 
-	if len(page.UrlAliases) > 0 {
-		metadata["url-aliases"] = page.UrlAliases
+	var yamlData strings.Builder
+	encoder := yaml.NewEncoder(&yamlData)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(frontmatter); err != nil {
+		return "", err
+	}
+	if err := encoder.Close(); err != nil {
+		return "", err
 	}
+	return "---\n" + yamlData.String() + "---\n", nil
+}
+
+// Clone returns a copy of the page that shares no slices or maps with the original, only the values of its custom
+// fields
+func (page *Page) Clone() *Page {
+	clone := *page
+	clone.Tags = slices.Clone(page.Tags)
+	clone.Aliases = slices.Clone(page.Aliases)
+	clone.UrlAliases = slices.Clone(page.UrlAliases)
+	clone.CustomFields = maps.Clone(page.CustomFields)
+	clone.customNodes = maps.Clone(page.customNodes)
+	return &clone
+}
+
+// frontmatterNode builds the page's metadata as a YAML mapping.  Known keys are always written in the same order so
+// that saving a page doesn't reshuffle its frontmatter, and custom keys stay after the known key they followed.
+func (page *Page) frontmatterNode() (*yaml.Node, error) {
+	mapping := &yaml.Node{Kind: yaml.MappingNode}
 
-	if page.WebBadgeColor != "" {
-		metadata["web-badge-color"] = string(page.WebBadgeColor)
+	// The custom fields loaded with the page, by the known field they follow, and the new ones
+	following := make(map[string][]string)
+	var added []string
+	for key := range page.CustomFields {
+		if node, ok := page.customNodes[key]; ok {
+			following[node.after] = append(following[node.after], key)
+		} else {
+			added = append(added, key)
+		}
+	}
+	var err error
+	addCustom := func(keys []string) {
+		slices.SortFunc(keys, func(a, b string) int { return page.customNodes[a].index - page.customNodes[b].index })
+		for _, key := range keys {
+			if err != nil {
+				return
+			}
+			var keyYAML, value *yaml.Node
+			keyYAML, value, err = page.customFieldNodes(key)
+			if err != nil {
+				err = fmt.Errorf("metadata %q: %w", key, err)
+				return
+			}
+			mapping.Content = append(mapping.Content, keyYAML, value)
+		}
 	}
 
-	if page.WebMessage != "" {
-		metadata["web-message"] = page.WebMessage
+	addScalar := func(key, value string) {
+		if value != "" {
+			mapping.Content = append(mapping.Content, keyNode(key), &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value})
+		}
+		addCustom(following[key])
+	}
+	addSequence := func(key string, values []string) {
+		if len(values) > 0 {
+			sequence := &yaml.Node{Kind: yaml.SequenceNode}
+			for _, value := range values {
+				sequence.Content = append(sequence.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value})
+			}
+			mapping.Content = append(mapping.Content, keyNode(key), sequence)
+		}
+		addCustom(following[key])
+	}
+
+	addCustom(following[""])
+
+	addSequence("tags", page.Tags)
+	addSequence("aliases", page.Aliases)
+	addScalar("url", page.Url)
+	addSequence("url-aliases", page.UrlAliases)
+	addScalar("web-badge-color", string(page.WebBadgeColor))
+	addScalar("web-message", page.WebMessage)
+	addScalar("blocked-date", page.BlockedDate)
+	addScalar("blocked-at", page.BlockedAt)
+	addScalar("friend-date", page.FriendDate)
+	addScalar("note-created", page.NoteCreated)
+	addScalar("note-updated", page.NoteUpdated)
+	addScalar("created-at", page.CreatedAt)
+	addScalar("synced-at", page.SyncedAt)
+
+	slices.Sort(added)
+	addCustom(added)
+	if err != nil {
+		return nil, err
+	}
+	return mapping, nil
+}
+
+// customFieldNodes returns the YAML key and value of a custom field, the nodes it was loaded from while its value is
+// unchanged so its style, like an unquoted `flag: yes`, is kept
+func (page *Page) customFieldNodes(key string) (*yaml.Node, *yaml.Node, error) {
+	value := page.CustomFields[key]
+	if node, ok := page.customNodes[key]; ok {
+		var original interface{}
+		if err := node.value.Decode(&original); err == nil && reflect.DeepEqual(original, value) {
+			return node.key, node.value, nil
+		}
 	}
+	node, err := customFieldNode(value)
+	if err != nil {
+		return nil, nil, err
+	}
+	return keyNode(key), node, nil
+}
 
-	// Serialize metadata to YAML
-	var fileContent strings.Builder
+// customFieldNode encodes the value of a custom field.  Dates and times, which YAML decodes into time.Time, are
+// written back as plain timestamps so "met-on: 2024-01-01" stays the same.
+func customFieldNode(value interface{}) (*yaml.Node, error) {
+	if t, ok := value.(time.Time); ok {
+		text := t.Format(time.RFC3339Nano)
+		if t.Equal(t.Truncate(24*time.Hour)) && t.Location() == time.UTC {
+			text = t.Format("2006-01-02")
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!timestamp", Value: text}, nil
+	}
+	node := &yaml.Node{}
+	if err := node.Encode(value); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
 
-	if len(metadata) > 0 {
-		yamlData, err := yaml.Marshal(metadata)
+// keyNode returns a YAML scalar node for a mapping key
+func keyNode(key string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Value: key}
+}
+
+// Add adds a page to the vault
+func (vault *Vault) Add(page *Page) {
+	vault.mu.Lock()
+	defer vault.mu.Unlock()
+	vault.Pages = append(vault.Pages, page)
+	vault.index(page)
+}
+
+// Rename renames a page of the vault like Page.Rename and updates the title index
+func (vault *Vault) Rename(page *Page, newTitle string) error {
+	vault.mu.Lock()
+	defer vault.mu.Unlock()
+	vault.unindex(page)
+	defer vault.index(page)
+	return page.Rename(newTitle)
+}
+
+// Reindex rebuilds the title index from Pages
+func (vault *Vault) Reindex() {
+	vault.mu.Lock()
+	defer vault.mu.Unlock()
+	vault.titles = nil
+	vault.titlesCI = nil
+	for _, page := range vault.Pages {
+		vault.index(page)
+	}
+}
+
+func (vault *Vault) index(page *Page) {
+	if vault.titles == nil {
+		vault.titles = make(map[string][]*Page)
+		vault.titlesCI = make(map[string][]*Page)
+	}
+	vault.titles[page.Title] = append(vault.titles[page.Title], page)
+	lower := strings.ToLower(page.Title)
+	vault.titlesCI[lower] = append(vault.titlesCI[lower], page)
+}
+
+func (vault *Vault) unindex(page *Page) {
+	remove := func(index map[string][]*Page, key string) {
+		index[key] = slices.DeleteFunc(index[key], func(p *Page) bool {
+			return p == page
+		})
+		if len(index[key]) == 0 {
+			delete(index, key)
+		}
+	}
+	if vault.titles != nil {
+		remove(vault.titles, page.Title)
+		remove(vault.titlesCI, strings.ToLower(page.Title))
+	}
+}
+
+// FindByTitle returns the page with exactly the given title, or nil if there is none.  If pages in several folders
+// have the title, the first one loaded is returned.
+func (vault *Vault) FindByTitle(title string) *Page {
+	vault.mu.RLock()
+	defer vault.mu.RUnlock()
+	if pages := vault.titles[title]; len(pages) > 0 {
+		return pages[0]
+	}
+	return nil
+}
+
+// FindByTitleCI returns the page with the given title ignoring case, or nil if there is none
+func (vault *Vault) FindByTitleCI(title string) *Page {
+	vault.mu.RLock()
+	defer vault.mu.RUnlock()
+	if pages := vault.titlesCI[strings.ToLower(title)]; len(pages) > 0 {
+		return pages[0]
+	}
+	return nil
+}
+
+// FindByTitleInFolder returns the page with exactly the given title in a folder relative to the vault, or nil if
+// there is none
+func (vault *Vault) FindByTitleInFolder(title, folder string) *Page {
+	vault.mu.RLock()
+	defer vault.mu.RUnlock()
+	folder = filepath.Clean(folder)
+	for _, page := range vault.titles[title] {
+		if page.Folder == folder {
+			return page
+		}
+	}
+	return nil
+}
+
+// Rename renames the page's markdown file within its folder and updates Title and FilePath to match.  An error
+// wrapping os.ErrExist is returned if another file already has the new name.
+func (page *Page) Rename(newTitle string) error {
+	if newTitle == "" || strings.ContainsAny(newTitle, `/\`) {
+		return fmt.Errorf("invalid page title %q", newTitle)
+	}
+
+	newPath := filepath.Join(filepath.Dir(page.FilePath), newTitle+".md")
+	if newPath == page.FilePath {
+		return nil
+	}
+
+	// A case-only rename finds the page's own file on case-insensitive filesystems
+	if !strings.EqualFold(newPath, page.FilePath) {
+		if _, err := os.Stat(newPath); err == nil {
+			return fmt.Errorf("cannot rename %s: %w", page.FilePath, &os.PathError{Op: "rename", Path: newPath, Err: os.ErrExist})
+		}
+	}
+
+	if err := os.Rename(page.FilePath, newPath); err != nil {
+		return err
+	}
+
+	page.Title = newTitle
+	page.FilePath = newPath
+	return nil
+}
+
+// Move moves a page's markdown file into another folder of the vault, creating the folder if needed, and updates
+// Folder and FilePath to match.  An error wrapping os.ErrExist is returned if the destination file already exists.
+func (vault *Vault) Move(page *Page, newFolder string) error {
+	vault.mu.Lock()
+	defer vault.mu.Unlock()
+	if !vault.contains(page) {
+		return fmt.Errorf("page %s is not part of the vault", page.FilePath)
+	}
+
+	folder := filepath.Clean(newFolder)
+	if filepath.IsAbs(folder) || folder == ".." || strings.HasPrefix(folder, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("folder %q is outside of the vault", newFolder)
+	}
+
+	newPath := filepath.Join(vault.Path, folder, page.Title+".md")
+	if newPath == page.FilePath {
+		return nil
+	}
+
+	if _, err := os.Stat(newPath); err == nil {
+		return fmt.Errorf("cannot move %s to %s: %w", page.FilePath, folder, &os.PathError{Op: "move", Path: newPath, Err: os.ErrExist})
+	}
+
+	if err := os.MkdirAll(filepath.Dir(newPath), 0755); err != nil {
+		return err
+	}
+
+	if err := os.Rename(page.FilePath, newPath); err != nil {
+		return err
+	}
+
+	page.Folder = folder
+	page.FilePath = newPath
+	return nil
+}
+
+// Delete removes a page's markdown file from disk and the page from the vault
+func (vault *Vault) Delete(page *Page) error {
+	vault.mu.Lock()
+	defer vault.mu.Unlock()
+	if !vault.contains(page) {
+		return fmt.Errorf("page %s is not part of the vault", page.FilePath)
+	}
+
+	if err := os.Remove(page.FilePath); err != nil {
+		return err
+	}
+
+	vault.Pages = slices.DeleteFunc(vault.Pages, func(p *Page) bool {
+		return p == page
+	})
+	vault.unindex(page)
+	return nil
+}
+
+// PruneFolder removes a folder of the vault if it is empty, and then each parent folder that becomes empty.  The
+// vault's own directory is never removed, and a folder that doesn't exist is left alone.
+func (vault *Vault) PruneFolder(folder string) error {
+	root := filepath.Clean(vault.Path)
+	dir := filepath.Join(root, folder)
+	for dir != root && strings.HasPrefix(dir, root+string(filepath.Separator)) {
+		entries, err := os.ReadDir(dir)
 		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if len(entries) > 0 {
+			return nil
+		}
+		if err := os.Remove(dir); err != nil {
 			return err
 		}
+		dir = filepath.Dir(dir)
+	}
+	return nil
+}
+
+// contains reports whether the page is one of the vault's pages
+func (vault *Vault) contains(page *Page) bool {
+	for _, p := range vault.Pages {
+		if p == page {
+			return true
+		}
+	}
+	return false
+}
+
+// AddTag adds a tag unless the page already has it, ignoring case.  Returns true if the tag was added.
+func (page *Page) AddTag(tag string) bool {
+	if page.HasTag(tag) {
+		return false
+	}
+	page.Tags = append(page.Tags, tag)
+	return true
+}
+
+// RemoveTag removes every occurrence of a tag, ignoring case.  Returns true if the tag was found.
+func (page *Page) RemoveTag(tag string) bool {
+	var tags []string
+	for _, t := range page.Tags {
+		if !strings.EqualFold(t, tag) {
+			tags = append(tags, t)
+		}
+	}
+	removed := len(tags) != len(page.Tags)
+	page.Tags = tags
+	return removed
+}
+
+// HasTag reports whether the page has a tag, ignoring case
+func (page *Page) HasTag(tag string) bool {
+	for _, t := range page.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetSection returns the text under the level 2 heading "## heading", up to the next level 1 or 2 heading, without
+// the blank lines around it.  It returns an empty string when the page doesn't have the heading.
+func (page *Page) GetSection(heading string) string {
+	lines := strings.SplitAfter(page.Content, "\n")
+	start, end := sectionBounds(lines, heading)
+	if start < 0 {
+		return ""
+	}
+	return strings.Trim(strings.Join(lines[start+1:end], ""), "\n")
+}
+
+// SetSection replaces the text under the level 2 heading "## heading" with content, up to the next level 1 or 2
+// heading.  A page without the heading gets the section added at the end.
+func (page *Page) SetSection(heading string, content string) {
+	section := "## " + heading + "\n\n" + strings.TrimRight(content, "\n") + "\n"
+	lines := strings.SplitAfter(page.Content, "\n")
+
+	start, end := sectionBounds(lines, heading)
+	if start < 0 {
+		body := strings.TrimRight(page.Content, "\n")
+		if body != "" {
+			body += "\n\n"
+		}
+		page.Content = body + section
+		return
+	}
 
-		// Write frontmatter
-		fileContent.WriteString("---\n")
-		fileContent.Write(yamlData)
-		fileContent.WriteString("---\n")
+	if end < len(lines) {
+		// Keep a blank line before the next heading
+		section += "\n"
 	}
+	page.Content = strings.Join(lines[:start], "") + section + strings.Join(lines[end:], "")
+}
 
-	// Write content (should start with newline if there's frontmatter)
-	fileContent.WriteString(page.Content)
+// sectionBounds returns the index of the "## heading" line and of the line that ends its section, or -1 for start
+// when the heading isn't found
+func sectionBounds(lines []string, heading string) (start, end int) {
+	start = -1
+	for i, line := range lines {
+		line = strings.TrimRight(line, " \t\r\n")
+		if start < 0 {
+			if line == "## "+heading {
+				start = i
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "# ") || strings.HasPrefix(line, "## ") {
+			return start, i
+		}
+	}
+	return start, len(lines)
+}
 
-	// Write to file
-	return os.WriteFile(page.FilePath, []byte(fileContent.String()), 0644)
+// Summary returns the page's metadata as a PageSummary
+func (page *Page) Summary() PageSummary {
+	return PageSummary{
+		Title:         page.Title,
+		Folder:        page.Folder,
+		URL:           page.Url,
+		Tags:          page.Tags,
+		Aliases:       page.Aliases,
+		WebBadgeColor: page.WebBadgeColor,
+		WebMessage:    page.WebMessage,
+	}
 }
 
+// FilterPages returns the pages for which pred returns true, in vault order.  pred is called without holding the
+// vault's lock, so it may use the vault's other methods.
+func (vault *Vault) FilterPages(pred func(*Page) bool) []*Page {
+	vault.mu.RLock()
+	all := slices.Clone(vault.Pages)
+	vault.mu.RUnlock()
+
+	var pages []*Page
+	for _, page := range all {
+		if pred(page) {
+			pages = append(pages, page)
+		}
+	}
+	return pages
+}
+
+// InFolder returns the pages directly in the folder, with "" or "." for the vault root
 func (vault *Vault) InFolder(folder string) []*Page {
 	if folder == "" {
 		folder = "."
 	}
+	return vault.FilterPages(func(page *Page) bool { return page.Folder == folder })
+}
 
-	var pages []*Page
+// WithTag returns the pages that have the tag, matching case
+func (vault *Vault) WithTag(tag string) []*Page {
+	return vault.FilterPages(func(page *Page) bool { return slices.Contains(page.Tags, tag) })
+}
+
+// WithAnyTag returns the pages that have at least one of the tags, ignoring case
+func (vault *Vault) WithAnyTag(tags ...string) []*Page {
+	return vault.FilterPages(func(page *Page) bool { return slices.ContainsFunc(tags, page.HasTag) })
+}
+
+// WithAllTags returns the pages that have every one of the tags, ignoring case
+func (vault *Vault) WithAllTags(tags ...string) []*Page {
+	return vault.FilterPages(func(page *Page) bool {
+		for _, tag := range tags {
+			if !page.HasTag(tag) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// Folders returns the folders that have pages, sorted, with "." for the vault root
+func (vault *Vault) Folders() []string {
+	vault.mu.RLock()
+	defer vault.mu.RUnlock()
+	var folders []string
 	for _, page := range vault.Pages {
-		if page.Folder == folder {
-			pages = append(pages, page)
+		if !slices.Contains(folders, page.Folder) {
+			folders = append(folders, page.Folder)
 		}
 	}
+	slices.Sort(folders)
+	return folders
+}
 
-	return pages
+// Tags returns the tags of the vault's pages, sorted and each once.  Tags that differ in case are listed separately,
+// like Stats counts them.
+func (vault *Vault) Tags() []string {
+	vault.mu.RLock()
+	defer vault.mu.RUnlock()
+	var tags []string
+	for _, page := range vault.Pages {
+		for _, tag := range page.Tags {
+			if !slices.Contains(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	slices.Sort(tags)
+	return tags
 }
 
-func (vault *Vault) WithTag(tag string) []*Page {
+// VaultStats counts the pages of a vault
+type VaultStats struct {
+	TotalPages int
+	// PagesByFolder counts the pages directly in each folder, with "." for the vault root
+	PagesByFolder map[string]int
+	// PagesByTag counts the pages with each tag.  A page with the same tag twice is counted once.
+	PagesByTag          map[string]int
+	PagesWithURL        int
+	PagesWithWebMessage int
+}
+
+// Stats counts the pages by folder and tag in a single pass over the pages
+func (vault *Vault) Stats() VaultStats {
+	stats := VaultStats{
+		TotalPages:    len(vault.Pages),
+		PagesByFolder: make(map[string]int),
+		PagesByTag:    make(map[string]int),
+	}
+	for _, page := range vault.Pages {
+		stats.PagesByFolder[page.Folder]++
+		for i, tag := range page.Tags {
+			if !slices.Contains(page.Tags[:i], tag) {
+				stats.PagesByTag[tag]++
+			}
+		}
+		if page.Url != "" {
+			stats.PagesWithURL++
+		}
+		if page.WebMessage != "" {
+			stats.PagesWithWebMessage++
+		}
+	}
+	return stats
+}
+
+// Search returns the pages whose body, title, web-message or tags contain the query, ignoring case
+func (vault *Vault) Search(query string) []*Page {
+	query = strings.ToLower(query)
+	return vault.search(func(text string) bool {
+		return strings.Contains(strings.ToLower(text), query)
+	})
+}
+
+// SearchRegex returns the pages whose body, title, web-message or tags match the regular expression
+func (vault *Vault) SearchRegex(pattern *regexp.Regexp) []*Page {
+	return vault.search(pattern.MatchString)
+}
+
+func (vault *Vault) search(matches func(text string) bool) []*Page {
+	return vault.FilterPages(func(page *Page) bool {
+		return matches(page.Content) || matches(page.Title) || matches(page.WebMessage) ||
+			matches(strings.Join(page.Tags, " "))
+	})
+}
+
+// FindByURL returns every page whose `url` or one of its `url-aliases` is exactly the given URL.  More than one match
+// means the vault has duplicate pages for the same person.
+func (vault *Vault) FindByURL(url string) ([]*Page, error) {
+	if url == "" {
+		return nil, errors.New("empty URL")
+	}
+
+	vault.mu.RLock()
+	defer vault.mu.RUnlock()
 	var pages []*Page
 	for _, page := range vault.Pages {
-		for _, t := range page.Tags {
-			if t == tag {
+		if page.Url == url {
+			pages = append(pages, page)
+			continue
+		}
+		for _, urlAlias := range page.UrlAliases {
+			if urlAlias == url {
 				pages = append(pages, page)
 				break
 			}
 		}
 	}
-	return pages
+	return pages, nil
 }
 
+// FindByUserID returns every page whose URL or URL aliases link to the FetLife profile of the user ID.  The user ID
+// is parsed out of the URLs with ParseUserURL and compared exactly, so user 123 never matches /users/12345.
+func (vault *Vault) FindByUserID(userID string) ([]*Page, error) {
+	if userID == "" {
+		return nil, errors.New("empty user ID")
+	}
+
+	links := func(url string) bool {
+		id, ok := ParseUserURL(url)
+		return ok && id == userID
+	}
+
+	vault.mu.RLock()
+	defer vault.mu.RUnlock()
+	var pages []*Page
+	for _, page := range vault.Pages {
+		if links(page.Url) || slices.ContainsFunc(page.UrlAliases, links) {
+			pages = append(pages, page)
+		}
+	}
+	return pages, nil
+}
+
+// FindDuplicates returns the pages that link to the same FetLife profile with their URL or URL aliases, keyed by the
+// canonical URL of the profile, for every profile with more than one page.  The user IDs are parsed out of the URLs
+// with ParseUserURL like FindByUserID does, so http://www.fetlife.com/users/123 and https://fetlife.com/users/123 are
+// the same profile.  The pages of a profile are in vault order.
+func (vault *Vault) FindDuplicates() map[string][]*Page {
+	vault.mu.RLock()
+	defer vault.mu.RUnlock()
+	byURL := make(map[string][]*Page)
+	for _, page := range vault.Pages {
+		for _, url := range append([]string{page.Url}, page.UrlAliases...) {
+			userID, ok := ParseUserURL(url)
+			if !ok {
+				continue
+			}
+			// A page linking to the profile several times is only listed once
+			key := UserURL(userID)
+			if pages := byURL[key]; len(pages) > 0 && pages[len(pages)-1] == page {
+				continue
+			}
+			byURL[key] = append(byURL[key], page)
+		}
+	}
+
+	maps.DeleteFunc(byURL, func(_ string, pages []*Page) bool { return len(pages) < 2 })
+	return byURL
+}
+
+// UserURL returns the canonical FetLife profile URL for a user ID
+func UserURL(userID string) string {
+	return "https://fetlife.com/users/" + userID
+}
+
+// ParseUserURL returns the user ID of a FetLife profile URL.  Besides the canonical https://fetlife.com/users/<id> it
+// accepts http:// and www. URLs, a trailing slash, a query string or fragment, and pages of the profile like
+// /users/<id>/about.
+func ParseUserURL(rawURL string) (string, bool) {
+	parsed, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") {
+		return "", false
+	}
+	host := strings.ToLower(parsed.Hostname())
+	if host != "fetlife.com" && host != "www.fetlife.com" {
+		return "", false
+	}
+
+	segments := strings.Split(strings.Trim(parsed.Path, "/"), "/")
+	if len(segments) < 2 || segments[0] != "users" || !userIDPattern.MatchString(segments[1]) {
+		return "", false
+	}
+	return segments[1], true
+}
+
+// userIDPattern matches a numeric FetLife user ID
+var userIDPattern = regexp.MustCompile(`^\d+$`)
+
 // IsVaultPath checks if the given path is a valid Obsidian vault by looking for the .obsidian directory
 func IsVaultPath(vault string) bool {
 	info, err := os.Stat(filepath.Join(vault, ".obsidian"))
@@ -1,9 +1,17 @@
 package obsidian
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 )
 
 func getExampleVaultPath(t *testing.T) string {
@@ -31,6 +39,112 @@ func TestVaultLoad(t *testing.T) {
 	}
 }
 
+func TestVaultLoadConcurrent(t *testing.T) {
+	sequential := NewVault(getExampleVaultPath(t))
+	if err := sequential.LoadConcurrent(context.Background(), 1); err != nil {
+		t.Fatalf("Failed to load vault: %v", err)
+	}
+
+	// Any number of workers loads the same pages in the same order
+	for _, workers := range []int{0, 4, 100} {
+		vault := NewVault(getExampleVaultPath(t))
+		if err := vault.LoadConcurrent(context.Background(), workers); err != nil {
+			t.Fatalf("Failed to load vault with %d workers: %v", workers, err)
+		}
+		if len(vault.Pages) != len(sequential.Pages) {
+			t.Fatalf("Expected %d pages with %d workers, got %d", len(sequential.Pages), workers, len(vault.Pages))
+		}
+		for i, page := range vault.Pages {
+			if page.FilePath != sequential.Pages[i].FilePath {
+				t.Errorf("Expected page %d to be %s with %d workers, got %s", i, sequential.Pages[i].FilePath, workers, page.FilePath)
+			}
+		}
+	}
+
+	// Errors are reported in the order of the paths
+	tempDir := t.TempDir()
+	for _, name := range []string{"A.md", "B.md", "C.md"} {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte("---\ntags: [\n---\n"), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	vault := NewVault(tempDir)
+	invalid, err := vault.LoadValid()
+	if err != nil {
+		t.Fatalf("LoadValid failed: %v", err)
+	}
+	if len(invalid) != 3 || filepath.Base(invalid[0].FilePath) != "A.md" || filepath.Base(invalid[2].FilePath) != "C.md" {
+		t.Errorf("Expected the errors of A.md, B.md and C.md in order, got %v", invalid)
+	}
+
+	// A cancelled load returns the context's error
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	vault = NewVault(getExampleVaultPath(t))
+	if err := vault.LoadConcurrent(ctx, 4); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if len(vault.Pages) != 0 {
+		t.Errorf("Expected no pages from a cancelled load, got %d", len(vault.Pages))
+	}
+}
+
+func BenchmarkVaultLoad(b *testing.B) {
+	vaultPath := b.TempDir()
+	for i := range 500 {
+		content := fmt.Sprintf("---\ntags:\n  - person\nurl: https://fetlife.com/users/%d\nweb-message: Note %d\n---\n\n# Person %d\n", i, i, i)
+		path := filepath.Join(vaultPath, fmt.Sprintf("Folder %d", i%10), fmt.Sprintf("Person %d.md", i))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			b.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	for _, workers := range []int{1, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for b.Loop() {
+				vault := NewVault(vaultPath)
+				if err := vault.LoadConcurrent(context.Background(), workers); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestVaultLoadValid(t *testing.T) {
+	tempDir := t.TempDir()
+	for name, content := range map[string]string{
+		"Good.md":   "---\ntags:\n  - person\n---\n",
+		"Broken.md": "---\ntags: [person\n---\n",
+	} {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write test file: %v", err)
+		}
+	}
+
+	if err := NewVault(tempDir).Load(); err == nil {
+		t.Error("Expected Load to fail on malformed frontmatter")
+	}
+
+	vault := NewVault(tempDir)
+	invalid, err := vault.LoadValid()
+	if err != nil {
+		t.Fatalf("Failed to load vault: %v", err)
+	}
+	if len(vault.Pages) != 1 || vault.Pages[0].Title != "Good" {
+		t.Errorf("Expected only the Good page to be loaded, got %d pages", len(vault.Pages))
+	}
+	if len(invalid) != 1 || filepath.Base(invalid[0].FilePath) != "Broken.md" {
+		t.Fatalf("Expected Broken.md to be invalid, got %v", invalid)
+	}
+	if invalid[0].Err == nil {
+		t.Error("Expected the invalid page to have an error")
+	}
+}
+
 func TestVaultLoadPageMetadata(t *testing.T) {
 	vault := NewVault(getExampleVaultPath(t))
 
@@ -227,6 +341,254 @@ func TestVaultWithTag(t *testing.T) {
 	}
 }
 
+func TestVaultStats(t *testing.T) {
+	vault := NewVault(getExampleVaultPath(t))
+
+	err := vault.Load()
+	if err != nil {
+		t.Fatalf("Failed to load vault: %v", err)
+	}
+
+	stats := vault.Stats()
+
+	if stats.TotalPages != 16 {
+		t.Errorf("Expected 16 pages, got %d", stats.TotalPages)
+	}
+	if stats.PagesWithURL != 13 {
+		t.Errorf("Expected 13 pages with a URL, got %d", stats.PagesWithURL)
+	}
+	if stats.PagesWithWebMessage != 10 {
+		t.Errorf("Expected 10 pages with a web-message, got %d", stats.PagesWithWebMessage)
+	}
+
+	folders := map[string]int{".": 5, "People": 5, "Bad People": 5, "Templates": 1}
+	if len(stats.PagesByFolder) != len(folders) {
+		t.Errorf("Expected %d folders, got %v", len(folders), stats.PagesByFolder)
+	}
+	for folder, count := range folders {
+		if stats.PagesByFolder[folder] != count {
+			t.Errorf("Expected %d pages in folder '%s', got %d", count, folder, stats.PagesByFolder[folder])
+		}
+	}
+
+	for tag, count := range map[string]int{"person": 10, "friend": 3, "blocked": 5, "meta": 2} {
+		if stats.PagesByTag[tag] != count {
+			t.Errorf("Expected %d pages with tag '%s', got %d", count, tag, stats.PagesByTag[tag])
+		}
+	}
+
+	// Counting doesn't change the vault
+	if len(vault.Pages) != 16 {
+		t.Errorf("Expected the vault to still have 16 pages, got %d", len(vault.Pages))
+	}
+}
+
+func TestVaultFolders(t *testing.T) {
+	vault := NewVault(getExampleVaultPath(t))
+
+	err := vault.Load()
+	if err != nil {
+		t.Fatalf("Failed to load vault: %v", err)
+	}
+
+	expected := []string{".", "Bad People", "People", "Templates"}
+	if folders := vault.Folders(); !slices.Equal(folders, expected) {
+		t.Errorf("Expected folders %v, got %v", expected, folders)
+	}
+
+	if folders := NewVault(t.TempDir()).Folders(); len(folders) != 0 {
+		t.Errorf("Expected no folders in an empty vault, got %v", folders)
+	}
+}
+
+func TestVaultTags(t *testing.T) {
+	vault := NewVault(getExampleVaultPath(t))
+
+	err := vault.Load()
+	if err != nil {
+		t.Fatalf("Failed to load vault: %v", err)
+	}
+
+	expected := []string{"about", "artist", "blocked", "catfish", "colleague", "creep", "drama", "friend",
+		"harassment", "index", "links", "meta", "misc", "musician", "notes", "person", "projects", "resources",
+		"todo", "warning", "writer"}
+	if tags := vault.Tags(); !slices.Equal(tags, expected) {
+		t.Errorf("Expected tags %v, got %v", expected, tags)
+	}
+
+	// Tags repeated on a page or across pages are listed once
+	vault = &Vault{Pages: []*Page{
+		{Title: "A", Folder: ".", Tags: []string{"person", "friend", "person"}},
+		{Title: "B", Folder: "People", Tags: []string{"Friend", "blocked"}},
+		{Title: "C", Folder: "."},
+	}}
+	expected = []string{"Friend", "blocked", "friend", "person"}
+	if tags := vault.Tags(); !slices.Equal(tags, expected) {
+		t.Errorf("Expected tags %v, got %v", expected, tags)
+	}
+	if folders := vault.Folders(); !slices.Equal(folders, []string{".", "People"}) {
+		t.Errorf("Expected folders [. People], got %v", folders)
+	}
+
+	if tags := NewVault(t.TempDir()).Tags(); len(tags) != 0 {
+		t.Errorf("Expected no tags in an empty vault, got %v", tags)
+	}
+}
+
+func TestVaultWithAnyTag(t *testing.T) {
+	vault := NewVault(getExampleVaultPath(t))
+
+	err := vault.Load()
+	if err != nil {
+		t.Fatalf("Failed to load vault: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		tags          []string
+		expectedCount int
+	}{
+		{name: "single tag", tags: []string{"friend"}, expectedCount: 3},
+		{name: "either tag", tags: []string{"friend", "blocked"}, expectedCount: 8},
+		{name: "overlapping tags", tags: []string{"person", "friend"}, expectedCount: 10},
+		{name: "ignores case", tags: []string{"BLOCKED"}, expectedCount: 5},
+		{name: "no tags", tags: nil, expectedCount: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pages := vault.WithAnyTag(tt.tags...)
+			if len(pages) != tt.expectedCount {
+				t.Errorf("Expected %d pages with any of %v, got %d", tt.expectedCount, tt.tags, len(pages))
+			}
+		})
+	}
+}
+
+func TestVaultFilterPages(t *testing.T) {
+	vault := NewVault(getExampleVaultPath(t))
+
+	err := vault.Load()
+	if err != nil {
+		t.Fatalf("Failed to load vault: %v", err)
+	}
+
+	friends := vault.FilterPages(func(page *Page) bool { return page.Folder == "People" && page.HasTag("friend") })
+	var expected []*Page
+	for _, page := range vault.Pages {
+		if page.Folder == "People" && page.HasTag("friend") {
+			expected = append(expected, page)
+		}
+	}
+	if len(expected) == 0 {
+		t.Fatal("Expected the example vault to have friends in People")
+	}
+	if !slices.Equal(friends, expected) {
+		t.Errorf("Expected %d friends in People in vault order, got %d", len(expected), len(friends))
+	}
+
+	if pages := vault.FilterPages(func(*Page) bool { return false }); len(pages) != 0 {
+		t.Errorf("Expected no pages, got %d", len(pages))
+	}
+	if pages := vault.FilterPages(func(*Page) bool { return true }); len(pages) != len(vault.Pages) {
+		t.Errorf("Expected all %d pages, got %d", len(vault.Pages), len(pages))
+	}
+
+	// The predicate may use the vault
+	folders := vault.FilterPages(func(page *Page) bool { return slices.Contains(vault.Folders(), page.Folder) })
+	if len(folders) != len(vault.Pages) {
+		t.Errorf("Expected a predicate using the vault to match all %d pages, got %d", len(vault.Pages), len(folders))
+	}
+
+	// The wrappers keep the vault order
+	if !slices.Equal(vault.InFolder("People"), vault.FilterPages(func(page *Page) bool { return page.Folder == "People" })) {
+		t.Error("Expected InFolder to return the same pages as FilterPages")
+	}
+	if !slices.Equal(vault.WithTag("blocked"), vault.FilterPages(func(page *Page) bool { return slices.Contains(page.Tags, "blocked") })) {
+		t.Error("Expected WithTag to return the same pages as FilterPages")
+	}
+}
+
+func TestVaultWithAllTags(t *testing.T) {
+	vault := NewVault(getExampleVaultPath(t))
+
+	err := vault.Load()
+	if err != nil {
+		t.Fatalf("Failed to load vault: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		tags          []string
+		expectedCount int
+	}{
+		{name: "single tag", tags: []string{"blocked"}, expectedCount: 5},
+		{name: "both tags", tags: []string{"person", "friend"}, expectedCount: 3},
+		{name: "ignores case", tags: []string{"Person", "BLOCKED"}, expectedCount: 5},
+		{name: "disjoint tags", tags: []string{"friend", "blocked"}, expectedCount: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pages := vault.WithAllTags(tt.tags...)
+			if len(pages) != tt.expectedCount {
+				t.Errorf("Expected %d pages with all of %v, got %d", tt.expectedCount, tt.tags, len(pages))
+			}
+		})
+	}
+}
+
+func TestVaultSearch(t *testing.T) {
+	vault := NewVault(getExampleVaultPath(t))
+
+	err := vault.Load()
+	if err != nil {
+		t.Fatalf("Failed to load vault: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		expected []string
+	}{
+		{name: "body", query: "PHOTO", expected: []string{"Alice", "Helen"}},
+		{name: "tags and web-message", query: "harass", expected: []string{"George"}},
+		{name: "title", query: "emma", expected: []string{"Emma"}},
+		{name: "no match", query: "nobody mentions this", expected: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var titles []string
+			for _, page := range vault.Search(tt.query) {
+				titles = append(titles, page.Title)
+			}
+			slices.Sort(titles)
+			if !slices.Equal(titles, tt.expected) {
+				t.Errorf("Search(%q) = %v, expected %v", tt.query, titles, tt.expected)
+			}
+		})
+	}
+}
+
+func TestVaultSearchRegex(t *testing.T) {
+	vault := NewVault(getExampleVaultPath(t))
+
+	err := vault.Load()
+	if err != nil {
+		t.Fatalf("Failed to load vault: %v", err)
+	}
+
+	var titles []string
+	for _, page := range vault.SearchRegex(regexp.MustCompile(`(?i)\b(climbing|hiking)\b`)) {
+		titles = append(titles, page.Title)
+	}
+	slices.Sort(titles)
+	if expected := []string{"Alice", "Bob"}; !slices.Equal(titles, expected) {
+		t.Errorf("SearchRegex() = %v, expected %v", titles, expected)
+	}
+}
+
 func TestVaultLoadEmptyMetadata(t *testing.T) {
 	vault := NewVault(getExampleVaultPath(t))
 
@@ -525,6 +887,124 @@ Some more content here.
 	}
 }
 
+// failingWriter writes up to limit bytes to w and then fails, like a process killed in the middle of a write
+type failingWriter struct {
+	w     io.Writer
+	limit int
+}
+
+func (writer *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > writer.limit {
+		n, _ := writer.w.Write(p[:writer.limit])
+		writer.limit -= n
+		return n, errors.New("write interrupted")
+	}
+	n, err := writer.w.Write(p)
+	writer.limit -= n
+	return n, err
+}
+
+func TestWriteFileAtomicInterrupted(t *testing.T) {
+	tempDir := t.TempDir()
+	testFile := filepath.Join(tempDir, "test-page.md")
+	original := "---\ntags:\n  - person\n---\n\n# Original\n"
+	if err := os.WriteFile(testFile, []byte(original), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	err := writeFileAtomic(testFile, func(file io.Writer) error {
+		_, err := (&failingWriter{w: file, limit: 10}).Write([]byte("---\ntags:\n  - blocked\n---\n\n# Changed\n"))
+		return err
+	})
+	if err == nil {
+		t.Fatal("Expected the interrupted write to fail")
+	}
+
+	content, err := os.ReadFile(testFile)
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+	if string(content) != original {
+		t.Errorf("Expected the original content to be untouched, got %q", content)
+	}
+	entries, err := os.ReadDir(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to read directory: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Expected the temporary file to be removed, found %d files", len(entries))
+	}
+}
+
+func TestWriteFileAtomicSymlink(t *testing.T) {
+	tempDir := t.TempDir()
+	target := filepath.Join(tempDir, "Notes", "alice.md")
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(target, []byte("# Old\n"), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	link := filepath.Join(tempDir, "Alice.md")
+	if err := os.Symlink(target, link); err != nil {
+		t.Skipf("Symlinks aren't supported: %v", err)
+	}
+
+	// The file the link points to is written and the link is kept
+	err := writeFileAtomic(link, func(file io.Writer) error {
+		_, err := file.Write([]byte("# New\n"))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Failed to write through the symlink: %v", err)
+	}
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("Expected %s to still be a symlink, got %v, %v", link, info, err)
+	}
+	content, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatalf("Failed to read target: %v", err)
+	}
+	if string(content) != "# New\n" {
+		t.Errorf("Expected the target to be written, got %q", content)
+	}
+}
+
+func TestPageSaveKeepsPermissions(t *testing.T) {
+	tempDir := t.TempDir()
+	testFile := filepath.Join(tempDir, "private.md")
+	if err := os.WriteFile(testFile, []byte("---\ntags:\n  - person\n---\n\n# Private\n"), 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	if err := os.Chmod(testFile, 0600); err != nil {
+		t.Fatalf("Failed to change permissions: %v", err)
+	}
+
+	page, err := loadPage(testFile, tempDir)
+	if err != nil {
+		t.Fatalf("Failed to load page: %v", err)
+	}
+	page.WebMessage = "Changed"
+	if err := page.Save(); err != nil {
+		t.Fatalf("Failed to save page: %v", err)
+	}
+
+	info, err := os.Stat(testFile)
+	if err != nil {
+		t.Fatalf("Failed to stat test file: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected permissions 0600, got %o", info.Mode().Perm())
+	}
+	content, err := os.ReadFile(testFile)
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+	if !strings.Contains(string(content), "web-message: Changed") {
+		t.Errorf("Expected the saved web-message, got %q", content)
+	}
+}
+
 func TestPageSaveUpdateBothTagsAndWebMessage(t *testing.T) {
 	// Create a temporary test file
 	tempDir := t.TempDir()
@@ -584,3 +1064,957 @@ Testing simultaneous updates.
 		t.Errorf("URL was not preserved, got: %s", reloadedPage.Url)
 	}
 }
+
+func TestVaultFindByURL(t *testing.T) {
+	vault := NewVault(getExampleVaultPath(t))
+
+	err := vault.Load()
+	if err != nil {
+		t.Fatalf("Failed to load vault: %v", err)
+	}
+
+	tests := []struct {
+		url           string
+		expectedTitle string
+	}{
+		{url: "https://fetlife.com/users/12345", expectedTitle: "Alice"},
+		{url: "https://fetlife.com/alice", expectedTitle: "Alice"},
+		{url: "https://fetlife.com/george-bad", expectedTitle: "George"},
+		{url: "https://fetlife.com/users/1234", expectedTitle: ""},
+		{url: "https://fetlife.com/users/123456", expectedTitle: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			pages, err := vault.FindByURL(tt.url)
+			if err != nil {
+				t.Fatalf("FindByURL failed: %v", err)
+			}
+
+			if tt.expectedTitle == "" {
+				if len(pages) != 0 {
+					t.Errorf("Expected no pages for '%s', got %d", tt.url, len(pages))
+				}
+				return
+			}
+
+			if len(pages) != 1 {
+				t.Fatalf("Expected 1 page for '%s', got %d", tt.url, len(pages))
+			}
+			if pages[0].Title != tt.expectedTitle {
+				t.Errorf("Expected page '%s', got '%s'", tt.expectedTitle, pages[0].Title)
+			}
+		})
+	}
+
+	if _, err := vault.FindByURL(""); err == nil {
+		t.Error("Expected an error for an empty URL")
+	}
+}
+
+func TestVaultFindByUserID(t *testing.T) {
+	vault := &Vault{
+		Pages: []*Page{
+			{Title: "First", Url: "https://fetlife.com/users/111"},
+			{Title: "Second", UrlAliases: []string{"https://fetlife.com/users/111"}},
+			{Title: "Other", Url: "https://fetlife.com/users/1111"},
+			{Title: "Shorter", Url: "https://fetlife.com/users/11"},
+			{Title: "About", Url: "https://www.fetlife.com/users/111/about?tab=kinks"},
+			{Title: "Slash", UrlAliases: []string{"https://fetlife.com/users/1112/"}},
+		},
+	}
+
+	tests := []struct {
+		userID   string
+		expected []string
+	}{
+		{userID: "111", expected: []string{"First", "Second", "About"}},
+		{userID: "11", expected: []string{"Shorter"}},
+		{userID: "1111", expected: []string{"Other"}},
+		{userID: "1112", expected: []string{"Slash"}},
+		{userID: "1", expected: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.userID, func(t *testing.T) {
+			pages, err := vault.FindByUserID(tt.userID)
+			if err != nil {
+				t.Fatalf("FindByUserID failed: %v", err)
+			}
+
+			var titles []string
+			for _, page := range pages {
+				titles = append(titles, page.Title)
+			}
+			if !slices.Equal(titles, tt.expected) {
+				t.Errorf("Expected pages %v, got %v", tt.expected, titles)
+			}
+		})
+	}
+}
+
+func TestVaultFindDuplicates(t *testing.T) {
+	vault := &Vault{
+		Pages: []*Page{
+			{Title: "First", Folder: "People", Url: "https://fetlife.com/users/111"},
+			{Title: "Second", Folder: "People", UrlAliases: []string{"http://www.fetlife.com/users/111/"}},
+			{Title: "Other", Folder: "People", Url: "https://fetlife.com/users/1111"},
+			{Title: "Twice", Folder: "People", Url: "https://fetlife.com/users/222", UrlAliases: []string{"https://fetlife.com/users/222"}},
+			{Title: "Site", Folder: "People", Url: "https://example.com/users/111"},
+		},
+	}
+
+	duplicates := vault.FindDuplicates()
+	if len(duplicates) != 1 {
+		t.Fatalf("Expected 1 duplicate profile, got %d: %v", len(duplicates), duplicates)
+	}
+	pages := duplicates["https://fetlife.com/users/111"]
+	if len(pages) != 2 || pages[0].Title != "First" || pages[1].Title != "Second" {
+		t.Errorf("Expected First and Second for user 111, got %v", pages)
+	}
+
+	// Loading a vault with duplicates only warns
+	tempDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(tempDir, "People"), 0755); err != nil {
+		t.Fatalf("Failed to create folder: %v", err)
+	}
+	for _, title := range []string{"Alice", "Ally"} {
+		content := "---\nurl: https://fetlife.com/users/12345\n---\n"
+		if err := os.WriteFile(filepath.Join(tempDir, "People", title+".md"), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write page: %v", err)
+		}
+	}
+	loaded := NewVault(tempDir)
+	if err := loaded.Load(); err != nil {
+		t.Fatalf("Failed to load vault with duplicates: %v", err)
+	}
+	if pages := loaded.FindDuplicates()["https://fetlife.com/users/12345"]; len(pages) != 2 {
+		t.Errorf("Expected 2 pages for user 12345, got %d", len(pages))
+	}
+
+	example := NewVault(getExampleVaultPath(t))
+	if err := example.Load(); err != nil {
+		t.Fatalf("Failed to load vault: %v", err)
+	}
+	if duplicates := example.FindDuplicates(); len(duplicates) != 0 {
+		t.Errorf("Expected no duplicates in the example vault, got %v", duplicates)
+	}
+}
+
+func TestParseUserURL(t *testing.T) {
+	tests := []struct {
+		url    string
+		userID string
+	}{
+		{url: "https://fetlife.com/users/12345", userID: "12345"},
+		{url: "https://fetlife.com/users/12345/", userID: "12345"},
+		{url: "https://fetlife.com/users/12345?ref=search", userID: "12345"},
+		{url: "https://fetlife.com/users/12345#pictures", userID: "12345"},
+		{url: "https://fetlife.com/users/12345/about", userID: "12345"},
+		{url: "http://www.FetLife.com/users/12345", userID: "12345"},
+		{url: " https://fetlife.com/users/123 ", userID: "123"},
+		{url: "https://fetlife.com/users/123abc", userID: ""},
+		{url: "https://fetlife.com/users/", userID: ""},
+		{url: "https://fetlife.com/alice", userID: ""},
+		{url: "https://fetlife.com/groups/12345", userID: ""},
+		{url: "https://example.com/users/12345", userID: ""},
+		{url: "ftp://fetlife.com/users/12345", userID: ""},
+		{url: "", userID: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			userID, ok := ParseUserURL(tt.url)
+			if ok != (tt.userID != "") || userID != tt.userID {
+				t.Errorf("Expected user ID '%s', got '%s' (ok %v)", tt.userID, userID, ok)
+			}
+		})
+	}
+}
+
+func TestPageRename(t *testing.T) {
+	tempDir := t.TempDir()
+	peopleDir := filepath.Join(tempDir, "People")
+	if err := os.MkdirAll(peopleDir, 0755); err != nil {
+		t.Fatalf("Failed to create People directory: %v", err)
+	}
+
+	oldPath := filepath.Join(peopleDir, "OldName.md")
+	if err := os.WriteFile(oldPath, []byte("# Old\n"), 0644); err != nil {
+		t.Fatalf("Failed to create page: %v", err)
+	}
+	takenPath := filepath.Join(peopleDir, "Taken.md")
+	if err := os.WriteFile(takenPath, []byte("# Taken\n"), 0644); err != nil {
+		t.Fatalf("Failed to create page: %v", err)
+	}
+
+	page, err := LoadPage(oldPath, tempDir)
+	if err != nil {
+		t.Fatalf("Failed to load page: %v", err)
+	}
+
+	// Renaming onto an existing file fails and leaves the page alone
+	err = page.Rename("Taken")
+	if !errors.Is(err, os.ErrExist) {
+		t.Errorf("Expected os.ErrExist, got %v", err)
+	}
+	if page.Title != "OldName" || page.FilePath != oldPath {
+		t.Errorf("Page should not change after a failed rename, got '%s' at '%s'", page.Title, page.FilePath)
+	}
+
+	// Invalid titles are rejected
+	if err := page.Rename("Sub/Dir"); err == nil {
+		t.Error("Expected an error for a title containing a path separator")
+	}
+
+	if err := page.Rename("NewName"); err != nil {
+		t.Fatalf("Failed to rename page: %v", err)
+	}
+
+	newPath := filepath.Join(peopleDir, "NewName.md")
+	if page.Title != "NewName" {
+		t.Errorf("Expected title 'NewName', got '%s'", page.Title)
+	}
+	if page.FilePath != newPath {
+		t.Errorf("Expected file path '%s', got '%s'", newPath, page.FilePath)
+	}
+	if _, err := os.Stat(oldPath); !os.IsNotExist(err) {
+		t.Error("Old file should no longer exist")
+	}
+	content, err := os.ReadFile(newPath)
+	if err != nil {
+		t.Fatalf("Failed to read renamed page: %v", err)
+	}
+	if string(content) != "# Old\n" {
+		t.Errorf("Renamed page content changed: %q", content)
+	}
+}
+
+func TestPageSaveKeyOrder(t *testing.T) {
+	tempDir := t.TempDir()
+	filePath := filepath.Join(tempDir, "Person.md")
+
+	page := &Page{
+		Title:         "Person",
+		FilePath:      filePath,
+		WebMessage:    "Met at a munch",
+		WebBadgeColor: "#FF0000",
+		UrlAliases:    []string{"https://fetlife.com/person"},
+		Url:           "https://fetlife.com/users/12345",
+		Aliases:       []string{"Someone"},
+		Tags:          []string{"person", "2024"},
+		Content:       "\n# Person\n",
+	}
+
+	if err := page.Save(); err != nil {
+		t.Fatalf("Failed to save page: %v", err)
+	}
+
+	first, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read page: %v", err)
+	}
+
+	expected := `---
+tags:
+  - person
+  - "2024"
+aliases:
+  - Someone
+url: https://fetlife.com/users/12345
+url-aliases:
+  - https://fetlife.com/person
+web-badge-color: '#FF0000'
+web-message: Met at a munch
+---
+
+# Person
+`
+	if string(first) != expected {
+		t.Errorf("Unexpected file content:\n%s\nexpected:\n%s", first, expected)
+	}
+
+	// Reloading and saving again must not change a single byte
+	reloaded, err := LoadPage(filePath, tempDir)
+	if err != nil {
+		t.Fatalf("Failed to reload page: %v", err)
+	}
+	if err := reloaded.Save(); err != nil {
+		t.Fatalf("Failed to save reloaded page: %v", err)
+	}
+
+	second, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read page: %v", err)
+	}
+	if string(first) != string(second) {
+		t.Errorf("Saving a reloaded page changed its content:\n%s\nvs:\n%s", first, second)
+	}
+}
+
+func TestPageSaveUnchanged(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "Alice.md")
+	if err := os.WriteFile(filePath, []byte("---\ntags:\n  - person\nweb-message: Met at a munch\n---\n\n# Alice\n"), 0644); err != nil {
+		t.Fatalf("Failed to write page: %v", err)
+	}
+	old := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(filePath, old, old); err != nil {
+		t.Fatalf("Failed to set modification time: %v", err)
+	}
+
+	page, err := LoadPage(filePath, filepath.Dir(filePath))
+	if err != nil {
+		t.Fatalf("Failed to load page: %v", err)
+	}
+	if page.IsDirty() {
+		t.Error("Expected a page that was just loaded not to be dirty")
+	}
+
+	// Saving an unchanged page doesn't write the file
+	if err := page.Save(); err != nil {
+		t.Fatalf("Failed to save page: %v", err)
+	}
+	if info, err := os.Stat(filePath); err != nil {
+		t.Fatalf("Failed to stat page: %v", err)
+	} else if !info.ModTime().Equal(old) {
+		t.Errorf("Expected the modification time to stay %v, got %v", old, info.ModTime())
+	}
+
+	// A changed page is dirty until it's saved
+	page.AddTag("friend")
+	if !page.IsDirty() {
+		t.Error("Expected a changed page to be dirty")
+	}
+	if err := page.Save(); err != nil {
+		t.Fatalf("Failed to save page: %v", err)
+	}
+	if info, err := os.Stat(filePath); err != nil {
+		t.Fatalf("Failed to stat page: %v", err)
+	} else if info.ModTime().Equal(old) {
+		t.Error("Expected the changed page to be written")
+	}
+	if page.IsDirty() {
+		t.Error("Expected a saved page not to be dirty")
+	}
+
+	// A page without a file is dirty
+	page.FilePath = filepath.Join(filepath.Dir(filePath), "Missing.md")
+	if !page.IsDirty() {
+		t.Error("Expected a page without a file to be dirty")
+	}
+}
+
+func BenchmarkPageSaveUnchanged(b *testing.B) {
+	filePath := filepath.Join(b.TempDir(), "Alice.md")
+	if err := os.WriteFile(filePath, []byte("---\ntags:\n  - person\nweb-message: Met at a munch\n---\n\n# Alice\n"), 0644); err != nil {
+		b.Fatal(err)
+	}
+	old := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(filePath, old, old); err != nil {
+		b.Fatal(err)
+	}
+	page, err := LoadPage(filePath, filepath.Dir(filePath))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for b.Loop() {
+		if err := page.Save(); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	if info, err := os.Stat(filePath); err != nil {
+		b.Fatal(err)
+	} else if !info.ModTime().Equal(old) {
+		b.Fatalf("Expected no write to the file, its modification time is %v", info.ModTime())
+	}
+}
+
+func TestPageCustomFields(t *testing.T) {
+	tempDir := t.TempDir()
+	filePath := filepath.Join(tempDir, "Alice.md")
+	content := "---\n" +
+		"trust-score: 4.5\n" +
+		"tags:\n  - person\n" +
+		"custom-field: \"hello\"\n" +
+		"met-on: 2024-01-01\n" +
+		"kinks:\n  - rope\n  - wax\n" +
+		"url: https://fetlife.com/users/12345\n" +
+		"contact:\n  signal: true\n" +
+		"flag: yes\n" +
+		"---\n\n# Alice\n"
+	if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write page: %v", err)
+	}
+
+	page, err := LoadPage(filePath, tempDir)
+	if err != nil {
+		t.Fatalf("Failed to load page: %v", err)
+	}
+	if page.CustomFields["custom-field"] != "hello" {
+		t.Errorf("Expected custom-field 'hello', got %v", page.CustomFields["custom-field"])
+	}
+	if _, ok := page.CustomFields["tags"]; ok {
+		t.Error("Expected known fields not to be custom fields")
+	}
+
+	// Custom fields stay after the known field they followed, written as they were, and new ones go at the end,
+	// sorted by key
+	page.WebMessage = "Met at a munch"
+	page.CustomFields["trust-score"] = 5
+	page.CustomFields["zodiac"] = "leo"
+	page.CustomFields["added"] = true
+	if err := page.Save(); err != nil {
+		t.Fatalf("Failed to save page: %v", err)
+	}
+	saved, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read page: %v", err)
+	}
+	expected := "---\n" +
+		"trust-score: 5\n" +
+		"tags:\n  - person\n" +
+		"custom-field: \"hello\"\n" +
+		"met-on: 2024-01-01\n" +
+		"kinks:\n  - rope\n  - wax\n" +
+		"url: https://fetlife.com/users/12345\n" +
+		"contact:\n  signal: true\n" +
+		"flag: yes\n" +
+		"web-message: Met at a munch\n" +
+		"added: true\n" +
+		"zodiac: leo\n" +
+		"---\n\n# Alice\n"
+	if string(saved) != expected {
+		t.Errorf("Expected saved page:\n%s\ngot:\n%s", expected, saved)
+	}
+
+	// Saving again changes nothing
+	reloaded, err := LoadPage(filePath, tempDir)
+	if err != nil {
+		t.Fatalf("Failed to reload page: %v", err)
+	}
+	if reloaded.IsDirty() {
+		t.Error("Expected a page with custom fields to round-trip without changes")
+	}
+
+	// A clone has its own custom fields
+	clone := reloaded.Clone()
+	clone.CustomFields["custom-field"] = "changed"
+	if reloaded.CustomFields["custom-field"] != "hello" {
+		t.Error("Expected changing a clone's custom fields to leave the page alone")
+	}
+}
+
+func TestPageSaveDates(t *testing.T) {
+	tempDir := t.TempDir()
+	filePath := filepath.Join(tempDir, "Blocked.md")
+
+	page := &Page{
+		Title:       "Blocked",
+		FilePath:    filePath,
+		Url:         "https://fetlife.com/users/12345",
+		BlockedDate: "2024-01-01",
+		BlockedAt:   "2024-01-01 09:00:00 UTC",
+		FriendDate:  "2023-06-01",
+		NoteCreated: "2024-02-01 10:00:00 UTC",
+		NoteUpdated: "2024-03-01 10:00:00 UTC",
+	}
+	if err := page.Save(); err != nil {
+		t.Fatalf("Failed to save page: %v", err)
+	}
+
+	reloaded, err := LoadPage(filePath, tempDir)
+	if err != nil {
+		t.Fatalf("Failed to reload page: %v", err)
+	}
+	if reloaded.BlockedDate != "2024-01-01" {
+		t.Errorf("Expected blocked date '2024-01-01', got '%s'", reloaded.BlockedDate)
+	}
+	if reloaded.BlockedAt != "2024-01-01 09:00:00 UTC" {
+		t.Errorf("Expected blocked at '2024-01-01 09:00:00 UTC', got '%s'", reloaded.BlockedAt)
+	}
+	if reloaded.FriendDate != "2023-06-01" {
+		t.Errorf("Expected friend date '2023-06-01', got '%s'", reloaded.FriendDate)
+	}
+	if reloaded.NoteCreated != "2024-02-01 10:00:00 UTC" {
+		t.Errorf("Expected note created '2024-02-01 10:00:00 UTC', got '%s'", reloaded.NoteCreated)
+	}
+	if reloaded.NoteUpdated != "2024-03-01 10:00:00 UTC" {
+		t.Errorf("Expected note updated '2024-03-01 10:00:00 UTC', got '%s'", reloaded.NoteUpdated)
+	}
+}
+
+func TestPageLoadTimestamps(t *testing.T) {
+	tempDir := t.TempDir()
+	filePath := filepath.Join(tempDir, "Synced.md")
+
+	// Unquoted timestamps are parsed as times by YAML
+	content := "---\ncreated-at: 2024-06-01T12:00:00Z\nsynced-at: \"2024-06-02T08:30:00Z\"\n---\n"
+	if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create page: %v", err)
+	}
+
+	page, err := LoadPage(filePath, tempDir)
+	if err != nil {
+		t.Fatalf("Failed to load page: %v", err)
+	}
+	if page.CreatedAt != "2024-06-01T12:00:00Z" {
+		t.Errorf("Expected created at '2024-06-01T12:00:00Z', got '%s'", page.CreatedAt)
+	}
+	if page.SyncedAt != "2024-06-02T08:30:00Z" {
+		t.Errorf("Expected synced at '2024-06-02T08:30:00Z', got '%s'", page.SyncedAt)
+	}
+}
+
+func TestVaultMove(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, path := range []string{"People/Mover.md", "Bad People/Taken.md", "People/Taken.md"} {
+		fullPath := filepath.Join(tempDir, path)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(fullPath, []byte("# "+path+"\n"), 0644); err != nil {
+			t.Fatalf("Failed to create page: %v", err)
+		}
+	}
+
+	vault := NewVault(tempDir)
+	if err := vault.Load(); err != nil {
+		t.Fatalf("Failed to load vault: %v", err)
+	}
+
+	var mover, taken *Page
+	for _, page := range vault.Pages {
+		if page.Folder == "People" && page.Title == "Mover" {
+			mover = page
+		}
+		if page.Folder == "People" && page.Title == "Taken" {
+			taken = page
+		}
+	}
+	if mover == nil || taken == nil {
+		t.Fatal("Could not find test pages")
+	}
+
+	// Moving onto an existing file fails
+	err := vault.Move(taken, "Bad People")
+	if !errors.Is(err, os.ErrExist) {
+		t.Errorf("Expected os.ErrExist, got %v", err)
+	}
+	if taken.Folder != "People" {
+		t.Errorf("Page should stay in People after a failed move, got '%s'", taken.Folder)
+	}
+
+	// Folders outside the vault are rejected
+	if err := vault.Move(mover, "../Elsewhere"); err == nil {
+		t.Error("Expected an error for a folder outside the vault")
+	}
+
+	// Pages that aren't in the vault are rejected
+	if err := vault.Move(&Page{Title: "Stranger", FilePath: filepath.Join(tempDir, "Stranger.md")}, "People"); err == nil {
+		t.Error("Expected an error for a page that isn't in the vault")
+	}
+
+	// Move into a folder that doesn't exist yet
+	if err := vault.Move(mover, "Friends/Close"); err != nil {
+		t.Fatalf("Failed to move page: %v", err)
+	}
+
+	newPath := filepath.Join(tempDir, "Friends", "Close", "Mover.md")
+	if mover.FilePath != newPath {
+		t.Errorf("Expected file path '%s', got '%s'", newPath, mover.FilePath)
+	}
+	if _, err := os.Stat(newPath); err != nil {
+		t.Errorf("Moved file should exist: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "People", "Mover.md")); !os.IsNotExist(err) {
+		t.Error("Old file should no longer exist")
+	}
+
+	// The vault sees the page in its new folder
+	moved := vault.InFolder(filepath.Join("Friends", "Close"))
+	if len(moved) != 1 || moved[0] != mover {
+		t.Errorf("Expected the moved page in Friends/Close, got %d pages", len(moved))
+	}
+	if len(vault.Pages) != 3 {
+		t.Errorf("Expected 3 pages in the vault, got %d", len(vault.Pages))
+	}
+}
+
+func TestPageAddTag(t *testing.T) {
+	page := &Page{Tags: []string{"person", "Friend"}}
+
+	if !page.AddTag("Blocked") {
+		t.Error("Expected AddTag to add a new tag")
+	}
+	if page.AddTag("friend") {
+		t.Error("Expected AddTag to ignore a tag that differs only in case")
+	}
+	if page.AddTag("person") {
+		t.Error("Expected AddTag to ignore a duplicate tag")
+	}
+
+	expected := []string{"person", "Friend", "Blocked"}
+	if len(page.Tags) != len(expected) {
+		t.Fatalf("Expected tags %v, got %v", expected, page.Tags)
+	}
+	for i, tag := range expected {
+		if page.Tags[i] != tag {
+			t.Errorf("Expected tag '%s' at position %d, got '%s'", tag, i, page.Tags[i])
+		}
+	}
+}
+
+func TestPageRemoveTag(t *testing.T) {
+	page := &Page{Tags: []string{"person", "Blocked", "friend"}}
+
+	if !page.RemoveTag("blocked") {
+		t.Error("Expected RemoveTag to remove a tag that differs only in case")
+	}
+	if page.RemoveTag("missing") {
+		t.Error("Expected RemoveTag to report a tag that isn't there")
+	}
+
+	expected := []string{"person", "friend"}
+	if len(page.Tags) != len(expected) {
+		t.Fatalf("Expected tags %v, got %v", expected, page.Tags)
+	}
+	for i, tag := range expected {
+		if page.Tags[i] != tag {
+			t.Errorf("Expected tag '%s' at position %d, got '%s'", tag, i, page.Tags[i])
+		}
+	}
+}
+
+func TestPageSetSection(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{
+			name:     "empty page",
+			content:  "",
+			expected: "## Conversations\n\nNew text\n",
+		},
+		{
+			name:     "page without the section",
+			content:  "\n# Alice\n\nMet at a munch\n",
+			expected: "\n# Alice\n\nMet at a munch\n\n## Conversations\n\nNew text\n",
+		},
+		{
+			name:     "section at the end",
+			content:  "# Alice\n\n## Conversations\n\nOld text\nMore old text\n",
+			expected: "# Alice\n\n## Conversations\n\nNew text\n",
+		},
+		{
+			name:     "section followed by another section",
+			content:  "# Alice\n\n## Conversations\n\nOld text\n\n### Subheading\n\nOld\n\n## Notes\n\nKeep me\n",
+			expected: "# Alice\n\n## Conversations\n\nNew text\n\n## Notes\n\nKeep me\n",
+		},
+		{
+			name:     "similar heading is not the section",
+			content:  "## Conversations with Bob\n\nKeep me\n",
+			expected: "## Conversations with Bob\n\nKeep me\n\n## Conversations\n\nNew text\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := &Page{Content: tt.content}
+			page.SetSection("Conversations", "New text\n")
+			if page.Content != tt.expected {
+				t.Errorf("Expected content %q, got %q", tt.expected, page.Content)
+			}
+
+			// Setting the section again changes nothing
+			page.SetSection("Conversations", "New text")
+			if page.Content != tt.expected {
+				t.Errorf("Expected setting the section twice to give %q, got %q", tt.expected, page.Content)
+			}
+		})
+	}
+}
+
+func TestPageGetSection(t *testing.T) {
+	content := "# Alice\n\nMet at a munch\n\n## Conversations\n\n3 messages\n\n### Last message\n\nHi\n\n## Notes \n\nFirst line\nSecond line\n\n## Empty\n\n# Next Title\n"
+
+	tests := []struct {
+		heading  string
+		expected string
+	}{
+		{heading: "Conversations", expected: "3 messages\n\n### Last message\n\nHi"},
+		{heading: "Notes", expected: "First line\nSecond line"},
+		{heading: "Empty", expected: ""},
+		{heading: "Missing", expected: ""},
+		{heading: "Last message", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.heading, func(t *testing.T) {
+			page := &Page{Content: content}
+			if section := page.GetSection(tt.heading); section != tt.expected {
+				t.Errorf("Expected section %q, got %q", tt.expected, section)
+			}
+		})
+	}
+
+	// A section that was set reads back the same
+	page := &Page{Content: content}
+	page.SetSection("Notes", "Replaced\n")
+	page.SetSection("Sync", "Created at the end")
+	if section := page.GetSection("Notes"); section != "Replaced" {
+		t.Errorf("Expected the replaced section, got %q", section)
+	}
+	if section := page.GetSection("Sync"); section != "Created at the end" {
+		t.Errorf("Expected the new section, got %q", section)
+	}
+	if !strings.HasSuffix(page.Content, "# Next Title\n\n## Sync\n\nCreated at the end\n") {
+		t.Errorf("Expected the new section at the end, got %q", page.Content)
+	}
+}
+
+func TestVaultDelete(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, name := range []string{"People/Old/Alice.md", "People/Bob.md"} {
+		path := filepath.Join(tempDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create folder: %v", err)
+		}
+		if err := os.WriteFile(path, []byte("# Test\n"), 0644); err != nil {
+			t.Fatalf("Failed to write test file: %v", err)
+		}
+	}
+
+	vault := NewVault(tempDir)
+	if err := vault.Load(); err != nil {
+		t.Fatalf("Failed to load vault: %v", err)
+	}
+
+	var alice *Page
+	for _, page := range vault.Pages {
+		if page.Title == "Alice" {
+			alice = page
+		}
+	}
+	if alice == nil {
+		t.Fatal("Alice not found")
+	}
+
+	if err := vault.Delete(alice); err != nil {
+		t.Fatalf("Failed to delete page: %v", err)
+	}
+	if _, err := os.Stat(alice.FilePath); !os.IsNotExist(err) {
+		t.Errorf("Expected %s to be removed, got %v", alice.FilePath, err)
+	}
+	if len(vault.Pages) != 1 || vault.Pages[0].Title != "Bob" {
+		t.Errorf("Expected only Bob to be left in the vault, got %d pages", len(vault.Pages))
+	}
+	if err := vault.Delete(alice); err == nil {
+		t.Error("Expected deleting a page twice to fail")
+	}
+
+	// Only the empty folder is pruned, People still holds Bob
+	if err := vault.PruneFolder(filepath.Join("People", "Old")); err != nil {
+		t.Fatalf("Failed to prune folder: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "People", "Old")); !os.IsNotExist(err) {
+		t.Errorf("Expected the empty folder to be removed, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "People", "Bob.md")); err != nil {
+		t.Errorf("Expected Bob to be kept: %v", err)
+	}
+
+	// The vault itself is never removed
+	if err := os.Remove(filepath.Join(tempDir, "People", "Bob.md")); err != nil {
+		t.Fatalf("Failed to remove Bob: %v", err)
+	}
+	if err := vault.PruneFolder("People"); err != nil {
+		t.Fatalf("Failed to prune folder: %v", err)
+	}
+	if _, err := os.Stat(tempDir); err != nil {
+		t.Errorf("Expected the vault directory to be kept: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "People")); !os.IsNotExist(err) {
+		t.Errorf("Expected People to be removed, got %v", err)
+	}
+}
+
+func TestVaultFindByTitle(t *testing.T) {
+	vault := NewVault(getExampleVaultPath(t))
+	if err := vault.Load(); err != nil {
+		t.Fatalf("Failed to load vault: %v", err)
+	}
+
+	if page := vault.FindByTitle("Alice"); page == nil || page.Folder != "People" {
+		t.Errorf("Expected FindByTitle to find Alice in People, got %v", page)
+	}
+	if page := vault.FindByTitle("alice"); page != nil {
+		t.Errorf("Expected FindByTitle to match case, got %s", page.Title)
+	}
+	if page := vault.FindByTitleCI("alice"); page == nil || page.Title != "Alice" {
+		t.Errorf("Expected FindByTitleCI to find Alice, got %v", page)
+	}
+	if page := vault.FindByTitleInFolder("Frank", "Bad People"); page == nil || page.Title != "Frank" {
+		t.Errorf("Expected FindByTitleInFolder to find Frank in Bad People, got %v", page)
+	}
+	if page := vault.FindByTitleInFolder("Frank", "People"); page != nil {
+		t.Errorf("Expected no Frank in People, got %s", page.FilePath)
+	}
+	if page := vault.FindByTitleInFolder("About", "."); page == nil {
+		t.Error("Expected FindByTitleInFolder to find About in the vault root")
+	}
+	for _, find := range []func(string) *Page{vault.FindByTitle, vault.FindByTitleCI} {
+		if page := find("Nobody"); page != nil {
+			t.Errorf("Expected nil for a missing title, got %s", page.Title)
+		}
+	}
+}
+
+func TestVaultTitleIndex(t *testing.T) {
+	tempDir := t.TempDir()
+	path := filepath.Join(tempDir, "People", "Alice.md")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("Failed to create folder: %v", err)
+	}
+	if err := os.WriteFile(path, []byte("# Alice\n"), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	vault := NewVault(tempDir)
+	if err := vault.Load(); err != nil {
+		t.Fatalf("Failed to load vault: %v", err)
+	}
+	alice := vault.FindByTitle("Alice")
+	if alice == nil {
+		t.Fatal("Expected Alice to be indexed by Load")
+	}
+
+	if err := vault.Rename(alice, "Alicia"); err != nil {
+		t.Fatalf("Failed to rename page: %v", err)
+	}
+	if vault.FindByTitle("Alice") != nil || vault.FindByTitleCI("alice") != nil {
+		t.Error("Expected the old title to be gone from the index")
+	}
+	if vault.FindByTitle("Alicia") != alice || vault.FindByTitleCI("ALICIA") != alice {
+		t.Error("Expected the new title to be indexed")
+	}
+
+	bob := &Page{Title: "Bob", Folder: "People", FilePath: filepath.Join(tempDir, "People", "Bob.md")}
+	vault.Add(bob)
+	if vault.FindByTitleInFolder("Bob", "People/") != bob {
+		t.Error("Expected an added page to be indexed")
+	}
+
+	if err := vault.Delete(alice); err != nil {
+		t.Fatalf("Failed to delete page: %v", err)
+	}
+	if vault.FindByTitle("Alicia") != nil {
+		t.Error("Expected a deleted page to be gone from the index")
+	}
+
+	// Pages changed directly are found again after Reindex
+	bob.Title = "Robert"
+	vault.Reindex()
+	if vault.FindByTitle("Bob") != nil || vault.FindByTitle("Robert") != bob {
+		t.Error("Expected Reindex to rebuild the index")
+	}
+}
+
+func TestPageSaveFrontmatterOnly(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"trailing spaces", "\n# Person  \n\nMet at a munch   \n"},
+		{"tabs", "\n\t- first\n\t\t- nested\t\n"},
+		{"no final newline", "\n# Person\n\nLast line"},
+		{"blank lines", "\n\n\n# Person\n\n\n\n"},
+		{"empty", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			testFile := filepath.Join(tempDir, "person.md")
+			original := "---\ntags:   [person]\nurl: https://fetlife.com/users/12345\n---\n" + tt.body
+			if err := os.WriteFile(testFile, []byte(original), 0644); err != nil {
+				t.Fatalf("Failed to write test file: %v", err)
+			}
+
+			page, err := loadPage(testFile, tempDir)
+			if err != nil {
+				t.Fatalf("Failed to load page: %v", err)
+			}
+			if page.ContentChanged() {
+				t.Error("Expected a loaded page to have an unchanged body")
+			}
+			page.AddTag("blocked")
+			if err := page.SaveFrontmatterOnly(); err != nil {
+				t.Fatalf("Failed to save page: %v", err)
+			}
+
+			content, err := os.ReadFile(testFile)
+			if err != nil {
+				t.Fatalf("Failed to read test file: %v", err)
+			}
+			expected := "---\ntags:\n  - person\n  - blocked\nurl: https://fetlife.com/users/12345\n---\n" + tt.body
+			if string(content) != expected {
+				t.Errorf("Expected %q, got %q", expected, content)
+			}
+		})
+	}
+}
+
+func TestPageSpliceFrontmatter(t *testing.T) {
+	page := &Page{Tags: []string{"person"}, Content: "\nIgnored\n"}
+
+	tests := []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{"closing line without newline", "---\ntags: []\n---", "---\ntags:\n  - person\n---"},
+		{"dashes inside a value", "---\nweb-message: a---\n---\nBody  ", "---\ntags:\n  - person\n---\nBody  "},
+		{"no frontmatter", "Just text\t\n", "---\ntags:\n  - person\n---\nJust text\t\n"},
+		{"unclosed frontmatter", "---\nnot closed", "---\ntags:\n  - person\n---\n---\nnot closed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, err := page.SpliceFrontmatter([]byte(tt.content))
+			if err != nil {
+				t.Fatalf("Failed to splice frontmatter: %v", err)
+			}
+			if string(content) != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, content)
+			}
+		})
+	}
+}
+
+func TestPageContentChangedAfterSave(t *testing.T) {
+	tempDir := t.TempDir()
+	testFile := filepath.Join(tempDir, "person.md")
+	if err := os.WriteFile(testFile, []byte("---\ntags:\n  - person\n---\n\n# Person\n"), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	page, err := loadPage(testFile, tempDir)
+	if err != nil {
+		t.Fatalf("Failed to load page: %v", err)
+	}
+
+	// Saving a body the file already has marks it saved, like a save that writes it
+	page.Content = "\n# Person\n\nNew line\n"
+	if err := os.WriteFile(testFile, []byte("---\ntags:\n  - person\n---\n"+page.Content), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	if !page.ContentChanged() {
+		t.Fatal("Expected the changed body to be reported")
+	}
+	if err := page.Save(); err != nil {
+		t.Fatalf("Failed to save page: %v", err)
+	}
+	if page.ContentChanged() {
+		t.Error("Expected the body to be unchanged after saving it")
+	}
+}
@@ -0,0 +1,113 @@
+package program
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/woodysmith1912/fetlife-data-tools/obsidian"
+)
+
+// backupTimeLayout is the timestamp at the end of a backup directory's name
+const backupTimeLayout = "20060102-150405"
+
+// configDir is the directory of a vault holding Obsidian's settings
+const configDir = ".obsidian"
+
+type BackupCmd struct {
+	IncludeConfig bool `help:"Copy the vault's .obsidian directory with Obsidian's settings too"`
+
+	// now returns the time the backup is named after, time.Now when not set
+	now func() time.Time
+}
+
+// Run copies the vault to <vault>-backup-<timestamp> next to it and prints the path of the copy
+func (backup *BackupCmd) Run(vault *obsidian.Vault) error {
+	now := time.Now
+	if backup.now != nil {
+		now = backup.now
+	}
+
+	path, files, err := backupVault(vault.Path, backup.IncludeConfig, now())
+	if err != nil {
+		log.Error().Err(err).Str("vault", vault.Path).Msg("Failed to back up vault")
+		return err
+	}
+
+	log.Info().Str("backup", path).Int("fileCount", files).Msg("Backed up vault")
+	fmt.Println(path)
+	return nil
+}
+
+// backupVault copies every file of the vault at vaultPath to a new directory next to it named after the time.  The
+// .obsidian directory is only copied with includeConfig.  Returns the path of the copy and the number of files copied.
+func backupVault(vaultPath string, includeConfig bool, at time.Time) (string, int, error) {
+	source, err := filepath.Abs(vaultPath)
+	if err != nil {
+		return "", 0, err
+	}
+	target := fmt.Sprintf("%s-backup-%s", source, at.Format(backupTimeLayout))
+
+	// Never copy over an earlier backup
+	if err := os.Mkdir(target, 0755); err != nil {
+		return "", 0, err
+	}
+
+	files := 0
+	err = filepath.WalkDir(source, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(source, path)
+		if err != nil || relPath == "." {
+			return err
+		}
+		if entry.IsDir() && relPath == configDir && !includeConfig {
+			return filepath.SkipDir
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case entry.IsDir():
+			return os.Mkdir(filepath.Join(target, relPath), info.Mode().Perm())
+		case info.Mode().IsRegular():
+			files++
+			return copyFile(path, filepath.Join(target, relPath), info)
+		default:
+			log.Warn().Str("file", relPath).Msg("Not backing up a file that isn't a regular file")
+			return nil
+		}
+	})
+	if err != nil {
+		return "", 0, err
+	}
+	return target, files, nil
+}
+
+// copyFile copies the file at source to target, keeping its permissions and modification time
+func copyFile(source, target string, info os.FileInfo) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(target, info.ModTime(), info.ModTime())
+}
@@ -0,0 +1,106 @@
+package program
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zenizh/go-capturer"
+)
+
+// countFiles counts the regular files under dir
+func countFiles(t *testing.T, dir string) int {
+	t.Helper()
+	count := 0
+	err := filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err == nil && entry.Type().IsRegular() {
+			count++
+		}
+		return err
+	})
+	assert.NoError(t, err)
+	return count
+}
+
+func TestBackupCmd(t *testing.T) {
+	tempVault := t.TempDir()
+	writeTestFile(t, filepath.Join(tempVault, ".obsidian", "app.json"), "{}")
+	writeTestFile(t, filepath.Join(tempVault, "People", "Alice.md"), "---\nurl: https://fetlife.com/users/12345\n---\n")
+	writeTestFile(t, filepath.Join(tempVault, "Bad People", "Frank.md"), "# Frank\n")
+	writeTestFile(t, filepath.Join(tempVault, "Attachments", "photo.png"), "png")
+	past := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	assert.NoError(t, os.Chtimes(filepath.Join(tempVault, "People", "Alice.md"), past, past))
+
+	tests := []struct {
+		name          string
+		includeConfig bool
+		at            time.Time
+		files         int
+	}{
+		{name: "without config", at: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC), files: 3},
+		{name: "with config", includeConfig: true, at: time.Date(2024, 6, 1, 12, 0, 1, 0, time.UTC), files: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backup := &BackupCmd{IncludeConfig: tt.includeConfig, now: func() time.Time { return tt.at }}
+			var err error
+			out := capturer.CaptureStdout(func() {
+				err = backup.Run(loadTestVault(t, tempVault))
+			})
+			assert.NoError(t, err)
+
+			backupPath := tempVault + "-backup-" + tt.at.Format(backupTimeLayout)
+			assert.Contains(t, out, backupPath+"\n")
+			assert.Equal(t, tt.files, countFiles(t, backupPath))
+			_, err = os.Stat(filepath.Join(backupPath, ".obsidian", "app.json"))
+			assert.Equal(t, tt.includeConfig, err == nil)
+
+			content, err := os.ReadFile(filepath.Join(backupPath, "People", "Alice.md"))
+			assert.NoError(t, err)
+			assert.Equal(t, "---\nurl: https://fetlife.com/users/12345\n---\n", string(content))
+			info, err := os.Stat(filepath.Join(backupPath, "People", "Alice.md"))
+			assert.NoError(t, err)
+			assert.True(t, info.ModTime().Equal(past))
+		})
+	}
+
+	// An existing backup is never overwritten
+	backup := &BackupCmd{now: func() time.Time { return tests[0].at }}
+	capturer.CaptureStdout(func() {
+		assert.ErrorIs(t, backup.Run(loadTestVault(t, tempVault)), os.ErrExist)
+	})
+}
+
+func TestSyncCmd_Backup(t *testing.T) {
+	tempVault := t.TempDir()
+	alicePath := filepath.Join(tempVault, "People", "Alice.md")
+	aliceContent := "---\ntags:\n  - person\nurl: https://fetlife.com/users/12345\n---\n"
+	writeTestFile(t, alicePath, aliceContent)
+
+	sync := &SyncCmd{
+		DataDir:        []string{writeTestData(t, "", "12345,2024-01-01,2024-01-01,Met at a munch\n")},
+		CreatePeopleIn: []string{"People"},
+		Backup:         true,
+		now:            fixedNow,
+	}
+	assert.NoError(t, sync.Validate())
+	var err error
+	capturer.CaptureStdout(func() {
+		err = sync.Run(loadTestVault(t, tempVault))
+	})
+	assert.NoError(t, err)
+
+	// The backup has the page as it was before the sync
+	content, err := os.ReadFile(filepath.Join(tempVault+"-backup-20240601-120000", "People", "Alice.md"))
+	assert.NoError(t, err)
+	assert.Equal(t, aliceContent, string(content))
+	content, err = os.ReadFile(alicePath)
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "Met at a munch")
+
+	sync = &SyncCmd{BackupIncludeConfig: true}
+	assert.Error(t, sync.Validate())
+}
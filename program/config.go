@@ -0,0 +1,151 @@
+package program
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/alecthomas/kong"
+	"gopkg.in/yaml.v3"
+)
+
+// configLoader reads a --config file, a YAML map from flag names in snake_case to their values, like
+//
+//	vault: ~/Obsidian/Kink
+//	data_dir: ~/Downloads/fetlife-export
+//	create_people_in:
+//	  - People
+//	  - "Bad People:creepy,stalker"
+//
+// The values are used for the flags that aren't given on the command line.
+func configLoader(r io.Reader) (kong.Resolver, error) {
+	values := make(map[string]any)
+	if err := yaml.NewDecoder(r).Decode(&values); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	return configResolver(values), nil
+}
+
+// configResolver resolves flags from the values of a config file
+type configResolver map[string]any
+
+// Validate checks that every key of the config file is the name of a flag
+func (values configResolver) Validate(app *kong.Application) error {
+	var names []string
+	var walk func(node *kong.Node)
+	walk = func(node *kong.Node) {
+		for _, flag := range node.Flags {
+			names = append(names, configKey(flag.Name))
+		}
+		for _, child := range node.Children {
+			walk(child)
+		}
+	}
+	walk(app.Node)
+
+	for key := range values {
+		if !slices.Contains(names, key) {
+			return fmt.Errorf("unknown key %q in config, expected the name of a flag in snake_case like data_dir", key)
+		}
+	}
+	return nil
+}
+
+// Resolve returns the value of the flag in the config file, or nil when it has none.  Values are lists for flags that
+// can be repeated and maps for folder=value flags.
+func (values configResolver) Resolve(_ *kong.Context, _ *kong.Path, flag *kong.Flag) (any, error) {
+	value, ok := values[configKey(flag.Name)]
+	if !ok {
+		return nil, nil
+	}
+	// kong's existingdir and existingfile mappers skip a value for a flag that already has its default, like --vault,
+	// so the default is forgotten for the config's value to be used
+	flag.Set = false
+	// Numbers and booleans are parsed like on the command line
+	switch value.(type) {
+	case int, float64, bool:
+		return fmt.Sprint(value), nil
+	}
+	return value, nil
+}
+
+// configKey is the key of a flag in a config file, its name in snake_case
+func configKey(flag string) string {
+	return strings.ReplaceAll(flag, "-", "_")
+}
+
+// ConfigCmd holds the commands about config files
+type ConfigCmd struct {
+	Init ConfigInitCmd `name:"init" cmd:"" help:"Write an example config file with comments"`
+}
+
+// ConfigInitCmd writes an example config file
+type ConfigInitCmd struct {
+	Path  string `arg:"" optional:"" help:"Where to write the config file, - for standard output" default:"fetlife-data-tools.yaml" type:"path"`
+	Force bool   `help:"Overwrite the file if it exists"`
+}
+
+// exampleConfig is the config file written by config init
+const exampleConfig = `# fetlife-data-tools config, read with --config <file>
+#
+# Keys are the names of the command line flags in snake_case, like data_dir for --data-dir.  Flags given on the
+# command line win over the values here.  Flags that can be repeated take a list, folder=value flags take a map.
+
+# The Obsidian vault (--vault)
+# vault: ~/Obsidian/Kink
+
+# The FetLife export, a directory or its zip archive (--data-dir)
+# data_dir: ~/Downloads/fetlife-export
+
+# Folders for people, with the keywords that route someone to them (--create-people-in)
+# create_people_in:
+#   - People
+#   - "Bad People:creepy,stalker"
+#   - "Friends:friend,cool"
+
+# Folders for blocked users (--create-blocked-in)
+# create_blocked_in:
+#   - Bad People
+
+# Badge colors by folder (--folder-color)
+# folder_color:
+#   Bad People: "#F44336"
+#   Friends: "#4CAF50"
+
+# Other sync options
+# note_mode: append
+# conflict_strategy: skip
+# move_blocked: true
+`
+
+// Run writes the example config file
+func (cmd *ConfigInitCmd) Run() error {
+	if cmd.Path == "-" {
+		_, err := fmt.Print(exampleConfig)
+		return err
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if cmd.Force {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	file, err := os.OpenFile(cmd.Path, flags, 0644)
+	if errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("%s already exists, use --force to overwrite it", cmd.Path)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := file.WriteString(exampleConfig); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote example config to %s\n", cmd.Path)
+	return nil
+}
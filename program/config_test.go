@@ -0,0 +1,99 @@
+package program
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOptions_Config(t *testing.T) {
+	tempVault := t.TempDir()
+	assert.NoError(t, os.Mkdir(filepath.Join(tempVault, ".obsidian"), 0755))
+	dataPath, err := filepath.Abs("../example/test-data")
+	assert.NoError(t, err)
+
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	writeTestFile(t, configPath, "vault: "+tempVault+"\n"+
+		"data_dir: "+dataPath+"\n"+
+		"create_people_in:\n  - People\n  - \"Bad People:creepy,stalker\"\n"+
+		"folder_color:\n  Bad People: \"#F44336\"\n"+
+		"move_blocked: true\n"+
+		"concurrency: 3\n"+
+		"note_mode: overwrite\n")
+
+	// The config supplies the flags that aren't given
+	var program Options
+	_, err = program.Parse([]string{"--config", configPath, "obsidian", "sync"})
+	assert.NoError(t, err)
+	sync := &program.Obsidian.Sync.Run
+	assert.Equal(t, tempVault, program.Obsidian.Vault)
+	assert.Equal(t, []string{dataPath}, sync.DataDir)
+	assert.Equal(t, []string{"People", "Bad People:creepy,stalker"}, sync.CreatePeopleIn)
+	assert.Equal(t, map[string]string{"Bad People": "#F44336"}, sync.FolderColor)
+	assert.True(t, sync.MoveBlocked)
+	assert.Equal(t, 3, sync.Concurrency)
+	assert.Equal(t, "overwrite", sync.NoteMode)
+	assert.Equal(t, []string{"Bad People"}, sync.CreateBlockedIn, "flags missing from the config keep their default")
+
+	// Flags win over the config
+	program = Options{}
+	_, err = program.Parse([]string{"--config", configPath, "obsidian", "sync",
+		"--create-people-in", "Friends", "--note-mode", "append", "--concurrency", "1"})
+	assert.NoError(t, err)
+	sync = &program.Obsidian.Sync.Run
+	assert.Equal(t, []string{"Friends"}, sync.CreatePeopleIn)
+	assert.Equal(t, "append", sync.NoteMode)
+	assert.Equal(t, 1, sync.Concurrency)
+	assert.Equal(t, []string{dataPath}, sync.DataDir)
+}
+
+func TestOptions_ConfigInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		err    string
+	}{
+		{name: "unknown key", config: "data-directory: /tmp\n", err: `unknown key "data-directory"`},
+		{name: "invalid value", config: "note_mode: sometimes\n", err: "must be one of"},
+		{name: "not a map", config: "- vault\n", err: "invalid config"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			writeTestFile(t, configPath, tt.config)
+			dataPath, err := filepath.Abs("../example/test-data")
+			assert.NoError(t, err)
+
+			tempVault := t.TempDir()
+			assert.NoError(t, os.Mkdir(filepath.Join(tempVault, ".obsidian"), 0755))
+
+			var program Options
+			_, err = program.Parse([]string{"--config", configPath, "obsidian", "--vault", tempVault, "sync",
+				"--data-dir", dataPath})
+			assert.ErrorContains(t, err, tt.err)
+		})
+	}
+}
+
+func TestConfigInitCmd(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fetlife-data-tools.yaml")
+	cmd := &ConfigInitCmd{Path: path}
+	assert.NoError(t, cmd.Run())
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, exampleConfig, string(content))
+
+	// An existing file is only overwritten with --force
+	writeTestFile(t, path, "vault: .\n")
+	assert.ErrorContains(t, cmd.Run(), "already exists")
+	cmd.Force = true
+	assert.NoError(t, cmd.Run())
+
+	// The example parses, with every setting commented out
+	var program Options
+	_, err = program.Parse([]string{"--config", path, "version"})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,147 @@
+package program
+
+import (
+	"errors"
+	"os"
+
+	"github.com/rs/zerolog/log"
+	"github.com/woodysmith1912/fetlife-data-tools/fetlife"
+)
+
+// primaryDataDir is the first --data-dir, which the sync state file is kept next to
+func (sync *SyncCmd) primaryDataDir() string {
+	if len(sync.DataDir) == 0 {
+		return ""
+	}
+	return sync.DataDir[0]
+}
+
+// orderDataDirs dates every --data-dir with fetlife.OrderExports when there are several, so the newest export wins
+// the merges whatever order the flags are given in
+func (sync *SyncCmd) orderDataDirs(options []fetlife.ReadOption) error {
+	sync.dataDirOrder = nil
+	if len(sync.DataDir) < 2 {
+		return nil
+	}
+	order, err := fetlife.OrderExports(sync.DataDir, options...)
+	if err != nil {
+		return err
+	}
+	sync.dataDirOrder = order
+	log.Debug().Strs("dataDirs", orderedDataDirs(sync.DataDir, order)).Msg("Ordered data directories from the oldest to the newest")
+	return nil
+}
+
+// orderedDataDirs returns dataDirs in order, or as they are without an order
+func orderedDataDirs(dataDirs []string, order []int) []string {
+	if order == nil {
+		return dataDirs
+	}
+	ordered := make([]string, len(order))
+	for i, index := range order {
+		ordered[i] = dataDirs[index]
+	}
+	return ordered
+}
+
+// readDataDirs reads a data file from every --data-dir with readExports, adding the records kept from each directory
+// to the summary when there are several
+func readDataDirs[T any](sync *SyncCmd, read func(string, ...fetlife.ReadOption) ([]T, error), options []fetlife.ReadOption, merge func(...[]T) ([]T, []int)) ([]T, error) {
+	merged, counts, err := readExports(sync.DataDir, sync.dataDirOrder, read, options, merge)
+	if err != nil {
+		return nil, err
+	}
+	if len(sync.DataDir) > 1 {
+		if sync.summary.DataDirRecords == nil {
+			sync.summary.DataDirRecords = make([]int, len(sync.DataDir))
+		}
+		for i, count := range counts {
+			sync.summary.DataDirRecords[i] += count
+		}
+	}
+	return merged, nil
+}
+
+// readExports reads a data file from every directory of dataDirs with read, in order from the oldest to the newest
+// export, and merges their records with merge.  counts holds the records kept from each directory of dataDirs.  With
+// several directories, a file that only some of them have is read and merged from those, so the newest export with
+// the file wins.
+func readExports[T any](dataDirs []string, order []int, read func(string, ...fetlife.ReadOption) ([]T, error), options []fetlife.ReadOption, merge func(...[]T) ([]T, []int)) (merged []T, counts []int, err error) {
+	if order == nil {
+		order = make([]int, len(dataDirs))
+		for i := range order {
+			order[i] = i
+		}
+	}
+
+	exports := make([][]T, 0, len(dataDirs))
+	var found []int
+	var missing error
+	for _, i := range order {
+		records, err := read(dataDirs[i], options...)
+		if errors.Is(err, os.ErrNotExist) && len(dataDirs) > 1 {
+			log.Debug().Err(err).Str("dataDir", dataDirs[i]).Msg("Data file missing from data directory")
+			missing = err
+			continue
+		} else if err != nil {
+			return nil, nil, err
+		}
+		exports = append(exports, records)
+		found = append(found, i)
+	}
+	if len(found) == 0 && missing != nil {
+		return nil, nil, missing
+	}
+
+	merged, kept := merge(exports...)
+	counts = make([]int, len(dataDirs))
+	for i, count := range kept {
+		counts[found[i]] = count
+	}
+	return merged, counts, nil
+}
+
+// recordsByDataDir returns the number of records taken from each --data-dir, for the summary and the report
+func (sync *SyncCmd) recordsByDataDir() map[string]int {
+	records := make(map[string]int, len(sync.DataDir))
+	for i, dataDir := range sync.DataDir {
+		count := 0
+		if i < len(sync.summary.DataDirRecords) {
+			count = sync.summary.DataDirRecords[i]
+		}
+		records[dataDir] += count
+	}
+	return records
+}
+
+// readAllPrivateNotes reads and merges private_notes.txt of every --data-dir without filtering it, for routing blocked
+// users by their notes when the notes read for syncing are missing some.  A missing file has no notes.
+func (sync *SyncCmd) readAllPrivateNotes(options []fetlife.ReadOption) ([]fetlife.PrivateNoteRecord, error) {
+	read := func(dataDir string, options ...fetlife.ReadOption) ([]fetlife.PrivateNoteRecord, error) {
+		notes, err := fetlife.ReadPrivateNotes(dataDir, options...)
+		if errors.Is(err, os.ErrNotExist) {
+			log.Debug().Err(err).Str("dataDir", dataDir).Msg("No private notes to route blocked users by")
+			return nil, nil
+		}
+		return notes, err
+	}
+	merged, _, err := readExports(sync.DataDir, sync.dataDirOrder, read, options, fetlife.MergePrivateNotes)
+	return merged, err
+}
+
+// notesByUser maps each user ID to the user's private notes, one per line
+func notesByUser(privateNotes []fetlife.PrivateNoteRecord) map[string]string {
+	notes := make(map[string]string)
+	for _, note := range privateNotes {
+		addNote(notes, note)
+	}
+	return notes
+}
+
+// addNote adds a private note to the notes of its user in notes, on a line of its own
+func addNote(notes map[string]string, note fetlife.PrivateNoteRecord) {
+	if notes[note.MemberID] != "" {
+		notes[note.MemberID] += "\n"
+	}
+	notes[note.MemberID] += note.PrivateNote
+}
@@ -0,0 +1,94 @@
+package program
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncCmd_MultipleDataDirs(t *testing.T) {
+	tempVault := t.TempDir()
+	older := writeTestData(t,
+		"11111,2024-01-01,2024-01-01,Dave\n",
+		"33333,2024-01-01,2024-01-01,Old note\n44444,2024-01-01,2024-01-01,Only in the older export\n")
+	newer := writeTestData(t,
+		"22222,2024-02-01,2024-02-01,Erin\n",
+		"33333,2024-01-01,2024-03-01,New note\n")
+
+	sync := &SyncCmd{
+		DataDir:         []string{older, newer},
+		CreatePeopleIn:  []string{"People"},
+		CreateBlockedIn: []string{"Bad People"},
+		StateFile:       filepath.Join(t.TempDir(), "state.json"),
+		NoCache:         true,
+	}
+	assert.NoError(t, sync.Run(loadTestVault(t, tempVault)))
+
+	assert.Equal(t, 3, sync.summary.Created)
+	assert.Equal(t, []int{1, 2}, sync.summary.DataDirRecords)
+	assert.Equal(t, map[string]int{older: 1, newer: 2}, sync.recordsByDataDir())
+
+	// Dave was unblocked since the older export, so only Erin is blocked
+	assert.FileExists(t, filepath.Join(tempVault, "Bad People", "Erin.md"))
+	assert.NoFileExists(t, filepath.Join(tempVault, "Bad People", "Dave.md"))
+
+	content, err := os.ReadFile(filepath.Join(tempVault, "People", "user-33333.md"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "New note", "the note of the newest export wins")
+	assert.NotContains(t, string(content), "Old note")
+	content, err = os.ReadFile(filepath.Join(tempVault, "People", "user-44444.md"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "Only in the older export")
+}
+
+func TestSyncCmd_MultipleDataDirsNewestFirst(t *testing.T) {
+	tempVault := t.TempDir()
+	older := writeTestData(t,
+		"11111,2024-01-01,2024-01-01,Dave\n",
+		"33333,2024-01-01,2024-01-01,Old note\n")
+	newer := writeTestData(t,
+		"22222,2024-02-01,2024-02-01,Erin\n",
+		"33333,2024-01-01,2024-03-01,New note\n")
+
+	// The exports are dated by their records, so the newer one wins when it's given first
+	sync := &SyncCmd{
+		DataDir:         []string{newer, older},
+		CreatePeopleIn:  []string{"People"},
+		CreateBlockedIn: []string{"Bad People"},
+		StateFile:       filepath.Join(t.TempDir(), "state.json"),
+		NoCache:         true,
+	}
+	assert.NoError(t, sync.Run(loadTestVault(t, tempVault)))
+	assert.Equal(t, []int{2, 0}, sync.summary.DataDirRecords)
+
+	assert.FileExists(t, filepath.Join(tempVault, "Bad People", "Erin.md"))
+	assert.NoFileExists(t, filepath.Join(tempVault, "Bad People", "Dave.md"))
+	content, err := os.ReadFile(filepath.Join(tempVault, "People", "user-33333.md"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "New note")
+	assert.NotContains(t, string(content), "Old note")
+}
+
+func TestSyncCmd_MultipleDataDirsMissingFile(t *testing.T) {
+	first := writeTestData(t, "11111,2024-01-01,2024-01-01,Dave\n", "33333,2024-01-01,2024-01-01,Met at a munch\n")
+	second := writeTestData(t, "22222,2024-01-01,2024-01-01,Erin\n", "")
+	assert.NoError(t, os.Remove(filepath.Join(second, "private_notes.txt")))
+
+	// A file only one of the exports has is read from that one, the others from the newest export
+	sync := &SyncCmd{
+		DataDir:         []string{first, second},
+		CreatePeopleIn:  []string{"People"},
+		CreateBlockedIn: []string{"Bad People"},
+		StateFile:       filepath.Join(t.TempDir(), "state.json"),
+		NoCache:         true,
+	}
+	assert.NoError(t, sync.Run(loadTestVault(t, t.TempDir())))
+	assert.Equal(t, 2, sync.summary.Created)
+	assert.Equal(t, []int{1, 1}, sync.summary.DataDirRecords)
+
+	// A file none of them has is still an error
+	assert.NoError(t, os.Remove(filepath.Join(first, "private_notes.txt")))
+	assert.ErrorIs(t, sync.Run(loadTestVault(t, t.TempDir())), os.ErrNotExist)
+}
@@ -0,0 +1,167 @@
+package program
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/woodysmith1912/fetlife-data-tools/obsidian"
+)
+
+type ExportCmd struct {
+	Output string   `help:"File to write the pages to, - for standard output" default:"-" type:"path" placeholder:"PATH"`
+	Format string   `help:"Output format: csv, json or jsonl" enum:"csv,json,jsonl" default:"csv"`
+	Folder string   `help:"Only export the pages of this folder"`
+	Tag    []string `help:"Only export pages with this tag.  Can be repeated to export pages with any of the tags"`
+}
+
+// ExportedPage is a page as written by obsidian export
+type ExportedPage struct {
+	Title         string   `json:"title"`
+	Folder        string   `json:"folder"`
+	Tags          []string `json:"tags"`
+	URL           string   `json:"url"`
+	Aliases       []string `json:"aliases"`
+	WebBadgeColor string   `json:"webBadgeColor"`
+	WebMessage    string   `json:"webMessage"`
+	// FilePath is the path of the page relative to the vault
+	FilePath string `json:"filePath"`
+}
+
+// exportListSeparator joins the tags and aliases of a page in a CSV cell
+const exportListSeparator = ", "
+
+// Run writes the pages of the vault, the inverse of sync
+func (export *ExportCmd) Run(vault *obsidian.Vault) error {
+	pages := export.pages(vault)
+
+	out := io.Writer(os.Stdout)
+	var file *os.File
+	if export.Output != "-" {
+		var err error
+		if file, err = os.Create(export.Output); err != nil {
+			return err
+		}
+		out = file
+	}
+
+	var err error
+	switch export.Format {
+	case "json":
+		err = export.writeJSON(out, pages)
+	case "jsonl":
+		err = export.writeJSONL(out, pages)
+	default:
+		err = export.writeCSV(out, pages)
+	}
+	// A failed Close can mean the export never fully reached the disk, so its error is returned like a failed write
+	if file != nil {
+		if err != nil {
+			file.Close()
+		} else {
+			err = file.Close()
+		}
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to export pages")
+		return err
+	}
+
+	if export.Output != "-" {
+		log.Info().
+			Str("path", export.Output).
+			Str("format", export.Format).
+			Int("pageCount", len(pages)).
+			Msg("Exported pages")
+	}
+	return nil
+}
+
+// pages returns the pages to export, those in --folder with any of the --tag tags, sorted by path
+func (export *ExportCmd) pages(vault *obsidian.Vault) []ExportedPage {
+	filtered := vault.FilterPages(func(page *obsidian.Page) bool {
+		if export.Folder != "" && page.Folder != filepath.Clean(export.Folder) {
+			return false
+		}
+		return len(export.Tag) == 0 || slices.ContainsFunc(export.Tag, page.HasTag)
+	})
+
+	pages := make([]ExportedPage, 0, len(filtered))
+	for _, page := range filtered {
+		pages = append(pages, ExportedPage{
+			Title:         page.Title,
+			Folder:        page.Folder,
+			Tags:          append([]string{}, page.Tags...),
+			URL:           page.Url,
+			Aliases:       append([]string{}, page.Aliases...),
+			WebBadgeColor: string(page.WebBadgeColor),
+			WebMessage:    page.WebMessage,
+			FilePath:      pageFile(page),
+		})
+	}
+	slices.SortFunc(pages, func(a, b ExportedPage) int { return strings.Compare(a.FilePath, b.FilePath) })
+	return pages
+}
+
+// writeCSV writes the pages as CSV with a header row, joining tags and aliases with exportListSeparator
+func (export *ExportCmd) writeCSV(out io.Writer, pages []ExportedPage) error {
+	writer := csv.NewWriter(out)
+
+	// Write header
+	header := []string{
+		"Title",
+		"Folder",
+		"Tags",
+		"URL",
+		"Aliases",
+		"Web Badge Color",
+		"Web Message",
+		"File Path",
+	}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	// Write data
+	for _, page := range pages {
+		record := []string{
+			page.Title,
+			page.Folder,
+			strings.Join(page.Tags, exportListSeparator),
+			page.URL,
+			strings.Join(page.Aliases, exportListSeparator),
+			page.WebBadgeColor,
+			page.WebMessage,
+			page.FilePath,
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// writeJSON writes the pages as an indented JSON array
+func (export *ExportCmd) writeJSON(out io.Writer, pages []ExportedPage) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(pages)
+}
+
+// writeJSONL writes the pages as JSON Lines, one page per line
+func (export *ExportCmd) writeJSONL(out io.Writer, pages []ExportedPage) error {
+	encoder := json.NewEncoder(out)
+	for _, page := range pages {
+		if err := encoder.Encode(page); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package program
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zenizh/go-capturer"
+)
+
+func TestExportCmd_CSV(t *testing.T) {
+	vaultPath, err := filepath.Abs("../example/vault")
+	if err != nil {
+		t.Fatalf("Failed to get vault path: %v", err)
+	}
+	output := filepath.Join(t.TempDir(), "people.csv")
+
+	var program Options
+	ctx, err := program.Parse([]string{"obsidian", "--vault", vaultPath, "export", "--folder", "People", "--output", output})
+	assert.NoError(t, err)
+	assert.NoError(t, ctx.Run(&program))
+
+	file, err := os.Open(output)
+	assert.NoError(t, err)
+	defer file.Close()
+	records, err := csv.NewReader(file).ReadAll()
+	assert.NoError(t, err)
+
+	if assert.Len(t, records, 6, "a header and the 5 pages in People") {
+		assert.Equal(t, []string{"Title", "Folder", "Tags", "URL", "Aliases", "Web Badge Color", "Web Message", "File Path"}, records[0])
+		assert.Equal(t, []string{
+			"Alice",
+			"People",
+			"person, friend",
+			"https://fetlife.com/users/12345",
+			"Ally, A-Train",
+			"#4CAF50",
+			"This is Alice's profile!",
+			"People/Alice.md",
+		}, records[1])
+	}
+}
+
+func TestExportCmd_JSON(t *testing.T) {
+	vaultPath, err := filepath.Abs("../example/vault")
+	if err != nil {
+		t.Fatalf("Failed to get vault path: %v", err)
+	}
+
+	var program Options
+	ctx, err := program.Parse([]string{"obsidian", "--vault", vaultPath, "--quiet", "export", "--format", "json", "--tag", "blocked"})
+	assert.NoError(t, err)
+
+	out := capturer.CaptureStdout(func() {
+		assert.NoError(t, ctx.Run(&program))
+	})
+
+	var pages []ExportedPage
+	assert.NoError(t, json.Unmarshal([]byte(out), &pages))
+	assert.Len(t, pages, 5)
+	for _, page := range pages {
+		assert.Equal(t, "Bad People", page.Folder)
+		assert.Contains(t, page.Tags, "blocked")
+	}
+}
+
+func TestExportCmd_JSONL(t *testing.T) {
+	vaultPath, err := filepath.Abs("../example/vault")
+	if err != nil {
+		t.Fatalf("Failed to get vault path: %v", err)
+	}
+	output := filepath.Join(t.TempDir(), "people.jsonl")
+
+	var program Options
+	ctx, err := program.Parse([]string{"obsidian", "--vault", vaultPath, "export", "--format", "jsonl", "--output", output})
+	assert.NoError(t, err)
+	assert.NoError(t, ctx.Run(&program))
+
+	data, err := os.ReadFile(output)
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	assert.Len(t, lines, 16, "every page of the vault")
+
+	var page ExportedPage
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &page))
+	assert.Equal(t, "About.md", page.FilePath)
+}
@@ -1,10 +1,18 @@
 package program
 
 import (
+	"cmp"
 	"encoding/csv"
+	"encoding/json"
 	"fmt"
+	"html/template"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/rs/zerolog/log"
 	"github.com/woodysmith1912/fetlife-data-tools/fetlife"
@@ -12,52 +20,101 @@ import (
 )
 
 type GenerateCmd struct {
-	DataDir   string `help:"Path to data directory containing blockeds.txt and private_notes.txt" env:"DATA_DIR" type:"existingdir" required:"true"`
-	OutputDir string `help:"Path to output directory for generated spreadsheets" default:"." type:"existingdir"`
-	Basename  string `help:"Base name for output files (without extension)" default:"fetlife-export"`
-	Format    string `help:"Output format: csv, xlsx, or both" enum:"csv,xlsx,both" default:"csv"`
+	DataDir   []string `help:"Path to data directory containing blockeds.txt and private_notes.txt, or to the zip archive of the export.  Repeat it to merge several exports, the export with the newest records winning" env:"DATA_DIR" type:"path" required:"true" sep:"none"`
+	OutputDir string   `help:"Path to output directory for generated spreadsheets" default:"." type:"existingdir"`
+	Basename  string   `help:"Base name for output files (without extension)" default:"fetlife-export"`
+	Format    []string `help:"Output formats, comma separated: csv, xlsx, both (csv and xlsx), json, jsonl, or html" enum:"csv,xlsx,both,json,jsonl,html" default:"csv"`
+	Since     string   `help:"Only include users blocked or noted on or after this date (YYYY-MM-DD)"`
+	Until     string   `help:"Only include users blocked or noted on or before this date (YYYY-MM-DD)"`
+	Sort      string   `help:"Order rows by user-id, nickname, blocked-at or note-created" enum:"user-id,nickname,blocked-at,note-created" default:"user-id"`
+	SortDesc  bool     `help:"Sort rows in descending order"`
+	Lenient   bool     `help:"Read data files whose header row doesn't have the expected column names"`
 }
 
+// dateLayout is the layout of the --since and --until dates, and of the date that starts FetLife timestamps
+const dateLayout = "2006-01-02"
+
 // MergedUser represents combined data from blocked users and private notes
 type MergedUser struct {
-	UserID      string
-	Nickname    string
-	URL         string
-	Blocked     bool
-	BlockedAt   string
-	PrivateNote string
-	NoteCreated string
-	NoteUpdated string
+	UserID      string `json:"userID"`
+	Nickname    string `json:"nickname"`
+	URL         string `json:"url"`
+	Blocked     bool   `json:"blocked"`
+	BlockedAt   string `json:"blockedAt"`
+	PrivateNote string `json:"privateNote"`
+	NoteCreated string `json:"noteCreated"`
+	NoteUpdated string `json:"noteUpdated"`
+}
+
+// readOptions returns the options for reading the data files
+func (generate *GenerateCmd) readOptions() []fetlife.ReadOption {
+	if generate.Lenient {
+		return []fetlife.ReadOption{fetlife.Lenient()}
+	}
+	return nil
 }
 
 // Run generates CSV and XLSX spreadsheets from FetLife data
 func (generate *GenerateCmd) Run(options *Options) error {
 	log.Info().
-		Str("dataDir", generate.DataDir).
+		Strs("dataDir", generate.DataDir).
 		Str("outputDir", generate.OutputDir).
 		Msg("Starting spreadsheet generation")
 
+	// Several exports are merged from the oldest to the newest, like sync does
+	var order []int
+	if len(generate.DataDir) > 1 {
+		var err error
+		if order, err = fetlife.OrderExports(generate.DataDir, generate.readOptions()...); err != nil {
+			log.Error().Err(err).Msg("Failed to read data directories")
+			return err
+		}
+	}
+
 	// Read FetLife data
-	blockeds, err := fetlife.ReadBlockeds(generate.DataDir)
+	blockeds, blockedCounts, err := readExports(generate.DataDir, order, fetlife.ReadBlockeds, generate.readOptions(), fetlife.MergeBlockeds)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to read blockeds.txt")
 		return err
 	}
 	log.Info().Int("blockedCount", len(blockeds)).Msg("Loaded blocked users")
 
-	privateNotes, err := fetlife.ReadPrivateNotes(generate.DataDir)
+	privateNotes, noteCounts, err := readExports(generate.DataDir, order, fetlife.ReadPrivateNotes, generate.readOptions(), fetlife.MergePrivateNotes)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to read private_notes.txt")
 		return err
 	}
 	log.Info().Int("privateNoteCount", len(privateNotes)).Msg("Loaded private notes")
 
+	if len(generate.DataDir) > 1 {
+		for i, dataDir := range generate.DataDir {
+			log.Info().Str("dataDir", dataDir).Int("records", blockedCounts[i]+noteCounts[i]).Msg("Records taken from data directory")
+		}
+	}
+
 	// Merge data by user ID
 	merged := mergeUserData(blockeds, privateNotes)
 	log.Info().Int("totalUsers", len(merged)).Msg("Merged user data")
 
+	// Keep the users in the date range
+	since, until, err := generate.dateRange()
+	if err != nil {
+		return err
+	}
+	if !since.IsZero() || !until.IsZero() {
+		merged = filterByDate(merged, since, until)
+		log.Info().
+			Str("since", generate.Since).
+			Str("until", generate.Until).
+			Int("userCount", len(merged)).
+			Msg("Filtered users by date")
+	}
+
+	// Sort so consecutive exports can be diffed
+	merged = generate.sortUsers(merged)
+
 	// Generate CSV if requested
-	if generate.Format == "csv" || generate.Format == "both" {
+	if generate.wants("csv") {
 		csvPath := filepath.Join(generate.OutputDir, generate.Basename+".csv")
 		if err := generate.writeCSV(csvPath, merged); err != nil {
 			log.Error().Err(err).Msg("Failed to write CSV")
@@ -67,7 +124,7 @@ func (generate *GenerateCmd) Run(options *Options) error {
 	}
 
 	// Generate XLSX if requested
-	if generate.Format == "xlsx" || generate.Format == "both" {
+	if generate.wants("xlsx") {
 		xlsxPath := filepath.Join(generate.OutputDir, generate.Basename+".xlsx")
 		if err := generate.writeXLSX(xlsxPath, merged); err != nil {
 			log.Error().Err(err).Msg("Failed to write XLSX")
@@ -76,10 +133,251 @@ func (generate *GenerateCmd) Run(options *Options) error {
 		log.Info().Str("path", xlsxPath).Msg("Generated XLSX file")
 	}
 
+	// Generate JSON if requested
+	if generate.wants("json") {
+		jsonPath := filepath.Join(generate.OutputDir, generate.Basename+".json")
+		if err := generate.writeJSON(jsonPath, merged); err != nil {
+			log.Error().Err(err).Msg("Failed to write JSON")
+			return err
+		}
+		log.Info().Str("path", jsonPath).Msg("Generated JSON file")
+	}
+
+	// Generate JSON Lines if requested
+	if generate.wants("jsonl") {
+		jsonlPath := filepath.Join(generate.OutputDir, generate.Basename+".jsonl")
+		if err := generate.writeJSONL(jsonlPath, merged); err != nil {
+			log.Error().Err(err).Msg("Failed to write JSONL")
+			return err
+		}
+		log.Info().Str("path", jsonlPath).Msg("Generated JSONL file")
+	}
+
+	// Generate HTML if requested
+	if generate.wants("html") {
+		htmlPath := filepath.Join(generate.OutputDir, generate.Basename+".html")
+		if err := generate.writeHTML(htmlPath, merged); err != nil {
+			log.Error().Err(err).Msg("Failed to write HTML")
+			return err
+		}
+		log.Info().Str("path", htmlPath).Msg("Generated HTML file")
+	}
+
 	log.Info().Msg("Spreadsheet generation completed successfully")
 	return nil
 }
 
+// wants reports whether format is one of the requested output formats.  "both" stands for csv and xlsx.
+func (generate *GenerateCmd) wants(format string) bool {
+	if slices.Contains(generate.Format, format) {
+		return true
+	}
+	return (format == "csv" || format == "xlsx") && slices.Contains(generate.Format, "both")
+}
+
+// Validate checks the --since and --until dates
+func (generate *GenerateCmd) Validate() error {
+	for _, dataDir := range generate.DataDir {
+		if err := validateDataDir(dataDir); err != nil {
+			return err
+		}
+	}
+	_, _, err := generate.dateRange()
+	return err
+}
+
+// The fill colors of highlighted rows in Excel output
+const (
+	blockedRowColor = "#FFC7CE"
+	noteRowColor    = "#FFF2CC"
+)
+
+// highlightRows adds conditional formats to the data rows in rangeRef, light red for blocked users and light yellow
+// for other users with a private note
+func highlightRows(f *excelize.File, sheetName, rangeRef string) error {
+	blocked, err := f.NewConditionalStyle(&excelize.Style{
+		Fill: excelize.Fill{Type: "pattern", Color: []string{blockedRowColor}, Pattern: 1},
+	})
+	if err != nil {
+		return err
+	}
+	noted, err := f.NewConditionalStyle(&excelize.Style{
+		Fill: excelize.Fill{Type: "pattern", Color: []string{noteRowColor}, Pattern: 1},
+	})
+	if err != nil {
+		return err
+	}
+
+	return f.SetConditionalFormat(sheetName, rangeRef, []excelize.ConditionalFormatOptions{
+		{Type: "formula", Criteria: `$D2="Yes"`, Format: &blocked},
+		{Type: "formula", Criteria: `AND($D2<>"Yes",$F2<>"")`, Format: &noted},
+	})
+}
+
+// writeLegend adds a sheet explaining the row colors of the data sheet
+func writeLegend(f *excelize.File) error {
+	sheetName := "Legend"
+	if _, err := f.NewSheet(sheetName); err != nil {
+		return err
+	}
+	f.SetColWidth(sheetName, "A", "A", 40)
+
+	for i, entry := range []struct {
+		color       string
+		description string
+	}{
+		{blockedRowColor, "Blocked user"},
+		{noteRowColor, "User with a private note"},
+	} {
+		cell := fmt.Sprintf("A%d", i+1)
+		style, err := f.NewStyle(&excelize.Style{
+			Fill: excelize.Fill{Type: "pattern", Color: []string{entry.color}, Pattern: 1},
+		})
+		if err != nil {
+			return err
+		}
+		f.SetCellValue(sheetName, cell, entry.description)
+		f.SetCellStyle(sheetName, cell, cell, style)
+	}
+	return nil
+}
+
+// summarySheetName is the name of the sheet with the counts of the users in Excel output
+const summarySheetName = "Summary"
+
+// writeSummarySheet adds a sheet counting the users by whether they're blocked and have a private note, with the time
+// the file was generated
+func writeSummarySheet(f *excelize.File, users []MergedUser) error {
+	if _, err := f.NewSheet(summarySheetName); err != nil {
+		return err
+	}
+
+	var blocked, noted, both int
+	for _, user := range users {
+		hasNote := user.PrivateNote != ""
+		if user.Blocked {
+			blocked++
+		}
+		if hasNote {
+			noted++
+		}
+		if user.Blocked && hasNote {
+			both++
+		}
+	}
+
+	headerStyle, err := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		return err
+	}
+	numberStyle, err := f.NewStyle(&excelize.Style{NumFmt: 3}) // #,##0
+	if err != nil {
+		return err
+	}
+	timeFormat := "yyyy-mm-dd hh:mm:ss"
+	timeStyle, err := f.NewStyle(&excelize.Style{CustomNumFmt: &timeFormat})
+	if err != nil {
+		return err
+	}
+	f.SetColWidth(summarySheetName, "A", "A", 28)
+	f.SetColWidth(summarySheetName, "B", "B", 20)
+
+	rows := []struct {
+		label string
+		value any
+		style int
+	}{
+		{"Generated", time.Now(), timeStyle},
+		{"", nil, 0},
+		{"Total users", len(users), numberStyle},
+		{"Blocked users", blocked, numberStyle},
+		{"Users with private notes", noted, numberStyle},
+		{"Blocked users with notes", both, numberStyle},
+		{"", nil, 0},
+		{"Category", "Users", headerStyle},
+		{"Blocked, no note", blocked - both, numberStyle},
+		{"Private note only", noted - both, numberStyle},
+		{"Blocked with a note", both, numberStyle},
+		{"Neither", len(users) - blocked - noted + both, numberStyle},
+	}
+	for i, row := range rows {
+		if row.label == "" {
+			continue
+		}
+		label := fmt.Sprintf("A%d", i+1)
+		value := fmt.Sprintf("B%d", i+1)
+		f.SetCellValue(summarySheetName, label, row.label)
+		f.SetCellValue(summarySheetName, value, row.value)
+		if row.style == headerStyle {
+			f.SetCellStyle(summarySheetName, label, value, headerStyle)
+			continue
+		}
+		f.SetCellStyle(summarySheetName, label, label, headerStyle)
+		f.SetCellStyle(summarySheetName, value, value, row.style)
+	}
+	return nil
+}
+
+// validateDataDir checks that --data-dir is a directory or the zip archive of an export
+func validateDataDir(dataDir string) error {
+	if dataDir == "" {
+		return nil
+	}
+	info, err := os.Stat(dataDir)
+	if err != nil {
+		return fmt.Errorf("--data-dir: %w", err)
+	}
+	if !info.IsDir() && !fetlife.IsArchive(dataDir) {
+		return fmt.Errorf("--data-dir %s is neither a directory nor a .zip file", dataDir)
+	}
+	return nil
+}
+
+// dateRange parses the --since and --until dates.  A date that isn't given is returned as the zero time.
+func (generate *GenerateCmd) dateRange() (since, until time.Time, err error) {
+	if generate.Since != "" {
+		if since, err = time.Parse(dateLayout, generate.Since); err != nil {
+			return since, until, fmt.Errorf("invalid --since date %q, expected YYYY-MM-DD: %w", generate.Since, err)
+		}
+	}
+	if generate.Until != "" {
+		if until, err = time.Parse(dateLayout, generate.Until); err != nil {
+			return since, until, fmt.Errorf("invalid --until date %q, expected YYYY-MM-DD: %w", generate.Until, err)
+		}
+	}
+	return since, until, nil
+}
+
+// filterByDate returns the users whose BlockedAt or NoteCreated date falls within since and until, both inclusive.
+// A zero since or until leaves that end of the range open.
+func filterByDate(users []MergedUser, since, until time.Time) []MergedUser {
+	inRange := func(timestamp string) bool {
+		date, ok := parseRecordDate(timestamp)
+		if !ok {
+			return false
+		}
+		return (since.IsZero() || !date.Before(since)) && (until.IsZero() || !date.After(until))
+	}
+
+	var result []MergedUser
+	for _, user := range users {
+		if inRange(user.BlockedAt) || inRange(user.NoteCreated) {
+			result = append(result, user)
+		}
+	}
+	return result
+}
+
+// parseRecordDate returns the date a FetLife timestamp like "2023-02-15 14:22:10 UTC" falls on
+func parseRecordDate(timestamp string) (time.Time, bool) {
+	timestamp = strings.TrimSpace(timestamp)
+	if len(timestamp) < len(dateLayout) {
+		return time.Time{}, false
+	}
+	date, err := time.Parse(dateLayout, timestamp[:len(dateLayout)])
+	return date, err == nil
+}
+
 // mergeUserData combines blocked users and private notes into a single dataset
 func mergeUserData(blockeds []fetlife.BlockedRecord, privateNotes []fetlife.PrivateNoteRecord) []MergedUser {
 	// Create a map to hold merged data
@@ -125,6 +423,50 @@ func mergeUserData(blockeds []fetlife.BlockedRecord, privateNotes []fetlife.Priv
 	return result
 }
 
+// sortUsers sorts users by --sort, reversed with --sort-desc
+func (generate *GenerateCmd) sortUsers(users []MergedUser) []MergedUser {
+	users = sortMergedUsers(users, generate.Sort)
+	if generate.SortDesc {
+		slices.Reverse(users)
+	}
+	return users
+}
+
+// sortMergedUsers sorts users by the given field in ascending order, breaking ties by user ID.  User IDs are
+// compared as numbers.
+func sortMergedUsers(users []MergedUser, field string) []MergedUser {
+	key := func(user MergedUser) string {
+		switch field {
+		case "nickname":
+			return strings.ToLower(user.Nickname)
+		case "blocked-at":
+			return user.BlockedAt
+		case "note-created":
+			return user.NoteCreated
+		default:
+			return ""
+		}
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		if a, b := key(users[i]), key(users[j]); a != b {
+			return a < b
+		}
+		return compareUserIDs(users[i].UserID, users[j].UserID) < 0
+	})
+	return users
+}
+
+// compareUserIDs compares numeric user IDs by value, falling back to comparing them as text
+func compareUserIDs(a, b string) int {
+	numA, errA := strconv.Atoi(a)
+	numB, errB := strconv.Atoi(b)
+	if errA == nil && errB == nil {
+		return cmp.Compare(numA, numB)
+	}
+	return strings.Compare(a, b)
+}
+
 // writeCSV writes merged user data to a CSV file
 func (generate *GenerateCmd) writeCSV(path string, users []MergedUser) error {
 	file, err := os.Create(path)
@@ -176,6 +518,73 @@ func (generate *GenerateCmd) writeCSV(path string, users []MergedUser) error {
 	return nil
 }
 
+// writeJSON writes merged user data to a JSON file holding an array of users
+func (generate *GenerateCmd) writeJSON(path string, users []MergedUser) error {
+	data, err := json.MarshalIndent(users, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// writeJSONL writes merged user data to a JSON Lines file, one user per line
+func (generate *GenerateCmd) writeJSONL(path string, users []MergedUser) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(file)
+	for _, user := range users {
+		if err := encoder.Encode(user); err != nil {
+			file.Close()
+			return err
+		}
+	}
+
+	return file.Close()
+}
+
+// htmlTemplate renders merged user data as a self-contained HTML page.  Rows of blocked users get the "blocked" class.
+var htmlTemplate = template.Must(template.New("html").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>FetLife Data</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+th { font-weight: bold; background: #e0e0e0; }
+tr.blocked { color: #c00; }
+</style>
+</head>
+<body>
+<table>
+<thead>
+<tr><th>User ID</th><th>Nickname</th><th>URL</th><th>Blocked</th><th>Blocked At</th><th>Private Note</th><th>Note Created</th><th>Note Updated</th></tr>
+</thead>
+<tbody>
+{{- range .}}
+<tr{{if .Blocked}} class="blocked"{{end}}><td>{{.UserID}}</td><td>{{.Nickname}}</td><td><a href="{{.URL}}">{{.URL}}</a></td><td>{{if .Blocked}}Yes{{else}}No{{end}}</td><td>{{.BlockedAt}}</td><td>{{.PrivateNote}}</td><td>{{.NoteCreated}}</td><td>{{.NoteUpdated}}</td></tr>
+{{- end}}
+</tbody>
+</table>
+</body>
+</html>
+`))
+
+// writeHTML writes merged user data to an HTML file with a single table
+func (generate *GenerateCmd) writeHTML(path string, users []MergedUser) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return htmlTemplate.Execute(file, users)
+}
+
 // writeXLSX writes merged user data to an Excel file
 func (generate *GenerateCmd) writeXLSX(path string, users []MergedUser) error {
 	f := excelize.NewFile()
@@ -185,6 +594,11 @@ func (generate *GenerateCmd) writeXLSX(path string, users []MergedUser) error {
 		}
 	}()
 
+	// The summary comes first, but the data sheet is the one that opens
+	if err := writeSummarySheet(f, users); err != nil {
+		return err
+	}
+
 	sheetName := "FetLife Data"
 	index, err := f.NewSheet(sheetName)
 	if err != nil {
@@ -208,6 +622,13 @@ func (generate *GenerateCmd) writeXLSX(path string, users []MergedUser) error {
 		f.SetCellStyle(sheetName, cell, cell, headerStyle)
 	}
 
+	linkStyle, err := f.NewStyle(&excelize.Style{
+		Font: &excelize.Font{Color: "#0563C1", Underline: "single"},
+	})
+	if err != nil {
+		return err
+	}
+
 	// Set column widths
 	f.SetColWidth(sheetName, "A", "A", 12) // User ID
 	f.SetColWidth(sheetName, "B", "B", 20) // Nickname
@@ -230,6 +651,13 @@ func (generate *GenerateCmd) writeXLSX(path string, users []MergedUser) error {
 		f.SetCellValue(sheetName, fmt.Sprintf("A%d", row), user.UserID)
 		f.SetCellValue(sheetName, fmt.Sprintf("B%d", row), user.Nickname)
 		f.SetCellValue(sheetName, fmt.Sprintf("C%d", row), user.URL)
+		if user.URL != "" {
+			cell := fmt.Sprintf("C%d", row)
+			if err := f.SetCellHyperLink(sheetName, cell, user.URL, "External"); err != nil {
+				return err
+			}
+			f.SetCellStyle(sheetName, cell, cell, linkStyle)
+		}
 		f.SetCellValue(sheetName, fmt.Sprintf("D%d", row), blocked)
 		f.SetCellValue(sheetName, fmt.Sprintf("E%d", row), user.BlockedAt)
 		f.SetCellValue(sheetName, fmt.Sprintf("F%d", row), user.PrivateNote)
@@ -237,6 +665,29 @@ func (generate *GenerateCmd) writeXLSX(path string, users []MergedUser) error {
 		f.SetCellValue(sheetName, fmt.Sprintf("H%d", row), user.NoteUpdated)
 	}
 
+	// Filter on every column and keep the header row in view while scrolling
+	lastCol, _ := excelize.ColumnNumberToName(len(headers))
+	if len(users) > 0 {
+		if err := highlightRows(f, sheetName, fmt.Sprintf("A2:%s%d", lastCol, len(users)+1)); err != nil {
+			return err
+		}
+	}
+	if err := f.AutoFilter(sheetName, fmt.Sprintf("A1:%s%d", lastCol, len(users)+1), nil); err != nil {
+		return err
+	}
+	if err := f.SetPanes(sheetName, &excelize.Panes{
+		Freeze:      true,
+		YSplit:      1,
+		TopLeftCell: "A2",
+		ActivePane:  "bottomLeft",
+	}); err != nil {
+		return err
+	}
+
+	if err := writeLegend(f); err != nil {
+		return err
+	}
+
 	// Delete default Sheet1 if it exists
 	f.DeleteSheet("Sheet1")
 
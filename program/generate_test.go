@@ -1,14 +1,20 @@
 package program
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/csv"
+	"encoding/json"
 	"os"
 	"path/filepath"
+	"slices"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/woodysmith1912/fetlife-data-tools/fetlife"
 	"github.com/xuri/excelize/v2"
+	"golang.org/x/net/html"
 )
 
 func TestMergeUserData(t *testing.T) {
@@ -123,6 +129,176 @@ func TestMergeUserData(t *testing.T) {
 	}
 }
 
+func TestFilterByDate(t *testing.T) {
+	users := []MergedUser{
+		{UserID: "1", BlockedAt: "2023-02-15 14:22:10 UTC"},
+		{UserID: "2", NoteCreated: "2024-01-15 10:30:00 UTC"},
+		{UserID: "3", BlockedAt: "2022-06-01 09:00:00 UTC", NoteCreated: "2024-03-01 12:00:00 UTC"},
+		{UserID: "4", BlockedAt: "2024-12-31"},
+		{UserID: "5"},
+	}
+	date := func(value string) time.Time {
+		parsed, err := time.Parse(dateLayout, value)
+		if err != nil {
+			t.Fatalf("Failed to parse %s: %v", value, err)
+		}
+		return parsed
+	}
+
+	tests := []struct {
+		name     string
+		since    time.Time
+		until    time.Time
+		expected []string
+	}{
+		{name: "no range", expected: []string{"1", "2", "3", "4"}},
+		{name: "since only", since: date("2024-01-01"), expected: []string{"2", "3", "4"}},
+		{name: "until only", until: date("2023-12-31"), expected: []string{"1", "3"}},
+		{name: "both ends", since: date("2023-01-01"), until: date("2024-01-31"), expected: []string{"1", "2"}},
+		{name: "inclusive on the day", since: date("2023-02-15"), until: date("2023-02-15"), expected: []string{"1"}},
+		{name: "blocked or noted in range", since: date("2024-02-01"), until: date("2024-03-31"), expected: []string{"3"}},
+		{name: "nothing in range", since: date("2025-01-01"), expected: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ids []string
+			for _, user := range filterByDate(users, tt.since, tt.until) {
+				ids = append(ids, user.UserID)
+			}
+			assert.Equal(t, tt.expected, ids)
+		})
+	}
+}
+
+func TestSortMergedUsers(t *testing.T) {
+	users := func() []MergedUser {
+		return []MergedUser{
+			{UserID: "456", Nickname: "bob", BlockedAt: "2024-03-01 10:00:00 UTC", NoteCreated: "2023-01-01 10:00:00 UTC"},
+			{UserID: "1000", Nickname: "Carol", NoteCreated: "2024-05-01 10:00:00 UTC"},
+			{UserID: "123", Nickname: "Alice", BlockedAt: "2023-12-01 10:00:00 UTC", NoteCreated: "2024-01-01 10:00:00 UTC"},
+			{UserID: "789", BlockedAt: "2024-01-15 10:00:00 UTC"},
+		}
+	}
+
+	tests := []struct {
+		field    string
+		expected []string
+	}{
+		{field: "user-id", expected: []string{"123", "456", "789", "1000"}},
+		{field: "nickname", expected: []string{"789", "123", "456", "1000"}},
+		{field: "blocked-at", expected: []string{"1000", "123", "789", "456"}},
+		{field: "note-created", expected: []string{"789", "456", "123", "1000"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			var ids []string
+			for _, user := range sortMergedUsers(users(), tt.field) {
+				ids = append(ids, user.UserID)
+			}
+			assert.Equal(t, tt.expected, ids)
+		})
+
+		t.Run(tt.field+" descending", func(t *testing.T) {
+			gen := &GenerateCmd{Sort: tt.field, SortDesc: true}
+			var ids []string
+			for _, user := range gen.sortUsers(users()) {
+				ids = append(ids, user.UserID)
+			}
+			expected := slices.Clone(tt.expected)
+			slices.Reverse(expected)
+			assert.Equal(t, expected, ids)
+		})
+	}
+}
+
+func TestGenerateCmd_DateRangeValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		since   string
+		until   string
+		wantErr bool
+	}{
+		{name: "no dates"},
+		{name: "valid dates", since: "2024-01-01", until: "2024-12-31"},
+		{name: "invalid since", since: "01/02/2024", wantErr: true},
+		{name: "invalid until", until: "2024-13-01", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gen := &GenerateCmd{Since: tt.since, Until: tt.until}
+			err := gen.Validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestGenerateCmd_Run_DateRange(t *testing.T) {
+	testDataDir := writeTestData(t,
+		"123,2023-02-15 14:22:10 UTC,2023-02-15 14:22:10 UTC,OldBlock\n456,2024-05-01 10:00:00 UTC,2024-05-01 10:00:00 UTC,NewBlock\n",
+		"789,2024-01-15 10:30:00 UTC,2024-01-15 10:30:00 UTC,Noted in January\n")
+	outputDir := t.TempDir()
+
+	gen := &GenerateCmd{
+		DataDir:   []string{testDataDir},
+		OutputDir: outputDir,
+		Basename:  "test-output",
+		Format:    []string{"json"},
+		Since:     "2024-01-01",
+	}
+	err := gen.Run(&Options{})
+	assert.NoError(t, err)
+
+	data, err := os.ReadFile(filepath.Join(outputDir, "test-output.json"))
+	assert.NoError(t, err)
+	var users []MergedUser
+	assert.NoError(t, json.Unmarshal(data, &users))
+
+	var ids []string
+	for _, user := range users {
+		ids = append(ids, user.UserID)
+	}
+	assert.ElementsMatch(t, []string{"456", "789"}, ids)
+}
+
+func TestGenerateCmd_Run_MultipleDataDirs(t *testing.T) {
+	older := writeTestData(t,
+		"123,2024-01-01,2024-01-01,Unblocked\n",
+		"789,2024-01-01,2024-01-01,Old note\n")
+	newer := writeTestData(t,
+		"456,2024-02-01,2024-02-01,Blocked\n",
+		"789,2024-01-01,2024-03-01,New note\n")
+	outputDir := t.TempDir()
+
+	// The newest export wins whatever order the directories are given in
+	gen := &GenerateCmd{
+		DataDir:   []string{newer, older},
+		OutputDir: outputDir,
+		Basename:  "test-output",
+		Format:    []string{"json"},
+		Sort:      "user-id",
+	}
+	err := gen.Run(&Options{})
+	assert.NoError(t, err)
+
+	data, err := os.ReadFile(filepath.Join(outputDir, "test-output.json"))
+	assert.NoError(t, err)
+	var users []MergedUser
+	assert.NoError(t, json.Unmarshal(data, &users))
+	if assert.Len(t, users, 2) {
+		assert.Equal(t, "456", users[0].UserID)
+		assert.True(t, users[0].Blocked)
+		assert.Equal(t, "789", users[1].UserID)
+		assert.Equal(t, "New note", users[1].PrivateNote)
+	}
+}
+
 func TestWriteCSV(t *testing.T) {
 	tempDir := t.TempDir()
 	csvPath := filepath.Join(tempDir, "test.csv")
@@ -238,6 +414,257 @@ func TestWriteXLSX(t *testing.T) {
 
 	note, _ := f.GetCellValue("FetLife Data", "F2")
 	assert.Equal(t, "Test note", note)
+
+	// URLs are clickable
+	link, target, err := f.GetCellHyperLink("FetLife Data", "C2")
+	assert.NoError(t, err)
+	assert.True(t, link)
+	assert.Equal(t, "https://fetlife.com/users/123", target)
+
+	// The auto-filter covers the headers and data
+	var filter string
+	for _, name := range f.GetDefinedName() {
+		if name.Name == "_xlnm._FilterDatabase" {
+			filter = name.RefersTo
+		}
+	}
+	assert.Equal(t, "'FetLife Data'!$A$1:$H$2", filter)
+
+	// Rows of blocked users are red, other rows with a note yellow
+	formats, err := f.GetConditionalFormats("FetLife Data")
+	assert.NoError(t, err)
+	rules := formats["A2:H2"]
+	if assert.Len(t, rules, 2) {
+		assert.Equal(t, "formula", rules[0].Type)
+		assert.Equal(t, `$D2="Yes"`, rules[0].Criteria)
+		assert.Equal(t, `AND($D2<>"Yes",$F2<>"")`, rules[1].Criteria)
+	}
+
+	// The legend explains the colors
+	assert.Contains(t, f.GetSheetList(), "Legend")
+	legend, _ := f.GetCellValue("Legend", "A1")
+	assert.Equal(t, "Blocked user", legend)
+
+	// The header row is frozen
+	panes, err := f.GetPanes("FetLife Data")
+	assert.NoError(t, err)
+	assert.True(t, panes.Freeze)
+	assert.Equal(t, 1, panes.YSplit)
+	assert.Equal(t, "A2", panes.TopLeftCell)
+}
+
+func TestWriteSummarySheet(t *testing.T) {
+	xlsxPath := filepath.Join(t.TempDir(), "test.xlsx")
+	users := []MergedUser{
+		{UserID: "1", Blocked: true},
+		{UserID: "2", Blocked: true, PrivateNote: "Creepy"},
+		{UserID: "3", PrivateNote: "Nice"},
+		{UserID: "4", PrivateNote: "Met at a munch"},
+		{UserID: "5"},
+	}
+
+	before := time.Now().Add(-time.Second)
+	gen := &GenerateCmd{}
+	err := gen.writeXLSX(xlsxPath, users)
+	assert.NoError(t, err)
+
+	f, err := excelize.OpenFile(xlsxPath)
+	assert.NoError(t, err)
+	defer f.Close()
+
+	// The summary is the first sheet, the data sheet still opens first
+	assert.Equal(t, []string{"Summary", "FetLife Data", "Legend"}, f.GetSheetList())
+	assert.Equal(t, "FetLife Data", f.GetSheetName(f.GetActiveSheetIndex()))
+
+	expected := map[string]string{
+		"A3": "Total users", "B3": "5",
+		"A4": "Blocked users", "B4": "2",
+		"A5": "Users with private notes", "B5": "3",
+		"A6": "Blocked users with notes", "B6": "1",
+		"A8": "Category", "B8": "Users",
+		"A9": "Blocked, no note", "B9": "1",
+		"A10": "Private note only", "B10": "2",
+		"A11": "Blocked with a note", "B11": "1",
+		"A12": "Neither", "B12": "1",
+	}
+	for cell, value := range expected {
+		actual, err := f.GetCellValue("Summary", cell)
+		assert.NoError(t, err)
+		assert.Equal(t, value, actual, cell)
+	}
+
+	// The counts are numbers and the generated time a date
+	cellType, err := f.GetCellType("Summary", "B3")
+	assert.NoError(t, err)
+	assert.NotEqual(t, excelize.CellTypeSharedString, cellType)
+	generated, err := f.GetCellValue("Summary", "B1")
+	assert.NoError(t, err)
+	at, err := time.ParseInLocation("2006-01-02 15:04:05", generated, time.Local)
+	assert.NoError(t, err)
+	assert.False(t, at.Before(before.Truncate(time.Second)), generated)
+
+	// Labels are bold
+	styleID, err := f.GetCellStyle("Summary", "A3")
+	assert.NoError(t, err)
+	style, err := f.GetStyle(styleID)
+	assert.NoError(t, err)
+	assert.True(t, style.Font != nil && style.Font.Bold)
+}
+
+func TestWriteJSON(t *testing.T) {
+	tempDir := t.TempDir()
+	jsonPath := filepath.Join(tempDir, "test.json")
+
+	users := []MergedUser{
+		{
+			UserID:      "123",
+			Nickname:    "TestUser",
+			URL:         "https://fetlife.com/users/123",
+			Blocked:     true,
+			BlockedAt:   "2024-01-01",
+			PrivateNote: "Test note",
+			NoteCreated: "2024-01-02",
+			NoteUpdated: "2024-01-03",
+		},
+	}
+
+	gen := &GenerateCmd{}
+	err := gen.writeJSON(jsonPath, users)
+	assert.NoError(t, err)
+
+	data, err := os.ReadFile(jsonPath)
+	assert.NoError(t, err)
+
+	// Field names are the CSV headers in camelCase
+	var records []map[string]any
+	err = json.Unmarshal(data, &records)
+	assert.NoError(t, err)
+	assert.Equal(t, []map[string]any{
+		{
+			"userID":      "123",
+			"nickname":    "TestUser",
+			"url":         "https://fetlife.com/users/123",
+			"blocked":     true,
+			"blockedAt":   "2024-01-01",
+			"privateNote": "Test note",
+			"noteCreated": "2024-01-02",
+			"noteUpdated": "2024-01-03",
+		},
+	}, records)
+
+	var decoded []MergedUser
+	err = json.Unmarshal(data, &decoded)
+	assert.NoError(t, err)
+	assert.Equal(t, users, decoded)
+}
+
+func TestWriteJSONL(t *testing.T) {
+	tempDir := t.TempDir()
+	jsonlPath := filepath.Join(tempDir, "test.jsonl")
+
+	users := []MergedUser{
+		{UserID: "123", Nickname: "TestUser", URL: "https://fetlife.com/users/123", Blocked: true, BlockedAt: "2024-01-01"},
+		{UserID: "456", URL: "https://fetlife.com/users/456", PrivateNote: "Line one\nLine two"},
+	}
+
+	gen := &GenerateCmd{}
+	err := gen.writeJSONL(jsonlPath, users)
+	assert.NoError(t, err)
+
+	file, err := os.Open(jsonlPath)
+	assert.NoError(t, err)
+	defer file.Close()
+
+	// Each line is a complete user, even when a note spans several lines
+	var decoded []MergedUser
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var user MergedUser
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &user))
+		decoded = append(decoded, user)
+	}
+	assert.NoError(t, scanner.Err())
+	assert.Equal(t, users, decoded)
+}
+
+func TestWriteHTML(t *testing.T) {
+	htmlPath := filepath.Join(t.TempDir(), "test.html")
+
+	users := []MergedUser{
+		{UserID: "123", Nickname: "Blocked<User>", URL: "https://fetlife.com/users/123", Blocked: true, BlockedAt: "2024-01-01"},
+		{UserID: "456", Nickname: "NotedUser", URL: "https://fetlife.com/users/456", PrivateNote: "Met at a munch & liked them"},
+	}
+
+	gen := &GenerateCmd{}
+	err := gen.writeHTML(htmlPath, users)
+	assert.NoError(t, err)
+
+	file, err := os.Open(htmlPath)
+	assert.NoError(t, err)
+	defer file.Close()
+	doc, err := html.Parse(file)
+	assert.NoError(t, err)
+
+	// Collect the rows of the table, with the text of their cells and the class and link of each row
+	type row struct {
+		class string
+		href  string
+		cells []string
+	}
+	var rows []row
+	var text func(n *html.Node) string
+	text = func(n *html.Node) string {
+		if n.Type == html.TextNode {
+			return n.Data
+		}
+		var result string
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			result += text(c)
+		}
+		return result
+	}
+	attr := func(n *html.Node, key string) string {
+		for _, a := range n.Attr {
+			if a.Key == key {
+				return a.Val
+			}
+		}
+		return ""
+	}
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "tr" {
+			r := row{class: attr(n, "class")}
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				if c.Type != html.ElementNode {
+					continue
+				}
+				r.cells = append(r.cells, text(c))
+				if a := c.FirstChild; a != nil && a.Type == html.ElementNode && a.Data == "a" {
+					r.href = attr(a, "href")
+				}
+			}
+			rows = append(rows, r)
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	if !assert.Len(t, rows, 3) {
+		return
+	}
+	assert.Equal(t, []string{"User ID", "Nickname", "URL", "Blocked", "Blocked At", "Private Note", "Note Created", "Note Updated"}, rows[0].cells)
+
+	assert.Equal(t, "blocked", rows[1].class)
+	assert.Equal(t, "https://fetlife.com/users/123", rows[1].href)
+	assert.Equal(t, []string{"123", "Blocked<User>", "https://fetlife.com/users/123", "Yes", "2024-01-01", "", "", ""}, rows[1].cells)
+
+	assert.Equal(t, "", rows[2].class)
+	assert.Equal(t, "https://fetlife.com/users/456", rows[2].href)
+	assert.Equal(t, "Met at a munch & liked them", rows[2].cells[5])
 }
 
 func TestGenerateCmd_Run_CSV(t *testing.T) {
@@ -246,7 +673,7 @@ func TestGenerateCmd_Run_CSV(t *testing.T) {
 	outputDir := t.TempDir()
 
 	// Create blockeds.txt
-	blockedsContent := `user_id,created_at,updated_at,nickname
+	blockedsContent := `blocked_user_id,created_at,updated_at,blocked_nickname
 123,2024-01-01,2024-01-01,TestUser
 456,2024-01-02,2024-01-02,AnotherUser
 `
@@ -265,10 +692,10 @@ func TestGenerateCmd_Run_CSV(t *testing.T) {
 
 	// Run generate command for CSV
 	gen := &GenerateCmd{
-		DataDir:   testDataDir,
+		DataDir:   []string{testDataDir},
 		OutputDir: outputDir,
 		Basename:  "test-output",
-		Format:    "csv",
+		Format:    []string{"csv"},
 	}
 
 	err = gen.Run(&Options{})
@@ -301,7 +728,7 @@ func TestGenerateCmd_Run_XLSX(t *testing.T) {
 	outputDir := t.TempDir()
 
 	// Create blockeds.txt
-	blockedsContent := `user_id,created_at,updated_at,nickname
+	blockedsContent := `blocked_user_id,created_at,updated_at,blocked_nickname
 123,2024-01-01,2024-01-01,TestUser
 `
 	blockedsPath := filepath.Join(testDataDir, "blockeds.txt")
@@ -317,10 +744,10 @@ func TestGenerateCmd_Run_XLSX(t *testing.T) {
 
 	// Run generate command for XLSX only
 	gen := &GenerateCmd{
-		DataDir:   testDataDir,
+		DataDir:   []string{testDataDir},
 		OutputDir: outputDir,
 		Basename:  "test-output",
-		Format:    "xlsx",
+		Format:    []string{"xlsx"},
 	}
 
 	err = gen.Run(&Options{})
@@ -343,7 +770,7 @@ func TestGenerateCmd_Run_Both(t *testing.T) {
 	outputDir := t.TempDir()
 
 	// Create blockeds.txt
-	blockedsContent := `user_id,created_at,updated_at,nickname
+	blockedsContent := `blocked_user_id,created_at,updated_at,blocked_nickname
 123,2024-01-01,2024-01-01,TestUser
 `
 	blockedsPath := filepath.Join(testDataDir, "blockeds.txt")
@@ -360,10 +787,10 @@ func TestGenerateCmd_Run_Both(t *testing.T) {
 
 	// Run generate command for both formats
 	gen := &GenerateCmd{
-		DataDir:   testDataDir,
+		DataDir:   []string{testDataDir},
 		OutputDir: outputDir,
 		Basename:  "test-output",
-		Format:    "both",
+		Format:    []string{"both"},
 	}
 
 	err = gen.Run(&Options{})
@@ -379,15 +806,83 @@ func TestGenerateCmd_Run_Both(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestGenerateCmd_Run_MultipleFormats(t *testing.T) {
+	testDataDir := writeTestData(t, "123,2024-01-01,2024-01-01,TestUser\n", "")
+	outputDir := t.TempDir()
+
+	var program Options
+	ctx, err := program.Parse([]string{"spreadsheet", "generate", "--data-dir", testDataDir, "--output-dir", outputDir,
+		"--basename", "test-output", "--format", "html,csv"})
+	assert.NoError(t, err)
+	assert.NoError(t, ctx.Run(&program))
+
+	assert.FileExists(t, filepath.Join(outputDir, "test-output.html"))
+	assert.FileExists(t, filepath.Join(outputDir, "test-output.csv"))
+	assert.NoFileExists(t, filepath.Join(outputDir, "test-output.xlsx"))
+
+	// Unknown formats are rejected
+	_, err = program.Parse([]string{"spreadsheet", "generate", "--data-dir", testDataDir, "--format", "html,pdf"})
+	assert.Error(t, err)
+}
+
+func TestGenerateCmd_Run_JSON(t *testing.T) {
+	testDataDir := writeTestData(t,
+		"123,2024-01-01,2024-01-01,TestUser\n456,2024-01-02,2024-01-02,AnotherUser\n",
+		"123,2024-01-03,2024-01-03,Has a note too\n789,2024-01-04,2024-01-04,Only has note\n")
+
+	tests := []struct {
+		format string
+		count  func(t *testing.T, data []byte) int
+	}{
+		{
+			format: "json",
+			count: func(t *testing.T, data []byte) int {
+				var users []MergedUser
+				assert.NoError(t, json.Unmarshal(data, &users))
+				return len(users)
+			},
+		},
+		{
+			format: "jsonl",
+			count: func(t *testing.T, data []byte) int {
+				return bytes.Count(data, []byte("\n"))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			outputDir := t.TempDir()
+			gen := &GenerateCmd{
+				DataDir:   []string{testDataDir},
+				OutputDir: outputDir,
+				Basename:  "test-output",
+				Format:    []string{tt.format},
+			}
+
+			err := gen.Run(&Options{})
+			assert.NoError(t, err)
+
+			data, err := os.ReadFile(filepath.Join(outputDir, "test-output."+tt.format))
+			assert.NoError(t, err)
+			assert.Equal(t, 3, tt.count(t, data))
+
+			// No spreadsheets are written
+			assert.NoFileExists(t, filepath.Join(outputDir, "test-output.csv"))
+			assert.NoFileExists(t, filepath.Join(outputDir, "test-output.xlsx"))
+		})
+	}
+}
+
 func TestGenerateCmd_Run_MissingFiles(t *testing.T) {
 	testDataDir := t.TempDir()
 	outputDir := t.TempDir()
 
 	gen := &GenerateCmd{
-		DataDir:   testDataDir,
+		DataDir:   []string{testDataDir},
 		OutputDir: outputDir,
 		Basename:  "test-output",
-		Format:    "csv",
+		Format:    []string{"csv"},
 	}
 
 	// Run without creating input files - should error
@@ -400,7 +895,7 @@ func TestGenerateCmd_Run_EmptyData(t *testing.T) {
 	outputDir := t.TempDir()
 
 	// Create empty blockeds.txt
-	blockedsContent := `user_id,created_at,updated_at,nickname
+	blockedsContent := `blocked_user_id,created_at,updated_at,blocked_nickname
 `
 	blockedsPath := filepath.Join(testDataDir, "blockeds.txt")
 	err := os.WriteFile(blockedsPath, []byte(blockedsContent), 0644)
@@ -414,10 +909,10 @@ func TestGenerateCmd_Run_EmptyData(t *testing.T) {
 	assert.NoError(t, err)
 
 	gen := &GenerateCmd{
-		DataDir:   testDataDir,
+		DataDir:   []string{testDataDir},
 		OutputDir: outputDir,
 		Basename:  "test-output",
-		Format:    "csv",
+		Format:    []string{"csv"},
 	}
 
 	err = gen.Run(&Options{})
@@ -0,0 +1,103 @@
+package program
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/woodysmith1912/fetlife-data-tools/obsidian"
+)
+
+// indexTag is the tag of an index page created by --write-index
+const indexTag = "people-index"
+
+// indexStart and indexEnd surround the part of the index page that is regenerated, everything around them is kept
+const (
+	indexStart = "<!-- fetlife-index:start -->"
+	indexEnd   = "<!-- fetlife-index:end -->"
+)
+
+// indexExcerptLength is the number of characters of a note shown in the index
+const indexExcerptLength = 80
+
+// writeIndex regenerates the --write-index page from the person pages in the vault, creating it when the vault
+// doesn't have it.  Only the text between indexStart and indexEnd is replaced, and an existing page without them gets
+// the index at the bottom.
+func (sync *SyncCmd) writeIndex(vault *obsidian.Vault) error {
+	page, created, err := generatedPage(vault, sync.WriteIndex, indexTag)
+	if err != nil {
+		return err
+	}
+
+	block := indexStart + "\n" + indexContent(vault, page) + indexEnd + "\n"
+	start := strings.Index(page.Content, indexStart)
+	end := strings.Index(page.Content, indexEnd)
+	if start >= 0 && end > start {
+		rest := strings.TrimPrefix(page.Content[end+len(indexEnd):], "\n")
+		page.Content = page.Content[:start] + block + rest
+	} else {
+		page.Content = strings.TrimRight(page.Content, "\n") + "\n\n" + block
+	}
+
+	if !created {
+		return sync.writePage(page)
+	}
+	return sync.createGeneratedPage(vault, page, "index")
+}
+
+// indexContent lists the person pages of the vault, except the templates and the index page itself, under a heading
+// per folder.  Each line links to the page and shows whether the user is blocked and the start of the note.
+func indexContent(vault *obsidian.Vault, index *obsidian.Page) string {
+	people := vault.FilterPages(func(page *obsidian.Page) bool {
+		return page != index && page.Folder != templatesFolder && page.HasTag("person")
+	})
+	slices.SortStableFunc(people, func(a, b *obsidian.Page) int {
+		if a.Folder != b.Folder {
+			return strings.Compare(a.Folder, b.Folder)
+		}
+		return strings.Compare(strings.ToLower(a.Title), strings.ToLower(b.Title))
+	})
+
+	var content strings.Builder
+	folder := ""
+	for _, page := range people {
+		if page.Folder != folder {
+			folder = page.Folder
+			heading := filepath.ToSlash(folder)
+			if folder == "." {
+				heading = "Vault root"
+			}
+			fmt.Fprintf(&content, "\n## %s\n\n", heading)
+		}
+		line := "- " + wikilink(page)
+		if page.HasTag("blocked") {
+			line += " (blocked)"
+		}
+		if excerpt := noteExcerpt(page); excerpt != "" {
+			line += ": " + excerpt
+		}
+		content.WriteString(line + "\n")
+	}
+	if len(people) == 0 {
+		content.WriteString("\nNo person pages yet.\n")
+	}
+	content.WriteString("\n")
+	return content.String()
+}
+
+// noteExcerpt returns the first line of the page's note, from its web-message or else its FetLife Private Note
+// section, shortened to indexExcerptLength characters
+func noteExcerpt(page *obsidian.Page) string {
+	note := page.WebMessage
+	if note == "" {
+		note = page.GetSection(noteHeading)
+	}
+	note, _, _ = strings.Cut(strings.TrimSpace(note), "\n")
+	note = strings.TrimSpace(note)
+	if utf8.RuneCountInString(note) > indexExcerptLength {
+		note = strings.TrimSpace(string([]rune(note)[:indexExcerptLength])) + "…"
+	}
+	return note
+}
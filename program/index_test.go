@@ -0,0 +1,83 @@
+package program
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/woodysmith1912/fetlife-data-tools/obsidian"
+)
+
+func TestSyncCmd_WriteIndex(t *testing.T) {
+	tempVault := t.TempDir()
+	writeTestFile(t, filepath.Join(tempVault, "People", "alice.md"),
+		"---\ntags:\n  - person\nurl: https://fetlife.com/users/11111\nweb-message: |-\n  Met at a munch\n  Second line\n---\n")
+	writeTestFile(t, filepath.Join(tempVault, "People", "Bob.md"),
+		"---\ntags:\n  - person\nurl: https://fetlife.com/users/22222\nweb-message: "+strings.Repeat("a", 90)+"\n---\n")
+	writeTestFile(t, filepath.Join(tempVault, "Templates", "People.md"), defaultTemplate)
+	writeTestFile(t, filepath.Join(tempVault, "Notes.md"), "# Notes\n")
+	dataDir := writeTestData(t, "33333,2024-01-01,2024-01-01,Frank\n", "")
+
+	sync := &SyncCmd{
+		DataDir:         []string{dataDir},
+		CreatePeopleIn:  []string{"People"},
+		CreateBlockedIn: []string{"Bad People"},
+		WriteIndex:      "Indexes/FetLife People Index.md",
+		NoCache:         true,
+		now:             fixedNow,
+	}
+	assert.NoError(t, sync.Run(loadTestVault(t, tempVault)))
+
+	indexPath := filepath.Join(tempVault, "Indexes", "FetLife People Index.md")
+	content, err := os.ReadFile(indexPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "---\ntags:\n  - people-index\n---\n\n# FetLife People Index\n\n"+
+		indexStart+"\n"+
+		"\n## Bad People\n\n"+
+		"- [[Bad People/Frank|Frank]] (blocked)\n"+
+		"\n## People\n\n"+
+		"- [[People/alice|alice]]: Met at a munch\n"+
+		"- [[People/Bob|Bob]]: "+strings.Repeat("a", 80)+"…\n"+
+		"\n"+indexEnd+"\n", string(content))
+
+	// The index is regenerated in place, keeping what was written around it
+	edited := strings.Replace(string(content), indexStart, "My notes above\n\n"+indexStart, 1) + "\nMy notes below\n"
+	assert.NoError(t, os.WriteFile(indexPath, []byte(edited), 0644))
+	assert.NoError(t, os.Remove(filepath.Join(tempVault, "People", "Bob.md")))
+	assert.NoError(t, sync.Run(loadTestVault(t, tempVault)))
+
+	index, err := obsidian.LoadPage(indexPath, tempVault)
+	assert.NoError(t, err)
+	assert.Equal(t, "\n# FetLife People Index\n\nMy notes above\n\n"+
+		indexStart+"\n"+
+		"\n## Bad People\n\n"+
+		"- [[Bad People/Frank|Frank]] (blocked)\n"+
+		"\n## People\n\n"+
+		"- [[People/alice|alice]]: Met at a munch\n"+
+		"\n"+indexEnd+"\n"+
+		"\nMy notes below\n", index.Content)
+}
+
+func TestSyncCmd_WriteIndexExistingPage(t *testing.T) {
+	tempVault := t.TempDir()
+	writeTestFile(t, filepath.Join(tempVault, "Index.md"), "# My index\n\nHand written links\n")
+
+	sync := &SyncCmd{
+		DataDir:         []string{writeTestData(t, "", "")},
+		CreatePeopleIn:  []string{"People"},
+		CreateBlockedIn: []string{"Bad People"},
+		WriteIndex:      "Index",
+		NoCache:         true,
+	}
+	assert.NoError(t, sync.Run(loadTestVault(t, tempVault)))
+
+	// A page without the markers gets the index at the bottom
+	content, err := os.ReadFile(filepath.Join(tempVault, "Index.md"))
+	assert.NoError(t, err)
+	assert.Equal(t, "# My index\n\nHand written links\n\n"+indexStart+"\n\nNo person pages yet.\n\n"+indexEnd+"\n", string(content))
+
+	sync.WriteIndex = "../Index"
+	assert.ErrorContains(t, sync.Validate(), "must be a page inside the vault")
+}
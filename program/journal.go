@@ -0,0 +1,282 @@
+package program
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/rs/zerolog/log"
+	"github.com/woodysmith1912/fetlife-data-tools/obsidian"
+)
+
+// journalFileName is the name of the file a sync run records its changes in
+const journalFileName = "fetlife-sync-journal.jsonl"
+
+// journalEntry is a single change made to the vault by a sync run.  Paths are relative to the vault and use
+// forward slashes, except for "state" entries.
+type journalEntry struct {
+	// Op is "create", "modify", "rename", "delete" or "state"
+	Op string `json:"op"`
+	// Path is the file that was changed, or the absolute path of the sync state file for a "state" entry
+	Path string `json:"path"`
+	// Vault is the key of the vault's state in the sync state file for a "state" entry
+	Vault string `json:"vault,omitempty"`
+	// From is the old path of a renamed file
+	From string `json:"from,omitempty"`
+	// Before is the content of a modified or deleted file before the change, or the vault's sync state before the
+	// sync for a "state" entry
+	Before string `json:"before,omitempty"`
+	// After is the content of a created or modified file after the change
+	After string `json:"after,omitempty"`
+}
+
+// journalPath returns the path of the sync journal, which lives in the vault's .obsidian directory unless another
+// directory is given
+func journalPath(vault *obsidian.Vault, journalDir string) string {
+	if journalDir == "" {
+		journalDir = filepath.Join(vault.Path, ".obsidian")
+	}
+	return filepath.Join(journalDir, journalFileName)
+}
+
+// record appends an entry to the journal of this run.  The journal is only started once the run changes something,
+// so a sync that leaves the vault alone keeps the journal of the previous run.
+func (sync *SyncCmd) record(entry journalEntry) error {
+	sync.locks.state.Lock()
+	defer sync.locks.state.Unlock()
+	if sync.journalPath == "" {
+		return nil
+	}
+
+	if sync.journal == nil {
+		if err := os.MkdirAll(filepath.Dir(sync.journalPath), 0755); err != nil {
+			return err
+		}
+		file, err := os.Create(sync.journalPath)
+		if err != nil {
+			return err
+		}
+		sync.journal = file
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	_, err = sync.journal.Write(append(line, '\n'))
+	return err
+}
+
+// recordState adds the vault's sync state from before this run to the journal, so undoing the run also forgets the
+// records it synced and the next sync processes them again.  Nothing is recorded when the run changed nothing.
+func (sync *SyncCmd) recordState(vault *obsidian.Vault) error {
+	sync.locks.state.Lock()
+	started := sync.journal != nil
+	sync.locks.state.Unlock()
+	if !started {
+		return nil
+	}
+
+	path, err := filepath.Abs(sync.statePath())
+	if err != nil {
+		return err
+	}
+	state, err := loadState(path, stateKey(vault))
+	if err != nil {
+		return err
+	}
+	before, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return sync.record(journalEntry{Op: "state", Path: path, Vault: stateKey(vault), Before: string(before)})
+}
+
+// closeJournal finishes the journal of this run
+func (sync *SyncCmd) closeJournal() error {
+	if sync.journal == nil {
+		return nil
+	}
+	err := sync.journal.Close()
+	sync.journal = nil
+	return err
+}
+
+// readJournal reads the entries of a sync journal in the order they were written
+func readJournal(path string) ([]journalEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []journalEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 64*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry journalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("invalid journal entry in %s: %w", path, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+type SyncUndoCmd struct {
+	JournalDir string `help:"Directory the sync journal was written to (default: the vault's .obsidian directory)" type:"path"`
+	Force      bool   `help:"Restore files even if they were changed after the sync"`
+}
+
+// Run reverts the last sync by replaying its journal backwards: created files are deleted, modified and deleted files
+// get their old content back, renamed files their old name and the sync state file the vault's old state.  Files changed since the sync are left alone unless
+// --force is given.
+func (cmd *SyncUndoCmd) Run(vault *obsidian.Vault) error {
+	path := journalPath(vault, cmd.JournalDir)
+	entries, err := readJournal(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			log.Error().Str("journal", path).Msg("No sync journal found, nothing to undo")
+		}
+		return err
+	}
+
+	conflicts := checkJournal(vault.Path, entries)
+	for _, conflict := range conflicts {
+		log.Warn().Str("file", conflict).Msg("File was changed after the sync")
+	}
+	if len(conflicts) > 0 && !cmd.Force {
+		return fmt.Errorf("%d files were changed after the sync, use --force to undo anyway", len(conflicts))
+	}
+
+	for i := len(entries) - 1; i >= 0; i-- {
+		if err := undoEntry(vault.Path, entries[i]); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+
+	log.Info().
+		Str("journal", path).
+		Int("changes", len(entries)).
+		Msg("Undid last sync")
+	return nil
+}
+
+// checkJournal walks the journal backwards as undo would and returns the files whose content no longer matches what
+// the sync left behind
+func checkJournal(vaultPath string, entries []journalEntry) []string {
+	// files holds the expected content of every file undo has already touched, nil for a file that is gone
+	files := make(map[string]*string)
+	content := func(path string) *string {
+		if current, ok := files[path]; ok {
+			return current
+		}
+		data, err := os.ReadFile(filepath.Join(vaultPath, filepath.FromSlash(path)))
+		if err != nil {
+			return nil
+		}
+		current := string(data)
+		return &current
+	}
+
+	var conflicts []string
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		switch entry.Op {
+		case "create":
+			if current := content(entry.Path); current == nil || *current != entry.After {
+				conflicts = append(conflicts, entry.Path)
+			}
+			files[entry.Path] = nil
+		case "modify":
+			if current := content(entry.Path); current == nil || *current != entry.After {
+				conflicts = append(conflicts, entry.Path)
+			}
+			files[entry.Path] = &entry.Before
+		case "rename":
+			current := content(entry.Path)
+			if current == nil || content(entry.From) != nil {
+				conflicts = append(conflicts, entry.Path)
+			}
+			files[entry.From] = current
+			files[entry.Path] = nil
+		case "delete":
+			if content(entry.Path) != nil {
+				conflicts = append(conflicts, entry.Path)
+			}
+			files[entry.Path] = &entry.Before
+		}
+	}
+	return conflicts
+}
+
+// undoEntry reverts a single journal entry.  Entries that can no longer be reverted, like a created file that has
+// already been deleted, are skipped with a warning.
+func undoEntry(vaultPath string, entry journalEntry) error {
+	path := filepath.Join(vaultPath, filepath.FromSlash(entry.Path))
+
+	switch entry.Op {
+	case "create":
+		if err := os.Remove(path); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				log.Warn().Str("file", entry.Path).Msg("Created file no longer exists")
+				return nil
+			}
+			return err
+		}
+		log.Info().Str("file", entry.Path).Msg("Deleted created file")
+	case "modify":
+		if err := obsidian.WriteFile(path, []byte(entry.Before)); err != nil {
+			return err
+		}
+		log.Info().Str("file", entry.Path).Msg("Restored modified file")
+	case "rename":
+		from := filepath.Join(vaultPath, filepath.FromSlash(entry.From))
+		if _, err := os.Stat(from); err == nil {
+			log.Warn().Str("file", entry.Path).Str("from", entry.From).Msg("Old name is taken, not renaming back")
+			return nil
+		}
+		if err := os.Rename(path, from); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				log.Warn().Str("file", entry.Path).Msg("Renamed file no longer exists")
+				return nil
+			}
+			return err
+		}
+		log.Info().Str("file", entry.Path).Str("from", entry.From).Msg("Renamed file back")
+	case "delete":
+		if _, err := os.Stat(path); err == nil {
+			log.Warn().Str("file", entry.Path).Msg("Deleted file has been recreated, not restoring")
+			return nil
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := obsidian.WriteFile(path, []byte(entry.Before)); err != nil {
+			return err
+		}
+		log.Info().Str("file", entry.Path).Msg("Restored deleted file")
+	case "state":
+		state := &SyncState{}
+		if err := json.Unmarshal([]byte(entry.Before), state); err != nil {
+			return fmt.Errorf("invalid sync state in journal: %w", err)
+		}
+		if err := saveState(entry.Path, entry.Vault, state); err != nil {
+			return err
+		}
+		log.Info().Str("file", entry.Path).Msg("Restored sync state")
+	default:
+		return fmt.Errorf("unknown journal operation %q", entry.Op)
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package program
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zenizh/go-capturer"
+)
+
+func TestSyncUndo(t *testing.T) {
+	tempVault := t.TempDir()
+
+	// Frank is renamed to Franklin, Alice gets a note, and Bob's page is new
+	frankContent := `---
+tags:
+  - person
+url: https://fetlife.com/users/98765
+---
+
+# Frank
+`
+	aliceContent := `---
+url: https://fetlife.com/users/12345
+---
+`
+	writeTestFile(t, filepath.Join(tempVault, "Bad People", "Frank.md"), frankContent)
+	writeTestFile(t, filepath.Join(tempVault, "People", "Alice.md"), aliceContent)
+
+	testDataDir := writeTestData(t,
+		"98765,2024-01-01,2024-01-01,Franklin\n",
+		"12345,2024-01-01,2024-01-01,Met at a munch\n55555,2024-01-01,2024-01-01,Bob from the party\n")
+
+	sync := &SyncCmd{
+		DataDir:         []string{testDataDir},
+		CreatePeopleIn:  []string{"People"},
+		CreateBlockedIn: []string{"Bad People"},
+	}
+	err := sync.Run(loadTestVault(t, tempVault))
+	assert.NoError(t, err)
+
+	entries, err := readJournal(filepath.Join(tempVault, ".obsidian", journalFileName))
+	assert.NoError(t, err)
+	var ops []string
+	for _, entry := range entries {
+		ops = append(ops, entry.Op+" "+entry.Path)
+	}
+	assert.Equal(t, []string{
+		"rename Bad People/Franklin.md",
+		"modify Bad People/Franklin.md",
+		"modify People/Alice.md",
+		"create People/user-55555.md",
+		"modify People/user-55555.md",
+		"state " + filepath.Join(testDataDir, stateFileName),
+	}, ops)
+
+	undo := &SyncUndoCmd{}
+	err = undo.Run(loadTestVault(t, tempVault))
+	assert.NoError(t, err)
+
+	frank, err := os.ReadFile(filepath.Join(tempVault, "Bad People", "Frank.md"))
+	assert.NoError(t, err)
+	assert.Equal(t, frankContent, string(frank))
+	alice, err := os.ReadFile(filepath.Join(tempVault, "People", "Alice.md"))
+	assert.NoError(t, err)
+	assert.Equal(t, aliceContent, string(alice))
+	for _, path := range []string{"Bad People/Franklin.md", "People/user-55555.md", ".obsidian/" + journalFileName} {
+		_, err = os.Stat(filepath.Join(tempVault, path))
+		assert.True(t, os.IsNotExist(err), "%s should not exist", path)
+	}
+
+	// There is nothing left to undo
+	err = undo.Run(loadTestVault(t, tempVault))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestSyncUndo_RestoresState(t *testing.T) {
+	tempVault := t.TempDir()
+	testDataDir := writeTestData(t,
+		"98765,2024-01-01,2024-01-01,Frank\n",
+		"12345,2024-01-01,2024-01-01,Met at a munch\n")
+	newSync := func() *SyncCmd {
+		return &SyncCmd{
+			DataDir:         []string{testDataDir},
+			CreatePeopleIn:  []string{"People"},
+			CreateBlockedIn: []string{"Bad People"},
+		}
+	}
+
+	sync := newSync()
+	err := sync.Run(loadTestVault(t, tempVault))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, sync.summary.Created)
+
+	undo := &SyncUndoCmd{}
+	err = undo.Run(loadTestVault(t, tempVault))
+	assert.NoError(t, err)
+
+	// The undone records aren't cached, so the pages are created again
+	sync = newSync()
+	err = sync.Run(loadTestVault(t, tempVault))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, sync.summary.Created)
+	assert.Equal(t, 0, sync.summary.Cached)
+	assert.FileExists(t, filepath.Join(tempVault, "Bad People", "Frank.md"))
+	assert.FileExists(t, filepath.Join(tempVault, "People", "user-12345.md"))
+}
+
+func TestSyncUndo_KeepsPermissions(t *testing.T) {
+	tempVault := t.TempDir()
+	aliceContent := "---\nurl: https://fetlife.com/users/12345\n---\n"
+	alicePath := filepath.Join(tempVault, "People", "Alice.md")
+	writeTestFile(t, alicePath, aliceContent)
+	assert.NoError(t, os.Chmod(alicePath, 0600))
+
+	sync := &SyncCmd{
+		DataDir:        []string{writeTestData(t, "", "12345,2024-01-01,2024-01-01,Met at a munch\n")},
+		CreatePeopleIn: []string{"People"},
+	}
+	assert.NoError(t, sync.Run(loadTestVault(t, tempVault)))
+
+	undo := &SyncUndoCmd{}
+	assert.NoError(t, undo.Run(loadTestVault(t, tempVault)))
+
+	content, err := os.ReadFile(alicePath)
+	assert.NoError(t, err)
+	assert.Equal(t, aliceContent, string(content))
+	info, err := os.Stat(alicePath)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	matches, err := filepath.Glob(filepath.Join(tempVault, "People", ".*.tmp"))
+	assert.NoError(t, err)
+	assert.Empty(t, matches, "no temporary files are left behind")
+}
+
+func TestSyncUndo_ChangedAfterSync(t *testing.T) {
+	tempVault := t.TempDir()
+	journalDir := t.TempDir()
+
+	testDataDir := writeTestData(t, "", "55555,2024-01-01,2024-01-01,Bob from the party\n")
+
+	sync := &SyncCmd{
+		DataDir:         []string{testDataDir},
+		CreatePeopleIn:  []string{"People"},
+		CreateBlockedIn: []string{"Bad People"},
+		JournalDir:      journalDir,
+	}
+	err := sync.Run(loadTestVault(t, tempVault))
+	assert.NoError(t, err)
+	assert.FileExists(t, filepath.Join(journalDir, journalFileName))
+
+	// The page is edited by hand after the sync
+	bobPath := filepath.Join(tempVault, "People", "user-55555.md")
+	writeTestFile(t, bobPath, "# Bob\n")
+
+	undo := &SyncUndoCmd{JournalDir: journalDir}
+	err = undo.Run(loadTestVault(t, tempVault))
+	assert.Error(t, err)
+	assert.FileExists(t, bobPath)
+	assert.FileExists(t, filepath.Join(journalDir, journalFileName))
+
+	undo.Force = true
+	err = undo.Run(loadTestVault(t, tempVault))
+	assert.NoError(t, err)
+	assert.NoFileExists(t, bobPath)
+	assert.NoFileExists(t, filepath.Join(journalDir, journalFileName))
+}
+
+func TestSyncCmd_DryRunWritesNoJournal(t *testing.T) {
+	tempVault := t.TempDir()
+	testDataDir := writeTestData(t, "", "55555,2024-01-01,2024-01-01,Bob from the party\n")
+
+	sync := &SyncCmd{
+		DataDir:         []string{testDataDir},
+		CreatePeopleIn:  []string{"People"},
+		CreateBlockedIn: []string{"Bad People"},
+		DryRun:          true,
+	}
+	var err error
+	capturer.CaptureStdout(func() {
+		err = sync.Run(loadTestVault(t, tempVault))
+	})
+	assert.NoError(t, err)
+	assert.NoFileExists(t, filepath.Join(tempVault, ".obsidian", journalFileName))
+}
+
+func TestSyncUndo_RemovedOrphan(t *testing.T) {
+	tempVault := t.TempDir()
+	goneContent := "---\ntags:\n  - person\nurl: https://fetlife.com/users/99999\n---\n\n# Gone\n"
+	gonePath := filepath.Join(tempVault, "People", "Old", "Gone.md")
+	writeTestFile(t, gonePath, goneContent)
+	writeTestFile(t, filepath.Join(tempVault, "People", "Alice.md"), "---\ntags:\n  - person\n---\n")
+
+	sync := &SyncCmd{
+		DataDir:         []string{writeTestData(t, "", "")},
+		CreatePeopleIn:  []string{"People"},
+		CreateBlockedIn: []string{"Bad People"},
+		RemoveOrphans:   true,
+		Force:           true,
+		NoCache:         true,
+	}
+	err := sync.Run(loadTestVault(t, tempVault))
+	assert.NoError(t, err)
+	assert.NoFileExists(t, gonePath)
+
+	// The folder left empty is removed, its parent still has a page
+	assert.NoDirExists(t, filepath.Dir(gonePath))
+	assert.DirExists(t, filepath.Join(tempVault, "People"))
+
+	undo := &SyncUndoCmd{}
+	err = undo.Run(loadTestVault(t, tempVault))
+	assert.NoError(t, err)
+
+	gone, err := os.ReadFile(gonePath)
+	assert.NoError(t, err)
+	assert.Equal(t, goneContent, string(gone))
+}
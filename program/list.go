@@ -1,37 +1,200 @@
 package program
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
 
 	"github.com/woodysmith1912/fetlife-data-tools/obsidian"
 )
 
 type ListCmd struct {
-	// Possible options for list command
+	Format      string   `help:"Output format: text or json.  Defaults to json when --output-format=jsonl, otherwise text" enum:",text,json" default:""`
+	Search      string   `help:"Only list pages anywhere in the vault whose body, title, web-message or tags contain this text"`
+	SearchRegex bool     `help:"Treat --search as a case-insensitive regular expression"`
+	Tag         []string `help:"Only list pages anywhere in the vault, or in --folder when given, with this tag.  Can be repeated to list pages with any of the tags"`
+	AllTags     bool     `help:"Only list pages that have every --tag instead of any of them" aliases:"match-all-tags"`
+	Folder      string   `help:"Folder to list the pages of (default: People).  With --search or --tag, only list matching pages in this folder"`
+	AllFolders  bool     `help:"List the pages of every folder, grouped by folder"`
 }
 
-func (list *ListCmd) Run(vault *obsidian.Vault) error {
+func (list *ListCmd) Validate() error {
+	if list.AllTags && len(list.Tag) == 0 {
+		return errors.New("--all-tags needs at least one --tag")
+	}
+	if list.SearchRegex {
+		if list.Search == "" {
+			return errors.New("--search-regex needs a --search pattern")
+		}
+		if _, err := list.searchPattern(); err != nil {
+			return fmt.Errorf("invalid --search pattern %q: %w", list.Search, err)
+		}
+	}
+	return nil
+}
 
-	// Print out all pages by title and URL
-	for _, person := range vault.InFolder("People") {
-		fmt.Printf("Person: %s\n", person.Title)
-		fmt.Printf("  Folder: %s\n", person.Folder)
-		if person.Url != "" {
-			fmt.Printf("  URL: %s\n", person.Url)
+func (list *ListCmd) Run(vault *obsidian.Vault, options *Options) error {
+	people, total, err := list.pages(vault)
+	if err != nil {
+		return err
+	}
+
+	if list.format(options) == "json" {
+		summaries := make([]obsidian.PageSummary, 0, len(people))
+		for _, person := range people {
+			summaries = append(summaries, person.Summary())
 		}
-		if len(person.Aliases) > 0 {
-			fmt.Printf("  Aliases: %s\n", person.Aliases)
+
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(summaries)
+	}
+
+	if len(list.Tag) > 0 {
+		defer fmt.Printf("Showing %d of %d pages (filtered by tag: %s)\n", len(people), total, strings.Join(list.Tag, ", "))
+	}
+
+	if !list.AllFolders {
+		if len(people) == 0 && list.Search == "" && len(list.Tag) == 0 {
+			fmt.Printf("No pages found in folder %q\n", list.folder())
 		}
-		if len(person.UrlAliases) > 0 {
-			fmt.Printf("  URL Aliases: %s\n", person.UrlAliases)
+		for _, person := range people {
+			printPerson(person)
 		}
-		if person.WebBadgeColor != "" {
-			fmt.Printf("  Web Badge Color: %s\n", person.WebBadgeColor)
+		return nil
+	}
+
+	// Print the pages under a header for each folder
+	printed := false
+	for _, folder := range vault.Folders() {
+		var inFolder []*obsidian.Page
+		for _, person := range people {
+			if person.Folder == folder {
+				inFolder = append(inFolder, person)
+			}
+		}
+		if len(inFolder) == 0 {
+			continue
 		}
-		if person.WebMessage != "" {
-			fmt.Printf("  Web Message: %s\n", person.WebMessage)
+		if printed {
+			fmt.Println()
+		}
+		printed = true
+		fmt.Printf("== %s (%d) ==\n", folder, len(inFolder))
+		for _, person := range inFolder {
+			printPerson(person)
 		}
 	}
 
 	return nil
 }
+
+// printPerson prints a page by title and URL, with the metadata it has
+func printPerson(person *obsidian.Page) {
+	fmt.Printf("Person: %s\n", person.Title)
+	fmt.Printf("  Folder: %s\n", person.Folder)
+	if person.Url != "" {
+		fmt.Printf("  URL: %s\n", person.Url)
+	}
+	if len(person.Aliases) > 0 {
+		fmt.Printf("  Aliases: %s\n", person.Aliases)
+	}
+	if len(person.UrlAliases) > 0 {
+		fmt.Printf("  URL Aliases: %s\n", person.UrlAliases)
+	}
+	if person.WebBadgeColor != "" {
+		fmt.Printf("  Web Badge Color: %s\n", person.WebBadgeColor)
+	}
+	if person.WebMessage != "" {
+		fmt.Printf("  Web Message: %s\n", person.WebMessage)
+	}
+}
+
+// pages returns the pages to list: the --folder folder, every page with --all-folders, or every page matching
+// --search and --tag, in --folder if given.  It also returns the number of pages before filtering by tag.
+func (list *ListCmd) pages(vault *obsidian.Vault) ([]*obsidian.Page, int, error) {
+	if list.Search == "" && len(list.Tag) == 0 {
+		if list.AllFolders {
+			return vault.Pages, len(vault.Pages), nil
+		}
+		pages := vault.InFolder(list.folder())
+		return pages, len(pages), nil
+	}
+
+	pages := vault.Pages
+	if list.Folder != "" && !list.AllFolders {
+		pages = vault.InFolder(list.folder())
+	}
+
+	if list.Search != "" {
+		var found []*obsidian.Page
+		if list.SearchRegex {
+			pattern, err := list.searchPattern()
+			if err != nil {
+				return nil, 0, err
+			}
+			found = vault.SearchRegex(pattern)
+		} else {
+			found = vault.Search(list.Search)
+		}
+		isFound := pageSet(found)
+		pages = slices.DeleteFunc(slices.Clone(pages), func(page *obsidian.Page) bool {
+			return !isFound[page]
+		})
+	}
+	total := len(pages)
+
+	if len(list.Tag) > 0 {
+		tagged := vault.WithAnyTag(list.Tag...)
+		if list.AllTags {
+			tagged = vault.WithAllTags(list.Tag...)
+		}
+		isTagged := pageSet(tagged)
+		var matching []*obsidian.Page
+		for _, page := range pages {
+			if isTagged[page] {
+				matching = append(matching, page)
+			}
+		}
+		pages = matching
+	}
+
+	return pages, total, nil
+}
+
+// pageSet returns a set of pages, for filtering pages by the results of a vault query
+func pageSet(pages []*obsidian.Page) map[*obsidian.Page]bool {
+	set := make(map[*obsidian.Page]bool, len(pages))
+	for _, page := range pages {
+		set[page] = true
+	}
+	return set
+}
+
+// folder returns the folder to list, People by default
+func (list *ListCmd) folder() string {
+	if list.Folder == "" {
+		return "People"
+	}
+	return filepath.Clean(list.Folder)
+}
+
+func (list *ListCmd) searchPattern() (*regexp.Regexp, error) {
+	return regexp.Compile("(?i)" + list.Search)
+}
+
+// format returns the output format, falling back to the global --output-format when --format isn't given
+func (list *ListCmd) format(options *Options) string {
+	if list.Format != "" {
+		return list.Format
+	}
+	if options != nil && options.OutputFormat == "jsonl" {
+		return "json"
+	}
+	return "text"
+}
@@ -0,0 +1,65 @@
+package program
+
+import (
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+	"github.com/woodysmith1912/fetlife-data-tools/obsidian"
+)
+
+// TooManyCreates is returned when a sync would create more pages than --max-creates
+type TooManyCreates struct {
+	Count int
+	Max   int
+}
+
+func (err *TooManyCreates) Error() string {
+	return fmt.Sprintf("the sync would create %d pages, more than --max-creates %d; check --data-dir, or pass a higher "+
+		"--max-creates, or --max-creates 0, to create them", err.Count, err.Max)
+}
+
+// guardsCreates tells whether the pages a sync would create are counted before anything is written
+func (sync *SyncCmd) guardsCreates() bool {
+	return sync.MaxCreates > 0 && !sync.DryRun
+}
+
+// plannedUser is a user whose records are about to be synced, for counting the pages the sync creates
+type plannedUser struct {
+	userID   string
+	nickname string
+}
+
+// checkCreates returns a *TooManyCreates when the users would get more new pages than --max-creates
+func (sync *SyncCmd) checkCreates(vault *obsidian.Vault, users []plannedUser) error {
+	count := sync.countCreates(vault, users)
+	if count > sync.MaxCreates {
+		log.Error().
+			Int("creates", count).
+			Int("maxCreates", sync.MaxCreates).
+			Msg("Sync would create too many pages, nothing was written")
+		return &TooManyCreates{Count: count, Max: sync.MaxCreates}
+	}
+	log.Debug().Int("creates", count).Msg("Planned the pages to create")
+	return nil
+}
+
+// countCreates returns the number of users that no page is found for, who get a new page when their records are
+// processed.  users holds the users of the records that may create a page, in the order they're processed; a user
+// with several records gets a single page.
+func (sync *SyncCmd) countCreates(vault *obsidian.Vault, users []plannedUser) int {
+	if sync.UpdateOnly {
+		return 0
+	}
+	seen := make(map[string]bool)
+	count := 0
+	for _, user := range users {
+		if seen[user.userID] {
+			continue
+		}
+		seen[user.userID] = true
+		if pages, _, err := sync.findPage(vault, user.userID, user.nickname); err == nil && len(pages) == 0 {
+			count++
+		}
+	}
+	return count
+}
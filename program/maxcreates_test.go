@@ -0,0 +1,89 @@
+package program
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncCmd_MaxCreates(t *testing.T) {
+	dataDir := writeTestData(t,
+		"11111,2024-01-01,2024-01-01,Dave\n22222,2024-01-01,2024-01-01,Erin\n",
+		"33333,2024-01-01,2024-01-01,Met at a munch\n11111,2024-01-01,2024-01-01,Dave's note\n")
+	newSync := func() *SyncCmd {
+		return &SyncCmd{
+			DataDir:         []string{dataDir},
+			CreatePeopleIn:  []string{"People"},
+			CreateBlockedIn: []string{"Bad People"},
+			MaxCreates:      2,
+			NoCache:         true,
+		}
+	}
+	files := func(vault string) []string {
+		matches, err := filepath.Glob(filepath.Join(vault, "*", "*.md"))
+		assert.NoError(t, err)
+		return matches
+	}
+
+	// Three pages are more than --max-creates 2, so nothing is written
+	tempVault := t.TempDir()
+	writeTestFile(t, filepath.Join(tempVault, "People", "Carol.md"),
+		"---\ntags:\n  - person\nurl: https://fetlife.com/users/44444\n---\n")
+	sync := newSync()
+	err := sync.Run(loadTestVault(t, tempVault))
+	var tooMany *TooManyCreates
+	if assert.True(t, errors.As(err, &tooMany)) {
+		assert.Equal(t, 3, tooMany.Count)
+		assert.Equal(t, 2, tooMany.Max)
+	}
+	assert.Len(t, files(tempVault), 1)
+	_, err = os.Stat(filepath.Join(tempVault, ".obsidian"))
+	assert.True(t, os.IsNotExist(err), "no journal is written")
+
+	// --update-only creates nothing, so it isn't stopped
+	sync = newSync()
+	sync.UpdateOnly = true
+	assert.NoError(t, sync.Run(loadTestVault(t, tempVault)))
+	assert.Len(t, files(tempVault), 1)
+
+	// A dry run shows what would be created
+	sync = newSync()
+	sync.DryRun = true
+	assert.NoError(t, sync.Run(loadTestVault(t, tempVault)))
+	assert.Equal(t, 3, sync.summary.Created)
+	assert.Len(t, files(tempVault), 1)
+
+	// --force only skips the --remove-orphans confirmation
+	sync = newSync()
+	sync.Force = true
+	assert.True(t, errors.As(sync.Run(loadTestVault(t, tempVault)), &tooMany))
+	assert.Len(t, files(tempVault), 1)
+
+	// --max-creates 0 creates them anyway, once
+	sync = newSync()
+	sync.MaxCreates = 0
+	assert.NoError(t, sync.Run(loadTestVault(t, tempVault)))
+	assert.Equal(t, 3, sync.summary.Created)
+	assert.Len(t, files(tempVault), 4)
+
+	// A higher limit plans the sync and then runs it on the vault as loaded
+	tempVault = t.TempDir()
+	sync = newSync()
+	sync.MaxCreates = 3
+	assert.NoError(t, sync.Run(loadTestVault(t, tempVault)))
+	assert.Equal(t, 3, sync.summary.Created)
+	assert.Equal(t, 1, sync.summary.Updated, "Dave's note updates the page of his blocked record")
+	assert.ElementsMatch(t, []string{
+		filepath.Join(tempVault, "Bad People", "Dave.md"),
+		filepath.Join(tempVault, "Bad People", "Erin.md"),
+		filepath.Join(tempVault, "People", "user-33333.md"),
+	}, files(tempVault))
+}
+
+func TestSyncCmd_MaxCreatesNegative(t *testing.T) {
+	sync := &SyncCmd{DataDir: []string{writeTestData(t, "", "")}, MaxCreates: -1}
+	assert.ErrorContains(t, sync.Validate(), "--max-creates can't be negative")
+}
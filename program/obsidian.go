@@ -9,9 +9,19 @@ import (
 )
 
 type ObsidianCmd struct {
-	Vault string  `help:"Path to vault" env:"VAULT_PATH" default:"." type:"existingdir"`
-	Sync  SyncCmd `name:"sync" cmd:"" help:"Sync data between Obsidian and remote source"`
-	List  ListCmd `name:"list" cmd:"" help:"List data from vault"`
+	Vault    string       `help:"Path to vault" env:"VAULT_PATH" default:"." type:"existingdir"`
+	Sync     SyncGroupCmd `name:"sync" cmd:"" help:"Sync data between Obsidian and remote source"`
+	List     ListCmd      `name:"list" cmd:"" help:"List data from vault"`
+	Stats    StatsCmd     `name:"stats" cmd:"" help:"Show page counts by folder and tag"`
+	Validate ValidateCmd  `name:"validate" cmd:"" help:"Check the vault for malformed or inconsistent pages"`
+	Backup   BackupCmd    `name:"backup" cmd:"" help:"Copy the vault to <vault>-backup-<timestamp> next to it"`
+	Export   ExportCmd    `name:"export" cmd:"" help:"Write the title, folder, tags, URL, aliases, badge color, web-message and path of pages as CSV, JSON or JSON Lines"`
+}
+
+// SyncGroupCmd holds the sync commands.  Running sync without a subcommand runs a sync.
+type SyncGroupCmd struct {
+	Run  SyncCmd     `name:"run" cmd:"" default:"withargs" help:"Sync data between Obsidian and remote source"`
+	Undo SyncUndoCmd `name:"undo" cmd:"" help:"Undo the changes made by the last sync"`
 }
 
 func (cmd *ObsidianCmd) Run(options *Options) error {
@@ -27,19 +37,24 @@ func (cmd *ObsidianCmd) AfterApply(ctx *kong.Context) error {
 			Msg("The specified path is not a valid Obsidian vault (missing .obsidian directory)")
 		return errors.New("invalid Obsidian vault path")
 	}
-	vault := obsidian.NewVault(cmd.Vault)
+	ctx.Bind(cmd)
+
+	// The vault is loaded when the command asks for it, so a subcommand can bind one loaded its own way instead
+	return ctx.BindToProvider(func() (*obsidian.Vault, error) {
+		vault := obsidian.NewVault(cmd.Vault)
+		if err := vault.Load(); err != nil {
+			log.Error().Err(err).Msg("Error loading vault")
+			return nil, err
+		}
+		logLoadedVault(vault)
+		return vault, nil
+	})
+}
 
-	err := vault.Load()
-	if err != nil {
-		log.Error().Err(err).Msg("Error loading vault")
-		return err
-	}
+// logLoadedVault logs the path and page count of a loaded vault
+func logLoadedVault(vault *obsidian.Vault) {
 	log.Info().
 		Str("path", vault.Path).
 		Int("pageCount", len(vault.Pages)).
 		Msg("Loaded vault")
-
-	ctx.Bind(vault)
-
-	return nil
 }
@@ -0,0 +1,64 @@
+package program
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/woodysmith1912/fetlife-data-tools/obsidian"
+	"gopkg.in/yaml.v3"
+)
+
+// overridesFileName is the name of the overrides file in the vault's .obsidian directory
+const overridesFileName = "fetlife-overrides.yaml"
+
+// overridesPath returns the path of the overrides file, <vault>/.obsidian/fetlife-overrides.yaml unless --overrides
+// is given
+func (sync *SyncCmd) overridesPath(vault *obsidian.Vault) string {
+	if sync.Overrides != "" {
+		return sync.Overrides
+	}
+	return filepath.Join(vault.Path, ".obsidian", overridesFileName)
+}
+
+// loadOverrides reads the overrides file, which maps user IDs to the vault relative paths of their pages, like
+//
+//	"12345": People/Anonymous.md
+//
+// and returns the page of each user.  A missing default file is no overrides, a missing --overrides file or an entry
+// without a page is an error.
+func (sync *SyncCmd) loadOverrides(vault *obsidian.Vault) (map[string]*obsidian.Page, error) {
+	path := sync.overridesPath(vault)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && sync.Overrides == "" {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries map[string]string
+	if err := yaml.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("invalid overrides in %s: %w", path, err)
+	}
+
+	overrides := make(map[string]*obsidian.Page, len(entries))
+	for _, userID := range slices.Sorted(maps.Keys(entries)) {
+		file := entries[userID]
+		if _, err := strconv.ParseUint(userID, 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid override %q: %q in %s, expected a numeric user ID", userID, file, path)
+		}
+		file = filepath.ToSlash(filepath.Clean(strings.TrimSpace(file)))
+		i := slices.IndexFunc(vault.Pages, func(page *obsidian.Page) bool { return pageFile(page) == file })
+		if i < 0 {
+			return nil, fmt.Errorf("invalid override %q: %q in %s, no page has that path", userID, file, path)
+		}
+		overrides[userID] = vault.Pages[i]
+	}
+	return overrides, nil
+}
@@ -0,0 +1,102 @@
+package program
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/woodysmith1912/fetlife-data-tools/obsidian"
+)
+
+func TestSyncCmd_Overrides(t *testing.T) {
+	tempVault := t.TempDir()
+	privatePath := filepath.Join(tempVault, "People", "Private.md")
+	writeTestFile(t, privatePath, "---\ntags:\n  - person\n---\n")
+	alicePath := filepath.Join(tempVault, "People", "Alice.md")
+	aliceContent := "---\ntags:\n  - person\nurl: https://fetlife.com/users/12345\n---\n"
+	writeTestFile(t, alicePath, aliceContent)
+	bobPath := filepath.Join(tempVault, "People", "Bob.md")
+	writeTestFile(t, bobPath, "---\ntags:\n  - person\nurl: https://fetlife.com/users/55555\n---\n")
+	writeTestFile(t, filepath.Join(tempVault, ".obsidian", overridesFileName), "\"12345\": People/Private.md\n")
+
+	dataDir := writeTestData(t, "", "12345,2024-01-01,2024-01-01,Keep this quiet\n55555,2024-01-01,2024-01-01,Bob's note\n")
+	sync := &SyncCmd{
+		DataDir:        []string{dataDir},
+		CreatePeopleIn: []string{"People"},
+	}
+	err := sync.Run(loadTestVault(t, tempVault))
+	assert.NoError(t, err)
+
+	// The override wins over the page with the user's URL, and the page doesn't get a URL
+	private, err := obsidian.LoadPage(privatePath, tempVault)
+	assert.NoError(t, err)
+	assert.Equal(t, "Keep this quiet", private.WebMessage)
+	assert.Empty(t, private.Url)
+	content, err := os.ReadFile(alicePath)
+	assert.NoError(t, err)
+	assert.Equal(t, aliceContent, string(content))
+
+	// Users without an override are matched by URL
+	bob, err := obsidian.LoadPage(bobPath, tempVault)
+	assert.NoError(t, err)
+	assert.Equal(t, "Bob's note", bob.WebMessage)
+	assert.Equal(t, 0, sync.summary.Created)
+}
+
+func TestLoadOverrides(t *testing.T) {
+	tempVault := t.TempDir()
+	writeTestFile(t, filepath.Join(tempVault, "People", "Private.md"), "---\ntags:\n  - person\n---\n")
+	writeTestFile(t, filepath.Join(tempVault, "Anonymous.md"), "")
+
+	tests := []struct {
+		name      string
+		overrides string
+		expected  map[string]string
+		err       string
+	}{
+		{
+			name:      "pages",
+			overrides: "\"12345\": People/Private.md\n23456: ./Anonymous.md\n",
+			expected:  map[string]string{"12345": "People/Private.md", "23456": "Anonymous.md"},
+		},
+		{name: "empty file", overrides: "", expected: map[string]string{}},
+		{
+			name:      "missing page",
+			overrides: "\"12345\": People/Private.md\n\"77777\": People/Gone.md\n",
+			err:       `invalid override "77777": "People/Gone.md"`,
+		},
+		{name: "user ID that isn't a number", overrides: "alice: People/Private.md\n", err: `invalid override "alice"`},
+		{name: "not a map", overrides: "- People/Private.md\n", err: "invalid overrides in"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "overrides.yaml")
+			writeTestFile(t, path, tt.overrides)
+
+			sync := &SyncCmd{Overrides: path}
+			overrides, err := sync.loadOverrides(loadTestVault(t, tempVault))
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			files := make(map[string]string)
+			for userID, page := range overrides {
+				files[userID] = pageFile(page)
+			}
+			assert.Equal(t, tt.expected, files)
+		})
+	}
+
+	// Only the default file may be missing
+	sync := &SyncCmd{}
+	overrides, err := sync.loadOverrides(loadTestVault(t, tempVault))
+	assert.NoError(t, err)
+	assert.Empty(t, overrides)
+
+	sync = &SyncCmd{Overrides: filepath.Join(t.TempDir(), "missing.yaml")}
+	_, err = sync.loadOverrides(loadTestVault(t, tempVault))
+	assert.Error(t, err)
+}
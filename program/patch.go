@@ -0,0 +1,115 @@
+package program
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/woodysmith1912/fetlife-data-tools/obsidian"
+)
+
+// JSONPatchOp is a single RFC 6902 JSON patch operation
+type JSONPatchOp struct {
+	Op    string `json:"op"`
+	From  string `json:"from,omitempty"`
+	Path  string `json:"path"`
+	Value any    `json:"value,omitempty"`
+
+	// removed is the value a "remove" operation takes away, kept for the human readable diff
+	removed string
+}
+
+// listFieldNames maps list metadata to the name used for a single element in the human readable diff
+var listFieldNames = map[string]string{
+	"tags":        "tag",
+	"aliases":     "alias",
+	"url-aliases": "url-alias",
+}
+
+// diffPage compares the metadata and content of two versions of a page and returns the operations that turn before
+// into after.  Paths are relative to the page, e.g. "/tags/-" or "/web-message".
+func diffPage(before, after *obsidian.Page) []JSONPatchOp {
+	var ops []JSONPatchOp
+	ops = append(ops, diffList("tags", before.Tags, after.Tags)...)
+	ops = append(ops, diffList("aliases", before.Aliases, after.Aliases)...)
+	ops = append(ops, diffScalar("url", before.Url, after.Url)...)
+	ops = append(ops, diffList("url-aliases", before.UrlAliases, after.UrlAliases)...)
+	ops = append(ops, diffScalar("web-badge-color", string(before.WebBadgeColor), string(after.WebBadgeColor))...)
+	ops = append(ops, diffScalar("web-message", before.WebMessage, after.WebMessage)...)
+	ops = append(ops, diffScalar("blocked-date", before.BlockedDate, after.BlockedDate)...)
+	ops = append(ops, diffScalar("blocked-at", before.BlockedAt, after.BlockedAt)...)
+	ops = append(ops, diffScalar("friend-date", before.FriendDate, after.FriendDate)...)
+	ops = append(ops, diffScalar("note-created", before.NoteCreated, after.NoteCreated)...)
+	ops = append(ops, diffScalar("note-updated", before.NoteUpdated, after.NoteUpdated)...)
+	ops = append(ops, diffScalar("created-at", before.CreatedAt, after.CreatedAt)...)
+	ops = append(ops, diffScalar("synced-at", before.SyncedAt, after.SyncedAt)...)
+	ops = append(ops, diffScalar("content", before.Content, after.Content)...)
+	return ops
+}
+
+// diffList returns removals, from the last index down so earlier indexes stay valid, followed by additions
+func diffList(key string, before, after []string) []JSONPatchOp {
+	var ops []JSONPatchOp
+	for i := len(before) - 1; i >= 0; i-- {
+		if !slices.Contains(after, before[i]) {
+			ops = append(ops, JSONPatchOp{Op: "remove", Path: fmt.Sprintf("/%s/%d", key, i), removed: before[i]})
+		}
+	}
+	for _, value := range after {
+		if !slices.Contains(before, value) {
+			ops = append(ops, JSONPatchOp{Op: "add", Path: "/" + key + "/-", Value: value})
+		}
+	}
+	return ops
+}
+
+// diffScalar returns the operation, if any, that changes a single value
+func diffScalar(key, before, after string) []JSONPatchOp {
+	switch {
+	case before == after:
+		return nil
+	case before == "":
+		return []JSONPatchOp{{Op: "add", Path: "/" + key, Value: after}}
+	case after == "":
+		return []JSONPatchOp{{Op: "remove", Path: "/" + key, removed: before}}
+	default:
+		return []JSONPatchOp{{Op: "replace", Path: "/" + key, Value: after}}
+	}
+}
+
+// describeChange renders a page relative operation as a line of a human readable diff, e.g. "+ tag blocked"
+func describeChange(op JSONPatchOp) string {
+	key, index, isList := strings.Cut(strings.TrimPrefix(op.Path, "/"), "/")
+	field := key
+	if isList {
+		field = listFieldNames[key]
+	}
+
+	switch {
+	case op.Op == "add" && (isList && index == "-"):
+		return fmt.Sprintf("+ %s %v", field, op.Value)
+	case op.Op == "remove" && isList:
+		return fmt.Sprintf("- %s %s", field, op.removed)
+	case op.Op == "remove":
+		return fmt.Sprintf("- %s", field)
+	default:
+		return fmt.Sprintf("~ %s updated", field)
+	}
+}
+
+// pageFile returns the page's file path relative to the vault, using forward slashes
+func pageFile(page *obsidian.Page) string {
+	return filepath.ToSlash(filepath.Join(page.Folder, page.Title+".md"))
+}
+
+// filePointer returns the JSON pointer for a file relative to the vault, treating each folder as an object
+func filePointer(file string) string {
+	var pointer strings.Builder
+	for _, segment := range strings.Split(file, "/") {
+		segment = strings.ReplaceAll(segment, "~", "~0")
+		segment = strings.ReplaceAll(segment, "/", "~1")
+		pointer.WriteString("/" + segment)
+	}
+	return pointer.String()
+}
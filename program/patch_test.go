@@ -0,0 +1,125 @@
+package program
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/woodysmith1912/fetlife-data-tools/obsidian"
+	"github.com/zenizh/go-capturer"
+)
+
+func TestDiffPage(t *testing.T) {
+	before := &obsidian.Page{
+		Tags:        []string{"person", "friend", "met"},
+		Url:         "https://fetlife.com/users/12345",
+		WebMessage:  "Old message",
+		NoteCreated: "2024-01-01",
+	}
+	after := before.Clone()
+	after.Tags = []string{"person", "blocked"}
+	after.Aliases = []string{"Someone"}
+	after.WebMessage = "New message"
+	after.BlockedDate = "2024-02-01"
+	after.NoteCreated = ""
+	after.Content = "# Someone\n"
+
+	ops := diffPage(before, after)
+
+	assert.Equal(t, []JSONPatchOp{
+		{Op: "remove", Path: "/tags/2", removed: "met"},
+		{Op: "remove", Path: "/tags/1", removed: "friend"},
+		{Op: "add", Path: "/tags/-", Value: "blocked"},
+		{Op: "add", Path: "/aliases/-", Value: "Someone"},
+		{Op: "replace", Path: "/web-message", Value: "New message"},
+		{Op: "add", Path: "/blocked-date", Value: "2024-02-01"},
+		{Op: "remove", Path: "/note-created", removed: "2024-01-01"},
+		{Op: "add", Path: "/content", Value: "# Someone\n"},
+	}, ops)
+
+	assert.Empty(t, diffPage(before, before.Clone()))
+}
+
+func TestDescribeChange(t *testing.T) {
+	tests := []struct {
+		op       JSONPatchOp
+		expected string
+	}{
+		{op: JSONPatchOp{Op: "add", Path: "/tags/-", Value: "blocked"}, expected: "+ tag blocked"},
+		{op: JSONPatchOp{Op: "add", Path: "/aliases/-", Value: "Frank"}, expected: "+ alias Frank"},
+		{op: JSONPatchOp{Op: "remove", Path: "/tags/0", removed: "friend"}, expected: "- tag friend"},
+		{op: JSONPatchOp{Op: "replace", Path: "/web-message", Value: "Hi"}, expected: "~ web-message updated"},
+		{op: JSONPatchOp{Op: "add", Path: "/blocked-date", Value: "2024-01-01"}, expected: "~ blocked-date updated"},
+		{op: JSONPatchOp{Op: "remove", Path: "/web-badge-color"}, expected: "- web-badge-color"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expected, func(t *testing.T) {
+			assert.Equal(t, tt.expected, describeChange(tt.op))
+		})
+	}
+}
+
+func TestFilePointer(t *testing.T) {
+	assert.Equal(t, "/Bad People/Frank.md", filePointer("Bad People/Frank.md"))
+	assert.Equal(t, "/Index.md", filePointer("Index.md"))
+	assert.Equal(t, "/People/a~0b.md", filePointer("People/a~b.md"))
+}
+
+func TestSyncCmd_DryRunJSONPatch(t *testing.T) {
+	tempVault := t.TempDir()
+
+	writeTestFile(t, filepath.Join(tempVault, "Bad People", "Frank.md"), `---
+tags:
+  - person
+url: https://fetlife.com/users/98765
+---
+`)
+
+	testDataDir := writeTestData(t,
+		"98765,2024-01-01,2024-01-01,Frank\n",
+		"11111,2024-01-01,2024-01-01,Nice person\n")
+
+	sync := &SyncCmd{
+		DataDir:         []string{testDataDir},
+		CreatePeopleIn:  []string{"People"},
+		CreateBlockedIn: []string{"Bad People"},
+		DryRun:          true,
+		DryRunFormat:    "json-patch",
+		now:             fixedNow,
+	}
+
+	vault := loadTestVault(t, tempVault)
+
+	var err error
+	out := capturer.CaptureStdout(func() {
+		err = sync.Run(vault)
+		assert.NoError(t, err)
+	})
+
+	var patch []map[string]any
+	err = json.Unmarshal([]byte(out), &patch)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []map[string]any{
+		{"op": "add", "path": "/Bad People/Frank.md/tags/-", "value": "blocked"},
+		{"op": "add", "path": "/Bad People/Frank.md/web-badge-color", "value": "#F44336"},
+		{"op": "add", "path": "/Bad People/Frank.md/blocked-date", "value": "2024-01-01"},
+		{"op": "add", "path": "/Bad People/Frank.md/blocked-at", "value": "2024-01-01"},
+		{"op": "add", "path": "/Bad People/Frank.md/synced-at", "value": "2024-06-01T12:00:00Z"},
+		{"op": "add", "path": "/People/user-11111.md", "value": `---
+tags:
+  - person
+url: https://fetlife.com/users/11111
+web-message: Nice person
+note-created: "2024-01-01"
+note-updated: "2024-01-01"
+created-at: "2024-06-01T12:00:00Z"
+synced-at: "2024-06-01T12:00:00Z"
+---
+
+# Notes
+`},
+	}, patch)
+}
@@ -0,0 +1,107 @@
+package program
+
+import (
+	"sync"
+
+	"github.com/woodysmith1912/fetlife-data-tools/obsidian"
+)
+
+// parallel calls work with every index from 0 to n-1, on up to workers goroutines at a time, and waits for the calls
+// to finish.  Once a call returns an error no new calls are started and the first error is returned.  With a single
+// worker the calls are made in order on the calling goroutine.
+func parallel(n, workers int, work func(i int) error) error {
+	if workers <= 1 {
+		for i := range n {
+			if err := work(i); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	failed := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return firstErr != nil
+	}
+
+	indexes := make(chan int)
+	for range min(workers, n) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if err := work(i); err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for i := 0; i < n && !failed(); i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return firstErr
+}
+
+// groupByUser splits the indexes of n records into the indexes of each user's records, in the order their users
+// first appear, so the records of a user can be processed one after the other while other users are processed in
+// parallel
+func groupByUser(n int, userID func(i int) string) [][]int {
+	var groups [][]int
+	index := make(map[string]int)
+	for i := range n {
+		group, ok := index[userID(i)]
+		if !ok {
+			group = len(groups)
+			index[userID(i)] = group
+			groups = append(groups, nil)
+		}
+		groups[group] = append(groups[group], i)
+	}
+	return groups
+}
+
+// syncLocks are the locks that let a sync process the records of several users at once
+type syncLocks struct {
+	// state guards the summary, the pages created so far, the templates found, the dry run's patch and the journal
+	state sync.Mutex
+	// files is held while picking the file name of a page and creating, renaming or moving it, so two pages never
+	// end up with the same file
+	files sync.Mutex
+	// pages guards the pages themselves, since records of different users can resolve to the same page
+	pages pageLocks
+}
+
+// pageLocks hands out a mutex per page
+type pageLocks struct {
+	mu    sync.Mutex
+	locks map[*obsidian.Page]*sync.Mutex
+}
+
+// lock locks the mutex of page and returns the function that unlocks it
+func (locks *pageLocks) lock(page *obsidian.Page) func() {
+	locks.mu.Lock()
+	if locks.locks == nil {
+		locks.locks = make(map[*obsidian.Page]*sync.Mutex)
+	}
+	lock, ok := locks.locks[page]
+	if !ok {
+		lock = &sync.Mutex{}
+		locks.locks[page] = lock
+	}
+	locks.mu.Unlock()
+
+	lock.Lock()
+	return lock.Unlock
+}
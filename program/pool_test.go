@@ -0,0 +1,54 @@
+package program
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParallel(t *testing.T) {
+	for _, workers := range []int{0, 1, 4, 100} {
+		var calls atomic.Int32
+		done := make([]bool, 50)
+		err := parallel(len(done), workers, func(i int) error {
+			calls.Add(1)
+			done[i] = true
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, int32(50), calls.Load(), "workers %d", workers)
+		assert.NotContains(t, done, false, "workers %d", workers)
+	}
+
+	// No new calls are started after an error, and the first error is returned
+	failure := errors.New("failure")
+	var calls atomic.Int32
+	err := parallel(1000, 4, func(i int) error {
+		calls.Add(1)
+		return failure
+	})
+	assert.ErrorIs(t, err, failure)
+	assert.Less(t, calls.Load(), int32(1000))
+
+	// A single worker stops right away
+	calls.Store(0)
+	err = parallel(10, 1, func(i int) error {
+		calls.Add(1)
+		if i == 2 {
+			return failure
+		}
+		return nil
+	})
+	assert.ErrorIs(t, err, failure)
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestGroupByUser(t *testing.T) {
+	userIDs := []string{"1", "2", "1", "3", "2", "1"}
+	groups := groupByUser(len(userIDs), func(i int) string { return userIDs[i] })
+	assert.Equal(t, [][]int{{0, 2, 5}, {1, 4}, {3}}, groups)
+
+	assert.Empty(t, groupByUser(0, func(i int) string { return "" }))
+}
@@ -14,18 +14,21 @@ import (
 
 // Options is the structure of program options
 type Options struct {
-	Debug        bool           `group:"Info" help:"Show debugging information"`
-	OutputFormat string         `group:"Info" enum:"auto,jsonl,terminal" default:"auto" help:"How to show program output (auto|terminal|jsonl)"`
-	Quiet        bool           `group:"Info" help:"Be less verbose than usual"`
-	Version      VersionCmd     `name:"version" cmd:"" help:"Show program version"`
-	Obsidian     ObsidianCmd    `name:"obsidian" cmd:"" help:"Obsidian related commands"`
-	Spreadsheet  SpreadsheetCmd `name:"spreadsheet" cmd:"" help:"Spreadsheet related commands"`
+	Debug        bool            `group:"Info" help:"Show debugging information"`
+	OutputFormat string          `group:"Info" enum:"auto,jsonl,terminal" default:"auto" help:"How to show program output (auto|terminal|jsonl)"`
+	Quiet        bool            `group:"Info" help:"Be less verbose than usual"`
+	ConfigFile   kong.ConfigFlag `name:"config" help:"YAML file with default values for the flags, keyed by flag name in snake_case (see config init)" type:"path"`
+	Version      VersionCmd      `name:"version" cmd:"" help:"Show program version"`
+	Obsidian     ObsidianCmd     `name:"obsidian" cmd:"" help:"Obsidian related commands"`
+	Spreadsheet  SpreadsheetCmd  `name:"spreadsheet" cmd:"" help:"Spreadsheet related commands"`
+	Config       ConfigCmd       `name:"config" cmd:"" help:"Config file related commands"`
 }
 
 // Parse calls the CLI parsing routines
 func (program *Options) Parse(args []string) (*kong.Context, error) {
 	parser, err := kong.New(program,
 		kong.ShortUsageOnError(),
+		kong.Configuration(configLoader),
 		// kong.Description("Brief Program Summary"),
 	)
 
@@ -1,11 +1,14 @@
 package program
 
 import (
+	"encoding/json"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/woodysmith1912/fetlife-data-tools/obsidian"
 	"github.com/zenizh/go-capturer"
 )
 
@@ -63,6 +66,193 @@ func TestListCmd_Run(t *testing.T) {
 	assert.NotContains(t, out, "Person: George")
 }
 
+func TestListCmd_Folder(t *testing.T) {
+	vaultPath, err := filepath.Abs("../example/vault")
+	if err != nil {
+		t.Fatalf("Failed to get vault path: %v", err)
+	}
+
+	var program Options
+
+	ctx, err := program.Parse([]string{"obsidian", "--vault", vaultPath, "list", "--folder", "Bad People"})
+	assert.NoError(t, err)
+
+	out := capturer.CaptureStdout(func() {
+		err = ctx.Run(&program)
+		assert.NoError(t, err)
+	})
+
+	assert.Contains(t, out, "Person: Frank")
+	assert.Contains(t, out, "Person: Jane")
+	assert.NotContains(t, out, "Person: Alice")
+
+	// A folder without pages says so
+	ctx, err = program.Parse([]string{"obsidian", "--vault", vaultPath, "list", "--folder", "Friends"})
+	assert.NoError(t, err)
+
+	out = capturer.CaptureStdout(func() {
+		err = ctx.Run(&program)
+		assert.NoError(t, err)
+	})
+
+	assert.Equal(t, "No pages found in folder \"Friends\"\n", out)
+}
+
+func TestListCmd_AllFolders(t *testing.T) {
+	vaultPath, err := filepath.Abs("../example/vault")
+	if err != nil {
+		t.Fatalf("Failed to get vault path: %v", err)
+	}
+
+	var program Options
+
+	ctx, err := program.Parse([]string{"obsidian", "--vault", vaultPath, "list", "--all-folders"})
+	assert.NoError(t, err)
+
+	out := capturer.CaptureStdout(func() {
+		err = ctx.Run(&program)
+		assert.NoError(t, err)
+	})
+
+	// Every folder gets a header, in order, followed by its pages
+	headers := []string{"== . (5) ==", "== Bad People (5) ==", "== People (5) ==", "== Templates (1) =="}
+	last := -1
+	for _, header := range headers {
+		i := strings.Index(out, header)
+		assert.Greater(t, i, last, header)
+		last = i
+	}
+	assert.True(t, strings.HasPrefix(out, headers[0]))
+	bad := strings.Index(out, "== Bad People")
+	people := strings.Index(out, "== People")
+	assert.Contains(t, out[bad:people], "Person: Frank")
+	assert.Contains(t, out[people:], "Person: Alice")
+	assert.Contains(t, out[:bad], "Person: Index")
+}
+
+func TestListCmd_Search(t *testing.T) {
+	vaultPath, err := filepath.Abs("../example/vault")
+	if err != nil {
+		t.Fatalf("Failed to get vault path: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		args        []string
+		expected    []string
+		notExpected []string
+	}{
+		{
+			name:        "substring",
+			args:        []string{"--search", "PHOTO"},
+			expected:    []string{"Person: Alice", "Person: Helen"},
+			notExpected: []string{"Person: Bob", "Person: George"},
+		},
+		{
+			name:        "regex",
+			args:        []string{"--search", `\b(climbing|hiking)\b`, "--search-regex"},
+			expected:    []string{"Person: Alice", "Person: Bob"},
+			notExpected: []string{"Person: Carol", "Person: Helen"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var program Options
+			ctx, err := program.Parse(append([]string{"obsidian", "--vault", vaultPath, "list"}, tt.args...))
+			assert.NoError(t, err)
+
+			out := capturer.CaptureStdout(func() {
+				err = ctx.Run(&program)
+				assert.NoError(t, err)
+			})
+
+			for _, expected := range tt.expected {
+				assert.Contains(t, out, expected)
+			}
+			for _, notExpected := range tt.notExpected {
+				assert.NotContains(t, out, notExpected)
+			}
+		})
+	}
+}
+
+func TestListCmd_Tags(t *testing.T) {
+	vaultPath, err := filepath.Abs("../example/vault")
+	if err != nil {
+		t.Fatalf("Failed to get vault path: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		args        []string
+		expected    []string
+		notExpected []string
+	}{
+		{
+			name:        "any tag",
+			args:        []string{"--tag", "friend", "--tag", "blocked"},
+			expected:    []string{"Person: Alice", "Person: Carol", "Person: Emma", "Person: Frank", "Person: Jane"},
+			notExpected: []string{"Person: Bob", "Person: David"},
+		},
+		{
+			name:        "all tags",
+			args:        []string{"--tag", "person", "--tag", "friend", "--all-tags"},
+			expected:    []string{"Person: Alice", "Person: Carol", "Person: Emma"},
+			notExpected: []string{"Person: Bob", "Person: Frank"},
+		},
+		{
+			name:        "match all tags alias",
+			args:        []string{"--tag", "person", "--tag", "friend", "--match-all-tags"},
+			expected:    []string{"Person: Alice", "Person: Carol", "Person: Emma", "Showing 3 of 16 pages (filtered by tag: person, friend)"},
+			notExpected: []string{"Person: Bob", "Person: Frank"},
+		},
+		{
+			name:        "tag in folder",
+			args:        []string{"--tag", "friend", "--tag", "blocked", "--folder", "People"},
+			expected:    []string{"Person: Alice", "Person: Carol", "Person: Emma", "Showing 3 of 5 pages (filtered by tag: friend, blocked)"},
+			notExpected: []string{"Person: Bob", "Person: Frank", "Person: Jane"},
+		},
+		{
+			name:        "tag and search",
+			args:        []string{"--tag", "blocked", "--search", "photos"},
+			expected:    []string{"Person: Helen"},
+			notExpected: []string{"Person: Alice", "Person: Frank"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var program Options
+			ctx, err := program.Parse(append([]string{"obsidian", "--vault", vaultPath, "list"}, tt.args...))
+			assert.NoError(t, err)
+
+			out := capturer.CaptureStdout(func() {
+				err = ctx.Run(&program)
+				assert.NoError(t, err)
+			})
+
+			for _, expected := range tt.expected {
+				assert.Contains(t, out, expected)
+			}
+			for _, notExpected := range tt.notExpected {
+				assert.NotContains(t, out, notExpected)
+			}
+		})
+	}
+}
+
+func TestListCmd_SearchInvalidRegex(t *testing.T) {
+	vaultPath, err := filepath.Abs("../example/vault")
+	if err != nil {
+		t.Fatalf("Failed to get vault path: %v", err)
+	}
+
+	var program Options
+	_, err = program.Parse([]string{"obsidian", "--vault", vaultPath, "list", "--search", "[unclosed", "--search-regex"})
+	assert.Error(t, err)
+}
+
 func TestListCmd_EmptyVault(t *testing.T) {
 	// Create a temporary empty vault
 	tempDir := t.TempDir()
@@ -110,6 +300,78 @@ func TestListCmd_VaultPath(t *testing.T) {
 	assert.Contains(t, out, "Person: Alice")
 }
 
+func TestListCmd_JSON(t *testing.T) {
+	// Get the path to the example vault
+	vaultPath, err := filepath.Abs("../example/vault")
+	if err != nil {
+		t.Fatalf("Failed to get vault path: %v", err)
+	}
+
+	var program Options
+
+	ctx, err := program.Parse([]string{"obsidian", "--vault", vaultPath, "list", "--format", "json"})
+	assert.NoError(t, err)
+
+	out := capturer.CaptureStdout(func() {
+		err = ctx.Run(&program)
+		assert.NoError(t, err)
+	})
+
+	// Output must be a valid JSON array with one object per person
+	var summaries []obsidian.PageSummary
+	err = json.Unmarshal([]byte(out), &summaries)
+	assert.NoError(t, err)
+	assert.Len(t, summaries, 5)
+
+	for _, summary := range summaries {
+		assert.Equal(t, "People", summary.Folder)
+		if summary.Title == "Alice" {
+			assert.Equal(t, "https://fetlife.com/users/12345", summary.URL)
+			assert.Equal(t, []string{"person", "friend"}, summary.Tags)
+		}
+	}
+}
+
+func TestListCmd_FormatPrecedence(t *testing.T) {
+	// Get the path to the example vault
+	vaultPath, err := filepath.Abs("../example/vault")
+	if err != nil {
+		t.Fatalf("Failed to get vault path: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "default is text",
+			args:     []string{"obsidian", "--vault", vaultPath, "list"},
+			expected: "text",
+		},
+		{
+			name:     "jsonl output format selects json",
+			args:     []string{"--output-format", "jsonl", "obsidian", "--vault", vaultPath, "list"},
+			expected: "json",
+		},
+		{
+			name:     "format flag overrides output format",
+			args:     []string{"--output-format", "jsonl", "obsidian", "--vault", vaultPath, "list", "--format", "text"},
+			expected: "text",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var program Options
+
+			_, err := program.Parse(tt.args)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, program.Obsidian.List.format(&program))
+		})
+	}
+}
+
 func TestSyncCmd_Parse(t *testing.T) {
 	// Create a temporary vault for the test
 	tempVault := t.TempDir()
@@ -131,8 +393,115 @@ func TestSyncCmd_Parse(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, ctx)
 
-	// Verify the sync command was selected
-	assert.Equal(t, "obsidian sync", ctx.Command())
+	// Verify the sync command was selected, running a sync is the default
+	assert.Equal(t, "obsidian sync run", ctx.Command())
+}
+
+func TestSyncCmd_ParseFolderColor(t *testing.T) {
+	tempVault := t.TempDir()
+	err := os.Mkdir(filepath.Join(tempVault, ".obsidian"), 0755)
+	assert.NoError(t, err)
+
+	dataPath, err := filepath.Abs("../example/test-data")
+	if err != nil {
+		t.Fatalf("Failed to get data path: %v", err)
+	}
+
+	var program Options
+	_, err = program.Parse([]string{"obsidian", "--vault", tempVault, "sync", "--data-dir", dataPath,
+		"--folder-color", "Bad People=#F44336", "--folder-color", "Friends=#4CAF50"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"Bad People": "#F44336", "Friends": "#4CAF50"}, program.Obsidian.Sync.Run.FolderColor)
+
+	_, err = program.Parse([]string{"obsidian", "--vault", tempVault, "sync", "--data-dir", dataPath,
+		"--folder-color", "Bad People=red"})
+	assert.Error(t, err)
+}
+
+func TestSyncCmd_ParseNoCreate(t *testing.T) {
+	tempVault := t.TempDir()
+	err := os.Mkdir(filepath.Join(tempVault, ".obsidian"), 0755)
+	assert.NoError(t, err)
+
+	dataPath, err := filepath.Abs("../example/test-data")
+	if err != nil {
+		t.Fatalf("Failed to get data path: %v", err)
+	}
+
+	// --no-create is another name for --update-only
+	var program Options
+	ctx, err := program.Parse([]string{"obsidian", "--vault", tempVault, "--quiet", "sync", "--data-dir", dataPath,
+		"--no-create", "--no-cache", "--state-file", filepath.Join(t.TempDir(), "state.json")})
+	assert.NoError(t, err)
+	assert.True(t, program.Obsidian.Sync.Run.UpdateOnly)
+
+	capturer.CaptureStdout(func() {
+		assert.NoError(t, ctx.Run(&program))
+	})
+	assert.Zero(t, program.Obsidian.Sync.Run.summary.Created)
+	assert.NotZero(t, program.Obsidian.Sync.Run.summary.Missing)
+	pages, err := filepath.Glob(filepath.Join(tempVault, "*", "*.md"))
+	assert.NoError(t, err)
+	assert.Empty(t, pages, "no pages are created in a fresh vault")
+
+	_, err = program.Parse([]string{"obsidian", "--vault", tempVault, "sync", "--data-dir", dataPath,
+		"--no-create", "--create-only"})
+	assert.Error(t, err)
+}
+
+func TestSyncCmd_ParseOnly(t *testing.T) {
+	tempVault := t.TempDir()
+	err := os.Mkdir(filepath.Join(tempVault, ".obsidian"), 0755)
+	assert.NoError(t, err)
+
+	dataPath, err := filepath.Abs("../example/test-data")
+	if err != nil {
+		t.Fatalf("Failed to get data path: %v", err)
+	}
+
+	var program Options
+	_, err = program.Parse([]string{"obsidian", "--vault", tempVault, "sync", "--data-dir", dataPath,
+		"--only", "blocked", "--only", "notes"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"blocked", "notes"}, program.Obsidian.Sync.Run.Only)
+
+	_, err = program.Parse([]string{"obsidian", "--vault", tempVault, "sync", "--data-dir", dataPath,
+		"--only", "blocked", "--skip", "notes"})
+	assert.Error(t, err)
+
+	_, err = program.Parse([]string{"obsidian", "--vault", tempVault, "sync", "--data-dir", dataPath,
+		"--skip", "messages"})
+	assert.Error(t, err)
+
+	program = Options{}
+	_, err = program.Parse([]string{"obsidian", "--vault", tempVault, "sync", "--data-dir", dataPath})
+	assert.NoError(t, err)
+	assert.Equal(t, "", program.Obsidian.Sync.Run.OnConflict)
+
+	_, err = program.Parse([]string{"obsidian", "--vault", tempVault, "sync", "--data-dir", dataPath,
+		"--on-conflict", "record"})
+	assert.NoError(t, err)
+	assert.Equal(t, "record", program.Obsidian.Sync.Run.OnConflict)
+
+	_, err = program.Parse([]string{"obsidian", "--vault", tempVault, "sync", "--data-dir", dataPath,
+		"--on-conflict", "merge"})
+	assert.Error(t, err)
+
+	// Keywords after a folder aren't split into folders of their own
+	program = Options{}
+	_, err = program.Parse([]string{"obsidian", "--vault", tempVault, "sync", "--data-dir", dataPath,
+		"--create-people-in", "People", "--create-people-in", "Bad People:creepy,stalker",
+		"--create-blocked-in", "Event Bans:event,munch"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"People", "Bad People:creepy,stalker"}, program.Obsidian.Sync.Run.CreatePeopleIn)
+	assert.Equal(t, []string{"Event Bans:event,munch"}, program.Obsidian.Sync.Run.CreateBlockedIn)
+
+	program = Options{}
+	_, err = program.Parse([]string{"obsidian", "--vault", tempVault, "sync", "--data-dir", dataPath,
+		"--folder-tags", "Bad People=avoid,do-not-engage", "--folder-tags", "Friends=friend"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"Bad People": "avoid,do-not-engage", "Friends": "friend"},
+		program.Obsidian.Sync.Run.FolderTags)
 }
 
 func TestSyncCmd_Run(t *testing.T) {
@@ -171,8 +540,9 @@ url: https://fetlife.com/users/
 
 	var program Options
 
-	// Parse the sync command
-	ctx, err := program.Parse([]string{"obsidian", "--vault", tempVault, "sync", "--data-dir", dataPath})
+	// Parse the sync command, keeping the sync state out of the example data
+	ctx, err := program.Parse([]string{"obsidian", "--vault", tempVault, "sync", "--data-dir", dataPath,
+		"--state-file", filepath.Join(t.TempDir(), "sync-state.json")})
 	assert.NoError(t, err)
 
 	// Run the sync command - should not error
@@ -253,3 +623,104 @@ func TestProgramOutputFormatInvalid(t *testing.T) {
 	// Kong should reject invalid enum values
 	assert.Contains(t, err.Error(), "must be one of")
 }
+
+func TestSyncCmd_ParseUpdateOnlyAndCreateOnly(t *testing.T) {
+	tempVault := t.TempDir()
+	err := os.Mkdir(filepath.Join(tempVault, ".obsidian"), 0755)
+	assert.NoError(t, err)
+
+	dataPath, err := filepath.Abs("../example/test-data")
+	if err != nil {
+		t.Fatalf("Failed to get data path: %v", err)
+	}
+
+	var program Options
+
+	// The two modes contradict each other
+	_, err = program.Parse([]string{"obsidian", "--vault", tempVault, "sync", "--data-dir", dataPath, "--update-only", "--create-only"})
+	assert.Error(t, err)
+}
+
+func TestStatsCmd_Run(t *testing.T) {
+	// Get the path to the example vault
+	vaultPath, err := filepath.Abs("../example/vault")
+	if err != nil {
+		t.Fatalf("Failed to get vault path: %v", err)
+	}
+
+	var program Options
+
+	ctx, err := program.Parse([]string{"obsidian", "--vault", vaultPath, "stats"})
+	assert.NoError(t, err)
+
+	out := capturer.CaptureStdout(func() {
+		err = ctx.Run(&program)
+		assert.NoError(t, err)
+	})
+
+	assert.Contains(t, out, "Total pages: 16")
+	assert.Contains(t, out, "Pages with URL: 13")
+	assert.Contains(t, out, "Pages without URL: 3")
+	assert.Contains(t, out, "  People: 5")
+	assert.Contains(t, out, "  Bad People: 5")
+	assert.Contains(t, out, "  person: 10")
+	assert.Contains(t, out, "  blocked: 5")
+}
+
+func TestStatsCmd_JSON(t *testing.T) {
+	// Get the path to the example vault
+	vaultPath, err := filepath.Abs("../example/vault")
+	if err != nil {
+		t.Fatalf("Failed to get vault path: %v", err)
+	}
+
+	var program Options
+
+	ctx, err := program.Parse([]string{"obsidian", "--vault", vaultPath, "stats", "--json"})
+	assert.NoError(t, err)
+
+	out := capturer.CaptureStdout(func() {
+		err = ctx.Run(&program)
+		assert.NoError(t, err)
+	})
+
+	var statistics vaultStatistics
+	err = json.Unmarshal([]byte(out), &statistics)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 16, statistics.TotalPages)
+	assert.Equal(t, 13, statistics.WithURL)
+	assert.Equal(t, 3, statistics.WithoutURL)
+
+	// Folders are sorted by count, then name
+	assert.Equal(t, []namedCount{
+		{Name: ".", Count: 5},
+		{Name: "Bad People", Count: 5},
+		{Name: "People", Count: 5},
+		{Name: "Templates", Count: 1},
+	}, statistics.Folders)
+	assert.Equal(t, namedCount{Name: "person", Count: 10}, statistics.Tags[0])
+}
+
+func TestSyncCmd_ParseDataDirs(t *testing.T) {
+	tempVault := t.TempDir()
+	err := os.Mkdir(filepath.Join(tempVault, ".obsidian"), 0755)
+	assert.NoError(t, err)
+
+	dataPath, err := filepath.Abs("../example/test-data")
+	if err != nil {
+		t.Fatalf("Failed to get data path: %v", err)
+	}
+	otherPath := writeTestData(t, "", "")
+
+	var program Options
+	_, err = program.Parse([]string{"obsidian", "--vault", tempVault, "sync", "--data-dir", dataPath,
+		"--data-dir", otherPath})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{dataPath, otherPath}, program.Obsidian.Sync.Run.DataDir)
+	assert.Equal(t, 1, program.Obsidian.Sync.Run.Concurrency, "records are processed in file order by default")
+
+	_, err = program.Parse([]string{"obsidian", "--vault", tempVault, "sync", "--data-dir", dataPath,
+		"--data-dir", filepath.Join(tempVault, "missing")})
+	assert.Error(t, err)
+}
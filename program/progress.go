@@ -0,0 +1,95 @@
+package program
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// progressEvery is how many records are processed between two progress events
+	progressEvery = 500
+	// progressInterval is the longest time between two progress events
+	progressInterval = 5 * time.Second
+	// progressBarWidth is the number of characters of the progress bar between its brackets
+	progressBarWidth = 30
+)
+
+// progress reports how far a sync is through its records, either as log events or as a progress bar
+type progress struct {
+	total int
+	done  int
+	// bar is where the progress bar is drawn, nil to log progress events instead
+	bar   io.Writer
+	start time.Time
+	last  time.Time
+	now   func() time.Time
+	// finished is set once the progress bar has been ended
+	finished bool
+	// mu lets records processed at the same time report their progress
+	mu sync.Mutex
+}
+
+// newProgress starts reporting the progress of processing total records.  A nil bar logs progress events.
+func newProgress(total int, bar io.Writer) *progress {
+	p := &progress{total: total, bar: bar, now: time.Now}
+	p.start = p.now()
+	p.last = p.start
+	return p
+}
+
+// Step records that one more record was processed
+func (p *progress) Step() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done++
+	now := p.now()
+	if p.bar != nil {
+		p.draw(now)
+		return
+	}
+	if p.done%progressEvery != 0 && now.Sub(p.last) < progressInterval && p.done != p.total {
+		return
+	}
+	p.last = now
+	log.Info().
+		Int("processed", p.done).
+		Int("total", p.total).
+		Dur("eta", p.eta(now)).
+		Msg("Sync progress")
+}
+
+// Finish ends the progress bar so the next output starts on a line of its own.  Calling it again does nothing.
+func (p *progress) Finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.bar != nil && p.done > 0 && !p.finished {
+		fmt.Fprintln(p.bar)
+	}
+	p.finished = true
+}
+
+// eta estimates the time left from the average time per record so far
+func (p *progress) eta(now time.Time) time.Duration {
+	if p.done == 0 || p.done >= p.total {
+		return 0
+	}
+	perRecord := now.Sub(p.start) / time.Duration(p.done)
+	return (perRecord * time.Duration(p.total-p.done)).Round(time.Second)
+}
+
+func (p *progress) draw(now time.Time) {
+	filled := progressBarWidth
+	percent := 100
+	if p.total > 0 {
+		filled = progressBarWidth * p.done / p.total
+		percent = 100 * p.done / p.total
+	}
+	fmt.Fprintf(p.bar, "\r[%s%s] %d/%d %3d%% ETA %s ",
+		strings.Repeat("#", filled), strings.Repeat("-", progressBarWidth-filled),
+		p.done, p.total, percent, p.eta(now))
+}
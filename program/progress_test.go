@@ -0,0 +1,82 @@
+package program
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClock returns a clock for a progress that moves forward by step every time it is read
+func fakeClock(step time.Duration) func() time.Time {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	return func() time.Time {
+		now = now.Add(step)
+		return now
+	}
+}
+
+func TestProgress_Log(t *testing.T) {
+	var out bytes.Buffer
+	logger := log.Logger
+	log.Logger = zerolog.New(&out)
+	defer func() { log.Logger = logger }()
+
+	p := newProgress(1200, nil)
+	p.now = fakeClock(5 * time.Millisecond)
+	p.start = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	p.last = p.start
+	for range 1200 {
+		p.Step()
+	}
+	p.Finish()
+
+	// Every progressEvery records and once at the end
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 3)
+	assert.Contains(t, lines[0], `"processed":500,"total":1200,"eta":4000`)
+	assert.Contains(t, lines[1], `"processed":1000,"total":1200,"eta":1000`)
+	assert.Contains(t, lines[2], `"processed":1200,"total":1200,"eta":0`)
+}
+
+func TestProgress_Interval(t *testing.T) {
+	var out bytes.Buffer
+	logger := log.Logger
+	log.Logger = zerolog.New(&out)
+	defer func() { log.Logger = logger }()
+
+	// A slow sync reports progress every progressInterval even between progressEvery records
+	p := newProgress(10, nil)
+	p.now = fakeClock(2 * time.Second)
+	p.start = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	p.last = p.start
+	for range 4 {
+		p.Step()
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 1)
+	assert.Contains(t, lines[0], `"processed":3,"total":10`)
+}
+
+func TestProgress_Bar(t *testing.T) {
+	var bar bytes.Buffer
+	p := newProgress(4, &bar)
+	p.now = fakeClock(time.Second)
+	p.start = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	p.Step()
+	assert.Equal(t, "\r[#######-----------------------] 1/4  25% ETA 3s ", bar.String())
+
+	bar.Reset()
+	for range 3 {
+		p.Step()
+	}
+	p.Finish()
+	p.Finish()
+	assert.True(t, strings.HasSuffix(bar.String(), "\r[##############################] 4/4 100% ETA 0s \n"), bar.String())
+}
@@ -0,0 +1,92 @@
+package program
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/woodysmith1912/fetlife-data-tools/obsidian"
+)
+
+// SyncReport is the summary of a sync run written by --report, for monitoring and CI pipelines
+type SyncReport struct {
+	StartedAt   string `json:"startedAt"`
+	CompletedAt string `json:"completedAt"`
+	DryRun      bool   `json:"dryRun"`
+	// PagesCreated, PagesUpdated and PagesUnchanged count the pages the records were applied to
+	PagesCreated   int `json:"pagesCreated"`
+	PagesUpdated   int `json:"pagesUpdated"`
+	PagesUnchanged int `json:"pagesUnchanged"`
+	// PagesSkipped counts the records that were skipped, unchanged since the last sync or had no page
+	PagesSkipped int `json:"pagesSkipped"`
+	// Errors lists the records that failed and the error that stopped the sync, if any
+	Errors []string `json:"errors"`
+	// DataDir is the first --data-dir, DataDirRecords the records taken from each one when there are several
+	DataDir        string         `json:"dataDir"`
+	DataDirRecords map[string]int `json:"dataDirRecords,omitempty"`
+	VaultPath      string         `json:"vaultPath"`
+}
+
+// RecordErrors is returned by a sync with --report when some records failed, so the program exits with code 2
+// instead of the code 1 of an error that stops the sync
+type RecordErrors struct {
+	Count int
+}
+
+func (err *RecordErrors) Error() string {
+	return fmt.Sprintf("%d records failed to sync", err.Count)
+}
+
+// ExitCode is the exit code of the program
+func (err *RecordErrors) ExitCode() int {
+	return 2
+}
+
+// writeSyncReport writes the report to path as indented JSON
+func writeSyncReport(path string, report SyncReport) error {
+	if report.Errors == nil {
+		report.Errors = []string{}
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// report returns the report of this run, which started at startedAt.  failure is the error that stopped the sync, or
+// nil when it completed.
+func (sync *SyncCmd) report(vault *obsidian.Vault, startedAt string, failure error) SyncReport {
+	errs := append([]string{}, sync.summary.Errors...)
+	if failure != nil {
+		errs = append(errs, failure.Error())
+	}
+	var dataDirRecords map[string]int
+	if len(sync.DataDir) > 1 {
+		dataDirRecords = sync.recordsByDataDir()
+	}
+	return SyncReport{
+		StartedAt:      startedAt,
+		CompletedAt:    sync.syncTime(),
+		DryRun:         sync.DryRun,
+		PagesCreated:   sync.summary.Created,
+		PagesUpdated:   sync.summary.Updated,
+		PagesUnchanged: sync.summary.Unchanged,
+		PagesSkipped:   sync.summary.Skipped + sync.summary.Missing + sync.summary.Cached,
+		Errors:         errs,
+		DataDir:        sync.primaryDataDir(),
+		DataDirRecords: dataDirRecords,
+		VaultPath:      vault.Path,
+	}
+}
+
+// addError records a record that failed in the summary
+func (sync *SyncCmd) addError(err error) {
+	sync.locks.state.Lock()
+	defer sync.locks.state.Unlock()
+	sync.summary.Errors = append(sync.summary.Errors, err.Error())
+}
@@ -0,0 +1,86 @@
+package program
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/kong"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncCmd_Report(t *testing.T) {
+	tempVault := t.TempDir()
+	writeTestFile(t, filepath.Join(tempVault, "People", "Carol.md"),
+		"---\ntags:\n  - person\nurl: https://fetlife.com/users/33333\n---\n")
+	dataDir := writeTestData(t,
+		"11111,2024-01-01,2024-01-01,Dave\n33333,2024-01-01,2024-01-01,Carol\n",
+		"33333,2024-01-01,2024-01-01,Carol's note\n")
+	reportPath := filepath.Join(t.TempDir(), "reports", "sync.json")
+
+	sync := &SyncCmd{
+		DataDir:         []string{dataDir},
+		CreatePeopleIn:  []string{"People"},
+		CreateBlockedIn: []string{"Bad People"},
+		Report:          reportPath,
+		now:             fixedNow,
+	}
+	vault := loadTestVault(t, tempVault)
+	assert.NoError(t, sync.Run(vault))
+
+	var report SyncReport
+	data, err := os.ReadFile(reportPath)
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(data, &report))
+	assert.Equal(t, SyncReport{
+		StartedAt:    "2024-06-01T12:00:00Z",
+		CompletedAt:  "2024-06-01T12:00:00Z",
+		PagesCreated: 1,
+		// Carol's page is updated by her blocked record and her note
+		PagesUpdated: 2,
+		Errors:       []string{},
+		DataDir:      dataDir,
+		VaultPath:    tempVault,
+	}, report)
+
+	// A page that can't be written is an error in the report, and the sync exits with code 2
+	carolPath := filepath.Join(tempVault, "People", "Carol.md")
+	vault = loadTestVault(t, tempVault)
+	assert.NoError(t, os.Remove(carolPath))
+	assert.NoError(t, os.Mkdir(carolPath, 0755))
+	sync.NoCache = true
+	err = sync.Run(vault)
+	var exitCoder kong.ExitCoder
+	if assert.True(t, errors.As(err, &exitCoder)) {
+		assert.Equal(t, 2, exitCoder.ExitCode())
+	}
+
+	data, err = os.ReadFile(reportPath)
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(data, &report))
+	if assert.Len(t, report.Errors, 2) {
+		assert.Contains(t, report.Errors[0], "Failed to process blocked user 33333")
+		assert.Contains(t, report.Errors[1], "Failed to process private note 33333")
+	}
+}
+
+func TestSyncCmd_ReportFatalError(t *testing.T) {
+	tempVault := t.TempDir()
+	dataDir := writeTestData(t, "", "")
+	assert.NoError(t, os.Remove(filepath.Join(dataDir, "blockeds.txt")))
+	reportPath := filepath.Join(t.TempDir(), "sync.json")
+
+	sync := &SyncCmd{DataDir: []string{dataDir}, CreatePeopleIn: []string{"People"}, Report: reportPath}
+	err := sync.Run(loadTestVault(t, tempVault))
+	assert.Error(t, err)
+	var exitCoder kong.ExitCoder
+	assert.False(t, errors.As(err, &exitCoder), "an error that stops the sync exits with code 1")
+
+	var report SyncReport
+	data, err := os.ReadFile(reportPath)
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(data, &report))
+	assert.Len(t, report.Errors, 1)
+}
@@ -0,0 +1,163 @@
+package program
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+// folderRule is an entry of the --rules-file, the structured form of a --create-people-in folder with the color and
+// tags of its pages
+type folderRule struct {
+	Folder   string   `yaml:"folder"`
+	Keywords []string `yaml:"keywords"`
+	Exclude  []string `yaml:"exclude"`
+	Color    string   `yaml:"color"`
+	Tags     []string `yaml:"tags"`
+	Priority int      `yaml:"priority"`
+}
+
+// loadRules reads a rules file, an ordered list of folder rules like
+//
+//   - folder: Bad People
+//     keywords: [creepy, 're:\bstalk']
+//     exclude: [joke]
+//     color: "#F44336"
+//     tags: [avoid]
+//     priority: 10
+//
+// and returns them in order.  Errors name the rule and the field that's wrong.
+func loadRules(path string) ([]folderRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []folderRule
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&rules); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid rules in %s: %w", path, err)
+	}
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("no rules in %s", path)
+	}
+
+	for i, rule := range rules {
+		if err := rule.validate(); err != nil {
+			name := fmt.Sprintf("rule %d", i+1)
+			if rule.Folder != "" {
+				name += fmt.Sprintf(" (%s)", rule.Folder)
+			}
+			return nil, fmt.Errorf("invalid %s in %s: %w", name, path, err)
+		}
+	}
+	return rules, nil
+}
+
+// validate checks the fields of a rule, naming the field that's wrong
+func (rule folderRule) validate() error {
+	if strings.TrimSpace(rule.Folder) == "" {
+		return errors.New("folder: is required")
+	}
+	for _, list := range []struct {
+		field    string
+		keywords []string
+	}{{"keywords", rule.Keywords}, {"exclude", rule.Exclude}} {
+		for _, keyword := range list.keywords {
+			if strings.TrimSpace(keyword) == "" {
+				return fmt.Errorf("%s: empty keyword", list.field)
+			}
+			if parsed, err := parseKeyword(strings.TrimSpace(keyword)); err != nil {
+				return fmt.Errorf("%s: invalid keyword pattern %q: %w", list.field, parsed.Text, err)
+			}
+		}
+	}
+	if rule.Color != "" && !colorPattern.MatchString(rule.Color) {
+		return fmt.Errorf("color: invalid color %q, expected #RRGGBB", rule.Color)
+	}
+	for _, tag := range rule.Tags {
+		if tag == "" || strings.ContainsAny(tag, " \t#,") {
+			return fmt.Errorf("tags: invalid tag %q, tags can't be empty or contain spaces, # or commas", tag)
+		}
+	}
+	return nil
+}
+
+// folderConfig returns the rule as the folder configuration --create-people-in would give
+func (rule folderRule) folderConfig() folderConfig {
+	config := folderConfig{Folder: filepath.Clean(strings.TrimSpace(rule.Folder)), Priority: rule.Priority}
+	for _, keyword := range rule.Keywords {
+		parsed, _ := parseKeyword(strings.TrimSpace(keyword))
+		config.Keywords = append(config.Keywords, parsed)
+	}
+	for _, keyword := range rule.Exclude {
+		parsed, _ := parseKeyword(strings.TrimSpace(keyword))
+		config.Exclusions = append(config.Exclusions, parsed)
+	}
+	return config
+}
+
+// applyRules reads the --rules-file and uses its rules instead of --create-people-in.  The colors and tags of the
+// rules are added to --folder-color and --folder-tags, replacing the ones given for the same folder.  When both the
+// file and flags configure something, the file wins with a warning.
+func (sync *SyncCmd) applyRules() error {
+	rules, err := loadRules(sync.RulesFile)
+	if err != nil {
+		return err
+	}
+
+	if !slices.Equal(sync.CreatePeopleIn, []string{"People"}) && len(sync.CreatePeopleIn) > 0 {
+		log.Warn().
+			Str("rulesFile", sync.RulesFile).
+			Strs("createPeopleIn", sync.CreatePeopleIn).
+			Msg("Both --rules-file and --create-people-in are given, using the rules file")
+	}
+
+	sync.rules = nil
+	for _, rule := range rules {
+		config := rule.folderConfig()
+		sync.rules = append(sync.rules, config)
+
+		if rule.Color != "" {
+			if sync.FolderColor == nil {
+				sync.FolderColor = make(map[string]string)
+			}
+			overrideFolderFlag(sync.FolderColor, config.Folder, rule.Color, "--folder-color")
+		}
+		if len(rule.Tags) > 0 {
+			if sync.FolderTags == nil {
+				sync.FolderTags = make(map[string]string)
+			}
+			overrideFolderFlag(sync.FolderTags, config.Folder, strings.Join(rule.Tags, ","), "--folder-tags")
+		}
+	}
+	return nil
+}
+
+// overrideFolderFlag sets the value of a folder in a folder=value flag, warning when the flag had another value for
+// the folder
+func overrideFolderFlag(values map[string]string, folder, value, flag string) {
+	for configured, existing := range values {
+		if filepath.Clean(configured) != folder {
+			continue
+		}
+		if existing != value {
+			log.Warn().
+				Str("folder", folder).
+				Str("flag", existing).
+				Str("rule", value).
+				Msg("Both --rules-file and " + flag + " configure the folder, using the rules file")
+		}
+		delete(values, configured)
+	}
+	values[folder] = value
+}
@@ -0,0 +1,103 @@
+package program
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/woodysmith1912/fetlife-data-tools/obsidian"
+)
+
+func TestLoadRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules string
+		err   string
+	}{
+		{
+			name: "rules",
+			rules: "- folder: Bad People\n  keywords: [creepy, 're:\\bstalk', 're:a{1,3}h']\n  exclude: [joke]\n" +
+				"  color: \"#F44336\"\n  tags: [avoid]\n  priority: 10\n- folder: People\n",
+		},
+		{name: "empty file", rules: "", err: "no rules in"},
+		{name: "missing folder", rules: "- folder: People\n- keywords: [rope]\n", err: "invalid rule 2 in"},
+		{
+			name:  "invalid exclusion",
+			rules: "- folder: People\n- folder: Bad People\n  exclude: ['re:(']\n",
+			err:   `invalid rule 2 (Bad People) in`,
+		},
+		{name: "invalid color", rules: "- folder: People\n  color: red\n", err: `color: invalid color "red"`},
+		{name: "invalid tag", rules: "- folder: People\n  tags: [\"#friend\"]\n", err: `tags: invalid tag "#friend"`},
+		{name: "unknown field", rules: "- folder: People\n  colour: \"#F44336\"\n", err: "field colour not found"},
+		{name: "not a list", rules: "folder: People\n", err: "invalid rules in"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "rules.yaml")
+			writeTestFile(t, path, tt.rules)
+
+			rules, err := loadRules(path)
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			if assert.Len(t, rules, 2) {
+				config := rules[0].folderConfig()
+				assert.Equal(t, "Bad People", config.Folder)
+				assert.Equal(t, 10, config.Priority)
+				assert.Len(t, config.Keywords, 3)
+				assert.True(t, config.Keywords[2].Matches("aaah"), "keywords may contain commas")
+				assert.Len(t, config.Exclusions, 1)
+			}
+		})
+	}
+
+	// The field of an invalid keyword is named
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	writeTestFile(t, path, "- folder: People\n  keywords: ['re:[']\n")
+	_, err := loadRules(path)
+	assert.ErrorContains(t, err, `invalid rule 1 (People) in `+path+`: keywords: invalid keyword pattern "["`)
+}
+
+func TestSyncCmd_RulesFile(t *testing.T) {
+	tempVault := t.TempDir()
+	rulesPath := filepath.Join(t.TempDir(), "rules.yaml")
+	writeTestFile(t, rulesPath, "- folder: People\n"+
+		"- folder: Rope\n  keywords: [rope, shibari]\n  exclude: [no rope]\n  tags: [rope]\n"+
+		"- folder: Bad People\n  keywords: [creepy]\n  color: \"#F44336\"\n  priority: 10\n")
+	dataDir := writeTestData(t, "",
+		"11111,2024-01-01,2024-01-01,Great at rope\n"+
+			"22222,2024-01-01,2024-01-01,Says no rope for now\n"+
+			"33333,2024-01-01,2024-01-01,Creepy about rope\n")
+
+	sync := &SyncCmd{
+		DataDir:        []string{dataDir},
+		CreatePeopleIn: []string{"Ignored:rope"},
+		RulesFile:      rulesPath,
+		FolderColor:    map[string]string{"Bad People": "#000000"},
+	}
+	assert.NoError(t, sync.Validate())
+	assert.NoError(t, sync.Run(loadTestVault(t, tempVault)))
+
+	vault := loadTestVault(t, tempVault)
+	for userID, file := range map[string]string{
+		"11111": "Rope/user-11111.md",
+		"22222": "People/user-22222.md",
+		"33333": "Bad People/user-33333.md",
+	} {
+		pages, err := vault.FindByUserID(userID)
+		assert.NoError(t, err)
+		if assert.Len(t, pages, 1, userID) {
+			assert.Equal(t, file, pageFile(pages[0]), userID)
+		}
+	}
+
+	// The rules' tags and colors are used, the file winning over the flags
+	pages, _ := vault.FindByUserID("11111")
+	assert.True(t, pages[0].HasTag("rope"))
+	pages, _ = vault.FindByUserID("33333")
+	assert.Equal(t, obsidian.Color("#F44336"), pages[0].WebBadgeColor)
+	assert.Empty(t, vault.InFolder("Ignored"))
+}
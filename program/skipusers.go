@@ -0,0 +1,77 @@
+package program
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/woodysmith1912/fetlife-data-tools/obsidian"
+)
+
+// loadSkipUsers returns the user IDs of --skip-user and the --skip-users-file, which has one user ID per line.  Blank
+// lines and lines starting with # are ignored.
+func (sync *SyncCmd) loadSkipUsers() (map[string]bool, error) {
+	skipped := make(map[string]bool)
+	add := func(userID, source string) error {
+		if _, err := strconv.ParseUint(userID, 10, 64); err != nil {
+			return fmt.Errorf("invalid user ID %q in %s, expected a number", userID, source)
+		}
+		skipped[userID] = true
+		return nil
+	}
+
+	for _, userID := range sync.SkipUser {
+		if err := add(strings.TrimSpace(userID), "--skip-user"); err != nil {
+			return nil, err
+		}
+	}
+	if sync.SkipUsersFile == "" {
+		return skipped, nil
+	}
+
+	file, err := os.Open(sync.SkipUsersFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		userID := strings.TrimSpace(scanner.Text())
+		if userID == "" || strings.HasPrefix(userID, "#") {
+			continue
+		}
+		if err := add(userID, fmt.Sprintf("%s line %d", sync.SkipUsersFile, line)); err != nil {
+			return nil, err
+		}
+	}
+	return skipped, scanner.Err()
+}
+
+// dropSkippedUsers drops the records of the skipped users and counts them as skipped
+func dropSkippedUsers[T any](sync *SyncCmd, records []T, userID func(T) string) []T {
+	kept := slices.DeleteFunc(records, func(record T) bool { return sync.skippedUsers[userID(record)] })
+	sync.summary.Skipped += len(records) - len(kept)
+	return kept
+}
+
+// skipsPage tells whether the page belongs to a skipped user, by its profile URL, one of its URL aliases or the
+// overrides file.  User IDs are compared exactly, like when pages are found for a record.
+func (sync *SyncCmd) skipsPage(page *obsidian.Page) bool {
+	if len(sync.skippedUsers) == 0 {
+		return false
+	}
+	for _, url := range append([]string{page.Url}, page.UrlAliases...) {
+		if userID, ok := profileUserID(url); ok && sync.skippedUsers[userID] {
+			return true
+		}
+	}
+	for userID, override := range sync.overrides {
+		if override == page && sync.skippedUsers[userID] {
+			return true
+		}
+	}
+	return false
+}
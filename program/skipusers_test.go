@@ -0,0 +1,85 @@
+package program
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/woodysmith1912/fetlife-data-tools/obsidian"
+)
+
+func TestSyncCmd_SkipUser(t *testing.T) {
+	tempVault := t.TempDir()
+	alicePath := filepath.Join(tempVault, "People", "Alice.md")
+	alice := "---\ntags:\n  - person\nurl: https://fetlife.com/users/11111\n---\n"
+	writeTestFile(t, alicePath, alice)
+	// Eve isn't blocked anymore, but her page is managed by hand
+	evePath := filepath.Join(tempVault, "Bad People", "Eve.md")
+	eve := "---\ntags:\n  - person\n  - blocked\nurl: https://fetlife.com/users/44444\nblocked-date: \"2024-01-01\"\n---\n"
+	writeTestFile(t, evePath, eve)
+
+	dataDir := writeTestData(t,
+		"11111,2024-01-01,2024-01-01,Alice\n111111,2024-01-01,2024-01-01,Bob\n",
+		"11111,2024-01-01,2024-01-01,Alice's note\n33333,2024-01-01,2024-01-01,Carol's note\n")
+	skipFile := filepath.Join(t.TempDir(), "skip.txt")
+	writeTestFile(t, skipFile, "# Managed by hand\n33333\n\n 44444 \n")
+
+	sync := &SyncCmd{
+		DataDir:         []string{dataDir},
+		CreatePeopleIn:  []string{"People"},
+		CreateBlockedIn: []string{"Bad People"},
+		SkipUser:        []string{"11111"},
+		SkipUsersFile:   skipFile,
+		PruneBlocked:    true,
+		NoCache:         true,
+	}
+	assert.NoError(t, sync.Validate())
+	assert.NoError(t, sync.Run(loadTestVault(t, tempVault)))
+	// Alice's blocked record and note and Carol's note
+	assert.Equal(t, 3, sync.summary.Skipped)
+	assert.Equal(t, 1, sync.summary.Created)
+	assert.Empty(t, sync.summary.Pruned)
+
+	for path, content := range map[string]string{alicePath: alice, evePath: eve} {
+		data, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		assert.Equal(t, content, string(data))
+	}
+	assert.NoFileExists(t, filepath.Join(tempVault, "People", "user-33333.md"))
+
+	// User IDs are compared exactly, so skipping 11111 doesn't skip 111111
+	bob, err := obsidian.LoadPage(filepath.Join(tempVault, "Bad People", "Bob.md"), tempVault)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://fetlife.com/users/111111", bob.Url)
+}
+
+func TestSyncCmd_SkipUserStreaming(t *testing.T) {
+	dataDir := writeTestData(t, "",
+		"11111,2024-01-01,2024-01-01,Alice's note\n22222,2024-01-01,2024-01-01,Bob's note\n")
+
+	// Skipped records don't count for --limit
+	sync := &SyncCmd{
+		DataDir:        []string{dataDir},
+		CreatePeopleIn: []string{"People"},
+		SkipUser:       []string{"11111"},
+		Limit:          1,
+		Streaming:      "always",
+		NoCache:        true,
+	}
+	tempVault := t.TempDir()
+	assert.NoError(t, sync.Run(loadTestVault(t, tempVault)))
+	assert.Equal(t, 1, sync.summary.Skipped)
+	assert.FileExists(t, filepath.Join(tempVault, "People", "user-22222.md"))
+	assert.NoFileExists(t, filepath.Join(tempVault, "People", "user-11111.md"))
+}
+
+func TestSyncCmd_SkipUserInvalid(t *testing.T) {
+	sync := &SyncCmd{DataDir: []string{writeTestData(t, "", "")}, SkipUser: []string{"alice"}}
+	assert.ErrorContains(t, sync.Validate(), `invalid user ID "alice" in --skip-user`)
+
+	skipFile := filepath.Join(t.TempDir(), "skip.txt")
+	writeTestFile(t, skipFile, "11111\nhttps://fetlife.com/users/22222\n")
+	sync = &SyncCmd{DataDir: []string{writeTestData(t, "", "")}, SkipUsersFile: skipFile}
+	assert.ErrorContains(t, sync.Validate(), "skip.txt line 2")
+}
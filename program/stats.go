@@ -0,0 +1,86 @@
+package program
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/woodysmith1912/fetlife-data-tools/obsidian"
+)
+
+type StatsCmd struct {
+	JSON bool `help:"Print statistics as JSON"`
+}
+
+// namedCount is the number of pages in a folder or with a tag
+type namedCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// vaultStatistics summarizes the pages in a vault
+type vaultStatistics struct {
+	TotalPages int          `json:"totalPages"`
+	WithURL    int          `json:"withUrl"`
+	WithoutURL int          `json:"withoutUrl"`
+	Folders    []namedCount `json:"folders"`
+	Tags       []namedCount `json:"tags"`
+}
+
+func (stats *StatsCmd) Run(vault *obsidian.Vault) error {
+	statistics := collectStatistics(vault)
+
+	if stats.JSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(statistics)
+	}
+
+	fmt.Printf("Total pages: %d\n", statistics.TotalPages)
+	fmt.Printf("Pages with URL: %d\n", statistics.WithURL)
+	fmt.Printf("Pages without URL: %d\n", statistics.WithoutURL)
+
+	fmt.Printf("\nFolders:\n")
+	for _, folder := range statistics.Folders {
+		fmt.Printf("  %s: %d\n", folder.Name, folder.Count)
+	}
+
+	fmt.Printf("\nTags:\n")
+	for _, tag := range statistics.Tags {
+		fmt.Printf("  %s: %d\n", tag.Name, tag.Count)
+	}
+
+	return nil
+}
+
+// collectStatistics counts the vault's pages per folder and tag
+func collectStatistics(vault *obsidian.Vault) vaultStatistics {
+	stats := vault.Stats()
+	statistics := vaultStatistics{
+		TotalPages: stats.TotalPages,
+		WithURL:    stats.PagesWithURL,
+		WithoutURL: stats.TotalPages - stats.PagesWithURL,
+		Folders:    []namedCount{},
+		Tags:       []namedCount{},
+	}
+
+	for _, folder := range vault.Folders() {
+		statistics.Folders = append(statistics.Folders, namedCount{Name: folder, Count: stats.PagesByFolder[folder]})
+	}
+	for _, tag := range vault.Tags() {
+		statistics.Tags = append(statistics.Tags, namedCount{Name: tag, Count: stats.PagesByTag[tag]})
+	}
+
+	sortCounts(statistics.Folders)
+	sortCounts(statistics.Tags)
+
+	return statistics
+}
+
+// sortCounts sorts counts given by name by count, largest first, keeping equal counts by name
+func sortCounts(counts []namedCount) {
+	sort.SliceStable(counts, func(i, j int) bool {
+		return counts[i].Count > counts[j].Count
+	})
+}
@@ -0,0 +1,140 @@
+package program
+
+import (
+	"errors"
+	"maps"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/woodysmith1912/fetlife-data-tools/fetlife"
+)
+
+// streamingThreshold is the size of blockeds.txt and private_notes.txt together above which --streaming auto streams
+// them
+const streamingThreshold = 64 << 20
+
+// errLimitReached stops reading a data file once --limit records are kept
+var errLimitReached = errors.New("limit reached")
+
+// streams tells whether blockeds.txt and private_notes.txt are read with the streaming readers, which drop the records
+// left out by --since, --user-id and --limit while reading
+func (sync *SyncCmd) streams() bool {
+	switch sync.Streaming {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+
+	var size int64
+	for _, dataDir := range sync.DataDir {
+		for _, name := range []string{"blockeds.txt", "private_notes.txt"} {
+			if fileSize, err := fetlife.DataFileSize(dataDir, name); err == nil {
+				size += fileSize
+			}
+		}
+	}
+	return size > streamingThreshold
+}
+
+// streamFilter returns a callback for the streaming readers that adds the records kept by --skip-user, --since,
+// --user-id and --limit to kept, counting the records of skipped users as skipped and the others in filtered.  It
+// stops the stream with errLimitReached once --limit records are kept, unless there are several data directories since
+// their records are limited once merged.  With several data directories the records of skipped users are kept too, so
+// dropSkippedUsers counts them once merged instead of once per directory.  Records whose date can't be parsed are
+// dropped with a warning, like filterSince does.
+func streamFilter[T any](sync *SyncCmd, since time.Time, kept *[]T, updated func(T) (time.Time, error), userID func(T) string, filtered *int) func(T) error {
+	return func(record T) error {
+		if sync.Limit > 0 && len(sync.DataDir) == 1 && len(*kept) == sync.Limit {
+			return errLimitReached
+		}
+		if sync.skippedUsers[userID(record)] {
+			if len(sync.DataDir) > 1 {
+				*kept = append(*kept, record)
+				return nil
+			}
+			sync.summary.Skipped++
+			return nil
+		}
+		if !since.IsZero() {
+			date, err := updated(record)
+			if err != nil {
+				log.Warn().Err(err).Str("userID", userID(record)).Msg("Skipping record with an unreadable date")
+				*filtered++
+				return nil
+			}
+			if date.Before(since) {
+				*filtered++
+				return nil
+			}
+		}
+		if len(sync.UserID) > 0 && !slices.Contains(sync.UserID, userID(record)) {
+			*filtered++
+			return nil
+		}
+		*kept = append(*kept, record)
+		return nil
+	}
+}
+
+// streamBlockeds reads the blocked users of dataDir kept by --since, --user-id and --limit with fetlife.StreamBlockeds
+func (sync *SyncCmd) streamBlockeds(dataDir string, since time.Time, filtered *int, options ...fetlife.ReadOption) ([]fetlife.BlockedRecord, error) {
+	var blockeds []fetlife.BlockedRecord
+	fn := streamFilter(sync, since, &blockeds, fetlife.BlockedRecord.Updated,
+		func(r fetlife.BlockedRecord) string { return r.UserID }, filtered)
+	if err := fetlife.StreamBlockeds(dataDir, fn, options...); err != nil && !errors.Is(err, errLimitReached) {
+		return nil, err
+	}
+	return blockeds, nil
+}
+
+// streamPrivateNotes reads the private notes of dataDir kept by --since, --user-id and --limit with
+// fetlife.StreamPrivateNotes.  Unless routing is nil, every note of dataDir is added to it by user, replacing the notes
+// of older data directories, so blocked users can be routed by all of the notes without reading the file again.  The
+// stream then goes on past --limit.
+func (sync *SyncCmd) streamPrivateNotes(dataDir string, since time.Time, filtered *int, routing map[string]string, options ...fetlife.ReadOption) ([]fetlife.PrivateNoteRecord, error) {
+	var notes []fetlife.PrivateNoteRecord
+	fn := streamFilter(sync, since, &notes, fetlife.PrivateNoteRecord.Updated,
+		func(r fetlife.PrivateNoteRecord) string { return r.MemberID }, filtered)
+
+	routes := make(map[string]string)
+	if routing != nil {
+		filter := fn
+		fn = func(note fetlife.PrivateNoteRecord) error {
+			addNote(routes, note)
+			if err := filter(note); !errors.Is(err, errLimitReached) {
+				return err
+			}
+			return nil
+		}
+	}
+
+	if err := fetlife.StreamPrivateNotes(dataDir, fn, options...); err != nil && !errors.Is(err, errLimitReached) {
+		return nil, err
+	}
+	maps.Copy(routing, routes)
+	return notes, nil
+}
+
+// streamNoteRoutes adds every private note of the --data-dir exports to routing by user, from the oldest to the newest
+// export so each user's notes come from the newest export that has the user, like fetlife.MergePrivateNotes.  The
+// notes are streamed, so only routing is held in memory.  A missing file has no notes.
+func (sync *SyncCmd) streamNoteRoutes(routing map[string]string, options ...fetlife.ReadOption) error {
+	for _, dataDir := range orderedDataDirs(sync.DataDir, sync.dataDirOrder) {
+		routes := make(map[string]string)
+		err := fetlife.StreamPrivateNotes(dataDir, func(note fetlife.PrivateNoteRecord) error {
+			addNote(routes, note)
+			return nil
+		}, options...)
+		if errors.Is(err, os.ErrNotExist) {
+			log.Debug().Err(err).Str("dataDir", dataDir).Msg("No private notes to route blocked users by")
+			continue
+		} else if err != nil {
+			return err
+		}
+		maps.Copy(routing, routes)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package program
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncCmd_Streaming(t *testing.T) {
+	testDataDir := writeTestData(t,
+		"11111,2024-01-01,2024-01-01,First\n44444,2024-03-01,2024-03-01,Fourth\n",
+		"11111,2024-01-01,2024-01-01,First's note\n"+
+			"22222,2024-02-01,2024-02-01,Second's note\n"+
+			"33333,2024-03-01,2024-03-01,Third's note\n")
+
+	tests := []struct {
+		name    string
+		userIDs []string
+		limit   int
+		since   string
+	}{
+		{name: "all records"},
+		{name: "user IDs", userIDs: []string{"22222", "44444"}},
+		{name: "limit", limit: 1},
+		{name: "since", since: "2024-02-01"},
+		{name: "all filters", userIDs: []string{"11111", "33333", "44444"}, limit: 1, since: "2024-02-01"},
+	}
+
+	// sync runs a sync with the filters of tt and returns the pages it wrote by path
+	sync := func(t *testing.T, streaming string, userIDs []string, limit int, since string) map[string]string {
+		tempVault := t.TempDir()
+		writeTestFile(t, filepath.Join(tempVault, "People", "Second.md"),
+			"---\ntags:\n  - person\nurl: https://fetlife.com/users/22222\n---\n")
+
+		cmd := &SyncCmd{
+			DataDir:          []string{testDataDir},
+			CreatePeopleIn:   []string{"People"},
+			CreateBlockedIn:  []string{"Bad People"},
+			ConflictStrategy: "skip",
+			UserID:           userIDs,
+			Limit:            limit,
+			Since:            since,
+			Streaming:        streaming,
+			NoCache:          true,
+			now:              fixedNow,
+		}
+		assert.NoError(t, cmd.Run(loadTestVault(t, tempVault)))
+
+		pages := make(map[string]string)
+		err := filepath.WalkDir(tempVault, func(path string, entry os.DirEntry, err error) error {
+			if err != nil || entry.IsDir() || filepath.Ext(path) != ".md" {
+				return err
+			}
+			data, err := os.ReadFile(path)
+			rel, _ := filepath.Rel(tempVault, path)
+			pages[rel] = string(data)
+			return err
+		})
+		assert.NoError(t, err)
+		return pages
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			read := sync(t, "never", tt.userIDs, tt.limit, tt.since)
+			streamed := sync(t, "always", tt.userIDs, tt.limit, tt.since)
+			assert.Equal(t, read, streamed)
+		})
+	}
+}
+
+func TestSyncCmd_StreamingAuto(t *testing.T) {
+	testDataDir := writeTestData(t, "11111,2024-01-01,2024-01-01,First\n", "")
+
+	cmd := &SyncCmd{DataDir: []string{testDataDir}, Streaming: "auto"}
+	assert.False(t, cmd.streams(), "small files are read at once")
+	cmd.Streaming = "always"
+	assert.True(t, cmd.streams())
+	cmd.Streaming = "never"
+	assert.False(t, cmd.streams())
+}
+
+func TestSyncCmd_StreamingRoutesBlocked(t *testing.T) {
+	older := writeTestData(t, "", "22222,2024-01-01,2024-01-01,Rude at the munch\n")
+	newer := writeTestData(t,
+		"11111,2024-02-01,2024-02-01,Dave\n22222,2024-02-01,2024-02-01,Eve\n",
+		"33333,2024-02-01,2024-02-01,Met at a munch\n11111,2024-02-01,2024-02-01,Groped people at the event\n"+
+			"22222,2024-02-01,2024-02-01,Grabbed someone at the event\n")
+
+	tests := []struct {
+		name     string
+		dataDirs []string
+		only     []string
+		limit    int
+	}{
+		{name: "notes synced", dataDirs: []string{newer}},
+		{name: "notes past the limit", dataDirs: []string{newer}, limit: 1},
+		{name: "only blocked", dataDirs: []string{newer}, only: []string{"blocked"}},
+		{name: "several exports", dataDirs: []string{newer, older}},
+		{name: "several exports only blocked", dataDirs: []string{newer, older}, only: []string{"blocked"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Blocked users are routed by their notes of the newest export, also with the notes they're not synced with
+			tempVault := t.TempDir()
+			sync := &SyncCmd{
+				DataDir:         tt.dataDirs,
+				CreatePeopleIn:  []string{"People"},
+				CreateBlockedIn: []string{"Bad People", "Event Bans:event", "Munch Bans:munch"},
+				Only:            tt.only,
+				Limit:           tt.limit,
+				Streaming:       "always",
+				StateFile:       filepath.Join(t.TempDir(), "state.json"),
+				NoCache:         true,
+			}
+			assert.NoError(t, sync.Run(loadTestVault(t, tempVault)))
+			assert.Equal(t, map[string]string{
+				"11111": "Groped people at the event",
+				"22222": "Grabbed someone at the event",
+			}, map[string]string{"11111": sync.notes["11111"], "22222": sync.notes["22222"]})
+			if tt.limit == 0 {
+				assert.FileExists(t, filepath.Join(tempVault, "Event Bans", "Dave.md"))
+				assert.FileExists(t, filepath.Join(tempVault, "Event Bans", "Eve.md"))
+			}
+		})
+	}
+}
+
+func TestSyncCmd_StreamingSkippedUsers(t *testing.T) {
+	older := writeTestData(t, "11111,2024-01-01,2024-01-01,Dave\n", "11111,2024-01-01,2024-01-01,Old note\n")
+	newer := writeTestData(t, "11111,2024-02-01,2024-02-01,Dave\n", "11111,2024-02-01,2024-02-01,New note\n")
+
+	// The records of a skipped user are counted once merged, like when the files are read at once
+	for _, streaming := range []string{"never", "always"} {
+		sync := &SyncCmd{
+			DataDir:         []string{older, newer},
+			CreatePeopleIn:  []string{"People"},
+			CreateBlockedIn: []string{"Bad People"},
+			SkipUser:        []string{"11111"},
+			Streaming:       streaming,
+			StateFile:       filepath.Join(t.TempDir(), "state.json"),
+			NoCache:         true,
+		}
+		assert.NoError(t, sync.Run(loadTestVault(t, t.TempDir())))
+		assert.Equal(t, 2, sync.summary.Skipped, streaming)
+		assert.Equal(t, 0, sync.summary.Created, streaming)
+	}
+}
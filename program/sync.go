@@ -1,313 +1,2565 @@
 package program
 
 import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"maps"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/woodysmith1912/fetlife-data-tools/fetlife"
 	"github.com/woodysmith1912/fetlife-data-tools/obsidian"
 )
 
 type SyncCmd struct {
-	DataDir         string   `help:"Path to data directory containing blockeds.txt and private_notes.txt" env:"DATA_DIR" type:"existingdir" required:"true"`
-	CreatePeopleIn  []string `alias:"in" help:"List of Obsidian folders to create individual people.  Syntax is folder[:keyword1,...] and this folder will be used if one of the keywords is found in the private note.  Keywords are not case sensitive" default:"People"`
-	CreateBlockedIn string   `help:"Obsidian folder to create blocked people in" default:"Bad People"`
+	DataDir             []string          `help:"Path to data directory containing blockeds.txt and private_notes.txt, or to the zip archive of the export.  Repeat it to sync several exports at once, the export with the newest records winning" env:"DATA_DIR" type:"path" required:"true" sep:"none"`
+	CreatePeopleIn      []string          `alias:"in" help:"List of Obsidian folders to create individual people.  Syntax is folder[:keyword1,...] and this folder will be used if one of the keywords is found in the private note.  Keywords are not case sensitive" default:"People" sep:"none"`
+	RulesFile           string            `help:"YAML file with an ordered list of folder rules (folder, keywords, exclude, color, tags, priority) to use instead of --create-people-in" type:"existingfile" placeholder:"PATH"`
+	CreateBlockedIn     []string          `help:"List of Obsidian folders to create blocked people in, with the same folder[:keyword1,...] syntax as --create-people-in.  Keywords are matched against the blocked user's nickname and private note, the first folder is used when none match" default:"Bad People" sep:"none"`
+	MoveBlocked         bool              `help:"Move the existing pages of blocked users into their --create-blocked-in folder"`
+	PruneBlocked        bool              `help:"Remove the blocked tag, blocked-date and blocked-at from pages of users who are no longer in blockeds.txt"`
+	FolderColor         map[string]string `help:"web-badge-color for pages created in a folder, as folder=#RRGGBB.  Existing pages of blocked users without a color get the color of their --create-blocked-in folder" placeholder:"FOLDER=COLOR"`
+	AssignColor         map[string]string `help:"web-badge-color for pages created in a folder, as folder=#RRGGBB like --folder-color, but replacing the color of the template.  Existing pages are never recolored" placeholder:"FOLDER=COLOR"`
+	BlockedColor        string            `help:"web-badge-color for the pages of blocked users that have no color and no --folder-color for their folder.  A color already on a page is never changed" default:"#F44336" placeholder:"COLOR"`
+	FolderTags          map[string]string `help:"Extra tags for the pages created or updated in a folder, as folder=tag1,tag2" placeholder:"FOLDER=TAGS"`
+	RemoveOrphans       bool              `help:"Delete person pages with a FetLife profile URL that isn't in any of the data files, after asking for confirmation"`
+	Force               bool              `help:"With --remove-orphans, delete the pages without asking"`
+	ReportOrphans       bool              `help:"List the title, path and user ID of person pages with a FetLife profile URL that isn't in any of the data files"`
+	Template            string            `help:"Template for new pages, instead of Templates/<folder>.md or Templates/People.md from the vault" type:"existingfile"`
+	RenameStubs         bool              `help:"Rename user-<id> pages to the user's nickname when a record has it, keeping user-<id> as an alias"`
+	Recategorize        bool              `help:"Move person pages in the --create-people-in folders to the folder their web-message matches now"`
+	RecategorizeBlocked bool              `help:"With --recategorize, move the pages of blocked users too"`
+	CreateFriendsIn     string            `help:"Obsidian folder to create friends from friends.txt in" default:"People"`
+	CreateFollowersIn   string            `help:"Obsidian folder to create followers and followings without a page in.  By default only existing pages are tagged"`
+	ConflictStrategy    string            `help:"What to do when several pages have the user's profile URL: skip the record (skip), update the first page found (first), update the page whose file was modified last (newest), or stop the sync with an error (error)" enum:"skip,first,newest,error" default:"skip"`
+	MaxCreates          int               `help:"Stop before writing anything when the sync would create more than N pages, like after pointing --data-dir at the wrong export.  0 turns the check off" default:"200" placeholder:"N"`
+	DryRun              bool              `help:"Show which pages would be created or updated without writing anything to the vault"`
+	DryRunFormat        string            `help:"How to show the changes of a dry run: a text diff or an RFC 6902 json-patch" enum:"text,json-patch" default:"text"`
+	UpdateOnly          bool              `help:"Only update pages that already exist in the vault, never create new ones" xor:"existing" aliases:"no-create"`
+	CreateOnly          bool              `help:"Only create pages for users without one, never modify existing pages" xor:"existing"`
+	MatchByName         bool              `help:"When no page has a user's profile URL, update the page titled or aliased with the user's nickname, ignoring case, and add the URL to it instead of creating a page.  Users are processed one at a time"`
+	MatchNickname       bool              `help:"Match --create-people-in keywords against the user's nickname as well as the private note"`
+	NoteMode            string            `help:"How to combine a private note with an existing web-message: overwrite it (replace is the same), append to it, or skip-if-set" enum:"overwrite,replace,append,skip-if-set" default:"append"`
+	OnConflict          string            `help:"What to do when an existing page's web-message differs from its private note: keep the web-message, replace it, or record both in a \"## Sync Conflict <date>\" section of the page body and leave the web-message alone.  By default --note-mode decides" enum:",keep,replace,record" default:""`
+	NoteTarget          string            `help:"Where to write private notes: the web-message frontmatter, a \"## FetLife Private Note\" section of the page body, or both" enum:"web-message,body,both" default:"web-message"`
+	JournalDir          string            `help:"Directory to write the journal of changes used by sync undo (default: the vault's .obsidian directory)" type:"path"`
+	WriteIndex          string            `help:"Page to regenerate after each sync with a section per folder linking every person page, with its blocked status and the start of its note, relative to the vault like \"FetLife People Index\".  Only the part between the index marker comments is replaced" placeholder:"PAGE"`
+	SyncLog             string            `help:"Page to add an entry with the counts and links to the pages created or moved to after each sync, relative to the vault like \"FetLife Sync Log\".  It's created with the sync-log tag when the vault doesn't have it" placeholder:"PAGE"`
+	Overrides           string            `help:"YAML file mapping user IDs to the vault relative paths of their pages, for pages without a profile URL (default: <vault>/.obsidian/fetlife-overrides.yaml when it exists)" type:"path"`
+	Report              string            `help:"Write a JSON summary of the sync to this file.  When records failed the program exits with code 2" type:"path" placeholder:"PATH"`
+	StateFile           string            `help:"File remembering the records of the last sync so unchanged users are skipped (default: <data-dir>/.sync-state.json, next to the zip archive for one)" type:"path"`
+	NoCache             bool              `help:"Process every record, even those unchanged since the last sync"`
+	ImportConversations bool              `help:"Add a Conversations section with the message count and last message date from conversations.txt to existing pages"`
+	FullText            bool              `help:"Include the text of every message in the Conversations section"`
+	Lenient             bool              `help:"Read data files whose header row doesn't have the expected column names"`
+	Progress            string            `help:"How to show the progress of the sync: a progress bar when the output is a terminal and log events otherwise (auto), or always a progress bar (bar), log events (log) or nothing (none)" enum:"auto,bar,log,none" default:"auto"`
+	Only                []string          `help:"Only sync these inputs, the files of the others don't need to exist" enum:"blocked,notes,friends,follows,conversations" xor:"inputs"`
+	Skip                []string          `help:"Don't sync these inputs, their files don't need to exist" enum:"blocked,notes,friends,follows,conversations" xor:"inputs"`
+	UserID              []string          `help:"Only sync the records of these user IDs" placeholder:"ID"`
+	SkipUser            []string          `help:"Never sync the records of these user IDs, nor change their pages with --prune-blocked, --recategorize or --remove-orphans.  Their records count as skipped" placeholder:"ID"`
+	SkipUsersFile       string            `help:"File of user IDs to never sync like --skip-user, one per line.  Blank lines and lines starting with # are ignored" type:"existingfile" placeholder:"PATH"`
+	Limit               int               `help:"Only sync the first N records of each input" placeholder:"N"`
+	Since               string            `help:"Only sync blocked users and private notes updated, or created when they have no update date, on or after this date (YYYY-MM-DD)" placeholder:"YYYY-MM-DD"`
+	Backup              bool              `help:"Copy the vault to <vault>-backup-<timestamp> before syncing"`
+	BackupIncludeConfig bool              `help:"With --backup, copy the vault's .obsidian directory too"`
+	Concurrency         int               `help:"Number of users whose records are processed at the same time.  With more than one, users whose new pages would get the same name can be named differently from run to run.  Dry runs process one user at a time" default:"1"`
+	Streaming           string            `help:"Read blockeds.txt and private_notes.txt a row at a time, keeping only the records that pass --since, --user-id and --limit: always, never, or when they're larger than 64 MB together (auto)" enum:"auto,always,never" default:"auto"`
+	Watch               bool              `help:"After syncing, keep watching the data directory and sync blockeds.txt or private_notes.txt again whenever it changes, until interrupted"`
+
+	summary syncSummary
+	// createdPages holds the pages created during this run
+	createdPages map[*obsidian.Page]bool
+	// createdOrder lists the pages created during this run in the order they were created
+	createdOrder []*obsidian.Page
+	// movedOrder lists the existing pages moved or renamed during this run, for the sync log
+	movedOrder []*obsidian.Page
+	// patch collects the changes to existing pages during a dry run
+	patch []JSONPatchOp
+	// journalPath is where the changes of this run are recorded, empty when nothing is recorded
+	journalPath string
+	journal     *os.File
+	// incomplete holds the users with a record that was skipped or failed, so they are processed again next time
+	incomplete map[string]bool
+	// input is where --remove-orphans reads its confirmation from, os.Stdin when not set
+	input io.Reader
+	// now returns the time written to created-at and synced-at, time.Now when not set
+	now func() time.Time
+	// templates caches the template of each folder new pages were created in during this run
+	templates map[string]folderTemplate
+	// dataDirOrder holds the indexes of DataDir from the oldest to the newest export, nil for a single one
+	dataDirOrder []int
+	// locks let the records of several users be processed at once
+	locks syncLocks
+	// notes maps a user ID to the user's private notes, so blocked users can be routed by their note
+	notes map[string]string
+	// rules are the folders of the --rules-file, used instead of CreatePeopleIn
+	rules []folderConfig
+	// overrides maps user IDs to their pages from the overrides file
+	overrides map[string]*obsidian.Page
+	// folderColors maps cleaned folders to their --folder-color, or the color of their rule
+	folderColors map[string]obsidian.Color
+	// assignedColors maps cleaned folders to their --assign-color
+	assignedColors map[string]obsidian.Color
+	// skippedUsers holds the user IDs of --skip-user and --skip-users-file
+	skippedUsers map[string]bool
+	// debounce is how long --watch waits for a changed file to settle, watchDebounce when not set
+	debounce time.Duration
+}
+
+// syncSummary counts what happened to the pages touched by a sync run
+type syncSummary struct {
+	Created   int
+	Updated   int
+	Unchanged int
+	Skipped   int
+	// Missing counts records skipped because no page existed for the user and none could be created, like with
+	// --update-only or for a conversation
+	Missing int
+	// NicknameChanges counts blocked users whose exported nickname differs from their page title
+	NicknameChanges int
+	// Collisions counts new pages that got a disambiguated name because another page already had the nickname
+	Collisions int
+	// Cached counts records skipped because the user's records haven't changed since the last sync
+	Cached int
+	// FollowsMatched counts follower and following records that matched an existing page
+	FollowsMatched int
+	// FollowsSkipped counts follower and following records without a page that weren't created
+	FollowsSkipped int
+	// Deleted counts orphan pages deleted by --remove-orphans
+	Deleted int
+	// StubsRenamed counts user-<id> pages renamed to the user's nickname by --rename-stubs
+	StubsRenamed int
+	// Recategorized counts pages moved to another folder by --recategorize
+	Recategorized int
+	// Pruned lists the titles of the pages whose blocked status was removed by --prune-blocked
+	Pruned []string
+	// Conflicts lists the pages whose web-message differed from the private note, with --on-conflict
+	Conflicts []string
+	// Errors lists the records that failed, with their user and error
+	Errors []string
+	// DataDirRecords counts the records taken from each --data-dir, in order, once merged, when there are several
+	DataDirRecords []int
+}
+
+// stateFileName is the name of the sync state file in the data directory
+const stateFileName = ".sync-state.json"
+
+// SyncState remembers the records of the last sync of a vault so users whose records haven't changed can be skipped
+type SyncState struct {
+	// Records maps a user ID to the hash of all of the user's records
+	Records map[string]string `json:"records"`
+}
+
+// syncStates is the content of the sync state file, which keeps the state of every vault synced with it apart so
+// syncing one vault doesn't skip users that were only synced to another
+type syncStates struct {
+	// Vaults maps the absolute path of a vault to its state
+	Vaults map[string]*SyncState `json:"vaults"`
+}
+
+// stateKey returns the absolute path of the vault, which its state is kept under in the sync state file
+func stateKey(vault *obsidian.Vault) string {
+	path, err := filepath.Abs(vault.Path)
+	if err != nil {
+		return filepath.Clean(vault.Path)
+	}
+	return path
+}
+
+// loadStates reads the sync state file at path.  A missing state file has no states.
+func loadStates(path string) (*syncStates, error) {
+	states := &syncStates{}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, states); err != nil {
+			return nil, fmt.Errorf("invalid sync state in %s: %w", path, err)
+		}
+	}
+	if states.Vaults == nil {
+		states.Vaults = make(map[string]*SyncState)
+	}
+	return states, nil
+}
+
+// loadState reads the sync state of the vault at key from the state file at path.  A missing state file or vault is an
+// empty state.
+func loadState(path, key string) (*SyncState, error) {
+	states, err := loadStates(path)
+	if err != nil {
+		return nil, err
+	}
+	state := states.Vaults[key]
+	if state == nil {
+		state = &SyncState{}
+	}
+	if state.Records == nil {
+		state.Records = make(map[string]string)
+	}
+	return state, nil
+}
+
+// saveState writes the sync state of the vault at key to the state file at path, keeping the states of other vaults
+func saveState(path, key string, state *SyncState) error {
+	states, err := loadStates(path)
+	if err != nil {
+		return err
+	}
+	states.Vaults[key] = state
+	data, err := json.MarshalIndent(states, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// recordHashes returns the sha256 of all of every user's records together with options, keyed by user ID
+func recordHashes(blockeds []fetlife.BlockedRecord, friends []fetlife.FriendRecord, privateNotes []fetlife.PrivateNoteRecord,
+	followers, followings []fetlife.FollowRecord, messages []fetlife.MessageRecord, options string) map[string]string {
+	type userRecords struct {
+		Blocked []fetlife.BlockedRecord
+		// Records read by later versions are left out when empty so hashes from before they were synced stay the same
+		Friends    []fetlife.FriendRecord `json:",omitempty"`
+		Notes      []fetlife.PrivateNoteRecord
+		Followers  []fetlife.FollowRecord  `json:",omitempty"`
+		Followings []fetlife.FollowRecord  `json:",omitempty"`
+		Messages   []fetlife.MessageRecord `json:",omitempty"`
+		Options    string                  `json:",omitempty"`
+	}
+
+	users := make(map[string]*userRecords)
+	user := func(userID string) *userRecords {
+		if users[userID] == nil {
+			users[userID] = &userRecords{}
+		}
+		return users[userID]
+	}
+	for _, blocked := range blockeds {
+		user(blocked.UserID).Blocked = append(user(blocked.UserID).Blocked, blocked)
+	}
+	for _, friend := range friends {
+		user(friend.UserID).Friends = append(user(friend.UserID).Friends, friend)
+	}
+	for _, note := range privateNotes {
+		user(note.MemberID).Notes = append(user(note.MemberID).Notes, note)
+	}
+	for _, follower := range followers {
+		user(follower.UserID).Followers = append(user(follower.UserID).Followers, follower)
+	}
+	for _, following := range followings {
+		user(following.UserID).Followings = append(user(following.UserID).Followings, following)
+	}
+	for _, message := range messages {
+		user(message.MemberID).Messages = append(user(message.MemberID).Messages, message)
+	}
+	for _, records := range users {
+		records.Options = options
+	}
+
+	hashes := make(map[string]string, len(users))
+	for userID, records := range users {
+		// Marshalling plain strings can't fail
+		data, _ := json.Marshal(records)
+		sum := sha256.Sum256(data)
+		hashes[userID] = hex.EncodeToString(sum[:])
+	}
+	return hashes
+}
+
+// outputOptions describes the options that change what records write to pages, so changing one of them processes
+// every user again.  It is empty when they are all at their defaults.
+func (sync *SyncCmd) outputOptions() string {
+	var options []string
+	if sync.FullText {
+		options = append(options, "full-text")
+	}
+	if sync.NoteTarget != "" && sync.NoteTarget != "web-message" {
+		options = append(options, "note-target="+sync.NoteTarget)
+	}
+	if sync.OnConflict != "" {
+		options = append(options, "on-conflict="+sync.OnConflict)
+	}
+	return strings.Join(options, ",")
+}
+
+// syncs tells whether the input is synced according to --only and --skip
+func (sync *SyncCmd) syncs(input string) bool {
+	if len(sync.Only) > 0 {
+		return slices.Contains(sync.Only, input)
+	}
+	return !slices.Contains(sync.Skip, input)
+}
+
+// workers returns how many users are processed at the same time.  Dry runs list their changes in the order of the
+// records, so they process one user at a time.  So does --match-by-name, since finding a page by name and adding the
+// user's URL to it must happen before another user looks for pages, or two users with the same nickname could both
+// claim the page.
+func (sync *SyncCmd) workers() int {
+	if sync.DryRun || sync.MatchByName || sync.Concurrency < 1 {
+		return 1
+	}
+	return sync.Concurrency
+}
+
+// tally adds one to a counter of the summary, when counter isn't nil, and marks the user as incomplete, when userID
+// isn't empty.  It's safe to call while other users are processed.
+func (sync *SyncCmd) tally(counter *int, userID string) {
+	sync.locks.state.Lock()
+	defer sync.locks.state.Unlock()
+	if counter != nil {
+		*counter++
+	}
+	if userID != "" {
+		sync.incomplete[userID] = true
+	}
+}
+
+// isCreated reports whether the page was created during this run
+func (sync *SyncCmd) isCreated(page *obsidian.Page) bool {
+	sync.locks.state.Lock()
+	defer sync.locks.state.Unlock()
+	return sync.createdPages[page]
+}
+
+// partial tells whether only some of the records are synced, because of --only, --skip, --user-id, --limit or --since
+func (sync *SyncCmd) partial() bool {
+	return len(sync.Only) > 0 || len(sync.Skip) > 0 || sync.filtered()
+}
+
+// filtered tells whether records are dropped by --user-id, --limit or --since
+func (sync *SyncCmd) filtered() bool {
+	return len(sync.UserID) > 0 || sync.Limit > 0 || sync.Since != ""
+}
+
+// filterRecords keeps the records of the --user-id users, up to --limit of them, and adds the number of records it
+// dropped to filtered
+func filterRecords[T any](sync *SyncCmd, records []T, userID func(T) string, filtered *int) []T {
+	var kept []T
+	for _, record := range records {
+		if sync.Limit > 0 && len(kept) == sync.Limit {
+			break
+		}
+		if len(sync.UserID) > 0 && !slices.Contains(sync.UserID, userID(record)) {
+			continue
+		}
+		kept = append(kept, record)
+	}
+	*filtered += len(records) - len(kept)
+	return kept
+}
+
+// filterSince keeps the records updated on or after since, and adds the number of records it dropped to filtered.
+// Records whose date can't be parsed are dropped with a warning.
+func filterSince[T any](records []T, since time.Time, updated func(T) (time.Time, error), userID func(T) string, filtered *int) []T {
+	var kept []T
+	for _, record := range records {
+		date, err := updated(record)
+		if err != nil {
+			log.Warn().Err(err).Str("userID", userID(record)).Msg("Skipping record with an unreadable date")
+			continue
+		}
+		if !date.Before(since) {
+			kept = append(kept, record)
+		}
+	}
+	*filtered += len(records) - len(kept)
+	return kept
+}
+
+// progressBar returns where to draw the progress bar, or nil to log progress events instead
+func (sync *SyncCmd) progressBar() io.Writer {
+	switch sync.Progress {
+	case "bar":
+		return os.Stdout
+	case "none":
+		return io.Discard
+	case "log":
+		return nil
+	default:
+		if zerolog.GlobalLevel() <= zerolog.InfoLevel && isTerminal(os.Stdout) {
+			return os.Stdout
+		}
+		return nil
+	}
+}
+
+// statePath returns the path of the sync state file in the first data directory, which is kept next to a zip archive
+// instead of inside it
+func (sync *SyncCmd) statePath() string {
+	if sync.StateFile != "" {
+		return sync.StateFile
+	}
+	dataDir := sync.primaryDataDir()
+	if fetlife.IsArchive(dataDir) {
+		return filepath.Join(filepath.Dir(dataDir), stateFileName)
+	}
+	return filepath.Join(dataDir, stateFileName)
 }
 
 func (sync *SyncCmd) Run(vault *obsidian.Vault) error {
+	if err := sync.run(vault); err != nil {
+		return err
+	}
+	if sync.Watch {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		if err := sync.watch(ctx, vault); err != nil {
+			return err
+		}
+	}
+
+	// With --report, failed records make the program exit with its own code
+	if sync.Report != "" && len(sync.summary.Errors) > 0 {
+		return &RecordErrors{Count: len(sync.summary.Errors)}
+	}
+	return nil
+}
+
+// run syncs the vault with the data directory once
+func (sync *SyncCmd) run(vault *obsidian.Vault) (err error) {
 	log.Info().
 		Str("vault", vault.Path).
-		Str("dataDir", sync.DataDir).
+		Strs("dataDir", sync.DataDir).
+		Bool("dryRun", sync.DryRun).
 		Msg("Starting sync")
 
+	sync.summary = syncSummary{}
+	sync.createdPages = make(map[*obsidian.Page]bool)
+	sync.templates = nil
+	sync.createdOrder = nil
+	sync.movedOrder = nil
+	sync.patch = nil
+	sync.journalPath = ""
+	if !sync.DryRun {
+		sync.journalPath = journalPath(vault, sync.JournalDir)
+	}
+	defer sync.closeJournal()
+
+	// The report is written whether the sync completes or not
+	if sync.Report != "" {
+		startedAt := sync.syncTime()
+		defer func() {
+			if reportErr := writeSyncReport(sync.Report, sync.report(vault, startedAt, err)); reportErr != nil {
+				log.Error().Err(reportErr).Str("path", sync.Report).Msg("Failed to write sync report")
+				if err == nil {
+					err = reportErr
+				}
+			}
+		}()
+	}
+
 	log.Info().Int("pageCount", len(vault.Pages)).Msg("Loaded vault")
 
-	// Read blockeds.txt
-	blockeds, err := fetlife.ReadBlockeds(sync.DataDir)
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to read blockeds.txt")
-		return err
+	if sync.overrides, err = sync.loadOverrides(vault); err != nil {
+		log.Error().Err(err).Msg("Failed to read overrides")
+		return err
+	}
+	if len(sync.overrides) > 0 {
+		log.Info().Int("overrideCount", len(sync.overrides)).Msg("Loaded overrides")
+	}
+	if sync.skippedUsers, err = sync.loadSkipUsers(); err != nil {
+		log.Error().Err(err).Msg("Failed to read skipped users")
+		return err
+	}
+	if sync.RulesFile != "" {
+		if err := sync.applyRules(); err != nil {
+			log.Error().Err(err).Msg("Failed to read rules")
+			return err
+		}
+		log.Info().Int("ruleCount", len(sync.rules)).Msg("Loaded rules")
+	}
+	if sync.folderColors, err = parseFolderColors("--folder-color", sync.FolderColor); err != nil {
+		return err
+	}
+	if sync.assignedColors, err = parseFolderColors("--assign-color", sync.AssignColor); err != nil {
+		return err
+	}
+
+	var options []fetlife.ReadOption
+	if sync.Lenient {
+		options = append(options, fetlife.Lenient())
+	}
+
+	var since time.Time
+	if sync.Since != "" {
+		if since, err = time.Parse(dateLayout, sync.Since); err != nil {
+			return err
+		}
+	}
+
+	// The exports are merged from the oldest to the newest by their records, whatever order they're given in
+	if err := sync.orderDataDirs(options); err != nil {
+		log.Error().Err(err).Msg("Failed to read data directories")
+		return err
+	}
+
+	// Large files are streamed, keeping only the records that pass the filters
+	streams := sync.streams()
+	filtered := 0
+	if streams {
+		log.Info().Msg("Streaming blockeds.txt and private_notes.txt")
+	}
+
+	// Read blockeds.txt
+	var blockeds []fetlife.BlockedRecord
+	if sync.syncs("blocked") {
+		if streams {
+			blockeds, err = readDataDirs(sync, func(dataDir string, options ...fetlife.ReadOption) ([]fetlife.BlockedRecord, error) {
+				return sync.streamBlockeds(dataDir, since, &filtered, options...)
+			}, options, fetlife.MergeBlockeds)
+		} else {
+			blockeds, err = readDataDirs(sync, fetlife.ReadBlockeds, options, fetlife.MergeBlockeds)
+		}
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to read blockeds.txt")
+			return err
+		}
+		log.Info().Int("blockedCount", len(blockeds)).Msg("Loaded blockeds")
+	}
+
+	// Blocked users are routed by every private note in the export, not just the notes --only and the filters sync.
+	// Streamed notes are added to the routing map as they're read.
+	var routing map[string]string
+	if sync.syncs("blocked") && streams {
+		routing = make(map[string]string)
+	}
+
+	// Read private_notes.txt
+	var privateNotes []fetlife.PrivateNoteRecord
+	if sync.syncs("notes") {
+		if streams {
+			privateNotes, err = readDataDirs(sync, func(dataDir string, options ...fetlife.ReadOption) ([]fetlife.PrivateNoteRecord, error) {
+				return sync.streamPrivateNotes(dataDir, since, &filtered, routing, options...)
+			}, options, fetlife.MergePrivateNotes)
+		} else {
+			privateNotes, err = readDataDirs(sync, fetlife.ReadPrivateNotes, options, fetlife.MergePrivateNotes)
+		}
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to read private_notes.txt")
+			return err
+		}
+		log.Info().Int("privateNoteCount", len(privateNotes)).Msg("Loaded private notes")
+	}
+
+	sync.notes = nil
+	if sync.syncs("blocked") {
+		switch {
+		case streams && sync.syncs("notes"):
+			// The routing map was filled while streaming the notes
+		case streams:
+			err = sync.streamNoteRoutes(routing, options...)
+		case sync.syncs("notes"):
+			routing = notesByUser(privateNotes)
+		default:
+			var allNotes []fetlife.PrivateNoteRecord
+			if allNotes, err = sync.readAllPrivateNotes(options); err == nil {
+				routing = notesByUser(allNotes)
+			}
+		}
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to read private_notes.txt")
+			return err
+		}
+		sync.notes = routing
+	}
+
+	// Read friends.txt, which not every export has
+	var friends []fetlife.FriendRecord
+	if sync.syncs("friends") {
+		friends, err = readDataDirs(sync, fetlife.ReadFriends, options, fetlife.MergeFriends)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Error().Err(err).Msg("Failed to read friends.txt")
+			return err
+		}
+		log.Info().Int("friendCount", len(friends)).Msg("Loaded friends")
+	}
+
+	// Read followers.csv and followings.csv, which not every export has
+	var followers, followings []fetlife.FollowRecord
+	if sync.syncs("follows") {
+		followers, err = readDataDirs(sync, fetlife.ReadFollowers, options, fetlife.MergeFollows)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Error().Err(err).Msg("Failed to read followers.csv")
+			return err
+		}
+		followings, err = readDataDirs(sync, fetlife.ReadFollowings, options, fetlife.MergeFollows)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Error().Err(err).Msg("Failed to read followings.csv")
+			return err
+		}
+		log.Info().
+			Int("followerCount", len(followers)).
+			Int("followingCount", len(followings)).
+			Msg("Loaded followers and followings")
+	}
+
+	// Read conversations.txt only when asked to, since it's the largest file of the export
+	var messages []fetlife.MessageRecord
+	if sync.ImportConversations && sync.syncs("conversations") {
+		messages, err = readDataDirs(sync, fetlife.ReadConversations, options, fetlife.MergeConversations)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to read conversations.txt")
+			return err
+		}
+		log.Info().Int("messageCount", len(messages)).Msg("Loaded conversations")
+	}
+
+	// Records of skipped users are dropped before anything else, streamed ones already are
+	if len(sync.skippedUsers) > 0 {
+		blockeds = dropSkippedUsers(sync, blockeds, func(r fetlife.BlockedRecord) string { return r.UserID })
+		privateNotes = dropSkippedUsers(sync, privateNotes, func(r fetlife.PrivateNoteRecord) string { return r.MemberID })
+		friends = dropSkippedUsers(sync, friends, func(r fetlife.FriendRecord) string { return r.UserID })
+		followers = dropSkippedUsers(sync, followers, func(r fetlife.FollowRecord) string { return r.UserID })
+		followings = dropSkippedUsers(sync, followings, func(r fetlife.FollowRecord) string { return r.UserID })
+		messages = dropSkippedUsers(sync, messages, func(r fetlife.MessageRecord) string { return r.MemberID })
+		log.Info().Int("skipped", sync.summary.Skipped).Msg("Skipped records of --skip-user users")
+	}
+
+	// Streamed records have been filtered already, filtering them again keeps them all
+	if sync.filtered() {
+		if !since.IsZero() {
+			blockeds = filterSince(blockeds, since, fetlife.BlockedRecord.Updated, func(r fetlife.BlockedRecord) string { return r.UserID }, &filtered)
+			privateNotes = filterSince(privateNotes, since, fetlife.PrivateNoteRecord.Updated, func(r fetlife.PrivateNoteRecord) string { return r.MemberID }, &filtered)
+		}
+		blockeds = filterRecords(sync, blockeds, func(r fetlife.BlockedRecord) string { return r.UserID }, &filtered)
+		privateNotes = filterRecords(sync, privateNotes, func(r fetlife.PrivateNoteRecord) string { return r.MemberID }, &filtered)
+		friends = filterRecords(sync, friends, func(r fetlife.FriendRecord) string { return r.UserID }, &filtered)
+		followers = filterRecords(sync, followers, func(r fetlife.FollowRecord) string { return r.UserID }, &filtered)
+		followings = filterRecords(sync, followings, func(r fetlife.FollowRecord) string { return r.UserID }, &filtered)
+		messages = filterRecords(sync, messages, func(r fetlife.MessageRecord) string { return r.MemberID }, &filtered)
+		log.Info().Int("filtered", filtered).Msg("Filtered out records by --user-id, --limit and --since")
+	}
+
+	// Users whose records are the same as last time are skipped
+	state := &SyncState{Records: make(map[string]string)}
+	if !sync.NoCache {
+		if state, err = loadState(sync.statePath(), stateKey(vault)); err != nil {
+			log.Error().Err(err).Msg("Failed to read sync state")
+			return err
+		}
+	}
+	hashes := recordHashes(blockeds, friends, privateNotes, followers, followings, messages, sync.outputOptions())
+	sync.incomplete = make(map[string]bool)
+	unchanged := func(userID string) bool {
+		return state.Records[userID] == hashes[userID]
+	}
+	cached := func(userID string) bool {
+		if !unchanged(userID) {
+			return false
+		}
+		log.Debug().Str("userID", userID).Msg("Records unchanged since last sync, skipping")
+		sync.tally(&sync.summary.Cached, "")
+		return true
+	}
+
+	// Conversations are processed per member
+	conversations := make(map[string][]fetlife.MessageRecord)
+	var members []string
+	for _, message := range messages {
+		if conversations[message.MemberID] == nil {
+			members = append(members, message.MemberID)
+		}
+		conversations[message.MemberID] = append(conversations[message.MemberID], message)
+	}
+
+	// With --max-creates, the pages the records would create are counted before anything is written
+	if sync.guardsCreates() {
+		var users []plannedUser
+		plan := func(userID, nickname string) {
+			if !unchanged(userID) {
+				users = append(users, plannedUser{userID: userID, nickname: nickname})
+			}
+		}
+		for _, blocked := range blockeds {
+			plan(blocked.UserID, blocked.Nickname)
+		}
+		for _, friend := range friends {
+			plan(friend.UserID, friend.Nickname)
+		}
+		for _, note := range privateNotes {
+			plan(note.MemberID, "")
+		}
+		if sync.CreateFollowersIn != "" {
+			for _, follow := range slices.Concat(followers, followings) {
+				plan(follow.UserID, follow.Nickname)
+			}
+		}
+		if err := sync.checkCreates(vault, users); err != nil {
+			return err
+		}
+	}
+
+	// A dry run doesn't change the vault, so there's nothing to back up
+	if sync.Backup && !sync.DryRun {
+		backup := &BackupCmd{IncludeConfig: sync.BackupIncludeConfig, now: sync.now}
+		if err := backup.Run(vault); err != nil {
+			return err
+		}
+	}
+
+	total := len(blockeds) + len(friends) + len(privateNotes) + len(followers) + len(followings) + len(members)
+	progress := newProgress(total, sync.progressBar())
+	defer progress.Finish()
+
+	// The records of each input are processed a user at a time, with several users at once.  Only a conflict
+	// stops the sync, after other errors the user is left out of the state so it's tried again next time.
+	workers := sync.workers()
+	processRecords := func(n int, userID func(i int) string, process func(i int) error, failure string) error {
+		users := groupByUser(n, userID)
+		return parallel(len(users), workers, func(user int) error {
+			for _, i := range users[user] {
+				progress.Step()
+				if cached(userID(i)) {
+					continue
+				}
+				if err := process(i); err != nil {
+					if errors.Is(err, errConflict) {
+						return err
+					}
+					log.Error().Err(err).Str("userID", userID(i)).Msg(failure)
+					sync.tally(nil, userID(i))
+					sync.addError(fmt.Errorf("%s %s: %w", failure, userID(i), err))
+					// Continue processing other records
+				}
+			}
+			return nil
+		})
+	}
+
+	// Process blockeds
+	err = processRecords(len(blockeds), func(i int) string { return blockeds[i].UserID }, func(i int) error {
+		return sync.processBlocked(vault, blockeds[i])
+	}, "Failed to process blocked user")
+	if err != nil {
+		return err
+	}
+
+	if sync.PruneBlocked {
+		if err := sync.pruneBlocked(vault, blockeds); err != nil {
+			log.Error().Err(err).Msg("Failed to prune blocked pages")
+			return err
+		}
+	}
+
+	// Process friends
+	err = processRecords(len(friends), func(i int) string { return friends[i].UserID }, func(i int) error {
+		return sync.processFriend(vault, friends[i])
+	}, "Failed to process friend")
+	if err != nil {
+		return err
+	}
+
+	// Process private notes
+	err = processRecords(len(privateNotes), func(i int) string { return privateNotes[i].MemberID }, func(i int) error {
+		return sync.processPrivateNote(vault, privateNotes[i])
+	}, "Failed to process private note")
+	if err != nil {
+		return err
+	}
+
+	// Process followers and followings
+	for _, follows := range []struct {
+		records []fetlife.FollowRecord
+		tag     string
+	}{{followers, "follower"}, {followings, "following"}} {
+		err = processRecords(len(follows.records), func(i int) string { return follows.records[i].UserID }, func(i int) error {
+			return sync.processFollow(vault, follows.records[i], follows.tag)
+		}, "Failed to process "+follows.tag)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Process conversations
+	err = processRecords(len(members), func(i int) string { return members[i] }, func(i int) error {
+		return sync.processConversation(vault, members[i], conversations[members[i]])
+	}, "Failed to process conversation")
+	if err != nil {
+		return err
+	}
+
+	progress.Finish()
+
+	if sync.Recategorize {
+		if err := sync.recategorize(vault); err != nil {
+			log.Error().Err(err).Msg("Failed to recategorize pages")
+			return err
+		}
+	}
+
+	if sync.RemoveOrphans || sync.ReportOrphans {
+		// The pages of skipped users are never orphans
+		userIDs := maps.Clone(sync.skippedUsers)
+		for userID := range hashes {
+			userIDs[userID] = true
+		}
+		if sync.ReportOrphans {
+			reportOrphans(orphanPages(vault, userIDs))
+		}
+		if sync.RemoveOrphans {
+			if err := sync.removeOrphans(vault, userIDs); err != nil {
+				log.Error().Err(err).Msg("Failed to remove orphan pages")
+				return err
+			}
+		}
+	}
+
+	event := log.Info().
+		Int("created", sync.summary.Created).
+		Int("updated", sync.summary.Updated).
+		Int("unchanged", sync.summary.Unchanged).
+		Int("skipped", sync.summary.Skipped).
+		Int("missing", sync.summary.Missing).
+		Int("nicknameChanges", sync.summary.NicknameChanges).
+		Int("collisions", sync.summary.Collisions).
+		Int("cached", sync.summary.Cached).
+		Int("followsMatched", sync.summary.FollowsMatched).
+		Int("followsSkipped", sync.summary.FollowsSkipped).
+		Int("deleted", sync.summary.Deleted).
+		Int("recategorized", sync.summary.Recategorized).
+		Int("stubsRenamed", sync.summary.StubsRenamed).
+		Strs("pruned", sync.summary.Pruned).
+		Strs("conflicts", sync.summary.Conflicts).
+		Int("errors", len(sync.summary.Errors))
+	if len(sync.DataDir) > 1 {
+		event = event.Interface("dataDirRecords", sync.recordsByDataDir())
+	}
+	if sync.DryRun {
+		if err := sync.printDryRun(); err != nil {
+			return err
+		}
+		if sync.MaxCreates > 0 && sync.summary.Created > sync.MaxCreates {
+			log.Warn().
+				Int("creates", sync.summary.Created).
+				Int("maxCreates", sync.MaxCreates).
+				Msg("The sync would stop, it creates more pages than --max-creates")
+		}
+		event.Msg("Dry run completed, no files were written")
+		return nil
+	}
+	if sync.SyncLog != "" {
+		if err := sync.writeSyncLog(vault); err != nil {
+			log.Error().Err(err).Msg("Failed to write sync log")
+			return err
+		}
+	}
+	if sync.WriteIndex != "" {
+		if err := sync.writeIndex(vault); err != nil {
+			log.Error().Err(err).Msg("Failed to write index")
+			return err
+		}
+	}
+	if err := sync.recordState(vault); err != nil {
+		log.Error().Err(err).Msg("Failed to record sync state in journal")
+		return err
+	}
+	if err := sync.closeJournal(); err != nil {
+		return err
+	}
+
+	// Remember every user that was fully processed.  Users without synced records keep their state, so a partial sync
+	// doesn't make the next full sync process them again.
+	newState := &SyncState{Records: make(map[string]string)}
+	if sync.partial() {
+		for userID, hash := range state.Records {
+			if _, ok := hashes[userID]; !ok {
+				newState.Records[userID] = hash
+			}
+		}
+	}
+	for userID, hash := range hashes {
+		if !sync.incomplete[userID] {
+			newState.Records[userID] = hash
+		}
+	}
+	if err := saveState(sync.statePath(), stateKey(vault), newState); err != nil {
+		log.Error().Err(err).Msg("Failed to write sync state")
+		return err
+	}
+
+	event.Msg("Sync completed successfully")
+	return nil
+}
+
+// pruneBlocked removes the blocked tag, blocked-date and blocked-at from the pages of users who aren't in blockeds.txt anymore.
+// Pages are only changed, never deleted.
+func (sync *SyncCmd) pruneBlocked(vault *obsidian.Vault, blockeds []fetlife.BlockedRecord) error {
+	blocked := make(map[string]bool)
+	for _, record := range blockeds {
+		blocked[record.UserID] = true
+	}
+	stillBlocked := func(url string) bool {
+		userID, ok := profileUserID(url)
+		return ok && blocked[userID]
+	}
+
+	for _, page := range vault.Pages {
+		if !page.HasTag("blocked") || sync.skipsPage(page) {
+			continue
+		}
+		urls := append([]string{page.Url}, page.UrlAliases...)
+		if !slices.ContainsFunc(urls, func(url string) bool {
+			_, ok := profileUserID(url)
+			return ok
+		}) || slices.ContainsFunc(urls, stillBlocked) {
+			continue
+		}
+
+		before := sync.snapshot(page, false)
+		page.RemoveTag("blocked")
+		page.BlockedDate = ""
+		page.BlockedAt = ""
+		if err := sync.savePage(before, page); err != nil {
+			return err
+		}
+		sync.summary.Pruned = append(sync.summary.Pruned, page.Title)
+		log.Info().
+			Str("page", page.Title).
+			Str("url", page.Url).
+			Msg("User is no longer blocked, removed blocked status")
+	}
+	return nil
+}
+
+// profileUserID returns the user ID of a FetLife profile URL like https://fetlife.com/users/12345, parsed the same way
+// pages are found for a record
+func profileUserID(url string) (string, bool) {
+	return obsidian.ParseUserURL(url)
+}
+
+// orphanPages returns the person pages with a FetLife profile URL whose user isn't one of userIDs, matching the URL
+// and its aliases the same way pages are found for a record
+func orphanPages(vault *obsidian.Vault, userIDs map[string]bool) []*obsidian.Page {
+	known := func(url string) bool {
+		userID, ok := profileUserID(url)
+		return ok && userIDs[userID]
+	}
+
+	return vault.FilterPages(func(page *obsidian.Page) bool {
+		_, ok := profileUserID(page.Url)
+		return page.HasTag("person") && ok && !known(page.Url) && !slices.ContainsFunc(page.UrlAliases, known)
+	})
+}
+
+// reportOrphans prints the title, path and user ID of each orphan page, one per line separated by tabs
+func reportOrphans(orphans []*obsidian.Page) {
+	if len(orphans) == 0 {
+		fmt.Println("No orphan pages found")
+		return
+	}
+	fmt.Printf("%d pages with users that aren't in the data files:\n", len(orphans))
+	for _, page := range orphans {
+		userID, _ := profileUserID(page.Url)
+		fmt.Printf("%s\t%s\t%s\n", page.Title, pageFile(page), userID)
+	}
+}
+
+// removeOrphans deletes the person pages whose FetLife profile isn't one of userIDs.  Unless --force is given the
+// orphans are listed and only deleted after the user confirms, which needs a terminal.
+func (sync *SyncCmd) removeOrphans(vault *obsidian.Vault, userIDs map[string]bool) error {
+	orphans := orphanPages(vault, userIDs)
+	if len(orphans) == 0 {
+		return nil
+	}
+
+	if sync.DryRun {
+		for _, page := range orphans {
+			if sync.DryRunFormat != "json-patch" {
+				fmt.Printf("- delete %s\n", pageFile(page))
+			}
+			sync.patch = append(sync.patch, JSONPatchOp{Op: "remove", Path: filePointer(pageFile(page))})
+		}
+		return nil
+	}
+
+	if !sync.Force {
+		input := sync.input
+		if input == nil {
+			if !isTerminal(os.Stdin) {
+				log.Warn().Int("orphanCount", len(orphans)).Msg("Not deleting orphan pages without a terminal to confirm, use --force")
+				return nil
+			}
+			input = os.Stdin
+		}
+
+		for _, page := range orphans {
+			fmt.Printf("%s\n", pageFile(page))
+		}
+		fmt.Printf("Delete these %d pages whose users aren't in the data files? [y/N] ", len(orphans))
+		answer, _ := bufio.NewReader(input).ReadString('\n')
+		if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+			log.Info().Int("orphanCount", len(orphans)).Msg("Keeping orphan pages")
+			return nil
+		}
+	}
+
+	for _, page := range orphans {
+		content, err := os.ReadFile(page.FilePath)
+		if err != nil {
+			return err
+		}
+		file := pageFile(page)
+		if err := vault.Delete(page); err != nil {
+			return err
+		}
+		if err := sync.record(journalEntry{Op: "delete", Path: file, Before: string(content)}); err != nil {
+			return err
+		}
+		// Undo creates the folders again when it restores the page
+		if err := vault.PruneFolder(page.Folder); err != nil {
+			return err
+		}
+		sync.summary.Deleted++
+		log.Info().Str("page", file).Msg("Deleted orphan page")
+	}
+	return nil
+}
+
+// errConflict is returned when several pages belong to the same user and --conflict-strategy is error.  It stops the
+// sync instead of only failing the record.
+var errConflict = errors.New("several pages for the same user")
+
+// resolvePages narrows several pages found for a user down to one with --conflict-strategy.  skip is true when the
+// record should be skipped.
+func (sync *SyncCmd) resolvePages(userID string, pages []*obsidian.Page) (resolved []*obsidian.Page, skip bool, err error) {
+	if len(pages) < 2 {
+		return pages, false, nil
+	}
+
+	page, err := resolveConflict(pages, sync.ConflictStrategy)
+	if err != nil {
+		return nil, false, err
+	}
+	if page == nil {
+		log.Warn().
+			Str("userID", userID).
+			Int("matchCount", len(pages)).
+			Msg("Multiple pages found for user ID, skipping")
+		sync.tally(&sync.summary.Skipped, userID)
+		return nil, true, nil
+	}
+
+	log.Warn().
+		Str("userID", userID).
+		Int("matchCount", len(pages)).
+		Str("strategy", sync.ConflictStrategy).
+		Str("page", pageFile(page)).
+		Msg("Multiple pages found for user ID, using one of them")
+	return []*obsidian.Page{page}, false, nil
+}
+
+// resolveConflict picks the page to update out of several pages for the same user:
+//   - skip returns no page
+//   - first returns the first page
+//   - newest returns the page whose file was modified last, where a page that only exists in memory is the newest
+//   - error returns an error wrapping errConflict
+func resolveConflict(pages []*obsidian.Page, strategy string) (*obsidian.Page, error) {
+	switch strategy {
+	case "skip":
+		return nil, nil
+	case "first":
+		return pages[0], nil
+	case "newest":
+		var newest *obsidian.Page
+		var newestTime time.Time
+		for _, page := range pages {
+			info, err := os.Stat(page.FilePath)
+			if errors.Is(err, os.ErrNotExist) {
+				return page, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			if newest == nil || info.ModTime().After(newestTime) {
+				newest, newestTime = page, info.ModTime()
+			}
+		}
+		return newest, nil
+	case "error":
+		files := make([]string, len(pages))
+		for i, page := range pages {
+			files[i] = pageFile(page)
+		}
+		return nil, fmt.Errorf("%w: %s", errConflict, strings.Join(files, ", "))
+	default:
+		return nil, fmt.Errorf("unknown conflict strategy %q", strategy)
+	}
+}
+
+// findPageByUserID finds the page the overrides file maps the user to, or else the pages whose URL or URL aliases
+// point at the user's FetLife profile
+func (sync *SyncCmd) findPageByUserID(vault *obsidian.Vault, userID string) ([]*obsidian.Page, error) {
+	if page, ok := sync.overrides[userID]; ok {
+		return []*obsidian.Page{page}, nil
+	}
+	return vault.FindByUserID(userID)
+}
+
+// findPage finds the pages of a user like findPageByUserID and, with --match-by-name, the pages titled or aliased
+// with the user's nickname when none has the user's profile URL.  byName tells whether the pages were found by name.
+func (sync *SyncCmd) findPage(vault *obsidian.Vault, userID, nickname string) (pages []*obsidian.Page, byName bool, err error) {
+	pages, err = sync.findPageByUserID(vault, userID)
+	if err != nil || len(pages) > 0 || !sync.MatchByName || nickname == "" {
+		return pages, false, err
+	}
+
+	pages = findPageByName(vault, nickname)
+	if len(pages) > 0 {
+		log.Debug().
+			Str("userID", userID).
+			Str("nickname", nickname).
+			Int("matchCount", len(pages)).
+			Msg("No page has the user's profile URL, found pages by name")
+	}
+	return pages, len(pages) > 0, nil
+}
+
+// findPageByName returns the pages whose title or one of whose aliases is the nickname, ignoring case.  Pages with a
+// FetLife profile URL already belong to a user and templates aren't people, so neither is returned.
+func findPageByName(vault *obsidian.Vault, nickname string) []*obsidian.Page {
+	return vault.FilterPages(func(page *obsidian.Page) bool {
+		if page.Folder == templatesFolder || slices.ContainsFunc(append([]string{page.Url}, page.UrlAliases...), func(url string) bool {
+			_, ok := profileUserID(url)
+			return ok
+		}) {
+			return false
+		}
+		return strings.EqualFold(page.Title, nickname) || slices.ContainsFunc(page.Aliases, func(alias string) bool {
+			return strings.EqualFold(alias, nickname)
+		})
+	})
+}
+
+// linkUserURL adds the user's profile URL to a page found by name, as its url or, when the page already has a url
+// of another site, as a url alias, so the page is found by the user's ID from now on
+func linkUserURL(page *obsidian.Page, userID string) {
+	url := obsidian.UserURL(userID)
+	if page.Url == "" {
+		page.Url = url
+	} else {
+		page.UrlAliases = append(page.UrlAliases, url)
+	}
+	log.Info().
+		Str("userID", userID).
+		Str("page", pageFile(page)).
+		Msg("Matched page by name, added the user's profile URL")
+}
+
+func (sync *SyncCmd) processBlocked(vault *obsidian.Vault, blocked fetlife.BlockedRecord) error {
+	pages, byName, err := sync.findPage(vault, blocked.UserID, blocked.Nickname)
+	if err != nil {
+		return err
+	}
+
+	if len(pages) > 0 && sync.CreateOnly && !sync.isCreated(pages[0]) {
+		log.Debug().
+			Str("userID", blocked.UserID).
+			Str("page", pages[0].Title).
+			Msg("Page already exists for blocked user, skipping")
+		sync.tally(&sync.summary.Skipped, blocked.UserID)
+		return nil
+	}
+
+	pages, skip, err := sync.resolvePages(blocked.UserID, pages)
+	if err != nil || skip {
+		return err
+	}
+
+	if len(pages) == 0 && sync.UpdateOnly {
+		log.Debug().
+			Str("userID", blocked.UserID).
+			Str("nickname", blocked.Nickname).
+			Msg("No existing page for blocked user, skipping")
+		sync.tally(&sync.summary.Missing, blocked.UserID)
+		return nil
+	}
+
+	var page *obsidian.Page
+	created := len(pages) == 0
+	folder := sync.determineBlockedFolder(blocked.UserID, blocked.Nickname, sync.notes[blocked.UserID])
+	if created {
+		// Create new page from template in the CreateBlockedIn folder
+		log.Debug().
+			Str("userID", blocked.UserID).
+			Str("nickname", blocked.Nickname).
+			Str("folder", folder).
+			Msg("Creating new page for blocked user")
+
+		page, err = sync.createPageInFolder(vault, templateFields{
+			UserID:    blocked.UserID,
+			Nickname:  blocked.Nickname,
+			BlockedAt: blocked.CreatedAt,
+			Blocked:   true,
+		}, folder)
+		if err != nil {
+			return err
+		}
+	} else {
+		page = pages[0]
+		log.Debug().
+			Str("userID", blocked.UserID).
+			Str("page", page.Title).
+			Msg("Updating existing page for blocked user")
+
+		// Without a note in the export, the note already on the page decides
+		if sync.notes[blocked.UserID] == "" {
+			folder = sync.determineBlockedFolder(blocked.UserID, blocked.Nickname, page.WebMessage)
+		}
+	}
+
+	defer sync.locks.pages.lock(page)()
+	before := sync.snapshot(page, created)
+	if byName {
+		linkUserURL(page, blocked.UserID)
+	}
+
+	if !created {
+		if err := sync.renameStub(vault, page, blocked.UserID, blocked.Nickname); err != nil {
+			return err
+		}
+	}
+
+	// Follow nickname changes by renaming the page, keeping the name that isn't the title as an alias so the
+	// person can still be found under either name.  A page found by name keeps the title it was given.
+	if !created && !byName && blocked.Nickname != "" && page.Title != blocked.Nickname &&
+		page.Title != disambiguatedTitle(blocked.Nickname, blocked.UserID) {
+		oldTitle := page.Title
+		log.Info().
+			Str("userID", blocked.UserID).
+			Str("page", oldTitle).
+			Str("nickname", blocked.Nickname).
+			Msg("Nickname in export differs from page title")
+		sync.tally(&sync.summary.NicknameChanges, "")
+
+		sync.locks.files.Lock()
+		renamed, err := sync.renamePage(vault, page, blocked.Nickname)
+		sync.locks.files.Unlock()
+		if err != nil {
+			return err
+		}
+
+		alias := blocked.Nickname
+		if renamed {
+			alias = oldTitle
+		}
+		addAlias(page, alias)
+	}
+
+	// Keep the FetLife nickname findable on pages titled otherwise, like disambiguated ones
+	addAlias(page, blocked.Nickname)
+
+	// Move the page of a newly blocked user out of the folder it was created in
+	if sync.MoveBlocked && !created && page.Folder != filepath.Clean(folder) {
+		if _, err := sync.movePage(vault, page, folder); err != nil {
+			return err
+		}
+	}
+
+	// Ensure "blocked" tag is present
+	page.AddTag("blocked")
+
+	// Color the badges of blocked users whose page has no color yet
+	sync.applyFolderColor(page, folder)
+	if page.WebBadgeColor == "" {
+		page.WebBadgeColor = sync.blockedColor()
+	}
+
+	// Older syncs stored the block date in web-message, move it to its own field
+	if message, blockedDate, ok := splitBlockedMessage(page.WebMessage); ok {
+		page.WebMessage = message
+		if page.BlockedDate == "" {
+			page.BlockedDate = blockedDate
+		}
+	}
+
+	// Record when the user was blocked
+	if blocked.CreatedAt != "" {
+		page.BlockedDate = blocked.CreatedAt
+	}
+	page.BlockedAt = blocked.CreatedAt
+
+	// Save the page
+	if err := sync.savePage(before, page); err != nil {
+		return err
+	}
+	if sync.DryRun {
+		return nil
+	}
+
+	log.Debug().
+		Str("userID", blocked.UserID).
+		Str("page", page.Title).
+		Msg("Successfully updated blocked user page")
+
+	return nil
+}
+
+func (sync *SyncCmd) processFriend(vault *obsidian.Vault, friend fetlife.FriendRecord) error {
+	pages, byName, err := sync.findPage(vault, friend.UserID, friend.Nickname)
+	if err != nil {
+		return err
+	}
+
+	if len(pages) > 0 && sync.CreateOnly && !sync.isCreated(pages[0]) {
+		log.Debug().
+			Str("userID", friend.UserID).
+			Str("page", pages[0].Title).
+			Msg("Page already exists for friend, skipping")
+		sync.tally(&sync.summary.Skipped, friend.UserID)
+		return nil
+	}
+
+	pages, skip, err := sync.resolvePages(friend.UserID, pages)
+	if err != nil || skip {
+		return err
+	}
+
+	if len(pages) == 0 && sync.UpdateOnly {
+		log.Debug().
+			Str("userID", friend.UserID).
+			Str("nickname", friend.Nickname).
+			Msg("No existing page for friend, skipping")
+		sync.tally(&sync.summary.Missing, friend.UserID)
+		return nil
+	}
+
+	var page *obsidian.Page
+	created := len(pages) == 0
+	if created {
+		// Create new page from template in the CreateFriendsIn folder
+		log.Debug().
+			Str("userID", friend.UserID).
+			Str("nickname", friend.Nickname).
+			Str("folder", sync.CreateFriendsIn).
+			Msg("Creating new page for friend")
+
+		page, err = sync.createPageInFolder(vault, templateFields{UserID: friend.UserID, Nickname: friend.Nickname}, sync.CreateFriendsIn)
+		if err != nil {
+			return err
+		}
+	} else {
+		page = pages[0]
+		log.Debug().
+			Str("userID", friend.UserID).
+			Str("page", page.Title).
+			Msg("Updating existing page for friend")
+	}
+
+	defer sync.locks.pages.lock(page)()
+	before := sync.snapshot(page, created)
+	if byName {
+		linkUserURL(page, friend.UserID)
+	}
+
+	if !created {
+		if err := sync.renameStub(vault, page, friend.UserID, friend.Nickname); err != nil {
+			return err
+		}
+	}
+
+	// Keep the FetLife nickname findable on pages titled otherwise
+	addAlias(page, friend.Nickname)
+
+	// Ensure "friend" tag is present, next to any other tags like "blocked"
+	page.AddTag("friend")
+
+	// Record when the friendship started
+	if friend.CreatedAt != "" {
+		page.FriendDate = friend.CreatedAt
+	}
+
+	// Save the page
+	if err := sync.savePage(before, page); err != nil {
+		return err
+	}
+	if sync.DryRun {
+		return nil
+	}
+
+	log.Debug().
+		Str("userID", friend.UserID).
+		Str("page", page.Title).
+		Msg("Successfully updated friend page")
+
+	return nil
+}
+
+// processFollow tags the page of a follower or following with tag.  Followers and followings are only created when
+// CreateFollowersIn is set, since there can be thousands of them.
+func (sync *SyncCmd) processFollow(vault *obsidian.Vault, follow fetlife.FollowRecord, tag string) error {
+	pages, byName, err := sync.findPage(vault, follow.UserID, follow.Nickname)
+	if err != nil {
+		return err
+	}
+
+	if len(pages) > 0 && sync.CreateOnly && !sync.isCreated(pages[0]) {
+		log.Debug().
+			Str("userID", follow.UserID).
+			Str("page", pages[0].Title).
+			Str("tag", tag).
+			Msg("Page already exists for follow, skipping")
+		sync.tally(&sync.summary.Skipped, follow.UserID)
+		return nil
+	}
+
+	pages, skip, err := sync.resolvePages(follow.UserID, pages)
+	if err != nil || skip {
+		return err
+	}
+
+	if len(pages) == 0 && (sync.UpdateOnly || sync.CreateFollowersIn == "") {
+		log.Debug().
+			Str("userID", follow.UserID).
+			Str("nickname", follow.Nickname).
+			Str("tag", tag).
+			Msg("No existing page for follow, skipping")
+		sync.tally(&sync.summary.FollowsSkipped, follow.UserID)
+		return nil
+	}
+
+	var page *obsidian.Page
+	created := len(pages) == 0
+	if created {
+		// Create new page from template in the CreateFollowersIn folder
+		log.Debug().
+			Str("userID", follow.UserID).
+			Str("nickname", follow.Nickname).
+			Str("folder", sync.CreateFollowersIn).
+			Str("tag", tag).
+			Msg("Creating new page for follow")
+
+		page, err = sync.createPageInFolder(vault, templateFields{UserID: follow.UserID, Nickname: follow.Nickname}, sync.CreateFollowersIn)
+		if err != nil {
+			return err
+		}
+	} else {
+		page = pages[0]
+		sync.tally(&sync.summary.FollowsMatched, "")
+	}
+
+	defer sync.locks.pages.lock(page)()
+	before := sync.snapshot(page, created)
+	if byName {
+		linkUserURL(page, follow.UserID)
+	}
+	if !created {
+		if err := sync.renameStub(vault, page, follow.UserID, follow.Nickname); err != nil {
+			return err
+		}
+	}
+	addAlias(page, follow.Nickname)
+	page.AddTag(tag)
+	return sync.savePage(before, page)
+}
+
+// conversationsHeading is the heading of the page section holding a user's conversation
+const conversationsHeading = "Conversations"
+
+// processConversation writes the message count and last message date, and with FullText the messages themselves,
+// to the Conversations section of the member's page.  Pages are never created for a conversation.
+func (sync *SyncCmd) processConversation(vault *obsidian.Vault, memberID string, messages []fetlife.MessageRecord) error {
+	pages, err := sync.findPageByUserID(vault, memberID)
+	if err != nil {
+		return err
+	}
+
+	if len(pages) == 0 {
+		log.Debug().
+			Str("memberID", memberID).
+			Msg("No existing page for conversation, skipping")
+		sync.tally(&sync.summary.Missing, memberID)
+		return nil
+	}
+
+	if sync.CreateOnly && !sync.isCreated(pages[0]) {
+		log.Debug().
+			Str("memberID", memberID).
+			Str("page", pages[0].Title).
+			Msg("Page already exists for conversation, skipping")
+		sync.tally(&sync.summary.Skipped, memberID)
+		return nil
+	}
+
+	pages, skip, err := sync.resolvePages(memberID, pages)
+	if err != nil || skip {
+		return err
+	}
+
+	page := pages[0]
+	defer sync.locks.pages.lock(page)()
+	before := sync.snapshot(page, false)
+	page.SetSection(conversationsHeading, conversationSection(messages, sync.FullText))
+	return sync.savePage(before, page)
+}
+
+// conversationSection renders the Conversations section of a page from the messages exchanged with a member, oldest
+// message first
+func conversationSection(messages []fetlife.MessageRecord, fullText bool) string {
+	messages = slices.Clone(messages)
+	slices.SortStableFunc(messages, func(a, b fetlife.MessageRecord) int {
+		return strings.Compare(a.CreatedAt, b.CreatedAt)
+	})
+
+	var section strings.Builder
+	fmt.Fprintf(&section, "- Messages: %d\n", len(messages))
+	fmt.Fprintf(&section, "- Last message: %s\n", messages[len(messages)-1].CreatedAt)
+	if fullText {
+		for _, message := range messages {
+			fmt.Fprintf(&section, "\n### %s, %s\n\n%s\n", message.CreatedAt, message.Sender, strings.TrimSpace(message.Body))
+		}
+	}
+	return section.String()
+}
+
+func (sync *SyncCmd) processPrivateNote(vault *obsidian.Vault, note fetlife.PrivateNoteRecord) error {
+	pages, err := sync.findPageByUserID(vault, note.MemberID)
+	if err != nil {
+		return err
+	}
+
+	if len(pages) > 0 && sync.CreateOnly && !sync.isCreated(pages[0]) {
+		log.Debug().
+			Str("memberID", note.MemberID).
+			Str("page", pages[0].Title).
+			Msg("Page already exists for member, skipping")
+		sync.tally(&sync.summary.Skipped, note.MemberID)
+		return nil
+	}
+
+	pages, skip, err := sync.resolvePages(note.MemberID, pages)
+	if err != nil || skip {
+		return err
+	}
+
+	if len(pages) == 0 && sync.UpdateOnly {
+		log.Debug().
+			Str("memberID", note.MemberID).
+			Msg("No existing page for member, skipping")
+		sync.tally(&sync.summary.Missing, note.MemberID)
+		return nil
+	}
+
+	var page *obsidian.Page
+	created := len(pages) == 0
+	if created {
+		// Create new page from template, passing the private note for folder determination
+		log.Debug().
+			Str("memberID", note.MemberID).
+			Msg("Creating new page for member with private note")
+
+		page, err = sync.createPageFromTemplateWithNote(vault, note.MemberID, "", note.PrivateNote)
+		if err != nil {
+			return err
+		}
+	} else {
+		page = pages[0]
+		log.Debug().
+			Str("memberID", note.MemberID).
+			Str("page", page.Title).
+			Msg("Updating existing page with private note")
+	}
+
+	defer sync.locks.pages.lock(page)()
+	before := sync.snapshot(page, created)
+
+	// Update web-message and/or the note section with private note
+	noteChanged := false
+	if sync.NoteTarget != "body" {
+		message := sync.mergeNote(page.WebMessage, note.PrivateNote)
+		// Pages created by this run only have the template's web-message, which never conflicts
+		if sync.OnConflict != "" && !created && !sync.isCreated(page) && noteConflicts(page.WebMessage, note.PrivateNote) {
+			message = sync.resolveNoteConflict(page, note)
+		}
+		if message != page.WebMessage {
+			page.WebMessage = message
+			noteChanged = true
+		}
+	}
+	if sync.NoteTarget == "body" || sync.NoteTarget == "both" {
+		content := page.Content
+		page.SetSection(noteHeading, noteSection(note))
+		noteChanged = noteChanged || page.Content != content
+	}
+
+	// Keep the note's timestamps, only moving note-updated along when the note text changed
+	if page.NoteCreated == "" && note.CreatedAt != "" {
+		page.NoteCreated = note.CreatedAt
+	}
+	if (noteChanged || page.NoteUpdated == "") && note.UpdatedAt != "" {
+		page.NoteUpdated = note.UpdatedAt
+	}
+
+	// Save the page
+	if err := sync.savePage(before, page); err != nil {
+		return err
+	}
+	if sync.DryRun {
+		return nil
+	}
+
+	log.Debug().
+		Str("memberID", note.MemberID).
+		Str("page", page.Title).
+		Msg("Successfully updated page with private note")
+
+	return nil
+}
+
+// conflictHeading starts the heading of the page section recording a conflict with --on-conflict record
+const conflictHeading = "Sync Conflict"
+
+// noteConflicts reports whether an existing web-message and a private note disagree: both are set and the
+// web-message doesn't already contain the note
+func noteConflicts(existing, note string) bool {
+	return existing != "" && note != "" && !strings.Contains(strings.ToLower(existing), strings.ToLower(note))
+}
+
+// resolveNoteConflict handles a page whose web-message conflicts with the private note according to --on-conflict
+// and returns the web-message the page should have.  With record, the web-message is kept and both values are
+// written to a "## Sync Conflict <date>" section, unless the page already records this conflict; the user is then
+// processed again by later syncs until the conflict is resolved.
+func (sync *SyncCmd) resolveNoteConflict(page *obsidian.Page, note fetlife.PrivateNoteRecord) string {
+	log.Warn().
+		Str("memberID", note.MemberID).
+		Str("page", pageFile(page)).
+		Str("onConflict", sync.OnConflict).
+		Msg("Private note differs from the page's web-message")
+	sync.locks.state.Lock()
+	sync.summary.Conflicts = append(sync.summary.Conflicts, pageFile(page))
+	sync.locks.state.Unlock()
+
+	switch sync.OnConflict {
+	case "replace":
+		return note.PrivateNote
+	case "record":
+		section := conflictSection(page.WebMessage, note.PrivateNote)
+		if !strings.Contains(page.Content, section) {
+			page.SetSection(conflictHeading+" "+sync.syncTime()[:len(dateLayout)], section)
+		}
+		sync.tally(nil, note.MemberID)
+		return page.WebMessage
+	default:
+		return page.WebMessage
+	}
+}
+
+// conflictSection renders the values of a conflict, each as a quote
+func conflictSection(existing, note string) string {
+	quote := func(text string) string {
+		return "> " + strings.ReplaceAll(strings.TrimSpace(text), "\n", "\n> ")
+	}
+	return "Previous web-message:\n\n" + quote(existing) + "\n\nIncoming private note:\n\n" + quote(note) + "\n"
+}
+
+// noteHeading is the heading of the page section holding the private note with --note-target body
+const noteHeading = "FetLife Private Note"
+
+// noteSection renders the private note section of a page: the note followed by its dates
+func noteSection(note fetlife.PrivateNoteRecord) string {
+	var section strings.Builder
+	section.WriteString(strings.TrimSpace(note.PrivateNote) + "\n")
+	if note.CreatedAt != "" || note.UpdatedAt != "" {
+		section.WriteString("\n")
+	}
+	if note.CreatedAt != "" {
+		fmt.Fprintf(&section, "- Created: %s\n", note.CreatedAt)
+	}
+	if note.UpdatedAt != "" {
+		fmt.Fprintf(&section, "- Updated: %s\n", note.UpdatedAt)
+	}
+	return section.String()
+}
+
+// addAlias adds an alias to a page, unless it's empty, the page's title or already one of its aliases.  Returns true
+// if the alias was added.
+func addAlias(page *obsidian.Page, alias string) bool {
+	if alias == "" || strings.EqualFold(alias, page.Title) ||
+		slices.ContainsFunc(page.Aliases, func(a string) bool { return strings.EqualFold(a, alias) }) {
+		return false
+	}
+	page.Aliases = append(page.Aliases, alias)
+	return true
+}
+
+// renamePage renames a page after a nickname change.  If a page with the new name already exists the rename is
+// skipped with a warning.  Returns whether the page was renamed.
+func (sync *SyncCmd) renamePage(vault *obsidian.Vault, page *obsidian.Page, newTitle string) (bool, error) {
+	oldTitle := page.Title
+	oldFile := pageFile(page)
+
+	// A dry run only renames the page in memory
+	rename := func(newTitle string) error {
+		return vault.Rename(page, newTitle)
+	}
+	if sync.DryRun {
+		rename = func(newTitle string) error {
+			newPath := filepath.Join(filepath.Dir(page.FilePath), newTitle+".md")
+			if _, err := os.Stat(newPath); err == nil {
+				return os.ErrExist
+			}
+			page.Title = newTitle
+			page.FilePath = newPath
+			vault.Reindex()
+			return nil
+		}
+	}
+
+	if err := rename(newTitle); err != nil {
+		if errors.Is(err, os.ErrExist) {
+			log.Warn().
+				Str("page", oldTitle).
+				Str("nickname", newTitle).
+				Msg("A page with the new nickname already exists, not renaming")
+			return false, nil
+		}
+		return false, err
+	}
+	if err := sync.record(journalEntry{Op: "rename", Path: pageFile(page), From: oldFile}); err != nil {
+		return false, err
+	}
+	sync.recordMove(page)
+
+	log.Info().
+		Str("oldTitle", oldTitle).
+		Str("newTitle", newTitle).
+		Str("folder", page.Folder).
+		Msg("Renamed page after nickname change")
+	return true, nil
+}
+
+// syncTime returns the time written to created-at and synced-at
+func (sync *SyncCmd) syncTime() string {
+	return sync.syncNow().Format(time.RFC3339)
+}
+
+// syncNow returns the current time in UTC, from sync.now when it's set
+func (sync *SyncCmd) syncNow() time.Time {
+	now := time.Now
+	if sync.now != nil {
+		now = sync.now
+	}
+	return now().UTC()
+}
+
+// stubTitle is the title of a page created for a user whose nickname wasn't known
+func stubTitle(userID string) string {
+	return "user-" + userID
+}
+
+// renameStub renames a user-<id> page to the user's nickname with --rename-stubs, keeping the old title as an alias.
+// When another page already has the nickname, the page gets the nickname followed by the user ID instead.
+func (sync *SyncCmd) renameStub(vault *obsidian.Vault, page *obsidian.Page, userID, nickname string) error {
+	if !sync.RenameStubs || nickname == "" || page.Title != stubTitle(userID) {
+		return nil
+	}
+
+	sync.locks.files.Lock()
+	defer sync.locks.files.Unlock()
+
+	title := nickname
+	if pageExists(vault, filepath.Join(filepath.Dir(page.FilePath), title+".md")) {
+		title = disambiguatedTitle(nickname, userID)
+		sync.tally(&sync.summary.Collisions, "")
+	}
+
+	renamed, err := sync.renamePage(vault, page, title)
+	if err != nil || !renamed {
+		return err
+	}
+	sync.tally(&sync.summary.StubsRenamed, "")
+	if !slices.Contains(page.Aliases, stubTitle(userID)) {
+		page.Aliases = append(page.Aliases, stubTitle(userID))
+	}
+	return nil
+}
+
+// movePage moves the page into another folder, recording the move in the journal.  Returns false if the folder
+// already has a page with the same title, in which case the page stays where it is.
+func (sync *SyncCmd) movePage(vault *obsidian.Vault, page *obsidian.Page, folder string) (bool, error) {
+	sync.locks.files.Lock()
+	defer sync.locks.files.Unlock()
+
+	oldFolder := page.Folder
+	oldFile := pageFile(page)
+
+	// A dry run only moves the page in memory
+	move := vault.Move
+	if sync.DryRun {
+		move = func(page *obsidian.Page, folder string) error {
+			newPath := filepath.Join(vault.Path, folder, page.Title+".md")
+			if _, err := os.Stat(newPath); err == nil {
+				return os.ErrExist
+			}
+			page.Folder = filepath.Clean(folder)
+			page.FilePath = newPath
+			return nil
+		}
+	}
+
+	if err := move(page, folder); err != nil {
+		if errors.Is(err, os.ErrExist) {
+			log.Warn().
+				Str("page", page.Title).
+				Str("folder", folder).
+				Msg("A page with the same name already exists in the folder, not moving")
+			return false, nil
+		}
+		return false, err
+	}
+	if err := sync.record(journalEntry{Op: "rename", Path: pageFile(page), From: oldFile}); err != nil {
+		return false, err
+	}
+	sync.recordMove(page)
+
+	log.Info().
+		Str("page", page.Title).
+		Str("oldFolder", oldFolder).
+		Str("newFolder", page.Folder).
+		Msg("Moved page")
+	return true, nil
+}
+
+// recategorize moves the person pages in the --create-people-in folders to the folder their web-message would be
+// created in now, so pages follow changes to the keywords.  Pages of blocked users stay where they are unless
+// --recategorize-blocked is given, and pages in other folders are never moved.
+func (sync *SyncCmd) recategorize(vault *obsidian.Vault) error {
+	folders := make(map[string]bool)
+	for _, folder := range sync.peopleFolders() {
+		folders[filepath.Clean(folder.Folder)] = true
+	}
+
+	for _, page := range slices.Clone(vault.Pages) {
+		if !page.HasTag("person") || !folders[page.Folder] || sync.skipsPage(page) {
+			continue
+		}
+		if page.HasTag("blocked") && !sync.RecategorizeBlocked {
+			continue
+		}
+
+		userID, _ := profileUserID(page.Url)
+		folder := sync.determineFolderForUser(userID, page.Title, page.WebMessage)
+		if filepath.Clean(folder) == page.Folder {
+			continue
+		}
+		moved, err := sync.movePage(vault, page, folder)
+		if err != nil {
+			return err
+		}
+		if moved {
+			sync.summary.Recategorized++
+		}
+	}
+	return nil
+}
+
+// blockedMessagePrefix starts the web-message that older versions wrote for blocked users
+const blockedMessagePrefix = "Blocked on "
+
+// splitBlockedMessage splits an old style "Blocked on <date>" line off the front of a web-message.  It returns the
+// rest of the message, the date, and whether the message started with the old style line.
+func splitBlockedMessage(message string) (rest string, blockedDate string, ok bool) {
+	if !strings.HasPrefix(message, blockedMessagePrefix) {
+		return message, "", false
+	}
+
+	line, rest, _ := strings.Cut(strings.TrimPrefix(message, blockedMessagePrefix), "\n")
+	return strings.TrimLeft(rest, "\n"), strings.TrimSpace(line), true
+}
+
+// noteSeparator separates the existing web-message from an appended private note
+const noteSeparator = "\n\n"
+
+// mergeNote combines an existing web-message with an imported private note according to NoteMode
+func (sync *SyncCmd) mergeNote(existing, note string) string {
+	switch sync.NoteMode {
+	case "overwrite", "replace":
+		return note
+	case "skip-if-set":
+		if existing != "" {
+			return existing
+		}
+		return note
+	default:
+		// Append, unless the note is already there from a previous run or was copied in by hand
+		if existing == "" {
+			return note
+		}
+		if note == "" || strings.Contains(strings.ToLower(existing), strings.ToLower(note)) {
+			return existing
+		}
+		return existing + noteSeparator + note
+	}
+}
+
+// snapshot returns a copy of an existing page to compare against once the record has been applied, or nil for a page
+// that was just created
+func (sync *SyncCmd) snapshot(page *obsidian.Page, created bool) *obsidian.Page {
+	if created {
+		return nil
+	}
+	return page.Clone()
+}
+
+// savePage writes the page to disk and records the outcome in the summary.  before is the page as it was before
+// the record was applied, or nil if the page was just created.  In dry-run mode nothing is written and the changes
+// that would have been made are collected instead.
+func (sync *SyncCmd) savePage(before, page *obsidian.Page) error {
+	if before != nil {
+		sync.applyFolderTags(page, page.Folder)
+	}
+
+	var ops []JSONPatchOp
+	moved := false
+	if before != nil {
+		ops = diffPage(before, page)
+		moved = pageFile(before) != pageFile(page)
+	}
+	if moved {
+		sync.recordMove(page)
+	}
+
+	sync.locks.state.Lock()
+	switch {
+	case before == nil:
+		sync.summary.Created++
+		sync.createdPages[page] = true
+		sync.createdOrder = append(sync.createdOrder, page)
+		page.SyncedAt = sync.syncTime()
+	case moved || len(ops) > 0:
+		sync.summary.Updated++
+		page.SyncedAt = sync.syncTime()
+		ops = diffPage(before, page)
+	default:
+		sync.summary.Unchanged++
+	}
+
+	if sync.DryRun {
+		// Pages created by this run are shown in full at the end instead
+		if before != nil && !sync.createdPages[page] {
+			sync.planChanges(before, page, ops)
+		}
+		sync.locks.state.Unlock()
+		return nil
+	}
+	sync.locks.state.Unlock()
+
+	return sync.writePage(page)
+}
+
+// writePage saves the page and records the change in the journal.  Files that already have the page's content are
+// left alone, so their modification time doesn't change.
+func (sync *SyncCmd) writePage(page *obsidian.Page) error {
+	before, err := os.ReadFile(page.FilePath)
+	if err != nil {
+		return err
+	}
+	// A page whose body wasn't changed only gets its frontmatter written, keeping the body byte for byte
+	save := page.SaveFrontmatterOnly
+	after, err := page.SpliceFrontmatter(before)
+	if page.ContentChanged() {
+		save = page.Save
+		after, err = page.Render()
+	}
+	if err != nil {
+		return err
+	}
+	if string(before) == string(after) {
+		return nil
+	}
+
+	if err := save(); err != nil {
+		return err
+	}
+	return sync.record(journalEntry{Op: "modify", Path: pageFile(page), Before: string(before), After: string(after)})
+}
+
+// planChanges records the changes a dry run would make to an existing page, printing them as a text diff unless a
+// json-patch was asked for
+func (sync *SyncCmd) planChanges(before, page *obsidian.Page, ops []JSONPatchOp) {
+	text := sync.DryRunFormat != "json-patch"
+	oldFile, newFile := pageFile(before), pageFile(page)
+
+	if oldFile != newFile {
+		sync.patch = append(sync.patch, JSONPatchOp{Op: "move", From: filePointer(oldFile), Path: filePointer(newFile)})
+		if text {
+			fmt.Printf("~ rename %s to %s\n", oldFile, newFile)
+		}
+	}
+
+	for _, op := range ops {
+		if text {
+			fmt.Printf("%s on %s\n", describeChange(op), newFile)
+		}
+		op.Path = filePointer(newFile) + op.Path
+		sync.patch = append(sync.patch, op)
 	}
-	log.Info().Int("blockedCount", len(blockeds)).Msg("Loaded blockeds")
+}
 
-	// Read private_notes.txt
-	privateNotes, err := fetlife.ReadPrivateNotes(sync.DataDir)
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to read private_notes.txt")
-		return err
+// printDryRun prints the pages a dry run would have created along with a summary, or the complete json-patch
+func (sync *SyncCmd) printDryRun() error {
+	if sync.DryRunFormat != "json-patch" {
+		for _, page := range sync.createdOrder {
+			fmt.Printf("+ create %s\n", pageFile(page))
+		}
+		fmt.Printf("Dry run: %d pages would be created, %d updated, %d skipped\n",
+			sync.summary.Created, sync.summary.Updated, sync.summary.Unchanged+sync.summary.Skipped+sync.summary.Missing)
+		return nil
 	}
-	log.Info().Int("privateNoteCount", len(privateNotes)).Msg("Loaded private notes")
 
-	// Process blockeds
-	for _, blocked := range blockeds {
-		if err := sync.processBlocked(vault, blocked); err != nil {
-			log.Error().Err(err).Str("userID", blocked.UserID).Msg("Failed to process blocked user")
-			// Continue processing other records
+	patch := append([]JSONPatchOp{}, sync.patch...)
+	for _, page := range sync.createdOrder {
+		content, err := page.Render()
+		if err != nil {
+			return err
 		}
+		patch = append(patch, JSONPatchOp{Op: "add", Path: filePointer(pageFile(page)), Value: string(content)})
 	}
 
-	// Process private notes
-	for _, note := range privateNotes {
-		if err := sync.processPrivateNote(vault, note); err != nil {
-			log.Error().Err(err).Str("memberID", note.MemberID).Msg("Failed to process private note")
-			// Continue processing other records
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(patch)
+}
+
+// folderKeyword is a keyword from a folder configuration.  Keywords with the regexPrefix or one of the regexMarkers are
+// compiled, everything else is matched as a plain substring.
+type folderKeyword struct {
+	// Text is the keyword as configured, lowercased for plain keywords
+	Text string
+	// Pattern is the compiled regular expression, or nil for plain keywords
+	Pattern *regexp.Regexp
+}
+
+// Matches reports whether the keyword is found in the lowercased text
+func (keyword folderKeyword) Matches(lowerText string) bool {
+	if keyword.Pattern != nil {
+		return keyword.Pattern.MatchString(lowerText)
+	}
+	return strings.Contains(lowerText, keyword.Text)
+}
+
+// regexPrefix marks a keyword as a regular expression even if it contains none of the regexMarkers
+const regexPrefix = "re:"
+
+// regexMarkers are the character sequences that make a keyword be treated as a regular expression.  Only sequences
+// that don't turn up in plain words are markers, so a keyword like "(ex)" or "$$$" stays a substring; other regular
+// expressions need the regexPrefix.
+var regexMarkers = []string{".*", `\b`}
+
+// isRegexKeyword reports whether a keyword should be compiled as a regular expression
+func isRegexKeyword(keyword string) bool {
+	if strings.HasPrefix(keyword, regexPrefix) {
+		return true
+	}
+	for _, marker := range regexMarkers {
+		if strings.Contains(keyword, marker) {
+			return true
 		}
 	}
+	return false
+}
 
-	log.Info().Msg("Sync completed successfully")
-	return nil
+// exclusionSeparator separates a folder's keywords from the terms that veto a match
+const exclusionSeparator = "!"
+
+// prioritySeparator separates a folder name from its priority
+const prioritySeparator = "@"
+
+// folderConfig is a parsed --create-people-in entry
+type folderConfig struct {
+	Folder string
+	// Priority decides between several matching folders, each matching when any one of its keywords does and none of
+	// its exclusions does.  The highest priority wins, and between equal priorities the folder listed first.
+	Priority int
+	Keywords []folderKeyword
+	// Exclusions veto a keyword match
+	Exclusions []folderKeyword
 }
 
-// findPageByUserID finds a page by matching the user ID in the URL or URL aliases
-func (sync *SyncCmd) findPageByUserID(vault *obsidian.Vault, userID string) ([]*obsidian.Page, error) {
-	var matches []*obsidian.Page
+// parseFolderConfig parses a folder configuration string like
+// "People@priority:keyword1,keyword2!exclusion1,exclusion2".  The priority is optional and defaults to 0.  Plain
+// keywords are lowercased, regex keywords (prefixed with "re:" or containing one of the regexMarkers) are compiled
+// case-insensitively.  An error is returned if a regex keyword doesn't compile.
+func parseFolderConfig(config string) (folderConfig, error) {
+	parts := strings.SplitN(config, ":", 2)
+	result := folderConfig{Folder: parts[0]}
 
-	for _, page := range vault.Pages {
-		// Check main URL
-		if strings.Contains(page.Url, "/users/"+userID) || strings.HasSuffix(page.Url, "/"+userID) {
-			matches = append(matches, page)
-			continue
+	// A folder name can contain "@", only a number after the last one is a priority
+	if i := strings.LastIndex(result.Folder, prioritySeparator); i >= 0 {
+		if priority, err := strconv.Atoi(result.Folder[i+len(prioritySeparator):]); err == nil {
+			result.Folder = result.Folder[:i]
+			result.Priority = priority
 		}
+	}
 
-		// Check URL aliases
-		for _, urlAlias := range page.UrlAliases {
-			if strings.Contains(urlAlias, "/users/"+userID) || strings.HasSuffix(urlAlias, "/"+userID) {
-				matches = append(matches, page)
-				break
-			}
+	if len(parts) == 2 && parts[1] != "" {
+		keywordList, exclusionList, _ := strings.Cut(parts[1], exclusionSeparator)
+		var err error
+		if result.Keywords, err = parseKeywords(keywordList, config); err != nil {
+			return result, err
+		}
+		if result.Exclusions, err = parseKeywords(exclusionList, config); err != nil {
+			return result, err
 		}
 	}
 
-	return matches, nil
+	return result, nil
 }
 
-func (sync *SyncCmd) processBlocked(vault *obsidian.Vault, blocked fetlife.BlockedRecord) error {
-	pages, err := sync.findPageByUserID(vault, blocked.UserID)
-	if err != nil {
-		return err
+// parseKeywords parses a comma separated list of keywords from a folder configuration
+func parseKeywords(list, config string) ([]folderKeyword, error) {
+	var keywords []folderKeyword
+	for _, kw := range strings.Split(list, ",") {
+		trimmed := strings.TrimSpace(kw)
+		if trimmed == "" {
+			continue
+		}
+		keyword, err := parseKeyword(trimmed)
+		if err != nil {
+			return nil, fmt.Errorf("invalid keyword pattern %q in folder config %q: %w", keyword.Text, config, err)
+		}
+		keywords = append(keywords, keyword)
 	}
+	return keywords, nil
+}
 
-	if len(pages) > 1 {
-		log.Warn().
-			Str("userID", blocked.UserID).
-			Int("matchCount", len(pages)).
-			Msg("Multiple pages found for user ID, skipping")
-		return nil
+// parseKeyword parses a single keyword.  The error is the one of compiling a regex keyword, whose Text is still set.
+func parseKeyword(keyword string) (folderKeyword, error) {
+	if !isRegexKeyword(keyword) {
+		return folderKeyword{Text: strings.ToLower(keyword)}, nil
 	}
+	keyword = strings.TrimPrefix(keyword, regexPrefix)
+	pattern, err := regexp.Compile("(?i)" + keyword)
+	return folderKeyword{Text: keyword, Pattern: pattern}, err
+}
 
-	var page *obsidian.Page
-	if len(pages) == 0 {
-		// Create new page from template in the CreateBlockedIn folder
-		log.Info().
-			Str("userID", blocked.UserID).
-			Str("nickname", blocked.Nickname).
-			Str("folder", sync.CreateBlockedIn).
-			Msg("Creating new page for blocked user")
-
-		page, err = sync.createPageInFolder(vault, blocked.UserID, blocked.Nickname, sync.CreateBlockedIn)
+// parseFolderConfigs parses folder configurations, leaving out the invalid ones with a warning
+func parseFolderConfigs(configs []string) []folderConfig {
+	var folders []folderConfig
+	for _, config := range configs {
+		folder, err := parseFolderConfig(config)
 		if err != nil {
-			return err
+			log.Warn().Err(err).Str("config", config).Msg("Ignoring invalid folder configuration")
+			continue
 		}
-	} else {
-		page = pages[0]
-		log.Info().
-			Str("userID", blocked.UserID).
-			Str("page", page.Title).
-			Msg("Updating existing page for blocked user")
+		folders = append(folders, folder)
 	}
+	return folders
+}
 
-	// Ensure "blocked" tag is present
-	hasBlockedTag := false
-	for _, tag := range page.Tags {
-		if tag == "blocked" {
-			hasBlockedTag = true
-			break
+// Validate checks that every folder configuration can be parsed
+func (sync *SyncCmd) Validate() error {
+	for _, dataDir := range sync.DataDir {
+		if err := validateDataDir(dataDir); err != nil {
+			return err
 		}
 	}
-	if !hasBlockedTag {
-		page.Tags = append(page.Tags, "blocked")
+	for _, config := range slices.Concat(sync.CreatePeopleIn, sync.CreateBlockedIn) {
+		if _, err := parseFolderConfig(config); err != nil {
+			return err
+		}
 	}
-
-	// Add block-date metadata (we'll need to add this field to the Page struct)
-	// For now, we'll set it as a web message if not already set
-	if page.WebMessage == "" {
-		page.WebMessage = fmt.Sprintf("Blocked on %s", blocked.CreatedAt)
+	if sync.RulesFile != "" {
+		if _, err := loadRules(sync.RulesFile); err != nil {
+			return err
+		}
 	}
-
-	// Save the page
-	if err := page.Save(); err != nil {
+	if _, err := sync.loadSkipUsers(); err != nil {
 		return err
 	}
-
-	log.Info().
-		Str("userID", blocked.UserID).
-		Str("page", page.Title).
-		Msg("Successfully updated blocked user page")
-
-	return nil
-}
-
-func (sync *SyncCmd) processPrivateNote(vault *obsidian.Vault, note fetlife.PrivateNoteRecord) error {
-	pages, err := sync.findPageByUserID(vault, note.MemberID)
-	if err != nil {
+	if sync.PruneBlocked && sync.CreateOnly {
+		return errors.New("--prune-blocked changes existing pages and can't be used with --create-only")
+	}
+	if sync.Recategorize && sync.CreateOnly {
+		return errors.New("--recategorize moves existing pages and can't be used with --create-only")
+	}
+	if sync.RecategorizeBlocked && !sync.Recategorize {
+		return errors.New("--recategorize-blocked needs --recategorize")
+	}
+	if sync.OnConflict != "" && sync.NoteTarget == "body" {
+		return errors.New("--on-conflict is about the web-message and can't be used with --note-target body")
+	}
+	if sync.BackupIncludeConfig && !sync.Backup {
+		return errors.New("--backup-include-config needs --backup")
+	}
+	if !sync.syncs("blocked") && sync.PruneBlocked {
+		return errors.New("--prune-blocked needs blockeds.txt and can't be used when blocked users aren't synced")
+	}
+	if sync.partial() && sync.RemoveOrphans {
+		return errors.New("--remove-orphans needs every record and can't be used with --only, --skip, --user-id, --limit or --since")
+	}
+	if sync.partial() && sync.ReportOrphans {
+		return errors.New("--report-orphans needs every record and can't be used with --only, --skip, --user-id, --limit or --since")
+	}
+	if sync.filtered() && sync.PruneBlocked {
+		return errors.New("--prune-blocked needs every blocked user and can't be used with --user-id, --limit or --since")
+	}
+	if sync.Since != "" {
+		if _, err := time.Parse(dateLayout, sync.Since); err != nil {
+			return fmt.Errorf("invalid --since date %q, expected YYYY-MM-DD: %w", sync.Since, err)
+		}
+	}
+	if sync.SyncLog != "" && !insideVault(sync.SyncLog) {
+		return fmt.Errorf("--sync-log %q must be a page inside the vault", sync.SyncLog)
+	}
+	if sync.WriteIndex != "" && !insideVault(sync.WriteIndex) {
+		return fmt.Errorf("--write-index %q must be a page inside the vault", sync.WriteIndex)
+	}
+	if sync.Limit < 0 {
+		return errors.New("--limit can't be negative")
+	}
+	if sync.MaxCreates < 0 {
+		return errors.New("--max-creates can't be negative")
+	}
+	if sync.Watch && slices.ContainsFunc(sync.DataDir, fetlife.IsArchive) {
+		return errors.New("--watch needs data directories and can't watch a zip archive")
+	}
+	if sync.Concurrency < 0 {
+		return errors.New("--concurrency can't be negative")
+	}
+	if _, err := parseFolderColors("--folder-color", sync.FolderColor); err != nil {
 		return err
 	}
-
-	if len(pages) > 1 {
-		log.Warn().
-			Str("memberID", note.MemberID).
-			Int("matchCount", len(pages)).
-			Msg("Multiple pages found for member ID, skipping")
-		return nil
+	if _, err := parseFolderColors("--assign-color", sync.AssignColor); err != nil {
+		return err
 	}
-
-	var page *obsidian.Page
-	if len(pages) == 0 {
-		// Create new page from template, passing the private note for folder determination
-		log.Info().
-			Str("memberID", note.MemberID).
-			Msg("Creating new page for member with private note")
-
-		page, err = sync.createPageFromTemplateWithNote(vault, note.MemberID, "", note.PrivateNote)
-		if err != nil {
-			return err
+	if sync.BlockedColor != "" && !colorPattern.MatchString(sync.BlockedColor) {
+		return fmt.Errorf("invalid --blocked-color %q, expected #RRGGBB", sync.BlockedColor)
+	}
+	for folder := range sync.FolderTags {
+		tags := sync.folderTags(folder)
+		if len(tags) == 0 {
+			return fmt.Errorf("no tags for folder %q in --folder-tags, expected folder=tag1,tag2", folder)
+		}
+		for _, tag := range tags {
+			if strings.ContainsAny(tag, " \t#") {
+				return fmt.Errorf("invalid tag %q for folder %q, tags can't contain spaces or #", tag, folder)
+			}
 		}
-	} else {
-		page = pages[0]
-		log.Info().
-			Str("memberID", note.MemberID).
-			Str("page", page.Title).
-			Msg("Updating existing page with private note")
 	}
+	return nil
+}
 
-	// Update web-message with private note
-	page.WebMessage = note.PrivateNote
+// defaultBlockedColor is the web-badge-color of blocked users' pages without --blocked-color
+const defaultBlockedColor = "#F44336"
 
-	// Save the page
-	if err := page.Save(); err != nil {
-		return err
+// blockedColor returns the --blocked-color, defaultBlockedColor when it isn't set
+func (sync *SyncCmd) blockedColor() obsidian.Color {
+	if sync.BlockedColor == "" {
+		return defaultBlockedColor
 	}
+	return obsidian.Color(sync.BlockedColor)
+}
 
-	log.Info().
-		Str("memberID", note.MemberID).
-		Str("page", page.Title).
-		Msg("Successfully updated page with private note")
+// colorPattern matches the HTML colors accepted by --folder-color, --assign-color and --blocked-color
+var colorPattern = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
 
-	return nil
+// parseFolderColors parses the folder=#RRGGBB colors of --folder-color or --assign-color, named by flag, into a map
+// from the cleaned folder to its color
+func parseFolderColors(flag string, configs map[string]string) (map[string]obsidian.Color, error) {
+	colors := make(map[string]obsidian.Color, len(configs))
+	for folder, color := range configs {
+		folder, color = strings.TrimSpace(folder), strings.TrimSpace(color)
+		if folder == "" {
+			return nil, fmt.Errorf("invalid %s %q, the folder is missing", flag, "="+color)
+		}
+		if !colorPattern.MatchString(color) {
+			return nil, fmt.Errorf("invalid color %q for folder %q in %s, expected #RRGGBB", color, folder, flag)
+		}
+		colors[filepath.Clean(folder)] = obsidian.Color(color)
+	}
+	return colors, nil
 }
 
-// parseFolderConfig parses a folder configuration string like "People:keyword1,keyword2"
-// Returns the folder name and list of keywords (all lowercase)
-func parseFolderConfig(config string) (folder string, keywords []string) {
-	parts := strings.SplitN(config, ":", 2)
-	folder = parts[0]
-
-	if len(parts) == 2 && parts[1] != "" {
-		keywordParts := strings.Split(parts[1], ",")
-		for _, kw := range keywordParts {
-			trimmed := strings.TrimSpace(kw)
-			if trimmed != "" {
-				keywords = append(keywords, strings.ToLower(trimmed))
+// folderTags returns the --folder-tags of a folder
+func (sync *SyncCmd) folderTags(folder string) []string {
+	var tags []string
+	for configured, list := range sync.FolderTags {
+		if filepath.Clean(configured) != filepath.Clean(folder) {
+			continue
+		}
+		for _, tag := range strings.Split(list, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
 			}
 		}
 	}
+	return tags
+}
+
+// applyFolderTags adds the --folder-tags of folder to a page, leaving out the tags it already has
+func (sync *SyncCmd) applyFolderTags(page *obsidian.Page, folder string) {
+	for _, tag := range sync.folderTags(folder) {
+		page.AddTag(tag)
+	}
+}
 
-	return folder, keywords
+// applyFolderColor sets the web-badge-color configured for folder on a page that doesn't have a color yet, so
+// colors set by hand are kept
+func (sync *SyncCmd) applyFolderColor(page *obsidian.Page, folder string) {
+	if page.WebBadgeColor != "" {
+		return
+	}
+	if color, ok := sync.folderColors[filepath.Clean(folder)]; ok {
+		page.WebBadgeColor = color
+	}
 }
 
 // determineFolderForUser determines which folder to place a user's page in
-// based on the CreatePeopleIn configuration and the private note content
-func (sync *SyncCmd) determineFolderForUser(userID, privateNote string) string {
-	if len(sync.CreatePeopleIn) == 0 {
+// based on the CreatePeopleIn configuration and the private note content.  With MatchNickname the keywords are
+// matched against the nickname as well.  When several folders match, the one with the highest priority wins, and
+// between equal priorities the one listed first.
+func (sync *SyncCmd) determineFolderForUser(userID, nickname, privateNote string) string {
+	configs := sync.peopleFolders()
+	if len(configs) == 0 {
 		return "People"
 	}
+	if !sync.MatchNickname {
+		nickname = ""
+	}
+	return determineFolder(configs, userID, nickname, privateNote)
+}
+
+// peopleFolders returns the folders people are created in: the rules of --rules-file, or else --create-people-in
+func (sync *SyncCmd) peopleFolders() []folderConfig {
+	if len(sync.rules) > 0 {
+		return sync.rules
+	}
+	return parseFolderConfigs(sync.CreatePeopleIn)
+}
 
-	// If we have a private note, try to match keywords
+// determineBlockedFolder determines which --create-blocked-in folder to place a blocked user's page in.  Keywords are
+// always matched against the nickname as well as the private note.
+func (sync *SyncCmd) determineBlockedFolder(userID, nickname, privateNote string) string {
+	configs := parseFolderConfigs(sync.CreateBlockedIn)
+	if len(configs) == 0 {
+		return "Bad People"
+	}
+	return determineFolder(configs, userID, nickname, privateNote)
+}
+
+// determineFolder picks the folder of configs whose keywords match the private note or nickname, the one with the
+// highest priority when several match, and the first folder when none does.  configs must not be empty.
+func determineFolder(configs []folderConfig, userID, nickname, privateNote string) string {
+	// The texts keywords are matched against, each on its own so anchored patterns keep working
+	var texts []string
 	if privateNote != "" {
-		lowerNote := strings.ToLower(privateNote)
+		texts = append(texts, strings.ToLower(privateNote))
+	}
+	if nickname != "" {
+		texts = append(texts, strings.ToLower(nickname))
+	}
+	matches := func(keyword folderKeyword) bool {
+		return slices.ContainsFunc(texts, keyword.Matches)
+	}
 
-		for _, config := range sync.CreatePeopleIn {
-			folder, keywords := parseFolderConfig(config)
+	// If we have a private note or nickname, try to match keywords in every folder
+	var best *folderConfig
+	var bestKeyword folderKeyword
+	if len(texts) > 0 {
+		for _, folder := range configs {
+			// An exclusion vetoes the folder, whatever keywords match
+			if i := slices.IndexFunc(folder.Exclusions, matches); i >= 0 {
+				log.Debug().
+					Str("userID", userID).
+					Str("folder", folder.Folder).
+					Str("exclusion", folder.Exclusions[i].Text).
+					Msg("Matched exclusion, not placing in folder")
+				continue
+			}
 
 			// If this folder has keywords, check for matches
-			if len(keywords) > 0 {
-				for _, keyword := range keywords {
-					if strings.Contains(lowerNote, keyword) {
-						log.Info().
-							Str("userID", userID).
-							Str("folder", folder).
-							Str("keyword", keyword).
-							Msg("Matched keyword, placing in folder")
-						return folder
-					}
-				}
+			i := slices.IndexFunc(folder.Keywords, matches)
+			if i < 0 {
+				continue
+			}
+			log.Debug().
+				Str("userID", userID).
+				Str("folder", folder.Folder).
+				Int("priority", folder.Priority).
+				Str("keyword", folder.Keywords[i].Text).
+				Msg("Matched keyword")
+			if best == nil || folder.Priority > best.Priority {
+				best = &folder
+				bestKeyword = folder.Keywords[i]
 			}
 		}
 	}
 
+	if best != nil {
+		log.Debug().
+			Str("userID", userID).
+			Str("folder", best.Folder).
+			Int("priority", best.Priority).
+			Str("keyword", bestKeyword.Text).
+			Msg("Matched keyword, placing in folder")
+		return best.Folder
+	}
+
 	// Default to the first folder
-	folder, _ := parseFolderConfig(sync.CreatePeopleIn[0])
-	return folder
+	return configs[0].Folder
+}
+
+// templatesFolder is the vault folder holding the templates new pages are created from
+const templatesFolder = "Templates"
+
+// templateFields are the values of the placeholders in the template of a new page
+type templateFields struct {
+	UserID    string
+	Nickname  string
+	Note      string
+	BlockedAt string
+	// Date is the day of the sync, as YYYY-MM-DD
+	Date string
+	// Folder is the vault folder the page is created in
+	Folder string
+	// Blocked is set for pages of blocked users, which get defaultBlockedTemplate when the vault has no template
+	Blocked bool
+}
+
+// renderTemplate replaces the {{title}}, {{user_id}} (or {{userID}}), {{url}}, {{nickname}}, {{note}}, {{date}},
+// {{folder}} and {{blocked_at}} placeholders of a template.  Other placeholders, like those of Obsidian's own
+// templates, are left alone.
+func renderTemplate(template, title string, fields templateFields) string {
+	url := ""
+	if fields.UserID != "" {
+		url = obsidian.UserURL(fields.UserID)
+	}
+	return applyTemplateVars(template, map[string]string{
+		"title":      title,
+		"user_id":    fields.UserID,
+		"userID":     fields.UserID,
+		"url":        url,
+		"nickname":   fields.Nickname,
+		"note":       fields.Note,
+		"date":       fields.Date,
+		"folder":     fields.Folder,
+		"blocked_at": fields.BlockedAt,
+	})
+}
+
+// applyTemplateVars replaces every {{key}} in template with the value of key in vars
+func applyTemplateVars(template string, vars map[string]string) string {
+	var pairs []string
+	for _, key := range slices.Sorted(maps.Keys(vars)) {
+		pairs = append(pairs, "{{"+key+"}}", vars[key])
+	}
+	return strings.NewReplacer(pairs...).Replace(template)
 }
 
 // createPageInFolder creates a page in a specific folder
-func (sync *SyncCmd) createPageInFolder(vault *obsidian.Vault, userID, nickname, folder string) (*obsidian.Page, error) {
+func (sync *SyncCmd) createPageInFolder(vault *obsidian.Vault, fields templateFields, folder string) (*obsidian.Page, error) {
+	sync.locks.files.Lock()
+	defer sync.locks.files.Unlock()
+
+	userID := fields.UserID
+
 	// Determine page name
-	pageName := nickname
+	pageName := fields.Nickname
 	if pageName == "" {
-		pageName = fmt.Sprintf("user-%s", userID)
+		pageName = stubTitle(userID)
 	}
 
 	folderPath := filepath.Join(vault.Path, folder)
 
-	// Create folder if it doesn't exist
-	if err := os.MkdirAll(folderPath, 0755); err != nil {
-		return nil, err
-	}
-
 	// Create file path
 	filePath := filepath.Join(folderPath, pageName+".md")
 
-	// Read template
-	templatePath := filepath.Join(vault.Path, "Templates", "People.md")
-	templateContent, err := os.ReadFile(templatePath)
+	// Never overwrite another person's page that happens to have the same name
+	if pageExists(vault, filePath) {
+		disambiguated := disambiguatedTitle(pageName, userID)
+		log.Warn().
+			Str("userID", userID).
+			Str("page", pageName).
+			Str("folder", folder).
+			Str("newName", disambiguated).
+			Msg("A page with this name already exists, using a different name")
+		sync.tally(&sync.summary.Collisions, "")
+
+		pageName = disambiguated
+		filePath = filepath.Join(folderPath, pageName+".md")
+		if pageExists(vault, filePath) {
+			return nil, fmt.Errorf("cannot create %s: %w", filePath, os.ErrExist)
+		}
+	}
+
+	templateContent, err := sync.readTemplate(vault, folder, fields.Blocked)
 	if err != nil {
-		log.Warn().Err(err).Msg("Template not found, using default")
-		// Use a default template
-		templateContent = []byte(`---
-tags:
-  - person
-url: https://fetlife.com/users/` + userID + `
----
+		return nil, err
+	}
 
-# Notes
-`)
+	fields.Folder = filepath.ToSlash(filepath.Clean(folder))
+	fields.Date = sync.syncNow().Format(dateLayout)
+	content := renderTemplate(string(templateContent), pageName, fields)
+	page, err := obsidian.ParsePage([]byte(content), filePath, vault.Path)
+	if err != nil {
+		return nil, fmt.Errorf("template for %s: %w", filePath, err)
 	}
 
-	// Replace {{title}} placeholder in template
-	content := strings.ReplaceAll(string(templateContent), "{{title}}", pageName)
+	// A template without the user's profile URL gets it added, one with a URL of its own keeps it
+	if page.Url == "" || page.Url == obsidian.UserURL("") {
+		page.Url = obsidian.UserURL(userID)
+	}
+	// The color of a new page is its folder's --assign-color, else the template's, else its folder's --folder-color
+	// or rule color, set below, else for blocked users --blocked-color
+	if color, ok := sync.assignedColors[filepath.Clean(folder)]; ok {
+		page.WebBadgeColor = color
+	}
+	page.CreatedAt = sync.syncTime()
+	rendered, err := page.Render()
+	if err != nil {
+		return nil, err
+	}
+	content = string(rendered)
 
-	// Update URL in template to include the user ID
-	content = strings.ReplaceAll(content, "url: https://fetlife.com/users/", "url: https://fetlife.com/users/"+userID)
+	// In a dry run the page only exists in memory, so later records for the same user still find it
+	if sync.DryRun {
+		sync.applyFolderColor(page, folder)
+		sync.applyFolderTags(page, folder)
+		vault.Add(page)
+		return page, nil
+	}
 
-	// Write the file
-	if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+	// Create folder if it doesn't exist
+	if err := os.MkdirAll(folderPath, 0755); err != nil {
 		return nil, err
 	}
 
-	// Load the newly created page
-	page, err := obsidian.LoadPage(filePath, vault.Path)
+	// Write the file atomically like Page.Save, so a killed sync doesn't leave half of a page
+	if err := obsidian.WriteFile(filePath, []byte(content)); err != nil {
+		return nil, err
+	}
+	relPath, err := filepath.Rel(vault.Path, filePath)
 	if err != nil {
 		return nil, err
 	}
+	if err := sync.record(journalEntry{Op: "create", Path: filepath.ToSlash(relPath), After: content}); err != nil {
+		return nil, err
+	}
+
+	// The color and tags are written when the page is saved
+	sync.applyFolderColor(page, folder)
+	sync.applyFolderTags(page, folder)
 
 	// Add to vault
-	vault.Pages = append(vault.Pages, page)
+	vault.Add(page)
 
-	log.Info().
+	log.Debug().
 		Str("page", pageName).
 		Str("path", filePath).
 		Str("folder", folder).
@@ -316,11 +2568,109 @@ url: https://fetlife.com/users/` + userID + `
 	return page, nil
 }
 
+// defaultTemplate is used for new pages when the vault has no template
+const defaultTemplate = `---
+tags:
+  - person
+url: https://fetlife.com/users/
+---
+
+# Notes
+`
+
+// defaultBlockedTemplate is used for new pages of blocked users when the vault has no template, so the browser
+// extension shows a warning even in a new vault.  The page gets the --blocked-color when the blocked record is applied.
+const defaultBlockedTemplate = `---
+tags:
+  - person
+  - blocked
+url: https://fetlife.com/users/
+web-message: "WARNING: Blocked user"
+---
+
+# Notes
+
+Blocked on {{blocked_at}}
+`
+
+// folderTemplate is the template found for a folder, found is false when the folder uses the default template
+type folderTemplate struct {
+	content []byte
+	found   bool
+}
+
+// readTemplate returns the template for a new page in folder: the --template file, or else Templates/<folder>.md,
+// Templates/People.md or the default template, whichever is found first.  Each folder's template is looked up once
+// per run, so a missing one is only warned about once.
+func (sync *SyncCmd) readTemplate(vault *obsidian.Vault, folder string, blocked bool) ([]byte, error) {
+	if sync.Template != "" {
+		return os.ReadFile(sync.Template)
+	}
+
+	sync.locks.state.Lock()
+	defer sync.locks.state.Unlock()
+	template, ok := sync.templates[folder]
+	if !ok {
+		var err error
+		if template, err = findTemplate(vault, folder); err != nil {
+			return nil, err
+		}
+		if !template.found {
+			log.Warn().Str("folder", folder).Msg("Template not found, using default")
+		}
+		if sync.templates == nil {
+			sync.templates = make(map[string]folderTemplate)
+		}
+		sync.templates[folder] = template
+	}
+
+	if template.found {
+		return template.content, nil
+	}
+	if blocked {
+		return []byte(defaultBlockedTemplate), nil
+	}
+	return []byte(defaultTemplate), nil
+}
+
+// findTemplate reads Templates/<folder>.md, or else Templates/People.md
+func findTemplate(vault *obsidian.Vault, folder string) (folderTemplate, error) {
+	for _, name := range []string{folder, "People"} {
+		templatePath := filepath.Join(vault.Path, templatesFolder, name+".md")
+		content, err := os.ReadFile(templatePath)
+		if err == nil {
+			log.Debug().Str("template", templatePath).Str("folder", folder).Msg("Using template")
+			return folderTemplate{content: content, found: true}, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return folderTemplate{}, err
+		}
+	}
+	return folderTemplate{}, nil
+}
+
+// disambiguatedTitle is the page title used when another page already has the person's name
+func disambiguatedTitle(name, userID string) string {
+	return fmt.Sprintf("%s (user %s)", name, userID)
+}
+
+// pageExists reports whether a file exists at filePath, either on disk or as a page only created in memory by a dry run
+func pageExists(vault *obsidian.Vault, filePath string) bool {
+	if _, err := os.Stat(filePath); err == nil {
+		return true
+	}
+	relPath, err := filepath.Rel(vault.Path, filePath)
+	if err != nil {
+		return false
+	}
+	return vault.FindByTitleInFolder(strings.TrimSuffix(filepath.Base(relPath), ".md"), filepath.Dir(relPath)) != nil
+}
+
 // createPageFromTemplateWithNote creates a page with private note for folder determination
 func (sync *SyncCmd) createPageFromTemplateWithNote(vault *obsidian.Vault, userID, nickname, privateNote string) (*obsidian.Page, error) {
 	// Determine folder based on CreatePeopleIn flag and private note
-	folder := sync.determineFolderForUser(userID, privateNote)
-	return sync.createPageInFolder(vault, userID, nickname, folder)
+	folder := sync.determineFolderForUser(userID, nickname, privateNote)
+	return sync.createPageInFolder(vault, templateFields{UserID: userID, Nickname: nickname, Note: privateNote}, folder)
 }
 
 func (sync *SyncCmd) createPageFromTemplate(vault *obsidian.Vault, userID, nickname string) (*obsidian.Page, error) {
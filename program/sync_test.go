@@ -1,12 +1,23 @@
 package program
 
 import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
 	"github.com/stretchr/testify/assert"
+	"github.com/woodysmith1912/fetlife-data-tools/fetlife"
 	"github.com/woodysmith1912/fetlife-data-tools/obsidian"
+	"github.com/zenizh/go-capturer"
 )
 
 func TestParseFolderConfig(t *testing.T) {
@@ -52,13 +63,168 @@ func TestParseFolderConfig(t *testing.T) {
 			expectedFolder:   "Bad People",
 			expectedKeywords: []string{"creepy", "stalker", "harassment"},
 		},
+		{
+			name:             "folder with regex keywords",
+			config:           `Bad People:creep.*,stalker\b,re:harass(ment|ing)?`,
+			expectedFolder:   "Bad People",
+			expectedKeywords: []string{"creep.*", `stalker\b`, "harass(ment|ing)?"},
+		},
+		{
+			name:             "folder with re: prefixed keywords",
+			config:           `Bad People:re:\bstalk(er|ing)\b,creepy,re:blocked|banned`,
+			expectedFolder:   "Bad People",
+			expectedKeywords: []string{`\bstalk(er|ing)\b`, "creepy", "blocked|banned"},
+		},
+		{
+			name:             "folder with mixed plain and regex keywords",
+			config:           "Bad People:Creepy,re:^blocked",
+			expectedFolder:   "Bad People",
+			expectedKeywords: []string{"creepy", "^blocked"},
+		},
+		{
+			name:             "folder with punctuation in plain keywords",
+			config:           "Bad People:(ex),$$$,[redacted],^^",
+			expectedFolder:   "Bad People",
+			expectedKeywords: []string{"(ex)", "$$$", "[redacted]", "^^"},
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			folder, keywords := parseFolderConfig(tt.config)
-			assert.Equal(t, tt.expectedFolder, folder)
-			assert.Equal(t, tt.expectedKeywords, keywords)
+			config, err := parseFolderConfig(tt.config)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedFolder, config.Folder)
+
+			var texts []string
+			for _, keyword := range config.Keywords {
+				texts = append(texts, keyword.Text)
+			}
+			assert.Equal(t, tt.expectedKeywords, texts)
+		})
+	}
+}
+
+func TestParseFolderConfig_InvalidRegex(t *testing.T) {
+	_, err := parseFolderConfig("Bad People:creepy,harass.*(ment")
+	assert.Error(t, err)
+
+	// The error names the folder config it came from
+	_, err = parseFolderConfig("Bad People:re:stalk(er")
+	assert.ErrorContains(t, err, `"Bad People:re:stalk(er"`)
+
+	// So are invalid exclusions
+	_, err = parseFolderConfig("Bad People:creepy!re:jok(e")
+	assert.Error(t, err)
+
+	sync := &SyncCmd{CreatePeopleIn: []string{"People", "Bad People:re:[stalker"}}
+	assert.Error(t, sync.Validate())
+}
+
+func TestParseFolderConfig_Exclusions(t *testing.T) {
+	tests := []struct {
+		name               string
+		config             string
+		expectedKeywords   []string
+		expectedExclusions []string
+	}{
+		{
+			name:             "no exclusions",
+			config:           "Bad People:creepy,stalker",
+			expectedKeywords: []string{"creepy", "stalker"},
+		},
+		{
+			name:               "exclusions after the separator",
+			config:             "Bad People:creepy,stalker!joking,False Alarm",
+			expectedKeywords:   []string{"creepy", "stalker"},
+			expectedExclusions: []string{"joking", "false alarm"},
+		},
+		{
+			name:               "regex exclusion",
+			config:             `Bad People:creep!re:\bnot creepy\b`,
+			expectedKeywords:   []string{"creep"},
+			expectedExclusions: []string{`\bnot creepy\b`},
+		},
+		{
+			name:               "only exclusions",
+			config:             "People:!blocked",
+			expectedExclusions: []string{"blocked"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := parseFolderConfig(tt.config)
+			assert.NoError(t, err)
+
+			var keywordTexts, exclusionTexts []string
+			for _, keyword := range config.Keywords {
+				keywordTexts = append(keywordTexts, keyword.Text)
+			}
+			for _, exclusion := range config.Exclusions {
+				exclusionTexts = append(exclusionTexts, exclusion.Text)
+			}
+			assert.NotEmpty(t, config.Folder)
+			assert.Equal(t, tt.expectedKeywords, keywordTexts)
+			assert.Equal(t, tt.expectedExclusions, exclusionTexts)
+		})
+	}
+}
+
+func TestParseFolderConfig_Priority(t *testing.T) {
+	tests := []struct {
+		name             string
+		config           string
+		expectedFolder   string
+		expectedPriority int
+	}{
+		{name: "no priority", config: "Bad People:creepy", expectedFolder: "Bad People"},
+		{name: "priority", config: "Bad People@10:creepy", expectedFolder: "Bad People", expectedPriority: 10},
+		{name: "negative priority", config: "Maybe@-5:odd", expectedFolder: "Maybe", expectedPriority: -5},
+		{name: "priority without keywords", config: "People@3", expectedFolder: "People", expectedPriority: 3},
+		{name: "@ in folder name", config: "Me@Work:colleague", expectedFolder: "Me@Work"},
+		{name: "@ in folder name with priority", config: "Me@Work@2:colleague", expectedFolder: "Me@Work", expectedPriority: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := parseFolderConfig(tt.config)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedFolder, config.Folder)
+			assert.Equal(t, tt.expectedPriority, config.Priority)
+		})
+	}
+}
+
+func TestFolderKeywordMatches(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		text     string
+		expected bool
+	}{
+		{name: "plain substring", config: "F:creep", text: "a creepy person", expected: true},
+		{name: "plain no match", config: "F:stalker", text: "a nice person", expected: false},
+		{name: "regex wildcard", config: "F:creep.*person", text: "a creepy old person", expected: true},
+		{name: "regex word boundary match", config: `F:stalker\b`, text: "a stalker.", expected: true},
+		{name: "regex word boundary no match", config: `F:stalker\b`, text: "stalkerish vibes", expected: false},
+		{name: "regex alternation", config: "F:re:harass(ment|ing)?", text: "sent harassing messages", expected: true},
+		{name: "regex anchor no match", config: "F:re:^blocked", text: "i blocked them", expected: false},
+		{name: "regex ignores case", config: "F:re:^BLOCKED", text: "blocked them", expected: true},
+		{name: "plain keyword with parentheses is a substring", config: "F:(ex)", text: "my (ex) partner", expected: true},
+		{name: "plain keyword with dollars is a substring", config: "F:$$$", text: "asked for $$$ upfront", expected: true},
+		{name: "plain keyword with caret is a substring", config: "F:^blocked", text: "i blocked them", expected: false},
+		{name: "re: word boundary no match", config: `F:re:\bblocked\b`, text: "they were unblocked", expected: false},
+		{name: "re: word boundary match", config: `F:re:\bblocked\b`, text: "i blocked them", expected: true},
+		{name: "re: without markers", config: "F:re:stalker|creep", text: "a creep", expected: true},
+		{name: "plain keyword with pipe is a substring", config: "F:stalker|creep", text: "a creep", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := parseFolderConfig(tt.config)
+			assert.NoError(t, err)
+			assert.Len(t, config.Keywords, 1)
+			assert.Equal(t, tt.expected, config.Keywords[0].Matches(tt.text))
 		})
 	}
 }
@@ -141,6 +307,20 @@ func TestDetermineFolderForUser(t *testing.T) {
 			privateNote:    "",
 			expectedFolder: "People",
 		},
+		{
+			name:           "regex keyword match",
+			createPeopleIn: []string{"People", `Bad People:re:harass(ment|ing)?,stalker\b`},
+			userID:         "12345",
+			privateNote:    "Kept HARASSING me",
+			expectedFolder: "Bad People",
+		},
+		{
+			name:           "regex keyword no match",
+			createPeopleIn: []string{"People", `Bad People:stalker\b`},
+			userID:         "12345",
+			privateNote:    "Has stalkerish vibes",
+			expectedFolder: "People",
+		},
 		{
 			name:           "first folder has keywords but doesn't match",
 			createPeopleIn: []string{"Friends:friend", "People"},
@@ -148,6 +328,69 @@ func TestDetermineFolderForUser(t *testing.T) {
 			privateNote:    "Someone I met",
 			expectedFolder: "Friends",
 		},
+		{
+			name:           "exclusion vetoes a keyword match",
+			createPeopleIn: []string{"People", "Bad People:creepy,stalker!not creepy,joke"},
+			userID:         "12345",
+			privateNote:    "Honestly not creepy at all",
+			expectedFolder: "People",
+		},
+		{
+			name:           "exclusion vetoes a match on another keyword",
+			createPeopleIn: []string{"People", "Bad People:creepy,stalker!joke"},
+			userID:         "12345",
+			privateNote:    "Called me a stalker as a JOKE",
+			expectedFolder: "People",
+		},
+		{
+			name:           "keyword matches when no exclusion does",
+			createPeopleIn: []string{"People", "Bad People:creepy,stalker!not creepy,joke"},
+			userID:         "12345",
+			privateNote:    "Very creepy messages",
+			expectedFolder: "Bad People",
+		},
+		{
+			name:           "excluded folder falls through to the next matching folder",
+			createPeopleIn: []string{"People", "Bad People:creepy!joke", "Watch:creepy"},
+			userID:         "12345",
+			privateNote:    "A creepy joke, keep an eye out",
+			expectedFolder: "Watch",
+		},
+		{
+			name:           "without priorities the first matching folder wins",
+			createPeopleIn: []string{"People", "Friends:friend", "Bad People:creepy"},
+			userID:         "12345",
+			privateNote:    "A friend who turned creepy",
+			expectedFolder: "Friends",
+		},
+		{
+			name:           "higher priority wins over folder order",
+			createPeopleIn: []string{"People", "Friends:friend", "Bad People@10:creepy"},
+			userID:         "12345",
+			privateNote:    "A friend who turned creepy",
+			expectedFolder: "Bad People",
+		},
+		{
+			name:           "equal priorities keep folder order",
+			createPeopleIn: []string{"People", "Friends@5:friend", "Bad People@5:creepy"},
+			userID:         "12345",
+			privateNote:    "A friend who turned creepy",
+			expectedFolder: "Friends",
+		},
+		{
+			name:           "priority only counts when the folder matches",
+			createPeopleIn: []string{"People", "Friends:friend", "Bad People@10:creepy"},
+			userID:         "12345",
+			privateNote:    "A good friend",
+			expectedFolder: "Friends",
+		},
+		{
+			name:           "exclusion only applies to its own folder",
+			createPeopleIn: []string{"People", "Friends:friend!creepy", "Bad People:creepy"},
+			userID:         "12345",
+			privateNote:    "A friend of a creepy guy",
+			expectedFolder: "Bad People",
+		},
 	}
 
 	for _, tt := range tests {
@@ -155,12 +398,155 @@ func TestDetermineFolderForUser(t *testing.T) {
 			sync := &SyncCmd{
 				CreatePeopleIn: tt.createPeopleIn,
 			}
-			folder := sync.determineFolderForUser(tt.userID, tt.privateNote)
+			folder := sync.determineFolderForUser(tt.userID, "", tt.privateNote)
+			assert.Equal(t, tt.expectedFolder, folder)
+		})
+	}
+}
+
+func TestDetermineFolderForUser_Nickname(t *testing.T) {
+	tests := []struct {
+		name           string
+		matchNickname  bool
+		nickname       string
+		privateNote    string
+		expectedFolder string
+	}{
+		{
+			name:           "nickname ignored without MatchNickname",
+			nickname:       "CreepyDude69",
+			expectedFolder: "People",
+		},
+		{
+			name:           "empty note with matching nickname",
+			matchNickname:  true,
+			nickname:       "CreepyDude69",
+			expectedFolder: "Bad People",
+		},
+		{
+			name:           "anchored pattern matches the start of the nickname",
+			matchNickname:  true,
+			nickname:       "Master_Stalker",
+			privateNote:    "Never met",
+			expectedFolder: "Watch",
+		},
+		{
+			name:           "exclusion in the note vetoes a nickname match",
+			matchNickname:  true,
+			nickname:       "CreepyDude69",
+			privateNote:    "Just a joke name",
+			expectedFolder: "People",
+		},
+		{
+			name:           "nickname without a keyword falls back to the first folder",
+			matchNickname:  true,
+			nickname:       "FriendlyFace",
+			expectedFolder: "People",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sync := &SyncCmd{
+				CreatePeopleIn: []string{"People", "Bad People:creepy!joke", "Watch:re:^master"},
+				MatchNickname:  tt.matchNickname,
+			}
+			folder := sync.determineFolderForUser("12345", tt.nickname, tt.privateNote)
+			assert.Equal(t, tt.expectedFolder, folder)
+		})
+	}
+}
+
+func TestDetermineBlockedFolder(t *testing.T) {
+	tests := []struct {
+		name           string
+		createIn       []string
+		nickname       string
+		privateNote    string
+		expectedFolder string
+	}{
+		{name: "no folders", expectedFolder: "Bad People"},
+		{name: "single folder", createIn: []string{"Blocked"}, privateNote: "Banned from the event", expectedFolder: "Blocked"},
+		{name: "note matches", createIn: []string{"Bad People", "Event Bans:event,munch"}, privateNote: "Banned from the EVENT", expectedFolder: "Event Bans"},
+		{name: "nickname matches", createIn: []string{"Bad People", "Event Bans:event,munch"}, nickname: "MunchHopper", expectedFolder: "Event Bans"},
+		{name: "nothing matches", createIn: []string{"Bad People", "Event Bans:event,munch"}, privateNote: "Rude", expectedFolder: "Bad People"},
+		{name: "priority wins", createIn: []string{"Bad People", "Event Bans:event", "Police@1:assault"}, privateNote: "Assault at the event", expectedFolder: "Police"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sync := &SyncCmd{CreateBlockedIn: tt.createIn}
+			folder := sync.determineBlockedFolder("12345", tt.nickname, tt.privateNote)
 			assert.Equal(t, tt.expectedFolder, folder)
 		})
 	}
 }
 
+func TestSyncCmd_CreateBlockedInKeywords(t *testing.T) {
+	tempVault := t.TempDir()
+	writeTestFile(t, filepath.Join(tempVault, "People", "Carol.md"),
+		"---\ntags:\n  - person\nurl: https://fetlife.com/users/33333\nweb-message: Trouble at every event\n---\n")
+	dataDir := writeTestData(t,
+		"11111,2024-01-01,2024-01-01,Dave\n22222,2024-01-01,2024-01-01,Eve\n33333,2024-01-01,2024-01-01,Carol\n",
+		"11111,2024-01-01,2024-01-01,Groped people at the event\n")
+
+	sync := &SyncCmd{
+		DataDir:         []string{dataDir},
+		CreatePeopleIn:  []string{"People"},
+		CreateBlockedIn: []string{"Bad People", "Event Bans:event"},
+		MoveBlocked:     true,
+		FolderColor:     map[string]string{"Event Bans": "#FF9800"},
+	}
+	assert.NoError(t, sync.Validate())
+	err := sync.Run(loadTestVault(t, tempVault))
+	assert.NoError(t, err)
+
+	// Dave's note mentions an event, Eve has no note and goes to the first folder
+	assert.FileExists(t, filepath.Join(tempVault, "Event Bans", "Dave.md"))
+	assert.FileExists(t, filepath.Join(tempVault, "Bad People", "Eve.md"))
+
+	// Carol's existing page is moved by its web-message and gets the color of that folder
+	carol, err := obsidian.LoadPage(filepath.Join(tempVault, "Event Bans", "Carol.md"), tempVault)
+	assert.NoError(t, err)
+	assert.Equal(t, obsidian.Color("#FF9800"), carol.WebBadgeColor)
+
+	sync.CreateBlockedIn = []string{"Bad People", "Event Bans:re:("}
+	assert.Error(t, sync.Validate())
+}
+
+func TestSyncCmd_CreateBlockedInKeywords_OnlyBlocked(t *testing.T) {
+	tempVault := t.TempDir()
+	dataDir := writeTestData(t,
+		"11111,2024-01-01,2024-01-01,Dave\n22222,2024-01-01,2024-01-01,Eve\n",
+		"11111,2024-01-01,2024-01-01,Groped people at the event\n22222,2024-01-01,2024-01-01,Rude at the munch\n")
+
+	// The notes aren't synced, but still route the blocked users
+	sync := &SyncCmd{
+		DataDir:         []string{dataDir},
+		CreatePeopleIn:  []string{"People"},
+		CreateBlockedIn: []string{"Bad People", "Event Bans:event", "Munch Bans:munch"},
+		Only:            []string{"blocked"},
+		NoCache:         true,
+	}
+	assert.NoError(t, sync.Validate())
+	assert.NoError(t, sync.Run(loadTestVault(t, tempVault)))
+
+	assert.FileExists(t, filepath.Join(tempVault, "Event Bans", "Dave.md"))
+	assert.FileExists(t, filepath.Join(tempVault, "Munch Bans", "Eve.md"))
+
+	// The notes themselves aren't written to the pages
+	dave, err := obsidian.LoadPage(filepath.Join(tempVault, "Event Bans", "Dave.md"), tempVault)
+	assert.NoError(t, err)
+	assert.NotContains(t, dave.WebMessage, "Groped")
+
+	// Without private_notes.txt, blocked users go to the first folder
+	assert.NoError(t, os.Remove(filepath.Join(dataDir, "private_notes.txt")))
+	writeTestFile(t, filepath.Join(dataDir, "blockeds.txt"),
+		"blocked_user_id,created_at,updated_at,blocked_nickname\n33333,2024-01-01,2024-01-01,Mallory\n")
+	assert.NoError(t, sync.Run(loadTestVault(t, tempVault)))
+	assert.FileExists(t, filepath.Join(tempVault, "Bad People", "Mallory.md"))
+}
+
 func TestCreatePageFromTemplateWithNote(t *testing.T) {
 	// Create a temporary vault
 	tempVault := t.TempDir()
@@ -187,6 +573,7 @@ url: https://fetlife.com/users/
 	tests := []struct {
 		name           string
 		createPeopleIn []string
+		matchNickname  bool
 		userID         string
 		nickname       string
 		privateNote    string
@@ -229,6 +616,16 @@ url: https://fetlife.com/users/
 			expectedFolder: "Friends",
 			expectedName:   "CoolFriend",
 		},
+		{
+			name:           "create in Bad People folder with nickname match and empty note",
+			createPeopleIn: []string{"People", "Bad People:creepy"},
+			matchNickname:  true,
+			userID:         "22222",
+			nickname:       "CreepyDude69",
+			privateNote:    "",
+			expectedFolder: "Bad People",
+			expectedName:   "CreepyDude69",
+		},
 	}
 
 	for _, tt := range tests {
@@ -240,6 +637,7 @@ url: https://fetlife.com/users/
 
 			sync := &SyncCmd{
 				CreatePeopleIn: tt.createPeopleIn,
+				MatchNickname:  tt.matchNickname,
 			}
 
 			page, err := sync.createPageFromTemplateWithNote(vault, tt.userID, tt.nickname, tt.privateNote)
@@ -321,6 +719,7 @@ func TestCreatePageFromTemplateWithNote_NoTemplate(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, page)
 	assert.Equal(t, "TestUser", page.Title)
+	assert.Equal(t, "https://fetlife.com/users/12345", page.Url)
 
 	// Verify file exists
 	expectedPath := filepath.Join(tempVault, "People", "TestUser.md")
@@ -335,70 +734,283 @@ func TestCreatePageFromTemplateWithNote_NoTemplate(t *testing.T) {
 	assert.Contains(t, string(content), "https://fetlife.com/users/12345")
 }
 
-func TestSyncCmd_Integration_KeywordMatching(t *testing.T) {
-	// Create a temporary vault
+func TestSyncCmd_FolderTemplates(t *testing.T) {
+	template := func(heading string) string {
+		return "---\ntags:\n  - person\nurl: https://fetlife.com/users/\n---\n\n# " + heading + "\n"
+	}
+	testDataDir := writeTestData(t, "",
+		"11111,2024-01-01,2024-01-01,Great photographer\n"+
+			"22222,2024-01-01,2024-01-01,This person is creepy\n")
+
 	tempVault := t.TempDir()
+	writeTestFile(t, filepath.Join(tempVault, "Templates", "People.md"), template("Friendly"))
+	writeTestFile(t, filepath.Join(tempVault, "Templates", "Bad People.md"), template("Warning"))
 
-	// Create Templates directory
-	templatesDir := filepath.Join(tempVault, "Templates")
-	if err := os.MkdirAll(templatesDir, 0755); err != nil {
-		t.Fatalf("Failed to create templates directory: %v", err)
+	sync := &SyncCmd{
+		DataDir:        []string{testDataDir},
+		CreatePeopleIn: []string{"People", "Bad People:creepy"},
+		NoCache:        true,
 	}
+	err := sync.Run(loadTestVault(t, tempVault))
+	assert.NoError(t, err)
 
-	templateContent := `---
-tags:
-  - person
-url: https://fetlife.com/users/
----
+	// The keyword routes the user to Bad People, which has a template of its own
+	content, err := os.ReadFile(filepath.Join(tempVault, "Bad People", "user-22222.md"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "# Warning")
+	assert.Contains(t, string(content), "https://fetlife.com/users/22222")
 
-# Notes
-`
-	templatePath := filepath.Join(templatesDir, "People.md")
-	if err := os.WriteFile(templatePath, []byte(templateContent), 0644); err != nil {
-		t.Fatalf("Failed to create template: %v", err)
+	content, err = os.ReadFile(filepath.Join(tempVault, "People", "user-11111.md"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "# Friendly")
+
+	// --template overrides the vault's templates
+	tempVault = t.TempDir()
+	writeTestFile(t, filepath.Join(tempVault, "Templates", "Bad People.md"), template("Warning"))
+	sync.Template = filepath.Join(t.TempDir(), "Override.md")
+	writeTestFile(t, sync.Template, template("Override"))
+	err = sync.Run(loadTestVault(t, tempVault))
+	assert.NoError(t, err)
+
+	for _, path := range []string{filepath.Join("Bad People", "user-22222.md"), filepath.Join("People", "user-11111.md")} {
+		content, err = os.ReadFile(filepath.Join(tempVault, path))
+		assert.NoError(t, err)
+		assert.Contains(t, string(content), "# Override", path)
 	}
+}
 
-	// Create test data directory
-	testDataDir := t.TempDir()
+func TestSyncCmd_TemplateNotFoundWarnsOnce(t *testing.T) {
+	testDataDir := writeTestData(t, "",
+		"11111,2024-01-01,2024-01-01,Great photographer\n"+
+			"22222,2024-01-01,2024-01-01,Met at a munch\n"+
+			"33333,2024-01-01,2024-01-01,This person is creepy\n")
 
-	// Create private_notes.txt
-	privateNotesContent := `member_id,created_at,updated_at,private_note
-11111,2024-01-01,2024-01-01,Great photographer! Very professional.
-22222,2024-01-01,2024-01-01,This person is creepy and sent harassing messages
-33333,2024-01-01,2024-01-01,Stalker behavior - blocked them
-44444,2024-01-01,2024-01-01,Cool person met at event
-55555,2024-01-01,2024-01-01,My friend from the workshop
-`
-	privateNotesPath := filepath.Join(testDataDir, "private_notes.txt")
-	if err := os.WriteFile(privateNotesPath, []byte(privateNotesContent), 0644); err != nil {
-		t.Fatalf("Failed to create private_notes.txt: %v", err)
+	var out bytes.Buffer
+	logger := log.Logger
+	log.Logger = zerolog.New(&out)
+	defer func() { log.Logger = logger }()
+
+	tempVault := t.TempDir()
+	sync := &SyncCmd{
+		DataDir:        []string{testDataDir},
+		CreatePeopleIn: []string{"People", "Bad People:creepy"},
+		NoCache:        true,
 	}
+	assert.NoError(t, sync.Run(loadTestVault(t, tempVault)))
+	assert.FileExists(t, filepath.Join(tempVault, "People", "user-22222.md"))
 
-	// Create empty blockeds.txt
-	blockedsContent := `user_id,created_at,updated_at,nickname
-`
-	blockedsPath := filepath.Join(testDataDir, "blockeds.txt")
-	if err := os.WriteFile(blockedsPath, []byte(blockedsContent), 0644); err != nil {
-		t.Fatalf("Failed to create blockeds.txt: %v", err)
+	// Two pages are created in People, but each folder is warned about once
+	assert.Equal(t, 2, strings.Count(out.String(), "Template not found, using default"), out.String())
+	assert.Equal(t, 1, strings.Count(out.String(), `"folder":"People","message":"Template not found`), out.String())
+}
+
+func TestRenderTemplate(t *testing.T) {
+	fields := templateFields{UserID: "12345", Nickname: "Alice", Note: "Met at a munch", BlockedAt: "2024-01-01 10:00:00 UTC", Date: "2024-06-01", Folder: "Bad People"}
+
+	tests := []struct {
+		template string
+		expected string
+	}{
+		{template: "# {{title}}", expected: "# Alice (user 12345)"},
+		{template: "id: {{user_id}}", expected: "id: 12345"},
+		{template: "Nickname: {{nickname}}", expected: "Nickname: Alice"},
+		{template: "> {{note}}", expected: "> Met at a munch"},
+		{template: "Added {{date}}", expected: "Added 2024-06-01"},
+		{template: "Blocked {{blocked_at}}", expected: "Blocked 2024-01-01 10:00:00 UTC"},
+		{template: "{{user_id}} and {{user_id}}", expected: "12345 and 12345"},
+		{template: "id: {{userID}}", expected: "id: 12345"},
+		{template: "url: {{url}}", expected: "url: https://fetlife.com/users/12345"},
+		{template: "In {{folder}}", expected: "In Bad People"},
+		{template: "No placeholders", expected: "No placeholders"},
+		{template: "Created {{time}}", expected: "Created {{time}}"},
 	}
 
-	// Create sync command directly
-	sync := &SyncCmd{
-		DataDir:        testDataDir,
-		CreatePeopleIn: []string{"People", "Bad People:creepy,stalker,harassing", "Friends:cool,friend"},
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			assert.Equal(t, tt.expected, renderTemplate(tt.template, "Alice (user 12345)", fields))
+		})
 	}
+}
 
-	vault := obsidian.NewVault(tempVault)
-	err := vault.Load()
+func TestApplyTemplateVars(t *testing.T) {
+	vars := map[string]string{"a": "1", "ab": "2", "empty": ""}
+	assert.Equal(t, "1 2 [] {{b}} {a}", applyTemplateVars("{{a}} {{ab}} [{{empty}}] {{b}} {a}", vars))
+	assert.Equal(t, "{{a}}", applyTemplateVars("{{a}}", nil))
+}
+
+func TestSyncCmd_TemplateVars(t *testing.T) {
+	tempVault := t.TempDir()
+	writeTestFile(t, filepath.Join(tempVault, "Templates", "People.md"),
+		"---\ntags:\n  - person\nurl: \"{{url}}\"\nfirst-seen: \"{{date}}\"\n---\n# {{nickname}}\n\nID {{userID}} in {{folder}}\n")
+
+	sync := &SyncCmd{
+		DataDir:         []string{writeTestData(t, "98765,2024-01-01,2024-01-01,Frank\n", "")},
+		CreatePeopleIn:  []string{"People"},
+		CreateBlockedIn: []string{"Bad People"},
+		now:             fixedNow,
+	}
+	err := sync.Run(loadTestVault(t, tempVault))
 	assert.NoError(t, err)
 
-	err = sync.Run(vault)
+	page, err := obsidian.LoadPage(filepath.Join(tempVault, "Bad People", "Frank.md"), tempVault)
 	assert.NoError(t, err)
+	assert.Equal(t, "https://fetlife.com/users/98765", page.Url)
+	assert.Contains(t, page.Content, "# Frank\n\nID 98765 in Bad People\n")
+}
 
-	// Verify files were created in correct folders
-	peopleDir := filepath.Join(tempVault, "People")
-	badPeopleDir := filepath.Join(tempVault, "Bad People")
-	friendsDir := filepath.Join(tempVault, "Friends")
+func TestSyncCmd_TemplateURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		expected string
+	}{
+		{
+			name:     "url without user ID",
+			template: "---\ntags:\n  - person\nurl: https://fetlife.com/users/\n---\n\n# {{nickname}}\n",
+			expected: "---\ntags:\n  - person\nurl: https://fetlife.com/users/12345\ncreated-at: \"2024-06-01T12:00:00Z\"\n---\n\n# Alice\n",
+		},
+		{
+			name:     "url with user ID placeholder",
+			template: "---\nurl: https://fetlife.com/users/{{user_id}}\ntags:\n  - person\n---\n\n# {{nickname}}\n",
+			expected: "---\ntags:\n  - person\nurl: https://fetlife.com/users/12345\ncreated-at: \"2024-06-01T12:00:00Z\"\n---\n\n# Alice\n",
+		},
+		{
+			name:     "no url",
+			template: "---\ntags:\n  - person\n---\n\n# {{nickname}}\n",
+			expected: "---\ntags:\n  - person\nurl: https://fetlife.com/users/12345\ncreated-at: \"2024-06-01T12:00:00Z\"\n---\n\n# Alice\n",
+		},
+		{
+			name:     "date of the sync",
+			template: "---\ntags:\n  - person\n---\n\nAdded {{date}}\n",
+			expected: "---\ntags:\n  - person\nurl: https://fetlife.com/users/12345\ncreated-at: \"2024-06-01T12:00:00Z\"\n---\n\nAdded 2024-06-01\n",
+		},
+		{
+			name:     "no frontmatter and no placeholders",
+			template: "# Notes\n",
+			expected: "---\nurl: https://fetlife.com/users/12345\ncreated-at: \"2024-06-01T12:00:00Z\"\n---\n# Notes\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempVault := t.TempDir()
+			writeTestFile(t, filepath.Join(tempVault, "Templates", "People.md"), tt.template)
+			vault := loadTestVault(t, tempVault)
+
+			sync := &SyncCmd{CreatePeopleIn: []string{"People"}, now: fixedNow}
+			page, err := sync.createPageInFolder(vault, templateFields{UserID: "12345", Nickname: "Alice"}, "People")
+			assert.NoError(t, err)
+			assert.Equal(t, "https://fetlife.com/users/12345", page.Url)
+
+			content, err := os.ReadFile(filepath.Join(tempVault, "People", "Alice.md"))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, string(content))
+		})
+	}
+}
+
+func TestSyncCmd_DefaultBlockedTemplate(t *testing.T) {
+	tempVault := t.TempDir()
+	testDataDir := writeTestData(t, "98765,2023-02-15 14:22:10 UTC,2023-02-15 14:22:10 UTC,Frank\n", "")
+
+	sync := &SyncCmd{
+		DataDir:         []string{testDataDir},
+		CreatePeopleIn:  []string{"People"},
+		CreateBlockedIn: []string{"Bad People"},
+		NoCache:         true,
+	}
+	err := sync.Run(loadTestVault(t, tempVault))
+	assert.NoError(t, err)
+
+	frank, err := obsidian.LoadPage(filepath.Join(tempVault, "Bad People", "Frank.md"), tempVault)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"person", "blocked"}, frank.Tags)
+	assert.Equal(t, obsidian.Color("#F44336"), frank.WebBadgeColor)
+	assert.Equal(t, "WARNING: Blocked user", frank.WebMessage)
+	assert.Equal(t, "2023-02-15 14:22:10 UTC", frank.BlockedDate)
+	assert.Equal(t, "\n# Notes\n\nBlocked on 2023-02-15 14:22:10 UTC\n", frank.Content)
+
+	rendered := renderTemplate(defaultBlockedTemplate, "Frank", templateFields{BlockedAt: "2023-02-15 14:22:10 UTC"})
+	assert.Contains(t, defaultBlockedTemplate, "Blocked on {{blocked_at}}")
+	assert.Contains(t, rendered, "Blocked on 2023-02-15 14:22:10 UTC")
+
+	// A template in the vault wins over the built-in one
+	tempVault = t.TempDir()
+	writeTestFile(t, filepath.Join(tempVault, "Templates", "People.md"), defaultTemplate)
+	err = sync.Run(loadTestVault(t, tempVault))
+	assert.NoError(t, err)
+
+	frank, err = obsidian.LoadPage(filepath.Join(tempVault, "Bad People", "Frank.md"), tempVault)
+	assert.NoError(t, err)
+	assert.Empty(t, frank.WebMessage)
+	// The template has no color, so the page gets the --blocked-color
+	assert.Equal(t, obsidian.Color("#F44336"), frank.WebBadgeColor)
+}
+
+func TestSyncCmd_Integration_KeywordMatching(t *testing.T) {
+	// Create a temporary vault
+	tempVault := t.TempDir()
+
+	// Create Templates directory
+	templatesDir := filepath.Join(tempVault, "Templates")
+	if err := os.MkdirAll(templatesDir, 0755); err != nil {
+		t.Fatalf("Failed to create templates directory: %v", err)
+	}
+
+	templateContent := `---
+tags:
+  - person
+url: https://fetlife.com/users/
+---
+
+# Notes
+`
+	templatePath := filepath.Join(templatesDir, "People.md")
+	if err := os.WriteFile(templatePath, []byte(templateContent), 0644); err != nil {
+		t.Fatalf("Failed to create template: %v", err)
+	}
+
+	// Create test data directory
+	testDataDir := t.TempDir()
+
+	// Create private_notes.txt
+	privateNotesContent := `member_id,created_at,updated_at,private_note
+11111,2024-01-01,2024-01-01,Great photographer! Very professional.
+22222,2024-01-01,2024-01-01,This person is creepy and sent harassing messages
+33333,2024-01-01,2024-01-01,Stalker behavior - blocked them
+44444,2024-01-01,2024-01-01,Cool person met at event
+55555,2024-01-01,2024-01-01,My friend from the workshop
+`
+	privateNotesPath := filepath.Join(testDataDir, "private_notes.txt")
+	if err := os.WriteFile(privateNotesPath, []byte(privateNotesContent), 0644); err != nil {
+		t.Fatalf("Failed to create private_notes.txt: %v", err)
+	}
+
+	// Create empty blockeds.txt
+	blockedsContent := `blocked_user_id,created_at,updated_at,blocked_nickname
+`
+	blockedsPath := filepath.Join(testDataDir, "blockeds.txt")
+	if err := os.WriteFile(blockedsPath, []byte(blockedsContent), 0644); err != nil {
+		t.Fatalf("Failed to create blockeds.txt: %v", err)
+	}
+
+	// Create sync command directly
+	sync := &SyncCmd{
+		DataDir:        []string{testDataDir},
+		CreatePeopleIn: []string{"People", "Bad People:creepy,stalker,harassing", "Friends:cool,friend"},
+	}
+
+	vault := obsidian.NewVault(tempVault)
+	err := vault.Load()
+	assert.NoError(t, err)
+
+	err = sync.Run(vault)
+	assert.NoError(t, err)
+
+	// Verify files were created in correct folders
+	peopleDir := filepath.Join(tempVault, "People")
+	badPeopleDir := filepath.Join(tempVault, "Bad People")
+	friendsDir := filepath.Join(tempVault, "Friends")
 
 	// User 11111 should be in People (no keywords matched)
 	user1Path := filepath.Join(peopleDir, "user-11111.md")
@@ -453,7 +1065,7 @@ url: https://fetlife.com/users/
 	testDataDir := t.TempDir()
 
 	// Create blockeds.txt with a user nicknamed "CreepyPerson"
-	blockedsContent := `user_id,created_at,updated_at,nickname
+	blockedsContent := `blocked_user_id,created_at,updated_at,blocked_nickname
 66666,2024-01-01,2024-01-01,CreepyPerson
 77777,2024-01-01,2024-01-01,NormalPerson
 `
@@ -472,9 +1084,9 @@ url: https://fetlife.com/users/
 
 	// Create sync command with CreateBlockedIn set to "Bad People"
 	sync := &SyncCmd{
-		DataDir:         testDataDir,
+		DataDir:         []string{testDataDir},
 		CreatePeopleIn:  []string{"People"},
-		CreateBlockedIn: "Bad People",
+		CreateBlockedIn: []string{"Bad People"},
 	}
 
 	vault := obsidian.NewVault(tempVault)
@@ -507,7 +1119,7 @@ url: https://fetlife.com/users/
 	assert.Contains(t, user2.Tags, "blocked", "NormalPerson should have 'blocked' tag")
 }
 
-func TestSyncCmd_PrivateNoteWithBlockedKeyword(t *testing.T) {
+func TestSyncCmd_FriendsInFriendsFolder(t *testing.T) {
 	// Create a temporary vault
 	tempVault := t.TempDir()
 
@@ -530,31 +1142,22 @@ url: https://fetlife.com/users/
 		t.Fatalf("Failed to create template: %v", err)
 	}
 
-	// Create test data directory
-	testDataDir := t.TempDir()
-
-	// Create empty blockeds.txt
-	blockedsContent := `user_id,created_at,updated_at,nickname
-`
-	blockedsPath := filepath.Join(testDataDir, "blockeds.txt")
-	if err := os.WriteFile(blockedsPath, []byte(blockedsContent), 0644); err != nil {
-		t.Fatalf("Failed to create blockeds.txt: %v", err)
-	}
+	// Create test data directory with a friend that was later blocked
+	testDataDir := writeTestData(t, "77777,2024-01-01,2024-01-01,FormerFriend\n", "")
 
-	// Create private_notes.txt with users who should go to Bad People
-	privateNotesContent := `member_id,created_at,updated_at,private_note
-88888,2024-01-01,2024-01-01,Blocked this creepy person immediately
-99999,2024-01-01,2024-01-01,Harassment and inappropriate messages - BLOCKED
+	// Create friends.txt
+	friendsContent := `friend_user_id,created_at,friend_nickname
+66666,2023-05-01 12:00:00 UTC,GoodFriend
+77777,2022-03-01 12:00:00 UTC,FormerFriend
 `
-	privateNotesPath := filepath.Join(testDataDir, "private_notes.txt")
-	if err := os.WriteFile(privateNotesPath, []byte(privateNotesContent), 0644); err != nil {
-		t.Fatalf("Failed to create private_notes.txt: %v", err)
-	}
+	writeTestFile(t, filepath.Join(testDataDir, "friends.txt"), friendsContent)
 
-	// Create sync command
+	// Create sync command with CreateFriendsIn set to "Friends"
 	sync := &SyncCmd{
-		DataDir:        testDataDir,
-		CreatePeopleIn: []string{"People", "Bad People:creepy,harassment,blocked"},
+		DataDir:         []string{testDataDir},
+		CreatePeopleIn:  []string{"People"},
+		CreateBlockedIn: []string{"Bad People"},
+		CreateFriendsIn: "Friends",
 	}
 
 	vault := obsidian.NewVault(tempVault)
@@ -564,25 +1167,2323 @@ url: https://fetlife.com/users/
 	err = sync.Run(vault)
 	assert.NoError(t, err)
 
-	// Both users should be in Bad People folder due to keyword matching
-	badPeopleDir := filepath.Join(tempVault, "Bad People")
+	// User 66666 (GoodFriend) should be in Friends folder (CreateFriendsIn setting)
+	friendPath := filepath.Join(tempVault, "Friends", "GoodFriend.md")
+	friend, err := obsidian.LoadPage(friendPath, tempVault)
+	assert.NoError(t, err, "GoodFriend should be created in Friends folder (CreateFriendsIn)")
+	assert.Contains(t, friend.Tags, "friend", "GoodFriend should have 'friend' tag")
+	assert.Equal(t, "2023-05-01 12:00:00 UTC", friend.FriendDate)
+
+	// User 77777 was blocked first, so the page stays in Bad People and keeps both tags
+	_, err = os.Stat(filepath.Join(tempVault, "Friends", "FormerFriend.md"))
+	assert.True(t, os.IsNotExist(err), "FormerFriend should not get a second page")
+	former, err := obsidian.LoadPage(filepath.Join(tempVault, "Bad People", "FormerFriend.md"), tempVault)
+	assert.NoError(t, err)
+	assert.Contains(t, former.Tags, "blocked", "FormerFriend should have 'blocked' tag")
+	assert.Contains(t, former.Tags, "friend", "FormerFriend should have 'friend' tag")
+	assert.Equal(t, "2022-03-01 12:00:00 UTC", former.FriendDate)
+	assert.Equal(t, "2024-01-01", former.BlockedDate)
+}
 
-	// User 88888 should be in Bad People (matches "creepy" and "blocked")
-	user1Path := filepath.Join(badPeopleDir, "user-88888.md")
-	_, err = os.Stat(user1Path)
-	assert.NoError(t, err, "User 88888 should be in Bad People folder (matches 'creepy' and 'blocked')")
+func TestSyncCmd_Follows(t *testing.T) {
+	tempVault := t.TempDir()
+	writeTestFile(t, filepath.Join(tempVault, "People", "Alice.md"), "---\nurl: https://fetlife.com/users/12345\n---\n")
 
-	// User 99999 should be in Bad People (matches "harassment" and "blocked")
-	user2Path := filepath.Join(badPeopleDir, "user-99999.md")
-	_, err = os.Stat(user2Path)
-	assert.NoError(t, err, "User 99999 should be in Bad People folder (matches 'harassment' and 'blocked')")
+	testDataDir := writeTestData(t, "", "")
+	writeTestFile(t, filepath.Join(testDataDir, "followers.csv"), `user_id,created_at,nickname
+12345,2024-01-01 12:00:00 UTC,Alice
+55555,2024-01-02 12:00:00 UTC,Bob
+`)
+	writeTestFile(t, filepath.Join(testDataDir, "followings.csv"), `user_id,created_at,nickname
+12345,2024-01-03 12:00:00 UTC,Alice
+`)
 
-	// Verify the private notes were saved
-	user1, err := obsidian.LoadPage(user1Path, tempVault)
+	sync := &SyncCmd{
+		DataDir:         []string{testDataDir},
+		CreatePeopleIn:  []string{"People"},
+		CreateBlockedIn: []string{"Bad People"},
+		NoCache:         true,
+	}
+	err := sync.Run(loadTestVault(t, tempVault))
 	assert.NoError(t, err)
-	assert.Equal(t, "Blocked this creepy person immediately", user1.WebMessage)
 
-	user2, err := obsidian.LoadPage(user2Path, tempVault)
+	// Only the existing page is tagged, Bob's page isn't created by default
+	alice, err := obsidian.LoadPage(filepath.Join(tempVault, "People", "Alice.md"), tempVault)
 	assert.NoError(t, err)
-	assert.Equal(t, "Harassment and inappropriate messages - BLOCKED", user2.WebMessage)
+	assert.Equal(t, []string{"follower", "following"}, alice.Tags)
+	assert.NoFileExists(t, filepath.Join(tempVault, "People", "Bob.md"))
+	assert.Equal(t, 2, sync.summary.FollowsMatched)
+	assert.Equal(t, 1, sync.summary.FollowsSkipped)
+
+	// With --create-followers-in Bob gets a page
+	sync = &SyncCmd{
+		DataDir:           []string{testDataDir},
+		CreatePeopleIn:    []string{"People"},
+		CreateBlockedIn:   []string{"Bad People"},
+		CreateFollowersIn: "Followers",
+		NoCache:           true,
+	}
+	err = sync.Run(loadTestVault(t, tempVault))
+	assert.NoError(t, err)
+
+	bob, err := obsidian.LoadPage(filepath.Join(tempVault, "Followers", "Bob.md"), tempVault)
+	assert.NoError(t, err)
+	assert.Contains(t, bob.Tags, "follower")
+	assert.Equal(t, 2, sync.summary.FollowsMatched)
+	assert.Equal(t, 0, sync.summary.FollowsSkipped)
+	assert.Equal(t, 1, sync.summary.Created)
+}
+
+func TestSyncCmd_Conversations(t *testing.T) {
+	tempVault := t.TempDir()
+	alicePath := filepath.Join(tempVault, "People", "Alice.md")
+	writeTestFile(t, alicePath, "---\nurl: https://fetlife.com/users/12345\n---\n\n# Alice\n\nMet at a munch\n")
+
+	testDataDir := writeTestData(t, "", "")
+	writeTestFile(t, filepath.Join(testDataDir, "conversations.txt"), `member_id,created_at,sender,body
+12345,2024-02-01 09:00:00 UTC,Me,See you there
+12345,2024-01-15 10:30:00 UTC,Alice,Going to the munch?
+99999,2024-01-01 12:00:00 UTC,Bob,Hi
+`)
+
+	sync := &SyncCmd{
+		DataDir:             []string{testDataDir},
+		CreatePeopleIn:      []string{"People"},
+		CreateBlockedIn:     []string{"Bad People"},
+		ImportConversations: true,
+		NoCache:             true,
+		now:                 fixedNow,
+	}
+	err := sync.Run(loadTestVault(t, tempVault))
+	assert.NoError(t, err)
+
+	expected := "---\nurl: https://fetlife.com/users/12345\nsynced-at: \"2024-06-01T12:00:00Z\"\n---\n\n# Alice\n\nMet at a munch\n\n" +
+		"## Conversations\n\n- Messages: 2\n- Last message: 2024-02-01 09:00:00 UTC\n"
+	alice, err := os.ReadFile(alicePath)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, string(alice))
+	assert.Equal(t, 1, sync.summary.Updated)
+	assert.Equal(t, 1, sync.summary.Missing, "Bob has no page and none is created")
+	assert.NoFileExists(t, filepath.Join(tempVault, "People", "Bob.md"))
+
+	// Syncing again replaces the section instead of adding a second one
+	err = sync.Run(loadTestVault(t, tempVault))
+	assert.NoError(t, err)
+	alice, err = os.ReadFile(alicePath)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, string(alice))
+	assert.Equal(t, 1, sync.summary.Unchanged)
+
+	// With --full-text the messages are included, oldest first
+	sync.FullText = true
+	err = sync.Run(loadTestVault(t, tempVault))
+	assert.NoError(t, err)
+	alice, err = os.ReadFile(alicePath)
+	assert.NoError(t, err)
+	assert.Equal(t, expected+"\n### 2024-01-15 10:30:00 UTC, Alice\n\nGoing to the munch?\n"+
+		"\n### 2024-02-01 09:00:00 UTC, Me\n\nSee you there\n", string(alice))
+}
+
+func TestSyncCmd_MoveBlocked(t *testing.T) {
+	frankContent := "---\ntags:\n  - person\nurl: https://fetlife.com/users/98765\n---\n\n# Frank\n\nMet at a munch\n"
+	testDataDir := writeTestData(t, "98765,2024-01-01,2024-01-01,Frank\n", "")
+
+	tests := []struct {
+		name        string
+		moveBlocked bool
+		expected    string
+	}{
+		{name: "stays without --move-blocked", moveBlocked: false, expected: "People/Frank.md"},
+		{name: "moved with --move-blocked", moveBlocked: true, expected: "Bad People/Frank.md"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempVault := t.TempDir()
+			writeTestFile(t, filepath.Join(tempVault, "People", "Frank.md"), frankContent)
+
+			sync := &SyncCmd{
+				DataDir:         []string{testDataDir},
+				CreatePeopleIn:  []string{"People"},
+				CreateBlockedIn: []string{"Bad People"},
+				MoveBlocked:     tt.moveBlocked,
+				NoCache:         true,
+			}
+			err := sync.Run(loadTestVault(t, tempVault))
+			assert.NoError(t, err)
+
+			if tt.moveBlocked {
+				assert.NoFileExists(t, filepath.Join(tempVault, "People", "Frank.md"))
+			}
+			frank, err := obsidian.LoadPage(filepath.Join(tempVault, filepath.FromSlash(tt.expected)), tempVault)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"person", "blocked"}, frank.Tags)
+			assert.Equal(t, "\n# Frank\n\nMet at a munch\n", frank.Content)
+			assert.Equal(t, 1, sync.summary.Updated)
+		})
+	}
+}
+
+func TestSyncCmd_NicknameAliases(t *testing.T) {
+	tempVault := t.TempDir()
+	franzPath := filepath.Join(tempVault, "People", "That photographer from Berlin.md")
+	writeTestFile(t, franzPath, "---\ntags:\n  - person\nurl: https://fetlife.com/users/11111\n---\n")
+	carolPath := filepath.Join(tempVault, "People", "Carol from the munch.md")
+	writeTestFile(t, carolPath, "---\ntags:\n  - person\naliases:\n  - carolyn\nurl: https://fetlife.com/users/33333\n---\n")
+	bobPath := filepath.Join(tempVault, "People", "Bob.md")
+	writeTestFile(t, bobPath, "---\ntags:\n  - person\nurl: https://fetlife.com/users/22222\n---\n")
+
+	dataDir := writeTestData(t, "", "")
+	writeTestFile(t, filepath.Join(dataDir, "friends.txt"),
+		"friend_user_id,created_at,friend_nickname\n11111,2024-01-01,FotoFranz\n22222,2024-01-01,Bob\n")
+	writeTestFile(t, filepath.Join(dataDir, "followers.csv"), "user_id,created_at,nickname\n33333,2024-01-01,Carolyn\n")
+
+	for range 2 {
+		sync := &SyncCmd{
+			DataDir:         []string{dataDir},
+			CreatePeopleIn:  []string{"People"},
+			CreateFriendsIn: "People",
+			NoCache:         true,
+		}
+		err := sync.Run(loadTestVault(t, tempVault))
+		assert.NoError(t, err)
+	}
+
+	// The nickname is added once, and not when it's the title or already an alias in another case
+	franz, err := obsidian.LoadPage(franzPath, tempVault)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"FotoFranz"}, franz.Aliases)
+
+	carol, err := obsidian.LoadPage(carolPath, tempVault)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"carolyn"}, carol.Aliases)
+
+	bob, err := obsidian.LoadPage(bobPath, tempVault)
+	assert.NoError(t, err)
+	assert.Empty(t, bob.Aliases)
+}
+
+func TestSyncCmd_MatchByName(t *testing.T) {
+	tempVault := t.TempDir()
+	alicePath := filepath.Join(tempVault, "People", "alice.md")
+	writeTestFile(t, alicePath, "---\ntags:\n  - person\n---\n\n# Met at the munch\n")
+	bobPath := filepath.Join(tempVault, "People", "Robert.md")
+	writeTestFile(t, bobPath, "---\ntags:\n  - person\naliases:\n  - Bob\nurl: https://example.com/robert\n---\n")
+	carolPath := filepath.Join(tempVault, "People", "Carol.md")
+	carolContent := "---\ntags:\n  - person\nurl: https://fetlife.com/users/99999\n---\n"
+	writeTestFile(t, carolPath, carolContent)
+
+	dataDir := writeTestData(t,
+		"11111,2024-01-01,2024-01-01,Alice\n33333,2024-01-01,2024-01-01,Carol\n",
+		"11111,2024-01-01,2024-01-01,Likes rope\n")
+	writeTestFile(t, filepath.Join(dataDir, "friends.txt"), "friend_user_id,created_at,friend_nickname\n22222,2024-01-01,bob\n")
+
+	sync := &SyncCmd{
+		DataDir:          []string{dataDir},
+		CreatePeopleIn:   []string{"People"},
+		CreateBlockedIn:  []string{"People"},
+		CreateFriendsIn:  "People",
+		ConflictStrategy: "skip",
+		MatchByName:      true,
+	}
+	err := sync.Run(loadTestVault(t, tempVault))
+	assert.NoError(t, err)
+
+	// The page titled with the nickname gets the URL and keeps its title, so the note finds it by ID
+	alice, err := obsidian.LoadPage(alicePath, tempVault)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://fetlife.com/users/11111", alice.Url)
+	assert.Equal(t, "Likes rope", alice.WebMessage)
+	assert.True(t, alice.HasTag("blocked"))
+	assert.Equal(t, "\n# Met at the munch\n", alice.Content)
+
+	// A page with a url of another site gets the profile URL as an alias
+	bob, err := obsidian.LoadPage(bobPath, tempVault)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com/robert", bob.Url)
+	assert.Equal(t, []string{"https://fetlife.com/users/22222"}, bob.UrlAliases)
+	assert.True(t, bob.HasTag("friend"))
+
+	// A page with another user's profile URL isn't matched
+	content, err := os.ReadFile(carolPath)
+	assert.NoError(t, err)
+	assert.Equal(t, carolContent, string(content))
+	assert.Equal(t, 1, sync.summary.Created)
+	pages, err := loadTestVault(t, tempVault).FindByUserID("33333")
+	assert.NoError(t, err)
+	assert.Len(t, pages, 1)
+}
+
+// TestSyncCmd_MatchByNameConcurrency is meant for go test -race: --match-by-name processes one user at a time whatever
+// --concurrency says, so only the first of two users with the same nickname claims the page
+func TestSyncCmd_MatchByNameConcurrency(t *testing.T) {
+	tempVault := t.TempDir()
+	davePath := filepath.Join(tempVault, "People", "Dave.md")
+	writeTestFile(t, davePath, "---\ntags:\n  - person\n---\n")
+	for i := range 20 {
+		writeTestFile(t, filepath.Join(tempVault, "People", fmt.Sprintf("Person %d.md", i)),
+			fmt.Sprintf("---\ntags:\n  - person\nurl: https://fetlife.com/users/%d\n---\n", 50000+i))
+	}
+	var blockeds strings.Builder
+	for i := range 20 {
+		fmt.Fprintf(&blockeds, "%d,2024-01-01,2024-01-01,Person %d\n", 50000+i, i)
+	}
+	blockeds.WriteString("11111,2024-01-01,2024-01-01,Dave\n22222,2024-01-01,2024-01-01,dave\n")
+
+	sync := &SyncCmd{
+		DataDir:         []string{writeTestData(t, blockeds.String(), "")},
+		CreatePeopleIn:  []string{"People"},
+		CreateBlockedIn: []string{"People"},
+		MatchByName:     true,
+		Concurrency:     8,
+		NoCache:         true,
+	}
+	assert.Equal(t, 1, sync.workers())
+	assert.NoError(t, sync.Run(loadTestVault(t, tempVault)))
+
+	dave, err := obsidian.LoadPage(davePath, tempVault)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://fetlife.com/users/11111", dave.Url)
+	assert.Empty(t, dave.UrlAliases)
+	assert.Equal(t, 1, sync.summary.Created, "the second Dave gets a page of their own")
+}
+
+func TestSyncCmd_MatchByNameAmbiguous(t *testing.T) {
+	tests := []struct {
+		strategy string
+		// linked is the page that gets the URL, empty when none does
+		linked string
+	}{
+		{strategy: "skip"},
+		{strategy: "first", linked: "Friends/Dave.md"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			tempVault := t.TempDir()
+			writeTestFile(t, filepath.Join(tempVault, "Friends", "Dave.md"), "---\ntags:\n  - person\n---\n")
+			writeTestFile(t, filepath.Join(tempVault, "People", "David.md"), "---\ntags:\n  - person\naliases:\n  - dave\n---\n")
+			dataDir := writeTestData(t, "44444,2024-01-01,2024-01-01,Dave\n", "")
+
+			sync := &SyncCmd{
+				DataDir:          []string{dataDir},
+				CreatePeopleIn:   []string{"People"},
+				CreateBlockedIn:  []string{"Bad People"},
+				ConflictStrategy: tt.strategy,
+				MatchByName:      true,
+			}
+			err := sync.Run(loadTestVault(t, tempVault))
+			assert.NoError(t, err)
+
+			// Neither strategy creates a page for the user
+			assert.Equal(t, 0, sync.summary.Created)
+			pages, err := loadTestVault(t, tempVault).FindByUserID("44444")
+			assert.NoError(t, err)
+			if tt.linked == "" {
+				assert.Empty(t, pages)
+				assert.Equal(t, 1, sync.summary.Skipped)
+				return
+			}
+			if assert.Len(t, pages, 1) {
+				assert.Equal(t, tt.linked, pageFile(pages[0]))
+			}
+		})
+	}
+}
+
+func TestSyncCmd_RenameStubs(t *testing.T) {
+	stub := func(userID string) string {
+		return "---\ntags:\n  - person\nurl: https://fetlife.com/users/" + userID + "\n---\n\n# Notes\n"
+	}
+	testDataDir := writeTestData(t, "22222,2024-01-01,2024-01-01,Bob\n", "")
+	writeTestFile(t, filepath.Join(testDataDir, "friends.txt"),
+		"friend_user_id,created_at,friend_nickname\n11111,2024-01-01,Alice\n")
+	writeTestFile(t, filepath.Join(testDataDir, "followers.csv"), "user_id,created_at,nickname\n33333,2024-01-01,Carol\n")
+
+	tests := []struct {
+		name        string
+		renameStubs bool
+		expected    map[string]string
+	}{
+		{
+			name: "stubs stay without --rename-stubs",
+			expected: map[string]string{
+				"user-11111": "11111",
+				"Bob":        "22222", // Blocked users always follow nickname changes
+				"user-33333": "33333",
+				"Carol":      "44444",
+			},
+		},
+		{
+			name:        "stubs renamed with --rename-stubs",
+			renameStubs: true,
+			expected: map[string]string{
+				"Alice":              "11111",
+				"Bob":                "22222",
+				"Carol (user 33333)": "33333",
+				"Carol":              "44444",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempVault := t.TempDir()
+			for _, userID := range []string{"11111", "22222", "33333"} {
+				writeTestFile(t, filepath.Join(tempVault, "People", stubTitle(userID)+".md"), stub(userID))
+			}
+			// Another Carol already has the nickname
+			writeTestFile(t, filepath.Join(tempVault, "People", "Carol.md"), stub("44444"))
+
+			sync := &SyncCmd{
+				DataDir:         []string{testDataDir},
+				CreatePeopleIn:  []string{"People"},
+				CreateBlockedIn: []string{"Bad People"},
+				CreateFriendsIn: "People",
+				RenameStubs:     tt.renameStubs,
+				NoCache:         true,
+			}
+			vault := loadTestVault(t, tempVault)
+			err := sync.Run(vault)
+			assert.NoError(t, err)
+
+			for title, userID := range tt.expected {
+				path := filepath.Join(tempVault, "People", title+".md")
+				page, err := obsidian.LoadPage(path, tempVault)
+				if !assert.NoError(t, err, title) {
+					continue
+				}
+				assert.Equal(t, obsidian.UserURL(userID), page.Url, title)
+				if tt.renameStubs && userID != "44444" {
+					assert.Contains(t, page.Aliases, stubTitle(userID), title)
+				}
+				assert.NotNil(t, vault.FindByTitleInFolder(title, "People"), title)
+			}
+			if tt.renameStubs {
+				assert.Equal(t, 3, sync.summary.StubsRenamed)
+			}
+		})
+	}
+}
+
+func TestSyncCmd_Recategorize(t *testing.T) {
+	page := func(tags, message string) string {
+		return "---\ntags:\n" + tags + "web-message: " + message + "\n---\n"
+	}
+	person := "  - person\n"
+	blocked := "  - person\n  - blocked\n"
+	testDataDir := writeTestData(t, "", "")
+
+	tests := []struct {
+		name                string
+		recategorizeBlocked bool
+		expected            []string
+		recategorized       int
+	}{
+		{
+			name:          "blocked pages stay",
+			expected:      []string{"Watch/Creep.md", "People/Nice.md", "People/Blocked.md", "Elsewhere/Other.md"},
+			recategorized: 1,
+		},
+		{
+			name:                "blocked pages move with --recategorize-blocked",
+			recategorizeBlocked: true,
+			expected:            []string{"Watch/Creep.md", "People/Nice.md", "Watch/Blocked.md", "Elsewhere/Other.md"},
+			recategorized:       2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempVault := t.TempDir()
+			writeTestFile(t, filepath.Join(tempVault, "People", "Creep.md"), page(person, "Very creepy"))
+			writeTestFile(t, filepath.Join(tempVault, "People", "Nice.md"), page(person, "Very nice"))
+			writeTestFile(t, filepath.Join(tempVault, "People", "Blocked.md"), page(blocked, "Creepy too"))
+			// Pages outside of the --create-people-in folders were put there by hand
+			writeTestFile(t, filepath.Join(tempVault, "Elsewhere", "Other.md"), page(person, "Also creepy"))
+
+			sync := &SyncCmd{
+				DataDir:             []string{testDataDir},
+				CreatePeopleIn:      []string{"People", "Watch:creepy"},
+				CreateBlockedIn:     []string{"Bad People"},
+				Recategorize:        true,
+				RecategorizeBlocked: tt.recategorizeBlocked,
+				NoCache:             true,
+			}
+			err := sync.Run(loadTestVault(t, tempVault))
+			assert.NoError(t, err)
+
+			for _, path := range tt.expected {
+				assert.FileExists(t, filepath.Join(tempVault, filepath.FromSlash(path)))
+			}
+			assert.Equal(t, tt.recategorized, sync.summary.Recategorized)
+		})
+	}
+
+	sync := &SyncCmd{RecategorizeBlocked: true}
+	assert.Error(t, sync.Validate())
+	sync = &SyncCmd{Recategorize: true, CreateOnly: true}
+	assert.Error(t, sync.Validate())
+}
+
+func TestSyncCmd_RemoveOrphans(t *testing.T) {
+	testDataDir := writeTestData(t, "", "12345,2024-01-01,2024-01-01,Met at a munch\n")
+
+	tests := []struct {
+		name    string
+		force   bool
+		input   string
+		deleted bool
+	}{
+		{name: "declined", input: "n\n", deleted: false},
+		{name: "confirmed", input: "y\n", deleted: true},
+		{name: "forced", force: true, deleted: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempVault := t.TempDir()
+			writeTestFile(t, filepath.Join(tempVault, "People", "Alice.md"), "---\ntags:\n  - person\nurl: https://fetlife.com/users/12345\n---\n")
+			writeTestFile(t, filepath.Join(tempVault, "People", "Gone.md"), "---\ntags:\n  - person\nurl: https://fetlife.com/users/99999\n---\n")
+			writeTestFile(t, filepath.Join(tempVault, "People", "Offline.md"), "---\ntags:\n  - person\n---\n")
+			writeTestFile(t, filepath.Join(tempVault, "Group.md"), "---\nurl: https://fetlife.com/users/88888\n---\n")
+
+			sync := &SyncCmd{
+				DataDir:         []string{testDataDir},
+				CreatePeopleIn:  []string{"People"},
+				CreateBlockedIn: []string{"Bad People"},
+				RemoveOrphans:   true,
+				Force:           tt.force,
+				NoCache:         true,
+				input:           strings.NewReader(tt.input),
+			}
+			var err error
+			out := capturer.CaptureStdout(func() {
+				err = sync.Run(loadTestVault(t, tempVault))
+			})
+			assert.NoError(t, err)
+
+			if tt.force {
+				assert.NotContains(t, out, "[y/N]")
+			} else {
+				assert.Contains(t, out, "People/Gone.md\n")
+				assert.Contains(t, out, "Delete these 1 pages")
+			}
+			if tt.deleted {
+				assert.NoFileExists(t, filepath.Join(tempVault, "People", "Gone.md"))
+				assert.Equal(t, 1, sync.summary.Deleted)
+			} else {
+				assert.FileExists(t, filepath.Join(tempVault, "People", "Gone.md"))
+				assert.Equal(t, 0, sync.summary.Deleted)
+			}
+
+			// Pages of users in the data, without a profile URL or without the person tag are kept
+			assert.FileExists(t, filepath.Join(tempVault, "People", "Alice.md"))
+			assert.FileExists(t, filepath.Join(tempVault, "People", "Offline.md"))
+			assert.FileExists(t, filepath.Join(tempVault, "Group.md"))
+		})
+	}
+}
+
+func TestSyncCmd_ReportOrphans(t *testing.T) {
+	tempVault := t.TempDir()
+	writeTestFile(t, filepath.Join(tempVault, "People", "Alice.md"), "---\ntags:\n  - person\nurl: https://fetlife.com/users/12345\n---\n")
+	writeTestFile(t, filepath.Join(tempVault, "People", "Gone.md"), "---\ntags:\n  - person\nurl: https://fetlife.com/users/99999\n---\n")
+	writeTestFile(t, filepath.Join(tempVault, "People", "Aliased.md"), "---\ntags:\n  - person\nurl: https://fetlife.com/users/77777\nurl-aliases:\n  - https://fetlife.com/users/12345\n---\n")
+	writeTestFile(t, filepath.Join(tempVault, "People", "Offline.md"), "---\ntags:\n  - person\n---\n")
+	writeTestFile(t, filepath.Join(tempVault, "Group.md"), "---\nurl: https://fetlife.com/users/88888\n---\n")
+
+	sync := &SyncCmd{
+		DataDir:         []string{writeTestData(t, "", "12345,2024-01-01,2024-01-01,Met at a munch\n")},
+		CreatePeopleIn:  []string{"People"},
+		CreateBlockedIn: []string{"Bad People"},
+		ReportOrphans:   true,
+		NoCache:         true,
+	}
+	var err error
+	out := capturer.CaptureStdout(func() {
+		err = sync.Run(loadTestVault(t, tempVault))
+	})
+	assert.NoError(t, err)
+
+	// Only the page whose URL and aliases match no record is reported, and nothing is deleted
+	assert.Contains(t, out, "1 pages with users that aren't in the data files:\n")
+	assert.Contains(t, out, "Gone\tPeople/Gone.md\t99999\n")
+	assert.NotContains(t, out, "Aliased\t")
+	assert.NotContains(t, out, "Group\t")
+	assert.FileExists(t, filepath.Join(tempVault, "People", "Gone.md"))
+	assert.Equal(t, 0, sync.summary.Deleted)
+
+	sync = &SyncCmd{Only: []string{"notes"}, ReportOrphans: true}
+	assert.Error(t, sync.Validate())
+}
+
+func TestSyncCmd_BlockedColor(t *testing.T) {
+	tempVault := t.TempDir()
+	davePath := filepath.Join(tempVault, "Bad People", "Dave.md")
+	writeTestFile(t, davePath, "---\ntags:\n  - person\nurl: https://fetlife.com/users/11111\n---\n")
+	erinPath := filepath.Join(tempVault, "Bad People", "Erin.md")
+	writeTestFile(t, erinPath, "---\ntags:\n  - person\nurl: https://fetlife.com/users/22222\nweb-badge-color: \"#4CAF50\"\n---\n")
+	testDataDir := writeTestData(t, "11111,2024-01-01,2024-01-01,Dave\n22222,2024-01-01,2024-01-01,Erin\n", "")
+
+	sync := &SyncCmd{
+		DataDir:         []string{testDataDir},
+		CreatePeopleIn:  []string{"People"},
+		CreateBlockedIn: []string{"Bad People"},
+		BlockedColor:    "#000000",
+		NoCache:         true,
+		now:             fixedNow,
+	}
+	assert.NoError(t, sync.Run(loadTestVault(t, tempVault)))
+
+	// Dave's page had no color and gets the --blocked-color, Erin's keeps hers
+	for path, color := range map[string]string{davePath: "web-badge-color: '#000000'\n", erinPath: "web-badge-color: '#4CAF50'\n"} {
+		content, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		assert.Contains(t, string(content), color)
+		assert.Equal(t, 1, strings.Count(string(content), "web-badge-color"))
+	}
+
+	sync.BlockedColor = "red"
+	assert.ErrorContains(t, sync.Validate(), `invalid --blocked-color "red"`)
+}
+
+func TestParseFolderColors(t *testing.T) {
+	tests := []struct {
+		name     string
+		configs  map[string]string
+		expected map[string]obsidian.Color
+		err      string
+	}{
+		{name: "none", expected: map[string]obsidian.Color{}},
+		{
+			name:     "folders",
+			configs:  map[string]string{"Bad People": "#F44336", " Friends/ ": " #4caf50", "Kink:Munch": "#FFF"},
+			expected: map[string]obsidian.Color{"Bad People": "#F44336", "Friends": "#4caf50", "Kink:Munch": "#FFF"},
+		},
+		{name: "no folder", configs: map[string]string{"": "#F44336"}, err: `invalid --assign-color "=#F44336", the folder is missing`},
+		{name: "color name", configs: map[string]string{"Bad People": "red"}, err: `invalid color "red" for folder "Bad People" in --assign-color`},
+		{name: "no hash", configs: map[string]string{"Bad People": "F44336"}, err: `invalid color "F44336"`},
+		{name: "too long", configs: map[string]string{"Bad People": "#F443366"}, err: `invalid color "#F443366"`},
+		{name: "not hex", configs: map[string]string{"Bad People": "#GGGGGG"}, err: `invalid color "#GGGGGG"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			colors, err := parseFolderColors("--assign-color", tt.configs)
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, colors)
+		})
+	}
+}
+
+func TestSyncCmd_AssignColor(t *testing.T) {
+	tempVault := t.TempDir()
+	writeTestFile(t, filepath.Join(tempVault, "Templates", "People.md"),
+		"---\ntags:\n  - person\nweb-badge-color: \"#F44336\"\n---\n")
+	carolPath := filepath.Join(tempVault, "Bad People", "Carol.md")
+	carol := "---\ntags:\n  - person\n  - blocked\nurl: https://fetlife.com/users/33333\nweb-badge-color: '#4CAF50'\nblocked-date: \"2024-01-01\"\nblocked-at: \"2024-01-01\"\n---\n"
+	writeTestFile(t, carolPath, carol)
+	testDataDir := writeTestData(t, "11111,2024-01-01,2024-01-01,Dave\n33333,2024-01-01,2024-01-01,Carol\n",
+		"22222,2024-01-01,2024-01-01,Nice person\n")
+
+	sync := &SyncCmd{
+		DataDir:         []string{testDataDir},
+		CreatePeopleIn:  []string{"People"},
+		CreateBlockedIn: []string{"Bad People"},
+		AssignColor:     map[string]string{"Bad People": "#000000"},
+		FolderColor:     map[string]string{"Bad People": "#FFFFFF"},
+		NoCache:         true,
+	}
+	assert.NoError(t, sync.Validate())
+	assert.NoError(t, sync.Run(loadTestVault(t, tempVault)))
+
+	// The new page in Bad People gets the assigned color instead of the template's, the one in People keeps the
+	// template's, and Carol's existing page keeps hers
+	dave, err := obsidian.LoadPage(filepath.Join(tempVault, "Bad People", "Dave.md"), tempVault)
+	assert.NoError(t, err)
+	assert.Equal(t, obsidian.Color("#000000"), dave.WebBadgeColor)
+	stub, err := obsidian.LoadPage(filepath.Join(tempVault, "People", "user-22222.md"), tempVault)
+	assert.NoError(t, err)
+	assert.Equal(t, obsidian.Color("#F44336"), stub.WebBadgeColor)
+	content, err := os.ReadFile(carolPath)
+	assert.NoError(t, err)
+	assert.Equal(t, carol, string(content))
+
+	sync.AssignColor = map[string]string{"Bad People": "red"}
+	assert.ErrorContains(t, sync.Validate(), `invalid color "red" for folder "Bad People" in --assign-color`)
+}
+
+func TestSyncCmd_FolderColor(t *testing.T) {
+	tempVault := t.TempDir()
+	writeTestFile(t, filepath.Join(tempVault, "People", "Frank.md"), "---\nurl: https://fetlife.com/users/98765\n---\n")
+	writeTestFile(t, filepath.Join(tempVault, "People", "George.md"), "---\nurl: https://fetlife.com/users/87654\nweb-badge-color: \"#FFEB3B\"\n---\n")
+
+	testDataDir := writeTestData(t,
+		"98765,2024-01-01,2024-01-01,Frank\n87654,2024-01-01,2024-01-01,George\n76543,2024-01-01,2024-01-01,Helen\n",
+		"12345,2024-01-01,2024-01-01,Met at a munch\n")
+
+	sync := &SyncCmd{
+		DataDir:         []string{testDataDir},
+		CreatePeopleIn:  []string{"People", "Friends:munch"},
+		CreateBlockedIn: []string{"Bad People"},
+		FolderColor:     map[string]string{"Bad People": "#F44336", "Friends": "#4CAF50"},
+		NoCache:         true,
+	}
+	assert.NoError(t, sync.Validate())
+	err := sync.Run(loadTestVault(t, tempVault))
+	assert.NoError(t, err)
+
+	tests := []struct {
+		file  string
+		color obsidian.Color
+	}{
+		// Existing page of a blocked user without a color
+		{file: "People/Frank.md", color: "#F44336"},
+		// A color set by hand is kept
+		{file: "People/George.md", color: "#FFEB3B"},
+		// New pages get the color of their folder
+		{file: "Bad People/Helen.md", color: "#F44336"},
+		{file: "Friends/user-12345.md", color: "#4CAF50"},
+	}
+	for _, tt := range tests {
+		page, err := obsidian.LoadPage(filepath.Join(tempVault, filepath.FromSlash(tt.file)), tempVault)
+		if assert.NoError(t, err) {
+			assert.Equal(t, tt.color, page.WebBadgeColor, tt.file)
+		}
+	}
+
+	sync.FolderColor = map[string]string{"Bad People": "red"}
+	assert.ErrorContains(t, sync.Validate(), `invalid color "red" for folder "Bad People"`)
+}
+
+func TestSyncCmd_ColorPrecedence(t *testing.T) {
+	tempVault := t.TempDir()
+	writeTestFile(t, filepath.Join(tempVault, "Templates", "Bad People.md"),
+		"---\ntags:\n  - person\nweb-badge-color: \"#111111\"\n---\n")
+	rulesPath := filepath.Join(t.TempDir(), "rules.yaml")
+	writeTestFile(t, rulesPath, "- folder: People\n- folder: Rope\n  keywords: [rope]\n  color: \"#222222\"\n")
+	dataDir := writeTestData(t,
+		"11111,2024-01-01,2024-01-01,Dave\n22222,2024-01-01,2024-01-01,Erin\n33333,2024-01-01,2024-01-01,Frank\n",
+		"44444,2024-01-01,2024-01-01,Great at rope\n55555,2024-01-01,2024-01-01,Met at a munch\n")
+
+	sync := &SyncCmd{
+		DataDir:         []string{dataDir},
+		CreateBlockedIn: []string{"Bad People", "Event Bans:erin", "Kink Bans:frank"},
+		RulesFile:       rulesPath,
+		FolderColor:     map[string]string{"Bad People": "#333333", "Event Bans": "#444444", "Rope": "#555555"},
+		AssignColor:     map[string]string{"Bad People": "#666666"},
+		BlockedColor:    "#777777",
+		NoCache:         true,
+	}
+	assert.NoError(t, sync.Validate())
+	assert.NoError(t, sync.Run(loadTestVault(t, tempVault)))
+
+	for file, color := range map[string]obsidian.Color{
+		// --assign-color replaces the template's color
+		"Bad People/Dave.md": "#666666",
+		// Without a template color, --folder-color is used
+		"Event Bans/Erin.md": "#444444",
+		// Without a folder color, blocked users get --blocked-color
+		"Kink Bans/Frank.md": "#777777",
+		// The color of a rule replaces the --folder-color of its folder
+		"Rope/user-44444.md": "#222222",
+		// Other pages have no color
+		"People/user-55555.md": "",
+	} {
+		page, err := obsidian.LoadPage(filepath.Join(tempVault, filepath.FromSlash(file)), tempVault)
+		if assert.NoError(t, err, file) {
+			assert.Equal(t, color, page.WebBadgeColor, file)
+		}
+	}
+}
+
+func TestSyncCmd_PruneBlocked(t *testing.T) {
+	tempVault := t.TempDir()
+	blockedPage := func(url string) string {
+		return "---\ntags:\n  - person\n  - blocked\nurl: " + url + "\nblocked-date: \"2023-01-01\"\n---\n\n# Notes\n"
+	}
+	writeTestFile(t, filepath.Join(tempVault, "Bad People", "Frank.md"), blockedPage("https://fetlife.com/users/98765"))
+	writeTestFile(t, filepath.Join(tempVault, "Bad People", "George.md"), blockedPage("https://fetlife.com/users/87654"))
+	writeTestFile(t, filepath.Join(tempVault, "Bad People", "Offline.md"), blockedPage("https://example.com/offline"))
+
+	testDataDir := writeTestData(t, "98765,2024-01-01,2024-01-01,Frank\n", "")
+
+	sync := &SyncCmd{
+		DataDir:         []string{testDataDir},
+		CreatePeopleIn:  []string{"People"},
+		CreateBlockedIn: []string{"Bad People"},
+		PruneBlocked:    true,
+		NoCache:         true,
+	}
+	err := sync.Run(loadTestVault(t, tempVault))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"George"}, sync.summary.Pruned)
+
+	// George was unblocked, the page is kept without its blocked status
+	george, err := obsidian.LoadPage(filepath.Join(tempVault, "Bad People", "George.md"), tempVault)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"person"}, george.Tags)
+	assert.Empty(t, george.BlockedDate)
+	assert.Empty(t, george.BlockedAt)
+	assert.Equal(t, "\n# Notes\n", george.Content)
+
+	// Frank is still blocked and the page without a FetLife profile is left alone
+	for _, title := range []string{"Frank", "Offline"} {
+		page, err := obsidian.LoadPage(filepath.Join(tempVault, "Bad People", title+".md"), tempVault)
+		assert.NoError(t, err)
+		assert.Contains(t, page.Tags, "blocked", title)
+		assert.NotEmpty(t, page.BlockedDate, title)
+	}
+
+	sync.CreateOnly = true
+	assert.Error(t, sync.Validate())
+}
+
+func TestSyncCmd_KeepsBody(t *testing.T) {
+	tempVault := t.TempDir()
+	bodies := map[string]string{
+		"Frank": "\n# Frank  \n\nMet at a munch   \n\t- rope\t\n",
+		"Grace": "\n# Grace\n\n\tIndented line\n\nNo final newline",
+	}
+	writeTestFile(t, filepath.Join(tempVault, "People", "Frank.md"),
+		"---\ntags: [person]\nurl: https://fetlife.com/users/98765\n---\n"+bodies["Frank"])
+	writeTestFile(t, filepath.Join(tempVault, "People", "Grace.md"),
+		"---\ntags: [person]\nurl: https://fetlife.com/users/87654\n---\n"+bodies["Grace"])
+	dataDir := writeTestData(t, "98765,2024-01-01,2024-01-01,Frank\n87654,2024-01-01,2024-01-01,Grace\n", "")
+
+	sync := &SyncCmd{
+		DataDir:         []string{dataDir},
+		CreatePeopleIn:  []string{"People"},
+		CreateBlockedIn: []string{"Bad People"},
+		NoCache:         true,
+	}
+	assert.NoError(t, sync.Run(loadTestVault(t, tempVault)))
+	assert.Equal(t, 2, sync.summary.Updated)
+
+	// Only the frontmatter is rewritten, everything after the closing --- stays byte for byte
+	for title, body := range bodies {
+		content, err := os.ReadFile(filepath.Join(tempVault, "People", title+".md"))
+		assert.NoError(t, err)
+		assert.Contains(t, string(content), "  - blocked\n", title)
+		assert.True(t, strings.HasSuffix(string(content), "\n---\n"+body), "%s body changed: %q", title, content)
+	}
+}
+
+func TestSyncCmd_Only(t *testing.T) {
+	frankContent := "---\ntags:\n  - person\nurl: https://fetlife.com/users/98765\n---\n\n# Notes\n"
+	aliceContent := "---\ntags:\n  - person\nurl: https://fetlife.com/users/12345\n---\n\n# Notes\n"
+
+	// Only blockeds.txt exists, which is enough when only blocked users are synced
+	tempVault := t.TempDir()
+	frankPath := filepath.Join(tempVault, "People", "Frank.md")
+	writeTestFile(t, frankPath, frankContent)
+	testDataDir := t.TempDir()
+	writeTestFile(t, filepath.Join(testDataDir, "blockeds.txt"),
+		"blocked_user_id,created_at,updated_at,blocked_nickname\n98765,2024-01-01,2024-01-01,Frank\n")
+
+	sync := &SyncCmd{
+		DataDir:         []string{testDataDir},
+		CreatePeopleIn:  []string{"People"},
+		CreateBlockedIn: []string{"Bad People"},
+		NoCache:         true,
+	}
+	err := sync.Run(loadTestVault(t, tempVault))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	sync.Only = []string{"blocked"}
+	err = sync.Run(loadTestVault(t, tempVault))
+	assert.NoError(t, err)
+	frank, err := obsidian.LoadPage(frankPath, tempVault)
+	assert.NoError(t, err)
+	assert.Contains(t, frank.Tags, "blocked")
+
+	// Skipping blocked users only syncs the private notes
+	tempVault = t.TempDir()
+	frankPath = filepath.Join(tempVault, "People", "Frank.md")
+	alicePath := filepath.Join(tempVault, "People", "Alice.md")
+	writeTestFile(t, frankPath, frankContent)
+	writeTestFile(t, alicePath, aliceContent)
+	sync.DataDir = []string{writeTestData(t, "98765,2024-01-01,2024-01-01,Frank\n",
+		"12345,2024-01-01 10:00:00 UTC,2024-01-01 10:00:00 UTC,Met at a munch\n")}
+	sync.Only = nil
+	sync.Skip = []string{"blocked"}
+	err = sync.Run(loadTestVault(t, tempVault))
+	assert.NoError(t, err)
+
+	frank, err = obsidian.LoadPage(frankPath, tempVault)
+	assert.NoError(t, err)
+	assert.NotContains(t, frank.Tags, "blocked")
+	alice, err := obsidian.LoadPage(alicePath, tempVault)
+	assert.NoError(t, err)
+	assert.Equal(t, "Met at a munch", alice.WebMessage)
+
+	// Pruning needs every blocked user and removing orphans every user
+	sync.PruneBlocked = true
+	assert.Error(t, sync.Validate())
+	sync.PruneBlocked = false
+	sync.RemoveOrphans = true
+	assert.Error(t, sync.Validate())
+}
+
+func TestSyncCmd_ZipArchive(t *testing.T) {
+	tempVault := t.TempDir()
+	archivePath := filepath.Join(t.TempDir(), "fetlife-export.zip")
+
+	file, err := os.Create(archivePath)
+	assert.NoError(t, err)
+	archive := zip.NewWriter(file)
+	for name, content := range map[string]string{
+		"export/blockeds.txt":      "blocked_user_id,created_at,updated_at,blocked_nickname\n98765,2024-01-01,2024-01-01,Frank\n",
+		"export/private_notes.txt": "member_id,created_at,updated_at,private_note\n12345,2024-01-01,2024-01-01,Met at a munch\n",
+	} {
+		writer, err := archive.Create(name)
+		assert.NoError(t, err)
+		_, err = writer.Write([]byte(content))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, archive.Close())
+	assert.NoError(t, file.Close())
+
+	sync := &SyncCmd{
+		DataDir:         []string{archivePath},
+		CreatePeopleIn:  []string{"People"},
+		CreateBlockedIn: []string{"Bad People"},
+	}
+	assert.NoError(t, sync.Validate())
+	err = sync.Run(loadTestVault(t, tempVault))
+	assert.NoError(t, err)
+
+	// The files are found in the folder of the archive, and the state is kept next to it
+	assert.FileExists(t, filepath.Join(tempVault, "Bad People", "Frank.md"))
+	page, err := obsidian.LoadPage(filepath.Join(tempVault, "People", "user-12345.md"), tempVault)
+	assert.NoError(t, err)
+	assert.Equal(t, "Met at a munch", page.WebMessage)
+	assert.FileExists(t, filepath.Join(filepath.Dir(archivePath), stateFileName))
+
+	// Other files aren't data directories
+	textPath := filepath.Join(t.TempDir(), "blockeds.txt")
+	writeTestFile(t, textPath, "")
+	sync.DataDir = []string{textPath}
+	assert.Error(t, sync.Validate())
+}
+
+// gzipped compresses content with gzip
+func gzipped(t *testing.T, content string) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	_, err := writer.Write([]byte(content))
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+	return buffer.Bytes()
+}
+
+func TestSyncCmd_GzipDataFiles(t *testing.T) {
+	blockeds := "blocked_user_id,created_at,updated_at,blocked_nickname\n98765,2024-01-01,2024-01-01,Frank\n"
+	notes := "member_id,created_at,updated_at,private_note\n12345,2024-01-01,2024-01-01,Met at a munch\n"
+
+	// The readers decompress any gzip input, plain input is read as is
+	records, err := fetlife.ReadBlockedsFromReader(bytes.NewReader(gzipped(t, blockeds)))
+	assert.NoError(t, err)
+	assert.Equal(t, []fetlife.BlockedRecord{{UserID: "98765", CreatedAt: "2024-01-01", UpdatedAt: "2024-01-01", Nickname: "Frank"}}, records)
+	plain, err := fetlife.ReadBlockedsFromReader(strings.NewReader(blockeds))
+	assert.NoError(t, err)
+	assert.Equal(t, records, plain)
+	_, err = fetlife.ReadPrivateNotesFromReader(strings.NewReader(blockeds))
+	assert.ErrorContains(t, err, "unexpected header")
+
+	// blockeds.txt.gz is read when there's no blockeds.txt, and a compressed private_notes.txt is found by its content
+	dataDir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dataDir, "blockeds.txt.gz"), gzipped(t, blockeds), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dataDir, "private_notes.txt"), gzipped(t, notes), 0644))
+	size, err := fetlife.DataFileSize(dataDir, "blockeds.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(blockeds)), size, "the uncompressed size")
+
+	for _, streaming := range []string{"never", "always"} {
+		tempVault := t.TempDir()
+		sync := &SyncCmd{
+			DataDir:         []string{dataDir},
+			CreatePeopleIn:  []string{"People"},
+			CreateBlockedIn: []string{"Bad People"},
+			Streaming:       streaming,
+			StateFile:       filepath.Join(t.TempDir(), "state.json"),
+		}
+		assert.NoError(t, sync.Run(loadTestVault(t, tempVault)), streaming)
+		assert.FileExists(t, filepath.Join(tempVault, "Bad People", "Frank.md"), streaming)
+		page, err := obsidian.LoadPage(filepath.Join(tempVault, "People", "user-12345.md"), tempVault)
+		assert.NoError(t, err, streaming)
+		assert.Equal(t, "Met at a munch", page.WebMessage, streaming)
+	}
+}
+
+func TestSyncCmd_Lenient(t *testing.T) {
+	tempVault := t.TempDir()
+	alicePath := filepath.Join(tempVault, "People", "Alice.md")
+	writeTestFile(t, alicePath, "---\ntags:\n  - person\nurl: https://fetlife.com/users/12345\n---\n")
+
+	// A private_notes.txt with an unexpected header is probably another file
+	testDataDir := writeTestData(t, "", "")
+	writeTestFile(t, filepath.Join(testDataDir, "private_notes.txt"),
+		"user_id,created_at,updated_at,note\n12345,2024-01-01,2024-01-01,Met at a munch\n")
+
+	sync := &SyncCmd{
+		DataDir:        []string{testDataDir},
+		CreatePeopleIn: []string{"People"},
+		NoCache:        true,
+	}
+	err := sync.Run(loadTestVault(t, tempVault))
+	assert.ErrorContains(t, err, `unexpected header "user_id" at column 0, expected "member_id"`)
+
+	sync.Lenient = true
+	err = sync.Run(loadTestVault(t, tempVault))
+	assert.NoError(t, err)
+	alice, err := obsidian.LoadPage(alicePath, tempVault)
+	assert.NoError(t, err)
+	assert.Equal(t, "Met at a munch", alice.WebMessage)
+}
+
+func TestSyncCmd_UserIDAndLimit(t *testing.T) {
+	page := func(userID string) string {
+		return "---\ntags:\n  - person\nurl: https://fetlife.com/users/" + userID + "\n---\n\n# Notes\n"
+	}
+	testDataDir := writeTestData(t, "", "11111,2024-01-01,2024-01-01,First\n"+
+		"22222,2024-01-01,2024-01-01,Second\n"+
+		"33333,2024-01-01,2024-01-01,Third\n")
+
+	tests := []struct {
+		name    string
+		userIDs []string
+		limit   int
+		synced  []string
+	}{
+		{name: "user IDs", userIDs: []string{"22222", "33333"}, synced: []string{"Second", "Third"}},
+		{name: "limit", limit: 2, synced: []string{"First", "Second"}},
+		{name: "user IDs and limit", userIDs: []string{"22222", "33333"}, limit: 1, synced: []string{"Second"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempVault := t.TempDir()
+			titles := map[string]string{"First": "11111", "Second": "22222", "Third": "33333"}
+			for title, userID := range titles {
+				writeTestFile(t, filepath.Join(tempVault, "People", title+".md"), page(userID))
+			}
+
+			sync := &SyncCmd{
+				DataDir:         []string{testDataDir},
+				CreatePeopleIn:  []string{"People"},
+				CreateBlockedIn: []string{"Bad People"},
+				UserID:          tt.userIDs,
+				Limit:           tt.limit,
+				NoCache:         true,
+			}
+			err := sync.Run(loadTestVault(t, tempVault))
+			assert.NoError(t, err)
+			assert.Equal(t, len(tt.synced), sync.summary.Updated)
+
+			for title := range titles {
+				page, err := obsidian.LoadPage(filepath.Join(tempVault, "People", title+".md"), tempVault)
+				assert.NoError(t, err)
+				if slices.Contains(tt.synced, title) {
+					assert.Equal(t, title, page.WebMessage)
+				} else {
+					assert.Empty(t, page.WebMessage, title)
+				}
+			}
+		})
+	}
+
+	sync := &SyncCmd{Limit: 1, PruneBlocked: true}
+	assert.Error(t, sync.Validate())
+	sync = &SyncCmd{UserID: []string{"11111"}, RemoveOrphans: true}
+	assert.Error(t, sync.Validate())
+	sync = &SyncCmd{Limit: -1}
+	assert.Error(t, sync.Validate())
+}
+
+func TestSyncCmd_Since(t *testing.T) {
+	tempVault := t.TempDir()
+	dataDir := writeTestData(t,
+		"11111,2024-01-01 10:00:00 UTC,2024-01-01 10:00:00 UTC,OldBlock\n"+
+			"22222,2024-01-01 10:00:00 UTC,2024-06-01 00:00:00 UTC,UpdatedBlock\n"+
+			"33333,yesterday,yesterday,BadDate\n",
+		"44444,2024-05-31 23:59:59 UTC,,Old note\n"+
+			"55555,2024-06-15,,New note\n"+
+			"66666,2023-01-01 09:00:00 UTC,2024-07-01T08:00:00Z,Updated note\n")
+
+	sync := &SyncCmd{
+		DataDir:         []string{dataDir},
+		CreatePeopleIn:  []string{"People"},
+		CreateBlockedIn: []string{"Bad People"},
+		Since:           "2024-06-01",
+	}
+	assert.NoError(t, sync.Validate())
+	err := sync.Run(loadTestVault(t, tempVault))
+	assert.NoError(t, err)
+
+	// Records are kept by updated_at, or created_at without one, and unreadable dates are skipped
+	assert.Equal(t, 3, sync.summary.Created)
+	assert.NoFileExists(t, filepath.Join(tempVault, "Bad People", "OldBlock.md"))
+	assert.FileExists(t, filepath.Join(tempVault, "Bad People", "UpdatedBlock.md"))
+	assert.NoFileExists(t, filepath.Join(tempVault, "Bad People", "BadDate.md"))
+	assert.NoFileExists(t, filepath.Join(tempVault, "People", "user-44444.md"))
+	assert.FileExists(t, filepath.Join(tempVault, "People", "user-55555.md"))
+	assert.FileExists(t, filepath.Join(tempVault, "People", "user-66666.md"))
+
+	sync = &SyncCmd{Since: "June 1st"}
+	assert.Error(t, sync.Validate())
+	sync = &SyncCmd{Since: "2024-06-01", ReportOrphans: true}
+	assert.Error(t, sync.Validate())
+	sync = &SyncCmd{Since: "2024-06-01", PruneBlocked: true}
+	assert.Error(t, sync.Validate())
+}
+
+func TestResolveConflict(t *testing.T) {
+	tempVault := t.TempDir()
+	older := filepath.Join(tempVault, "People", "Frank.md")
+	newer := filepath.Join(tempVault, "Bad People", "Frank.md")
+	writeTestFile(t, older, "")
+	writeTestFile(t, newer, "")
+	assert.NoError(t, os.Chtimes(older, time.Now(), time.Now().Add(-time.Hour)))
+	vault := loadTestVault(t, tempVault)
+
+	oldPage := vault.FindByTitleInFolder("Frank", "People")
+	newPage := vault.FindByTitleInFolder("Frank", "Bad People")
+	conflict := []*obsidian.Page{oldPage, newPage}
+
+	page, err := resolveConflict(conflict, "skip")
+	assert.NoError(t, err)
+	assert.Nil(t, page)
+
+	page, err = resolveConflict(conflict, "first")
+	assert.NoError(t, err)
+	assert.Same(t, oldPage, page)
+
+	page, err = resolveConflict(conflict, "newest")
+	assert.NoError(t, err)
+	assert.Same(t, newPage, page)
+
+	_, err = resolveConflict(conflict, "error")
+	assert.ErrorIs(t, err, errConflict)
+	assert.ErrorContains(t, err, "People/Frank.md, Bad People/Frank.md")
+
+	_, err = resolveConflict(conflict, "random")
+	assert.Error(t, err)
+}
+
+func TestSyncCmd_ConflictStrategy(t *testing.T) {
+	testDataDir := writeTestData(t, "98765,2024-01-01,2024-01-01,Frank\n", "55555,2024-01-01,2024-01-01,Bob from the party\n")
+	frankContent := "---\ntags:\n  - person\nurl: https://fetlife.com/users/98765\n---\n"
+
+	tests := []struct {
+		strategy string
+		// blocked lists the pages that end up with the blocked tag
+		blocked []string
+		err     bool
+	}{
+		{strategy: "skip"},
+		{strategy: "first", blocked: []string{"Frank"}},
+		{strategy: "error", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			tempVault := t.TempDir()
+			writeTestFile(t, filepath.Join(tempVault, "People", "Frank.md"), frankContent)
+			writeTestFile(t, filepath.Join(tempVault, "People", "Frankie.md"), frankContent)
+
+			sync := &SyncCmd{
+				DataDir:          []string{testDataDir},
+				CreatePeopleIn:   []string{"People"},
+				CreateBlockedIn:  []string{"Bad People"},
+				ConflictStrategy: tt.strategy,
+				NoCache:          true,
+			}
+			err := sync.Run(loadTestVault(t, tempVault))
+			if tt.err {
+				assert.ErrorIs(t, err, errConflict)
+				// The sync stopped before the private notes
+				assert.NoFileExists(t, filepath.Join(tempVault, "People", "user-55555.md"))
+				return
+			}
+			assert.NoError(t, err)
+			assert.FileExists(t, filepath.Join(tempVault, "People", "user-55555.md"))
+
+			var blocked []string
+			for _, page := range loadTestVault(t, tempVault).WithTag("blocked") {
+				blocked = append(blocked, page.Title)
+			}
+			assert.Equal(t, tt.blocked, blocked)
+		})
+	}
+}
+
+func TestSyncCmd_NoteTarget(t *testing.T) {
+	aliceContent := "---\ntags:\n  - person\nurl: https://fetlife.com/users/12345\n---\n\n# Alice\n\n## Log\n\nMet in 2023\n"
+	section := "## FetLife Private Note\n\nMet at a munch\n\nSecond paragraph\n\n" +
+		"- Created: 2024-01-01 10:00:00 UTC\n- Updated: 2024-02-01 10:00:00 UTC\n"
+	testDataDir := writeTestData(t, "",
+		"12345,2024-01-01 10:00:00 UTC,2024-02-01 10:00:00 UTC,\"Met at a munch\n\nSecond paragraph\"\n")
+
+	tests := []struct {
+		target     string
+		webMessage string
+		content    string
+	}{
+		{target: "web-message", webMessage: "Met at a munch\n\nSecond paragraph", content: "\n# Alice\n\n## Log\n\nMet in 2023\n"},
+		{target: "body", webMessage: "", content: "\n# Alice\n\n## Log\n\nMet in 2023\n\n" + section},
+		{target: "both", webMessage: "Met at a munch\n\nSecond paragraph", content: "\n# Alice\n\n## Log\n\nMet in 2023\n\n" + section},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			tempVault := t.TempDir()
+			alicePath := filepath.Join(tempVault, "People", "Alice.md")
+			writeTestFile(t, alicePath, aliceContent)
+
+			sync := &SyncCmd{
+				DataDir:         []string{testDataDir},
+				CreatePeopleIn:  []string{"People"},
+				CreateBlockedIn: []string{"Bad People"},
+				NoteTarget:      tt.target,
+				NoteMode:        "overwrite",
+				NoCache:         true,
+			}
+
+			// Syncing twice replaces the section instead of adding another one
+			for range 2 {
+				err := sync.Run(loadTestVault(t, tempVault))
+				assert.NoError(t, err)
+
+				alice, err := obsidian.LoadPage(alicePath, tempVault)
+				assert.NoError(t, err)
+				assert.Equal(t, tt.webMessage, alice.WebMessage)
+				assert.Equal(t, tt.content, alice.Content)
+				assert.Equal(t, "2024-02-01 10:00:00 UTC", alice.NoteUpdated)
+			}
+		})
+	}
+}
+
+func TestSyncCmd_UserIDPrefixes(t *testing.T) {
+	tempVault := t.TempDir()
+	alicePath := filepath.Join(tempVault, "People", "Alice.md")
+	aliceContent := "---\ntags:\n  - person\nurl: https://fetlife.com/users/12345\n---\n"
+	writeTestFile(t, alicePath, aliceContent)
+	bobPath := filepath.Join(tempVault, "People", "Bob.md")
+	writeTestFile(t, bobPath, "---\ntags:\n  - person\nurl: https://fetlife.com/users/123/about\n---\n")
+
+	// 123 and 1234 are prefixes of Alice's ID, only 123 has a page
+	dataDir := writeTestData(t, "",
+		"123,2024-01-01,2024-01-01,Bob's note\n1234,2024-01-01,2024-01-01,Someone else\n")
+	sync := &SyncCmd{
+		DataDir:        []string{dataDir},
+		CreatePeopleIn: []string{"People"},
+	}
+	err := sync.Run(loadTestVault(t, tempVault))
+	assert.NoError(t, err)
+
+	content, err := os.ReadFile(alicePath)
+	assert.NoError(t, err)
+	assert.Equal(t, aliceContent, string(content))
+
+	bob, err := obsidian.LoadPage(bobPath, tempVault)
+	assert.NoError(t, err)
+	assert.Equal(t, "Bob's note", bob.WebMessage)
+
+	created, err := obsidian.LoadPage(filepath.Join(tempVault, "People", "user-1234.md"), tempVault)
+	assert.NoError(t, err)
+	assert.Equal(t, "Someone else", created.WebMessage)
+	assert.Equal(t, 1, sync.summary.Created)
+}
+
+func TestSyncCmd_FolderTags(t *testing.T) {
+	tempVault := t.TempDir()
+	writeTestFile(t, filepath.Join(tempVault, "Bad People", "Frank.md"),
+		"---\ntags:\n  - person\n  - blocked\n  - Avoid\nurl: https://fetlife.com/users/11111\n---\n")
+	writeTestFile(t, filepath.Join(tempVault, "People", "Alice.md"),
+		"---\ntags:\n  - person\nurl: https://fetlife.com/users/12345\n---\n")
+	dataDir := writeTestData(t, "11111,2024-01-01,2024-01-01,Frank\n22222,2024-01-01,2024-01-01,Mallory\n",
+		"12345,2024-01-01,2024-01-01,Met at a munch\n")
+
+	sync := &SyncCmd{
+		DataDir:         []string{dataDir},
+		CreatePeopleIn:  []string{"People"},
+		CreateBlockedIn: []string{"Bad People"},
+		FolderTags:      map[string]string{"Bad People": "avoid, do-not-engage"},
+	}
+	assert.NoError(t, sync.Validate())
+	err := sync.Run(loadTestVault(t, tempVault))
+	assert.NoError(t, err)
+
+	// The existing page keeps its own spelling of a tag it already has
+	frank, err := obsidian.LoadPage(filepath.Join(tempVault, "Bad People", "Frank.md"), tempVault)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"person", "blocked", "Avoid", "do-not-engage"}, frank.Tags)
+
+	mallory, err := obsidian.LoadPage(filepath.Join(tempVault, "Bad People", "Mallory.md"), tempVault)
+	assert.NoError(t, err)
+	assert.Contains(t, mallory.Tags, "avoid")
+	assert.Contains(t, mallory.Tags, "do-not-engage")
+
+	// Pages in other folders don't get the tags
+	alice, err := obsidian.LoadPage(filepath.Join(tempVault, "People", "Alice.md"), tempVault)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"person"}, alice.Tags)
+
+	sync.FolderTags = map[string]string{"Bad People": " , "}
+	assert.Error(t, sync.Validate())
+	sync.FolderTags = map[string]string{"Bad People": "do not engage"}
+	assert.Error(t, sync.Validate())
+}
+
+func TestSyncCmd_OnConflict(t *testing.T) {
+	aliceContent := "---\ntags:\n  - person\nurl: https://fetlife.com/users/12345\nweb-message: Met at a munch\n---\n\n# Alice\n"
+	bobContent := "---\ntags:\n  - person\nurl: https://fetlife.com/users/55555\nweb-message: Bob likes rope\n---\n"
+	dataDir := writeTestData(t, "",
+		"12345,2024-01-01,2024-01-01,Owes me money\n55555,2024-01-01,2024-01-01,likes rope\n77777,2024-01-01,2024-01-01,New person\n")
+
+	tests := []struct {
+		name       string
+		onConflict string
+		message    string
+		section    bool
+		conflicts  []string
+	}{
+		{name: "note mode", message: "Met at a munch\n\nOwes me money"},
+		{name: "keep", onConflict: "keep", message: "Met at a munch", conflicts: []string{"People/Alice.md"}},
+		{name: "replace", onConflict: "replace", message: "Owes me money", conflicts: []string{"People/Alice.md"}},
+		{name: "record", onConflict: "record", message: "Met at a munch", section: true, conflicts: []string{"People/Alice.md"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempVault := t.TempDir()
+			alicePath := filepath.Join(tempVault, "People", "Alice.md")
+			writeTestFile(t, alicePath, aliceContent)
+			writeTestFile(t, filepath.Join(tempVault, "People", "Bob.md"), bobContent)
+
+			sync := &SyncCmd{
+				DataDir:        []string{dataDir},
+				CreatePeopleIn: []string{"People"},
+				OnConflict:     tt.onConflict,
+				now:            fixedNow,
+			}
+			assert.NoError(t, sync.Validate())
+			err := sync.Run(loadTestVault(t, tempVault))
+			assert.NoError(t, err)
+
+			// Bob's web-message already has the note and the new page only the template's, neither conflicts
+			assert.Equal(t, tt.conflicts, sync.summary.Conflicts)
+
+			alice, err := obsidian.LoadPage(alicePath, tempVault)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.message, alice.WebMessage)
+			section := "## Sync Conflict 2024-06-01\n\nPrevious web-message:\n\n> Met at a munch\n\nIncoming private note:\n\n> Owes me money\n"
+			if !tt.section {
+				assert.NotContains(t, alice.Content, "Sync Conflict")
+				return
+			}
+			assert.Equal(t, "\n# Alice\n\n"+section, alice.Content)
+
+			// The conflict is checked again by the next sync, which doesn't record it twice
+			err = sync.Run(loadTestVault(t, tempVault))
+			assert.NoError(t, err)
+			alice, err = obsidian.LoadPage(alicePath, tempVault)
+			assert.NoError(t, err)
+			assert.Equal(t, 1, strings.Count(alice.Content, "Sync Conflict"))
+			assert.Equal(t, []string{"People/Alice.md"}, sync.summary.Conflicts)
+		})
+	}
+
+	sync := &SyncCmd{OnConflict: "record", NoteTarget: "body"}
+	assert.Error(t, sync.Validate())
+}
+
+func TestSyncCmd_PrivateNoteWithBlockedKeyword(t *testing.T) {
+	// Create a temporary vault
+	tempVault := t.TempDir()
+
+	// Create Templates directory
+	templatesDir := filepath.Join(tempVault, "Templates")
+	if err := os.MkdirAll(templatesDir, 0755); err != nil {
+		t.Fatalf("Failed to create templates directory: %v", err)
+	}
+
+	templateContent := `---
+tags:
+  - person
+url: https://fetlife.com/users/
+---
+
+# Notes
+`
+	templatePath := filepath.Join(templatesDir, "People.md")
+	if err := os.WriteFile(templatePath, []byte(templateContent), 0644); err != nil {
+		t.Fatalf("Failed to create template: %v", err)
+	}
+
+	// Create test data directory
+	testDataDir := t.TempDir()
+
+	// Create empty blockeds.txt
+	blockedsContent := `blocked_user_id,created_at,updated_at,blocked_nickname
+`
+	blockedsPath := filepath.Join(testDataDir, "blockeds.txt")
+	if err := os.WriteFile(blockedsPath, []byte(blockedsContent), 0644); err != nil {
+		t.Fatalf("Failed to create blockeds.txt: %v", err)
+	}
+
+	// Create private_notes.txt with users who should go to Bad People
+	privateNotesContent := `member_id,created_at,updated_at,private_note
+88888,2024-01-01,2024-01-01,Blocked this creepy person immediately
+99999,2024-01-01,2024-01-01,Harassment and inappropriate messages - BLOCKED
+`
+	privateNotesPath := filepath.Join(testDataDir, "private_notes.txt")
+	if err := os.WriteFile(privateNotesPath, []byte(privateNotesContent), 0644); err != nil {
+		t.Fatalf("Failed to create private_notes.txt: %v", err)
+	}
+
+	// Create sync command
+	sync := &SyncCmd{
+		DataDir:        []string{testDataDir},
+		CreatePeopleIn: []string{"People", "Bad People:creepy,harassment,blocked"},
+	}
+
+	vault := obsidian.NewVault(tempVault)
+	err := vault.Load()
+	assert.NoError(t, err)
+
+	err = sync.Run(vault)
+	assert.NoError(t, err)
+
+	// Both users should be in Bad People folder due to keyword matching
+	badPeopleDir := filepath.Join(tempVault, "Bad People")
+
+	// User 88888 should be in Bad People (matches "creepy" and "blocked")
+	user1Path := filepath.Join(badPeopleDir, "user-88888.md")
+	_, err = os.Stat(user1Path)
+	assert.NoError(t, err, "User 88888 should be in Bad People folder (matches 'creepy' and 'blocked')")
+
+	// User 99999 should be in Bad People (matches "harassment" and "blocked")
+	user2Path := filepath.Join(badPeopleDir, "user-99999.md")
+	_, err = os.Stat(user2Path)
+	assert.NoError(t, err, "User 99999 should be in Bad People folder (matches 'harassment' and 'blocked')")
+
+	// Verify the private notes were saved
+	user1, err := obsidian.LoadPage(user1Path, tempVault)
+	assert.NoError(t, err)
+	assert.Equal(t, "Blocked this creepy person immediately", user1.WebMessage)
+
+	user2, err := obsidian.LoadPage(user2Path, tempVault)
+	assert.NoError(t, err)
+	assert.Equal(t, "Harassment and inappropriate messages - BLOCKED", user2.WebMessage)
+}
+
+// writeTestFile writes a file, creating any missing parent directories
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("Failed to create directory for %s: %v", path, err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+}
+
+// writeTestData creates a data directory holding the given blockeds.txt and private_notes.txt rows (without headers)
+func writeTestData(t *testing.T, blockeds, privateNotes string) string {
+	t.Helper()
+	dataDir := t.TempDir()
+	writeTestFile(t, filepath.Join(dataDir, "blockeds.txt"), "blocked_user_id,created_at,updated_at,blocked_nickname\n"+blockeds)
+	writeTestFile(t, filepath.Join(dataDir, "private_notes.txt"), "member_id,created_at,updated_at,private_note\n"+privateNotes)
+	return dataDir
+}
+
+// fixedNow is the clock of tests that compare pages with their created-at and synced-at
+func fixedNow() time.Time {
+	return time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+}
+
+// loadTestVault loads the vault at path, failing the test on error
+func loadTestVault(t *testing.T, path string) *obsidian.Vault {
+	t.Helper()
+	vault := obsidian.NewVault(path)
+	if err := vault.Load(); err != nil {
+		t.Fatalf("Failed to load vault: %v", err)
+	}
+	return vault
+}
+
+func TestSyncCmd_DryRun(t *testing.T) {
+	// Create a temporary vault
+	tempVault := t.TempDir()
+
+	// Create an existing page for a user that will be blocked
+	badPeopleDir := filepath.Join(tempVault, "Bad People")
+	if err := os.MkdirAll(badPeopleDir, 0755); err != nil {
+		t.Fatalf("Failed to create Bad People directory: %v", err)
+	}
+
+	frankContent := `---
+tags:
+  - person
+url: https://fetlife.com/users/98765
+---
+
+# Frank
+`
+	frankPath := filepath.Join(badPeopleDir, "Frank.md")
+	if err := os.WriteFile(frankPath, []byte(frankContent), 0644); err != nil {
+		t.Fatalf("Failed to create Frank.md: %v", err)
+	}
+
+	// Create test data directory
+	testDataDir := t.TempDir()
+
+	blockedsContent := `blocked_user_id,created_at,updated_at,blocked_nickname
+98765,2024-01-01,2024-01-01,Frank
+`
+	blockedsPath := filepath.Join(testDataDir, "blockeds.txt")
+	if err := os.WriteFile(blockedsPath, []byte(blockedsContent), 0644); err != nil {
+		t.Fatalf("Failed to create blockeds.txt: %v", err)
+	}
+
+	privateNotesContent := `member_id,created_at,updated_at,private_note
+11111,2024-01-01,2024-01-01,This person is creepy
+`
+	privateNotesPath := filepath.Join(testDataDir, "private_notes.txt")
+	if err := os.WriteFile(privateNotesPath, []byte(privateNotesContent), 0644); err != nil {
+		t.Fatalf("Failed to create private_notes.txt: %v", err)
+	}
+
+	sync := &SyncCmd{
+		DataDir:         []string{testDataDir},
+		CreatePeopleIn:  []string{"People", "Bad People:creepy"},
+		CreateBlockedIn: []string{"Bad People"},
+		DryRun:          true,
+	}
+
+	vault := obsidian.NewVault(tempVault)
+	err := vault.Load()
+	assert.NoError(t, err)
+
+	out := capturer.CaptureStdout(func() {
+		err = sync.Run(vault)
+		assert.NoError(t, err)
+	})
+
+	// The diff shows what would happen
+	assert.Contains(t, out, "+ tag blocked on Bad People/Frank.md")
+	assert.Contains(t, out, "~ blocked-date updated on Bad People/Frank.md")
+	assert.Contains(t, out, "+ create Bad People/user-11111.md")
+	assert.Contains(t, out, "Dry run: 1 pages would be created, 1 updated, 0 skipped")
+
+	// The existing page must be untouched
+	content, err := os.ReadFile(frankPath)
+	assert.NoError(t, err)
+	assert.Equal(t, frankContent, string(content))
+
+	// The new page must not have been written
+	_, err = os.Stat(filepath.Join(badPeopleDir, "user-11111.md"))
+	assert.True(t, os.IsNotExist(err), "Dry run should not create user-11111.md")
+
+	assert.Equal(t, syncSummary{Created: 1, Updated: 1}, sync.summary)
+}
+
+func TestSyncCmd_DryRun_NoChanges(t *testing.T) {
+	// Create a temporary vault
+	tempVault := t.TempDir()
+
+	// Create a page that is already up to date with the export
+	badPeopleDir := filepath.Join(tempVault, "Bad People")
+	if err := os.MkdirAll(badPeopleDir, 0755); err != nil {
+		t.Fatalf("Failed to create Bad People directory: %v", err)
+	}
+
+	frankContent := `---
+tags:
+  - person
+  - blocked
+url: https://fetlife.com/users/98765
+web-badge-color: "#F44336"
+blocked-date: "2024-01-01"
+blocked-at: "2024-01-01"
+---
+
+# Frank
+`
+	frankPath := filepath.Join(badPeopleDir, "Frank.md")
+	if err := os.WriteFile(frankPath, []byte(frankContent), 0644); err != nil {
+		t.Fatalf("Failed to create Frank.md: %v", err)
+	}
+
+	// Create test data directory
+	testDataDir := t.TempDir()
+
+	blockedsContent := `blocked_user_id,created_at,updated_at,blocked_nickname
+98765,2024-01-01,2024-01-01,Frank
+`
+	blockedsPath := filepath.Join(testDataDir, "blockeds.txt")
+	if err := os.WriteFile(blockedsPath, []byte(blockedsContent), 0644); err != nil {
+		t.Fatalf("Failed to create blockeds.txt: %v", err)
+	}
+
+	privateNotesContent := `member_id,created_at,updated_at,private_note
+`
+	privateNotesPath := filepath.Join(testDataDir, "private_notes.txt")
+	if err := os.WriteFile(privateNotesPath, []byte(privateNotesContent), 0644); err != nil {
+		t.Fatalf("Failed to create private_notes.txt: %v", err)
+	}
+
+	sync := &SyncCmd{
+		DataDir:         []string{testDataDir},
+		CreatePeopleIn:  []string{"People"},
+		CreateBlockedIn: []string{"Bad People"},
+		DryRun:          true,
+	}
+
+	vault := obsidian.NewVault(tempVault)
+	err := vault.Load()
+	assert.NoError(t, err)
+
+	out := capturer.CaptureStdout(func() {
+		err = sync.Run(vault)
+		assert.NoError(t, err)
+	})
+
+	assert.Equal(t, "Dry run: 0 pages would be created, 0 updated, 1 skipped\n", out)
+
+	content, err := os.ReadFile(frankPath)
+	assert.NoError(t, err)
+	assert.Equal(t, frankContent, string(content))
+}
+
+func TestMergeNote(t *testing.T) {
+	tests := []struct {
+		name     string
+		noteMode string
+		existing string
+		note     string
+		expected string
+	}{
+		{
+			name:     "overwrite replaces existing message",
+			noteMode: "overwrite",
+			existing: "Written by hand",
+			note:     "Imported note",
+			expected: "Imported note",
+		},
+		{
+			name:     "replace replaces existing message",
+			noteMode: "replace",
+			existing: "Written by hand",
+			note:     "Imported note",
+			expected: "Imported note",
+		},
+		{
+			name:     "replace fills empty message",
+			noteMode: "replace",
+			existing: "",
+			note:     "Imported note",
+			expected: "Imported note",
+		},
+		{
+			name:     "skip-if-set keeps existing message",
+			noteMode: "skip-if-set",
+			existing: "Written by hand",
+			note:     "Imported note",
+			expected: "Written by hand",
+		},
+		{
+			name:     "skip-if-set fills empty message",
+			noteMode: "skip-if-set",
+			existing: "",
+			note:     "Imported note",
+			expected: "Imported note",
+		},
+		{
+			name:     "append joins messages",
+			noteMode: "append",
+			existing: "Written by hand",
+			note:     "Imported note",
+			expected: "Written by hand\n\nImported note",
+		},
+		{
+			name:     "append does not duplicate a previously appended note",
+			noteMode: "append",
+			existing: "Written by hand\n\nImported note",
+			note:     "Imported note",
+			expected: "Written by hand\n\nImported note",
+		},
+		{
+			name:     "append ignores case when looking for the note",
+			noteMode: "append",
+			existing: "Written by hand\n\nimported NOTE",
+			note:     "Imported note",
+			expected: "Written by hand\n\nimported NOTE",
+		},
+		{
+			name:     "append fills empty message",
+			noteMode: "append",
+			existing: "",
+			note:     "Imported note",
+			expected: "Imported note",
+		},
+		{
+			name:     "unset mode appends",
+			noteMode: "",
+			existing: "Written by hand",
+			note:     "Imported note",
+			expected: "Written by hand\n\nImported note",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sync := &SyncCmd{NoteMode: tt.noteMode}
+			assert.Equal(t, tt.expected, sync.mergeNote(tt.existing, tt.note))
+		})
+	}
+}
+
+func TestSyncCmd_UpdateOnly(t *testing.T) {
+	tempVault := t.TempDir()
+
+	// Only Frank already has a page
+	frankPath := filepath.Join(tempVault, "Bad People", "Frank.md")
+	writeTestFile(t, frankPath, `---
+tags:
+  - person
+url: https://fetlife.com/users/98765
+---
+
+# Frank
+`)
+
+	testDataDir := writeTestData(t,
+		"98765,2024-01-01,2024-01-01,Frank\n87654,2024-01-01,2024-01-01,George\n",
+		"11111,2024-01-01,2024-01-01,Nice person\n")
+
+	sync := &SyncCmd{
+		DataDir:         []string{testDataDir},
+		CreatePeopleIn:  []string{"People"},
+		CreateBlockedIn: []string{"Bad People"},
+		UpdateOnly:      true,
+	}
+
+	vault := loadTestVault(t, tempVault)
+	err := sync.Run(vault)
+	assert.NoError(t, err)
+
+	// The existing page was updated
+	frank, err := obsidian.LoadPage(frankPath, tempVault)
+	assert.NoError(t, err)
+	assert.Contains(t, frank.Tags, "blocked")
+
+	// No new pages were created
+	_, err = os.Stat(filepath.Join(tempVault, "Bad People", "George.md"))
+	assert.True(t, os.IsNotExist(err), "George.md should not be created")
+	_, err = os.Stat(filepath.Join(tempVault, "People"))
+	assert.True(t, os.IsNotExist(err), "People folder should not be created")
+
+	assert.Equal(t, syncSummary{Updated: 1, Missing: 2}, sync.summary)
+}
+
+func TestSyncCmd_CreateOnly(t *testing.T) {
+	tempVault := t.TempDir()
+
+	// Frank already has a page that must not be touched
+	frankContent := `---
+tags:
+  - person
+url: https://fetlife.com/users/98765
+web-message: Written by hand
+---
+
+# Frank
+`
+	frankPath := filepath.Join(tempVault, "Bad People", "Frank.md")
+	writeTestFile(t, frankPath, frankContent)
+
+	testDataDir := writeTestData(t,
+		"98765,2024-01-01,2024-01-01,Frank\n87654,2024-01-01,2024-01-01,George\n",
+		"98765,2024-01-01,2024-01-01,Imported note\n11111,2024-01-01,2024-01-01,Nice person\n87654,2024-01-01,2024-01-01,Note about George\n")
+
+	sync := &SyncCmd{
+		DataDir:         []string{testDataDir},
+		CreatePeopleIn:  []string{"People"},
+		CreateBlockedIn: []string{"Bad People"},
+		CreateOnly:      true,
+	}
+
+	vault := loadTestVault(t, tempVault)
+	err := sync.Run(vault)
+	assert.NoError(t, err)
+
+	// The existing page is byte for byte unchanged
+	content, err := os.ReadFile(frankPath)
+	assert.NoError(t, err)
+	assert.Equal(t, frankContent, string(content))
+
+	// New pages were created for unknown users
+	george, err := obsidian.LoadPage(filepath.Join(tempVault, "Bad People", "George.md"), tempVault)
+	assert.NoError(t, err, "George.md should be created")
+	_, err = os.Stat(filepath.Join(tempVault, "People", "user-11111.md"))
+	assert.NoError(t, err, "user-11111.md should be created")
+
+	// Pages created during the run still receive later records
+	assert.Contains(t, george.WebMessage, "Note about George")
+
+	assert.Equal(t, syncSummary{Created: 2, Updated: 1, Skipped: 2}, sync.summary)
+}
+
+func TestSyncCmd_BlockedNicknameChange(t *testing.T) {
+	tempVault := t.TempDir()
+
+	// Frank has since changed his nickname to Franklin
+	writeTestFile(t, filepath.Join(tempVault, "Bad People", "Frank.md"), `---
+tags:
+  - person
+url: https://fetlife.com/users/98765
+---
+`)
+	// George's new nickname is already taken by another page
+	writeTestFile(t, filepath.Join(tempVault, "Bad People", "George.md"), `---
+url: https://fetlife.com/users/87654
+---
+`)
+	writeTestFile(t, filepath.Join(tempVault, "Bad People", "Greg.md"), "# Someone else\n")
+
+	testDataDir := writeTestData(t,
+		"98765,2024-01-01,2024-01-01,Franklin\n87654,2024-01-01,2024-01-01,Greg\n",
+		"")
+
+	sync := &SyncCmd{
+		DataDir:         []string{testDataDir},
+		CreatePeopleIn:  []string{"People"},
+		CreateBlockedIn: []string{"Bad People"},
+	}
+
+	vault := loadTestVault(t, tempVault)
+	err := sync.Run(vault)
+	assert.NoError(t, err)
+
+	// Frank's page follows the nickname change and is still the only page for the user
+	_, err = os.Stat(filepath.Join(tempVault, "Bad People", "Frank.md"))
+	assert.True(t, os.IsNotExist(err), "Frank.md should have been renamed")
+	franklin, err := obsidian.LoadPage(filepath.Join(tempVault, "Bad People", "Franklin.md"), tempVault)
+	assert.NoError(t, err)
+	assert.Contains(t, franklin.Tags, "blocked")
+	assert.Equal(t, []string{"Frank"}, franklin.Aliases)
+
+	pages, err := vault.FindByUserID("98765")
+	assert.NoError(t, err)
+	assert.Len(t, pages, 1)
+	assert.Equal(t, "Franklin", pages[0].Title)
+
+	// George's page keeps its name because Greg.md already exists
+	george, err := obsidian.LoadPage(filepath.Join(tempVault, "Bad People", "George.md"), tempVault)
+	assert.NoError(t, err)
+	assert.Contains(t, george.Tags, "blocked")
+	assert.Equal(t, []string{"Greg"}, george.Aliases)
+	greg, err := os.ReadFile(filepath.Join(tempVault, "Bad People", "Greg.md"))
+	assert.NoError(t, err)
+	assert.Equal(t, "# Someone else\n", string(greg))
+	assert.Equal(t, 2, sync.summary.NicknameChanges)
+
+	// Running again doesn't duplicate the aliases
+	sync = &SyncCmd{
+		DataDir:         []string{testDataDir},
+		CreatePeopleIn:  []string{"People"},
+		CreateBlockedIn: []string{"Bad People"},
+		NoCache:         true,
+	}
+	vault = loadTestVault(t, tempVault)
+	err = sync.Run(vault)
+	assert.NoError(t, err)
+
+	george, err = obsidian.LoadPage(filepath.Join(tempVault, "Bad People", "George.md"), tempVault)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Greg"}, george.Aliases)
+	franklin, err = obsidian.LoadPage(filepath.Join(tempVault, "Bad People", "Franklin.md"), tempVault)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Frank"}, franklin.Aliases)
+	assert.Equal(t, 1, sync.summary.NicknameChanges)
+}
+
+func TestSplitBlockedMessage(t *testing.T) {
+	tests := []struct {
+		name         string
+		message      string
+		expectedRest string
+		expectedDate string
+		expectedOK   bool
+	}{
+		{
+			name:         "plain message",
+			message:      "Met at a munch",
+			expectedRest: "Met at a munch",
+		},
+		{
+			name:         "old style blocked message",
+			message:      "Blocked on 2024-01-01 10:00:00 UTC",
+			expectedDate: "2024-01-01 10:00:00 UTC",
+			expectedOK:   true,
+		},
+		{
+			name:         "old style blocked message with appended note",
+			message:      "Blocked on 2024-01-01\n\nSent creepy messages",
+			expectedRest: "Sent creepy messages",
+			expectedDate: "2024-01-01",
+			expectedOK:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rest, date, ok := splitBlockedMessage(tt.message)
+			assert.Equal(t, tt.expectedRest, rest)
+			assert.Equal(t, tt.expectedDate, date)
+			assert.Equal(t, tt.expectedOK, ok)
+		})
+	}
+}
+
+func TestSyncCmd_BlockedDate(t *testing.T) {
+	tempVault := t.TempDir()
+
+	// Frank was synced by an older version that put the block date in web-message
+	frankPath := filepath.Join(tempVault, "Bad People", "Frank.md")
+	writeTestFile(t, frankPath, `---
+tags:
+  - person
+  - blocked
+url: https://fetlife.com/users/98765
+web-message: Blocked on 2023-02-15 14:22:10 UTC
+---
+`)
+
+	testDataDir := writeTestData(t,
+		"98765,2023-02-15 14:22:10 UTC,2023-02-15 14:22:10 UTC,Frank\n87654,2023-03-20 18:45:33 UTC,2023-03-20 18:45:33 UTC,George\n",
+		"87654,2024-01-01,2024-01-01,Sent creepy messages\n")
+
+	sync := &SyncCmd{
+		DataDir:         []string{testDataDir},
+		CreatePeopleIn:  []string{"People"},
+		CreateBlockedIn: []string{"Bad People"},
+	}
+
+	vault := loadTestVault(t, tempVault)
+	err := sync.Run(vault)
+	assert.NoError(t, err)
+
+	// The old web-message was migrated
+	frank, err := obsidian.LoadPage(frankPath, tempVault)
+	assert.NoError(t, err)
+	assert.Equal(t, "", frank.WebMessage)
+	assert.Equal(t, "2023-02-15 14:22:10 UTC", frank.BlockedDate)
+
+	// New pages keep the block date and private note apart, the note follows the warning of the built-in template
+	george, err := obsidian.LoadPage(filepath.Join(tempVault, "Bad People", "George.md"), tempVault)
+	assert.NoError(t, err)
+	assert.Equal(t, "WARNING: Blocked user\n\nSent creepy messages", george.WebMessage)
+	assert.Equal(t, "2023-03-20 18:45:33 UTC", george.BlockedDate)
+	assert.Equal(t, "2023-03-20 18:45:33 UTC", george.BlockedAt)
+}
+
+func TestSyncCmd_NoteTimestamps(t *testing.T) {
+	tempVault := t.TempDir()
+	pagePath := filepath.Join(tempVault, "People", "user-11111.md")
+
+	sync := &SyncCmd{
+		DataDir:        []string{writeTestData(t, "", "11111,2024-01-01,2024-02-01,Met at a munch\n")},
+		CreatePeopleIn: []string{"People"},
+		NoteMode:       "overwrite",
+	}
+	err := sync.Run(loadTestVault(t, tempVault))
+	assert.NoError(t, err)
+
+	page, err := obsidian.LoadPage(pagePath, tempVault)
+	assert.NoError(t, err)
+	assert.Equal(t, "2024-01-01", page.NoteCreated)
+	assert.Equal(t, "2024-02-01", page.NoteUpdated)
+
+	// A newer export with the same note text leaves note-updated alone
+	sync.DataDir = []string{writeTestData(t, "", "11111,2024-01-01,2024-03-01,Met at a munch\n")}
+	err = sync.Run(loadTestVault(t, tempVault))
+	assert.NoError(t, err)
+
+	page, err = obsidian.LoadPage(pagePath, tempVault)
+	assert.NoError(t, err)
+	assert.Equal(t, "2024-02-01", page.NoteUpdated)
+
+	// Changing the note text moves note-updated along
+	sync.DataDir = []string{writeTestData(t, "", "11111,2024-01-01,2024-04-01,\"Met at a munch, very friendly\"\n")}
+	err = sync.Run(loadTestVault(t, tempVault))
+	assert.NoError(t, err)
+
+	page, err = obsidian.LoadPage(pagePath, tempVault)
+	assert.NoError(t, err)
+	assert.Equal(t, "2024-01-01", page.NoteCreated)
+	assert.Equal(t, "2024-04-01", page.NoteUpdated)
+	assert.Equal(t, "Met at a munch, very friendly", page.WebMessage)
+}
+
+func TestSyncCmd_SyncTimestamps(t *testing.T) {
+	tempVault := t.TempDir()
+	pagePath := filepath.Join(tempVault, "People", "user-11111.md")
+
+	sync := &SyncCmd{
+		DataDir:        []string{writeTestData(t, "", "11111,2024-01-01,2024-02-01,Met at a munch\n")},
+		CreatePeopleIn: []string{"People"},
+		now:            fixedNow,
+	}
+	err := sync.Run(loadTestVault(t, tempVault))
+	assert.NoError(t, err)
+
+	page, err := obsidian.LoadPage(pagePath, tempVault)
+	assert.NoError(t, err)
+	assert.Equal(t, "2024-06-01T12:00:00Z", page.CreatedAt)
+	assert.Equal(t, "2024-06-01T12:00:00Z", page.SyncedAt)
+	_, err = time.Parse(time.RFC3339, page.CreatedAt)
+	assert.NoError(t, err)
+
+	// Syncing the same data later doesn't touch the page
+	sync.now = func() time.Time { return fixedNow().Add(24 * time.Hour) }
+	err = sync.Run(loadTestVault(t, tempVault))
+	assert.NoError(t, err)
+
+	page, err = obsidian.LoadPage(pagePath, tempVault)
+	assert.NoError(t, err)
+	assert.Equal(t, "2024-06-01T12:00:00Z", page.SyncedAt)
+
+	// A changed note moves synced-at along, created-at stays
+	sync.DataDir = []string{writeTestData(t, "", "11111,2024-01-01,2024-03-01,Met at a play party\n")}
+	err = sync.Run(loadTestVault(t, tempVault))
+	assert.NoError(t, err)
+
+	page, err = obsidian.LoadPage(pagePath, tempVault)
+	assert.NoError(t, err)
+	assert.Equal(t, "2024-06-01T12:00:00Z", page.CreatedAt)
+	assert.Equal(t, "2024-06-02T12:00:00Z", page.SyncedAt)
+}
+
+func TestSyncCmd_Idempotent(t *testing.T) {
+	tempVault := t.TempDir()
+	writeTestFile(t, filepath.Join(tempVault, "People", "Alice.md"), "---\ntags:\n  - person\nurl: https://fetlife.com/users/12345\n---\n\n# Alice\n")
+
+	sync := &SyncCmd{
+		DataDir: []string{writeTestData(t,
+			"98765,2024-01-01,2024-01-01,Frank\n",
+			"12345,2024-01-01,2024-01-01,Met at a munch\n98765,2024-01-01,2024-01-01,Sent creepy messages\n33333,2024-01-01,2024-01-01,Rope top\n")},
+		CreatePeopleIn:  []string{"People"},
+		CreateBlockedIn: []string{"Bad People"},
+		NoCache:         true,
+	}
+	err := sync.Run(loadTestVault(t, tempVault))
+	assert.NoError(t, err)
+
+	// Date every page back so a rewrite would show up in its modification time
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	var files []string
+	err = filepath.WalkDir(tempVault, func(path string, entry os.DirEntry, err error) error {
+		if err == nil && filepath.Ext(path) == ".md" {
+			files = append(files, path)
+			err = os.Chtimes(path, past, past)
+		}
+		return err
+	})
+	assert.NoError(t, err)
+	assert.Len(t, files, 3)
+
+	err = sync.Run(loadTestVault(t, tempVault))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, sync.summary.Created)
+	assert.Equal(t, 0, sync.summary.Updated)
+
+	for _, file := range files {
+		info, err := os.Stat(file)
+		assert.NoError(t, err)
+		assert.True(t, info.ModTime().Equal(past), "%s was rewritten", file)
+	}
+}
+
+// writeSyntheticData writes the data files of n users, a third of them blocked and all of them with a private note
+func writeSyntheticData(t testing.TB, n int) string {
+	t.Helper()
+	var blockeds, notes strings.Builder
+	for i := range n {
+		userID := fmt.Sprint(100000 + i)
+		if i%3 == 0 {
+			fmt.Fprintf(&blockeds, "%s,2024-01-01,2024-01-01,Blocked%d\n", userID, i)
+		}
+		fmt.Fprintf(&notes, "%s,2024-01-02,2024-01-03,Note about user %d\n", userID, i)
+	}
+
+	dataDir := t.TempDir()
+	for name, content := range map[string]string{
+		"blockeds.txt":      "blocked_user_id,created_at,updated_at,blocked_nickname\n" + blockeds.String(),
+		"private_notes.txt": "member_id,created_at,updated_at,private_note\n" + notes.String(),
+	} {
+		if err := os.WriteFile(filepath.Join(dataDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	return dataDir
+}
+
+// readVaultFiles returns the content of every page of the vault by its path relative to the vault
+func readVaultFiles(t *testing.T, vaultPath string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	err := filepath.WalkDir(vaultPath, func(path string, entry os.DirEntry, err error) error {
+		if err != nil || filepath.Ext(path) != ".md" {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		relPath, _ := filepath.Rel(vaultPath, path)
+		files[relPath] = string(content)
+		return nil
+	})
+	assert.NoError(t, err)
+	return files
+}
+
+func TestSyncCmd_Concurrency(t *testing.T) {
+	dataDir := writeSyntheticData(t, 300)
+
+	// Both vaults have a page that two users link to, which is updated for both of them
+	shared := "---\ntags:\n  - person\nurl: https://fetlife.com/users/100001\nurl-aliases:\n  - https://fetlife.com/users/100002\n---\n"
+	run := func(concurrency int) (map[string]string, syncSummary) {
+		tempVault := t.TempDir()
+		writeTestFile(t, filepath.Join(tempVault, "People", "Shared.md"), shared)
+		sync := &SyncCmd{
+			DataDir:         []string{dataDir},
+			CreatePeopleIn:  []string{"People", "Rope:rope"},
+			CreateBlockedIn: []string{"Bad People"},
+			NoCache:         true,
+			Concurrency:     concurrency,
+			now:             fixedNow,
+		}
+		err := sync.Run(loadTestVault(t, tempVault))
+		assert.NoError(t, err)
+		return readVaultFiles(t, tempVault), sync.summary
+	}
+
+	// Processing several users at once gives the same vault as one at a time
+	sequential, sequentialSummary := run(1)
+	concurrent, concurrentSummary := run(8)
+	assert.Len(t, sequential, 299)
+	sharedPath := filepath.Join("People", "Shared.md")
+	for _, files := range []map[string]string{sequential, concurrent} {
+		// The notes of the two users can be appended in either order
+		assert.Contains(t, files[sharedPath], "Note about user 1\n")
+		assert.Contains(t, files[sharedPath], "Note about user 2\n")
+		delete(files, sharedPath)
+	}
+	assert.Equal(t, sequential, concurrent)
+	assert.Equal(t, sequentialSummary, concurrentSummary)
+
+	sync := &SyncCmd{Concurrency: -1}
+	assert.Error(t, sync.Validate())
+}
+
+func BenchmarkSyncCmd(b *testing.B) {
+	logger := log.Logger
+	log.Logger = zerolog.Nop()
+	defer func() { log.Logger = logger }()
+
+	dataDir := writeSyntheticData(b, 10000)
+	for _, concurrency := range []int{1, 8} {
+		b.Run(fmt.Sprintf("concurrency-%d", concurrency), func(b *testing.B) {
+			for range b.N {
+				vault := obsidian.NewVault(b.TempDir())
+				sync := &SyncCmd{
+					DataDir:         []string{dataDir},
+					CreatePeopleIn:  []string{"People"},
+					CreateBlockedIn: []string{"Bad People"},
+					NoCache:         true,
+					Progress:        "none",
+					Concurrency:     concurrency,
+				}
+				if err := sync.Run(vault); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestSyncCmd_NicknameCollision(t *testing.T) {
+	tempVault := t.TempDir()
+
+	testDataDir := writeTestData(t,
+		"111,2024-01-01,2024-01-01,Alex\n456,2024-01-02,2024-01-02,Alex\n",
+		"")
+
+	sync := &SyncCmd{
+		DataDir:         []string{testDataDir},
+		CreatePeopleIn:  []string{"People"},
+		CreateBlockedIn: []string{"Bad People"},
+	}
+
+	err := sync.Run(loadTestVault(t, tempVault))
+	assert.NoError(t, err)
+
+	// Both users have their own page
+	first, err := obsidian.LoadPage(filepath.Join(tempVault, "Bad People", "Alex.md"), tempVault)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://fetlife.com/users/111", first.Url)
+
+	second, err := obsidian.LoadPage(filepath.Join(tempVault, "Bad People", "Alex (user 456).md"), tempVault)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://fetlife.com/users/456", second.Url)
+
+	assert.Equal(t, 2, sync.summary.Created)
+	assert.Equal(t, 1, sync.summary.Collisions)
+
+	// A second run finds both pages again instead of creating more
+	sync = &SyncCmd{
+		DataDir:         []string{testDataDir},
+		CreatePeopleIn:  []string{"People"},
+		CreateBlockedIn: []string{"Bad People"},
+	}
+	vault := loadTestVault(t, tempVault)
+	err = sync.Run(vault)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, sync.summary.Created)
+	assert.Equal(t, 0, sync.summary.NicknameChanges)
+	assert.Len(t, vault.Pages, 2)
+}
+
+func TestSyncCmd_Incremental(t *testing.T) {
+	tempVault := t.TempDir()
+	statePath := filepath.Join(t.TempDir(), "state.json")
+
+	newSync := func(dataDir string) *SyncCmd {
+		return &SyncCmd{
+			DataDir:         []string{dataDir},
+			CreatePeopleIn:  []string{"People"},
+			CreateBlockedIn: []string{"Bad People"},
+			StateFile:       statePath,
+		}
+	}
+
+	dataDir := writeTestData(t,
+		"98765,2024-01-01,2024-01-01,Frank\n",
+		"98765,2024-01-01,2024-01-01,Sent creepy messages\n11111,2024-01-01,2024-01-01,Met at a munch\n")
+	sync := newSync(dataDir)
+	err := sync.Run(loadTestVault(t, tempVault))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, sync.summary.Created)
+	assert.FileExists(t, statePath)
+
+	// Nothing changed, so every record is skipped
+	sync = newSync(dataDir)
+	err = sync.Run(loadTestVault(t, tempVault))
+	assert.NoError(t, err)
+	assert.Equal(t, syncSummary{Cached: 3}, sync.summary)
+
+	// Only the user whose note changed is processed, with both of their records
+	dataDir = writeTestData(t,
+		"98765,2024-01-01,2024-01-01,Frank\n",
+		"98765,2024-01-01,2024-02-01,Sent creepy messages again\n11111,2024-01-01,2024-01-01,Met at a munch\n")
+	sync = newSync(dataDir)
+	err = sync.Run(loadTestVault(t, tempVault))
+	assert.NoError(t, err)
+	assert.Equal(t, syncSummary{Updated: 1, Unchanged: 1, Cached: 1}, sync.summary)
+
+	// --no-cache processes everything again
+	sync = newSync(dataDir)
+	sync.NoCache = true
+	err = sync.Run(loadTestVault(t, tempVault))
+	assert.NoError(t, err)
+	assert.Equal(t, syncSummary{Unchanged: 3}, sync.summary)
+}
+
+func TestSyncCmd_IncrementalSkippedRecords(t *testing.T) {
+	tempVault := t.TempDir()
+	dataDir := writeTestData(t, "", "11111,2024-01-01,2024-01-01,Met at a munch\n")
+
+	// A record skipped by --update-only isn't remembered, so a later full sync still creates the page
+	sync := &SyncCmd{
+		DataDir:        []string{dataDir},
+		CreatePeopleIn: []string{"People"},
+		UpdateOnly:     true,
+	}
+	err := sync.Run(loadTestVault(t, tempVault))
+	assert.NoError(t, err)
+	assert.Equal(t, syncSummary{Missing: 1}, sync.summary)
+
+	state, err := loadState(filepath.Join(dataDir, stateFileName), tempVault)
+	assert.NoError(t, err)
+	assert.Empty(t, state.Records)
+
+	sync = &SyncCmd{
+		DataDir:        []string{dataDir},
+		CreatePeopleIn: []string{"People"},
+	}
+	err = sync.Run(loadTestVault(t, tempVault))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, sync.summary.Created)
+}
+
+func TestLoadState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	// A missing state file is an empty state
+	state, err := loadState(path, "/vaults/one")
+	assert.NoError(t, err)
+	assert.Empty(t, state.Records)
+
+	state.Records["12345"] = "abc"
+	assert.NoError(t, saveState(path, "/vaults/one", state))
+	loaded, err := loadState(path, "/vaults/one")
+	assert.NoError(t, err)
+	assert.Equal(t, state, loaded)
+
+	// Every vault has its own state
+	other, err := loadState(path, "/vaults/two")
+	assert.NoError(t, err)
+	assert.Empty(t, other.Records)
+	other.Records["67890"] = "def"
+	assert.NoError(t, saveState(path, "/vaults/two", other))
+	loaded, err = loadState(path, "/vaults/one")
+	assert.NoError(t, err)
+	assert.Equal(t, state, loaded)
+
+	writeTestFile(t, path, "not json")
+	_, err = loadState(path, "/vaults/one")
+	assert.Error(t, err)
+}
+
+func TestSyncCmd_IncrementalVaults(t *testing.T) {
+	dataDir := writeTestData(t, "", "11111,2024-01-01,2024-01-01,Met at a munch\n")
+	newSync := func() *SyncCmd {
+		return &SyncCmd{
+			DataDir:        []string{dataDir},
+			CreatePeopleIn: []string{"People"},
+		}
+	}
+
+	sync := newSync()
+	err := sync.Run(loadTestVault(t, t.TempDir()))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, sync.summary.Created)
+
+	// Syncing the same data to another vault doesn't skip the users synced to the first one
+	sync = newSync()
+	err = sync.Run(loadTestVault(t, t.TempDir()))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, sync.summary.Created)
 }
@@ -0,0 +1,125 @@
+package program
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/woodysmith1912/fetlife-data-tools/obsidian"
+)
+
+// syncLogTag is the tag of a sync log page created by --sync-log
+const syncLogTag = "sync-log"
+
+// vaultPageName returns the folder and title of a page given relative to the vault with or without .md, like the
+// --sync-log and --write-index pages
+func vaultPageName(name string) (folder, title string) {
+	file := filepath.Clean(strings.TrimSuffix(strings.TrimSpace(name), ".md"))
+	return filepath.Dir(file), filepath.Base(file)
+}
+
+// insideVault tells whether a page given relative to the vault stays inside it
+func insideVault(name string) bool {
+	file := filepath.Clean(name)
+	return !filepath.IsAbs(file) && file != ".." && !strings.HasPrefix(file, ".."+string(filepath.Separator))
+}
+
+// generatedPage returns the page given relative to the vault, like the --sync-log and --write-index pages, or a new page
+// tagged tag with just a heading when the vault doesn't have it.  created tells whether the page is new.
+func generatedPage(vault *obsidian.Vault, name, tag string) (page *obsidian.Page, created bool, err error) {
+	folder, title := vaultPageName(name)
+	if page := vault.FindByTitleInFolder(title, folder); page != nil {
+		return page, false, nil
+	}
+	content := fmt.Sprintf("---\ntags:\n  - %s\n---\n\n# %s\n", tag, title)
+	page, err = obsidian.ParsePage([]byte(content), filepath.Join(vault.Path, folder, title+".md"), vault.Path)
+	return page, true, err
+}
+
+// createGeneratedPage writes a new page returned by generatedPage with an atomic write, records it in the journal and
+// adds it to the vault.  what names the page in the log.
+func (sync *SyncCmd) createGeneratedPage(vault *obsidian.Vault, page *obsidian.Page, what string) error {
+	content, err := page.Render()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(page.FilePath), 0755); err != nil {
+		return err
+	}
+	if err := page.Save(); err != nil {
+		return err
+	}
+	if err := sync.record(journalEntry{Op: "create", Path: pageFile(page), After: string(content)}); err != nil {
+		return err
+	}
+	vault.Add(page)
+	log.Info().Str("page", pageFile(page)).Msg("Created " + what + " page")
+	return nil
+}
+
+// writeSyncLog appends an entry for this run to the --sync-log page, creating the page when the vault doesn't have it.
+// Entries are appended, so the latest run is at the bottom of the page.
+func (sync *SyncCmd) writeSyncLog(vault *obsidian.Vault) error {
+	page, created, err := generatedPage(vault, sync.SyncLog, syncLogTag)
+	if err != nil {
+		return err
+	}
+
+	page.Content = strings.TrimRight(page.Content, "\n") + "\n\n" + sync.syncLogEntry()
+
+	if !created {
+		return sync.writePage(page)
+	}
+	return sync.createGeneratedPage(vault, page, "sync log")
+}
+
+// syncLogEntry is the section of the sync log for this run, with the counts of the summary and links to the pages
+// created or moved
+func (sync *SyncCmd) syncLogEntry() string {
+	var entry strings.Builder
+	fmt.Fprintf(&entry, "## Sync %s\n\n", sync.syncTime())
+	fmt.Fprintf(&entry, "- Created: %d\n- Updated: %d\n- Unchanged: %d\n- Skipped: %d\n",
+		sync.summary.Created, sync.summary.Updated, sync.summary.Unchanged,
+		sync.summary.Skipped+sync.summary.Missing+sync.summary.Cached)
+	if sync.summary.Deleted > 0 {
+		fmt.Fprintf(&entry, "- Deleted: %d\n", sync.summary.Deleted)
+	}
+
+	for _, list := range []struct {
+		heading string
+		pages   []*obsidian.Page
+	}{
+		{"Created", sync.createdOrder},
+		{"Moved", sync.movedOrder},
+	} {
+		if len(list.pages) == 0 {
+			continue
+		}
+		fmt.Fprintf(&entry, "\n### %s\n\n", list.heading)
+		for _, page := range list.pages {
+			fmt.Fprintf(&entry, "- %s\n", wikilink(page))
+		}
+	}
+	return entry.String()
+}
+
+// wikilink returns an Obsidian link to the page.  Pages outside the vault root are linked by their path, so pages with
+// the same title in different folders get the right link, and shown by their title.
+func wikilink(page *obsidian.Page) string {
+	if page.Folder == "." {
+		return "[[" + page.Title + "]]"
+	}
+	return "[[" + filepath.ToSlash(filepath.Join(page.Folder, page.Title)) + "|" + page.Title + "]]"
+}
+
+// recordMove remembers a page moved to another folder or renamed by this run, for the sync log
+func (sync *SyncCmd) recordMove(page *obsidian.Page) {
+	sync.locks.state.Lock()
+	defer sync.locks.state.Unlock()
+	if !sync.createdPages[page] && !slices.Contains(sync.movedOrder, page) {
+		sync.movedOrder = append(sync.movedOrder, page)
+	}
+}
@@ -0,0 +1,70 @@
+package program
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/woodysmith1912/fetlife-data-tools/obsidian"
+)
+
+func TestSyncCmd_SyncLog(t *testing.T) {
+	tempVault := t.TempDir()
+	writeTestFile(t, filepath.Join(tempVault, "People", "Carol.md"),
+		"---\ntags:\n  - person\nurl: https://fetlife.com/users/33333\n---\n")
+	dataDir := writeTestData(t,
+		"33333,2024-01-01,2024-01-01,Carol\n",
+		"12345,2024-01-01,2024-01-01,Met at a munch\n")
+
+	sync := &SyncCmd{
+		DataDir:         []string{dataDir},
+		CreatePeopleIn:  []string{"People"},
+		CreateBlockedIn: []string{"Bad People"},
+		MoveBlocked:     true,
+		SyncLog:         "Logs/FetLife Sync Log",
+		NoCache:         true,
+		now:             fixedNow,
+	}
+	assert.NoError(t, sync.Run(loadTestVault(t, tempVault)))
+
+	logPath := filepath.Join(tempVault, "Logs", "FetLife Sync Log.md")
+	content, err := os.ReadFile(logPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "---\ntags:\n  - sync-log\n---\n\n# FetLife Sync Log\n\n"+
+		"## Sync 2024-06-01T12:00:00Z\n\n"+
+		"- Created: 1\n- Updated: 1\n- Unchanged: 0\n- Skipped: 0\n\n"+
+		"### Created\n\n- [[People/user-12345|user-12345]]\n\n"+
+		"### Moved\n\n- [[Bad People/Carol|Carol]]\n", string(content))
+
+	// The next run appends its entry, and the page round-trips through Page.Save
+	assert.NoError(t, sync.Run(loadTestVault(t, tempVault)))
+	page, err := obsidian.LoadPage(logPath, tempVault)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"sync-log"}, page.Tags)
+	assert.False(t, page.IsDirty())
+	assert.Equal(t, "- Created: 1\n- Updated: 1\n- Unchanged: 0\n- Skipped: 0\n\n"+
+		"### Created\n\n- [[People/user-12345|user-12345]]\n\n### Moved\n\n- [[Bad People/Carol|Carol]]",
+		page.GetSection("Sync 2024-06-01T12:00:00Z"))
+	content, err = os.ReadFile(logPath)
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "### Moved\n\n- [[Bad People/Carol|Carol]]\n\n## Sync 2024-06-01T12:00:00Z\n\n"+
+		"- Created: 0\n- Updated: 0\n- Unchanged: 2\n- Skipped: 0\n")
+
+	// A dry run doesn't write an entry
+	sync.DryRun = true
+	assert.NoError(t, sync.Run(loadTestVault(t, tempVault)))
+	after, err := os.ReadFile(logPath)
+	assert.NoError(t, err)
+	assert.Equal(t, string(content), string(after))
+}
+
+func TestSyncCmd_SyncLogOutsideVault(t *testing.T) {
+	dataDir := writeTestData(t, "", "")
+	for _, file := range []string{"../Sync Log", "/tmp/Sync Log"} {
+		sync := &SyncCmd{DataDir: []string{dataDir}, SyncLog: file}
+		assert.ErrorContains(t, sync.Validate(), "must be a page inside the vault", file)
+	}
+	sync := &SyncCmd{DataDir: []string{dataDir}, SyncLog: "Logs/Sync Log.md"}
+	assert.NoError(t, sync.Validate())
+}
@@ -0,0 +1,233 @@
+package program
+
+import (
+	"fmt"
+	"maps"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/alecthomas/kong"
+	"github.com/rs/zerolog/log"
+	"github.com/woodysmith1912/fetlife-data-tools/obsidian"
+)
+
+type ValidateCmd struct {
+	PeopleFolder    string `help:"Folder whose pages must have the person tag" default:"People"`
+	Fix             bool   `help:"Correct the violations that can be fixed automatically, like adding missing person tags"`
+	CheckDuplicates bool   `help:"Also report pages that link to the same FetLife profile as another page with their url or url-aliases"`
+}
+
+// userURLPattern matches the URL of a FetLife profile as sync writes it
+var userURLPattern = regexp.MustCompile(`^https://fetlife\.com/users/\d+$`)
+
+// violation is a problem found with a page
+type violation struct {
+	// File is the page's path relative to the vault
+	File       string
+	Type       string
+	Message    string
+	Suggestion string
+	// fix corrects the violation, nil when it has to be fixed by hand
+	fix  func()
+	page *obsidian.Page
+}
+
+// AfterApply loads the vault skipping the pages that can't be parsed, which Run reports itself, instead of failing
+// like the other commands
+func (cmd *ValidateCmd) AfterApply(ctx *kong.Context, obsidianCmd *ObsidianCmd) error {
+	vault := obsidian.NewVault(obsidianCmd.Vault)
+	invalid, err := vault.LoadValid()
+	if err != nil {
+		log.Error().Err(err).Msg("Error loading vault")
+		return err
+	}
+	logLoadedVault(vault)
+	ctx.Bind(vault, invalid)
+	return nil
+}
+
+// Run prints every violation in the vault and fails if there are any.  With --fix the violations that can be
+// corrected automatically are fixed and saved first.
+func (cmd *ValidateCmd) Run(vault *obsidian.Vault, invalid []*obsidian.PageError) error {
+	// A misspelled --people-folder would check no page for the person tag
+	if !slices.Contains(vault.Folders(), filepath.FromSlash(cmd.PeopleFolder)) {
+		log.Warn().Str("peopleFolder", cmd.PeopleFolder).Msg("The people folder has no pages")
+	}
+
+	violations := cmd.validate(vault, invalid)
+
+	if cmd.Fix {
+		var remaining []violation
+		fixed := make(map[*obsidian.Page]bool)
+		for _, v := range violations {
+			if v.fix == nil {
+				remaining = append(remaining, v)
+				continue
+			}
+			v.fix()
+			fixed[v.page] = true
+			fmt.Printf("%s: %s: fixed\n", v.File, v.Type)
+		}
+		for page := range fixed {
+			if err := page.Save(); err != nil {
+				return err
+			}
+		}
+		violations = remaining
+	}
+
+	for _, v := range violations {
+		fmt.Printf("%s: %s: %s. Fix: %s\n", v.File, v.Type, v.Message, v.Suggestion)
+	}
+
+	if len(violations) > 0 {
+		return fmt.Errorf("found %d violations", len(violations))
+	}
+	log.Info().Int("pageCount", len(vault.Pages)).Msg("Vault is valid")
+	return nil
+}
+
+// validate checks every page of the vault, except the templates, and returns the violations ordered by file
+func (cmd *ValidateCmd) validate(vault *obsidian.Vault, invalid []*obsidian.PageError) []violation {
+	var violations []violation
+
+	for _, err := range invalid {
+		file, relErr := filepath.Rel(vault.Path, err.FilePath)
+		if relErr != nil {
+			file = err.FilePath
+		}
+		violations = append(violations, violation{
+			File:       filepath.ToSlash(file),
+			Type:       "malformed-frontmatter",
+			Message:    err.Err.Error(),
+			Suggestion: "correct the YAML between the --- lines",
+		})
+	}
+
+	// titles groups the pages of each folder by title, ignoring case since not every file system tells them apart
+	titles := make(map[string][]*obsidian.Page)
+	for _, page := range vault.Pages {
+		if page.Folder == templatesFolder {
+			continue
+		}
+		key := page.Folder + "/" + strings.ToLower(page.Title)
+		titles[key] = append(titles[key], page)
+
+		violations = append(violations, cmd.validatePage(page)...)
+	}
+
+	for _, pages := range titles {
+		if len(pages) < 2 {
+			continue
+		}
+		for _, page := range pages {
+			var others []string
+			for _, other := range pages {
+				if other != page {
+					others = append(others, pageFile(other))
+				}
+			}
+			violations = append(violations, violation{
+				File:       pageFile(page),
+				Type:       "duplicate-title",
+				Message:    "same title as " + strings.Join(others, ", "),
+				Suggestion: "merge the pages or rename one of them",
+				page:       page,
+			})
+		}
+	}
+
+	if cmd.CheckDuplicates {
+		violations = append(violations, duplicateUsers(vault)...)
+	}
+
+	sort.SliceStable(violations, func(i, j int) bool {
+		return violations[i].File < violations[j].File
+	})
+	return violations
+}
+
+// duplicateUsers returns a duplicate-user violation for each page that links to the same FetLife profile as another
+// page, leaving out the templates
+func duplicateUsers(vault *obsidian.Vault) []violation {
+	var violations []violation
+	duplicates := vault.FindDuplicates()
+	for _, url := range slices.Sorted(maps.Keys(duplicates)) {
+		pages := slices.DeleteFunc(duplicates[url], func(page *obsidian.Page) bool { return page.Folder == templatesFolder })
+		if len(pages) < 2 {
+			continue
+		}
+		for _, page := range pages {
+			var others []string
+			for _, other := range pages {
+				if other != page {
+					others = append(others, pageFile(other))
+				}
+			}
+			violations = append(violations, violation{
+				File:       pageFile(page),
+				Type:       "duplicate-user",
+				Message:    fmt.Sprintf("links to the same FetLife profile %s as %s", url, strings.Join(others, ", ")),
+				Suggestion: "merge the pages or remove the profile URL from the pages that aren't the user's",
+				page:       page,
+			})
+		}
+	}
+	return violations
+}
+
+// validatePage checks the metadata of a single page.  Only the url of people's pages has to be a FetLife profile,
+// other pages can link anywhere.
+func (cmd *ValidateCmd) validatePage(page *obsidian.Page) []violation {
+	var violations []violation
+	file := pageFile(page)
+	inPeopleFolder := page.Folder == filepath.FromSlash(cmd.PeopleFolder)
+	person := inPeopleFolder || page.HasTag("person") || page.HasTag("blocked")
+
+	if person && page.Url != "" && !userURLPattern.MatchString(page.Url) {
+		v := violation{
+			File:       file,
+			Type:       "invalid-url",
+			Message:    fmt.Sprintf("url %q is not a FetLife profile URL", page.Url),
+			Suggestion: "set url to https://fetlife.com/users/<numeric-id>",
+			page:       page,
+		}
+		// Any URL sync would find the page by, like a www. one or one of the profile's pages, is fixed to the canonical URL
+		if userID, ok := obsidian.ParseUserURL(page.Url); ok {
+			url := obsidian.UserURL(userID)
+			v.Suggestion = "set url to " + url
+			v.fix = func() {
+				page.Url = url
+			}
+		}
+		violations = append(violations, v)
+	}
+
+	if inPeopleFolder && !page.HasTag("person") {
+		violations = append(violations, violation{
+			File:       file,
+			Type:       "missing-person-tag",
+			Message:    "page in " + cmd.PeopleFolder + " has no person tag",
+			Suggestion: "add the person tag",
+			fix: func() {
+				page.AddTag("person")
+			},
+			page: page,
+		})
+	}
+
+	if page.HasTag("blocked") && page.WebMessage == "" {
+		violations = append(violations, violation{
+			File:       file,
+			Type:       "orphan",
+			Message:    "blocked page has no web-message",
+			Suggestion: "add a web-message saying why the user is blocked",
+			page:       page,
+		})
+	}
+
+	return violations
+}
@@ -0,0 +1,129 @@
+package program
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/woodysmith1912/fetlife-data-tools/obsidian"
+	"github.com/zenizh/go-capturer"
+)
+
+// runValidate runs obsidian validate on the vault with extra arguments, returning its output and error
+func runValidate(t *testing.T, vaultPath string, args ...string) (string, error) {
+	t.Helper()
+	var program Options
+	ctx, err := program.Parse(append([]string{"obsidian", "--vault", vaultPath, "--quiet", "validate"}, args...))
+	if !assert.NoError(t, err) {
+		return "", err
+	}
+	out := capturer.CaptureStdout(func() {
+		err = ctx.Run(&program)
+	})
+	return out, err
+}
+
+func TestValidateCmd(t *testing.T) {
+	tempVault := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(tempVault, ".obsidian"), 0755))
+
+	writeTestFile(t, filepath.Join(tempVault, "People", "Alice.md"), "---\nurl: http://www.fetlife.com/users/12345\n---\n")
+	writeTestFile(t, filepath.Join(tempVault, "People", "alice.md"), "---\ntags:\n  - person\nurl: https://fetlife.com/users/54321\n---\n")
+	writeTestFile(t, filepath.Join(tempVault, "Bad People", "Frank.md"), "---\ntags:\n  - person\n  - blocked\nurl: https://fetlife.com/frank\n---\n")
+	writeTestFile(t, filepath.Join(tempVault, "Broken.md"), "---\ntags: [person\n---\n")
+	writeTestFile(t, filepath.Join(tempVault, "Links.md"), "---\nurl: https://example.com/links\n---\n")
+	writeTestFile(t, filepath.Join(tempVault, "Templates", "People.md"), "---\ntags:\n  - person\nurl: https://fetlife.com/users/\n---\n")
+
+	out, err := runValidate(t, tempVault)
+	assert.EqualError(t, err, "found 7 violations")
+
+	var found []string
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		file, rest, _ := strings.Cut(line, ": ")
+		violationType, _, _ := strings.Cut(rest, ": ")
+		found = append(found, file+" "+violationType)
+	}
+	assert.ElementsMatch(t, []string{
+		"Bad People/Frank.md invalid-url",
+		"Bad People/Frank.md orphan",
+		"Broken.md malformed-frontmatter",
+		"People/Alice.md invalid-url",
+		"People/Alice.md missing-person-tag",
+		"People/Alice.md duplicate-title",
+		"People/alice.md duplicate-title",
+	}, found)
+	assert.Contains(t, out, "People/Alice.md: invalid-url: url \"http://www.fetlife.com/users/12345\" is not a FetLife profile URL. Fix: set url to https://fetlife.com/users/12345\n")
+
+	// --fix corrects Alice's url and tag and leaves the rest
+	out, err = runValidate(t, tempVault, "--fix")
+	assert.EqualError(t, err, "found 5 violations")
+	assert.Contains(t, out, "People/Alice.md: invalid-url: fixed\n")
+	assert.Contains(t, out, "People/Alice.md: missing-person-tag: fixed\n")
+
+	alice, err := obsidian.LoadPage(filepath.Join(tempVault, "People", "Alice.md"), tempVault)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://fetlife.com/users/12345", alice.Url)
+	assert.Equal(t, []string{"person"}, alice.Tags)
+
+	// A vault without violations is valid
+	for _, file := range []string{"People/alice.md", "Bad People/Frank.md", "Broken.md"} {
+		assert.NoError(t, os.Remove(filepath.Join(tempVault, file)))
+	}
+	out, err = runValidate(t, tempVault)
+	assert.NoError(t, err)
+	assert.Empty(t, out)
+}
+
+func TestValidateCmd_FixProfileURLs(t *testing.T) {
+	tests := map[string]string{
+		"http://www.fetlife.com/users/12345":       "https://fetlife.com/users/12345",
+		"https://fetlife.com/users/12345/":         "https://fetlife.com/users/12345",
+		"https://fetlife.com/users/12345/about":    "https://fetlife.com/users/12345",
+		"https://fetlife.com/users/12345?sp=1":     "https://fetlife.com/users/12345",
+		"https://fetlife.com/users/12345#pictures": "https://fetlife.com/users/12345",
+		"https://fetlife.com/frank":                "https://fetlife.com/frank",
+		"https://fetlife.com/users/frank":          "https://fetlife.com/users/frank",
+		"https://example.com/users/12345":          "https://example.com/users/12345",
+	}
+	for url, expected := range tests {
+		t.Run(url, func(t *testing.T) {
+			tempVault := t.TempDir()
+			assert.NoError(t, os.MkdirAll(filepath.Join(tempVault, ".obsidian"), 0755))
+			writeTestFile(t, filepath.Join(tempVault, "People", "Alice.md"), "---\ntags:\n  - person\nurl: "+url+"\n---\n")
+
+			_, err := runValidate(t, tempVault, "--fix")
+			if url == expected {
+				assert.EqualError(t, err, "found 1 violations")
+			} else {
+				assert.NoError(t, err)
+			}
+
+			alice, err := obsidian.LoadPage(filepath.Join(tempVault, "People", "Alice.md"), tempVault)
+			assert.NoError(t, err)
+			assert.Equal(t, expected, alice.Url)
+		})
+	}
+}
+
+func TestValidateCmd_CheckDuplicates(t *testing.T) {
+	tempVault := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(tempVault, ".obsidian"), 0755))
+
+	writeTestFile(t, filepath.Join(tempVault, "People", "Alice.md"), "---\ntags:\n  - person\nurl: https://fetlife.com/users/12345\n---\n")
+	writeTestFile(t, filepath.Join(tempVault, "People", "Ally.md"), "---\ntags:\n  - person\nurl-aliases:\n  - http://www.fetlife.com/users/12345\n---\n")
+	writeTestFile(t, filepath.Join(tempVault, "People", "Bob.md"), "---\ntags:\n  - person\nurl: https://fetlife.com/users/123\n---\n")
+	writeTestFile(t, filepath.Join(tempVault, "Templates", "People.md"), "---\ntags:\n  - person\nurl: https://fetlife.com/users/123\n---\n")
+
+	// Duplicates are only reported when asked for
+	_, err := runValidate(t, tempVault)
+	assert.NoError(t, err)
+
+	out, err := runValidate(t, tempVault, "--check-duplicates")
+	assert.EqualError(t, err, "found 2 violations")
+	assert.Equal(t, "People/Alice.md: duplicate-user: links to the same FetLife profile https://fetlife.com/users/12345 as People/Ally.md. "+
+		"Fix: merge the pages or remove the profile URL from the pages that aren't the user's\n"+
+		"People/Ally.md: duplicate-user: links to the same FetLife profile https://fetlife.com/users/12345 as People/Alice.md. "+
+		"Fix: merge the pages or remove the profile URL from the pages that aren't the user's\n", out)
+}
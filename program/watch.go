@@ -0,0 +1,110 @@
+package program
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog/log"
+	"github.com/woodysmith1912/fetlife-data-tools/obsidian"
+)
+
+// watchDebounce is how long --watch waits after the last change of a file before syncing it, since saving a file
+// often takes several writes
+const watchDebounce = 500 * time.Millisecond
+
+// watchedInputs maps the data files watched by --watch to the input they're synced as
+var watchedInputs = map[string]string{
+	"blockeds.txt":      "blocked",
+	"private_notes.txt": "notes",
+}
+
+// watch syncs blockeds.txt or private_notes.txt again whenever it's written or created in a data directory, until
+// ctx is done.  Failed syncs are logged and the watch goes on.
+func (sync *SyncCmd) watch(ctx context.Context, vault *obsidian.Vault) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	// The directory is watched rather than the files, since editors often replace a file instead of writing it
+	for _, dataDir := range sync.DataDir {
+		if err := watcher.Add(dataDir); err != nil {
+			log.Error().Err(err).Str("dataDir", dataDir).Msg("Failed to watch data directory")
+			return err
+		}
+	}
+	fmt.Printf("Watching %s for changes... (Ctrl-C to stop)\n", strings.Join(sync.DataDir, ", "))
+
+	debounce := sync.debounce
+	if debounce == 0 {
+		debounce = watchDebounce
+	}
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+	changed := make(map[string]bool)
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("Stopped watching")
+			return nil
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			// A gzip compressed data file is read like the plain one
+			input, watched := watchedInputs[strings.TrimSuffix(filepath.Base(event.Name), ".gz")]
+			if !watched || !sync.syncs(input) || !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) {
+				continue
+			}
+			log.Debug().Str("file", event.Name).Str("op", event.Op.String()).Msg("Data file changed")
+			changed[input] = true
+			timer.Reset(debounce)
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			log.Error().Err(err).Msg("Failed to watch data directory")
+
+		case <-timer.C:
+			// Blocked users are synced before private notes, like in a full sync
+			for _, input := range []string{"blocked", "notes"} {
+				if !changed[input] {
+					continue
+				}
+				if err := sync.resync(vault, input); err != nil {
+					log.Error().Err(err).Str("input", input).Msg("Failed to sync changed data file")
+				}
+			}
+			clear(changed)
+		}
+	}
+}
+
+// resync syncs a single input again.  The steps that need every record, like --remove-orphans and --recategorize, and
+// --backup are left to the initial sync, and --prune-blocked only runs again for blockeds.txt.
+func (sync *SyncCmd) resync(vault *obsidian.Vault, input string) error {
+	only, skip := sync.Only, sync.Skip
+	removeOrphans, reportOrphans := sync.RemoveOrphans, sync.ReportOrphans
+	recategorize, backup, pruneBlocked := sync.Recategorize, sync.Backup, sync.PruneBlocked
+	defer func() {
+		sync.Only, sync.Skip = only, skip
+		sync.RemoveOrphans, sync.ReportOrphans = removeOrphans, reportOrphans
+		sync.Recategorize, sync.Backup, sync.PruneBlocked = recategorize, backup, pruneBlocked
+	}()
+
+	sync.Only, sync.Skip = []string{input}, nil
+	sync.RemoveOrphans, sync.ReportOrphans = false, false
+	sync.Recategorize, sync.Backup = false, false
+	sync.PruneBlocked = sync.PruneBlocked && input == "blocked"
+
+	log.Info().Str("input", input).Msg("Syncing changed data file")
+	return sync.run(vault)
+}
@@ -0,0 +1,102 @@
+package program
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// waitForFile rewrites a data file until the vault file at path contains want, since the watcher may only start
+// watching after the first write
+func waitForFile(t *testing.T, dataFile, data, path, want string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		writeTestFile(t, dataFile, data)
+		time.Sleep(100 * time.Millisecond)
+		if content, err := os.ReadFile(path); err == nil && strings.Contains(string(content), want) {
+			return
+		}
+	}
+	t.Fatalf("%s doesn't contain %q after changing %s", path, want, dataFile)
+}
+
+func TestSyncCmd_Watch(t *testing.T) {
+	tempVault := t.TempDir()
+	writeTestFile(t, filepath.Join(tempVault, "People", "Alice.md"),
+		"---\ntags:\n  - person\nurl: https://fetlife.com/users/12345\n---\n")
+	dataDir := writeTestData(t, "", "12345,2024-01-01,2024-01-01,Met at a munch\n")
+
+	sync := &SyncCmd{
+		DataDir:         []string{dataDir},
+		CreatePeopleIn:  []string{"People"},
+		CreateBlockedIn: []string{"Bad People"},
+		NoteMode:        "replace",
+		debounce:        10 * time.Millisecond,
+	}
+	assert.NoError(t, sync.Validate())
+	vault := loadTestVault(t, tempVault)
+	assert.NoError(t, sync.run(vault))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- sync.watch(ctx, vault)
+	}()
+
+	// A changed private note is synced again
+	alicePath := filepath.Join(tempVault, "People", "Alice.md")
+	waitForFile(t, filepath.Join(dataDir, "private_notes.txt"),
+		"member_id,created_at,updated_at,private_note\n12345,2024-01-01,2024-02-01,Owes me money\n",
+		alicePath, "web-message: Owes me money")
+
+	// So is a new blocked user
+	waitForFile(t, filepath.Join(dataDir, "blockeds.txt"),
+		"blocked_user_id,created_at,updated_at,blocked_nickname\n99999,2024-03-01,2024-03-01,Mallory\n",
+		filepath.Join(tempVault, "Bad People", "Mallory.md"), "https://fetlife.com/users/99999")
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("watch didn't stop when its context was done")
+	}
+
+	// The options changed for each sync are restored
+	assert.Empty(t, sync.Only)
+
+	// A zip archive can't be watched
+	archivePath := filepath.Join(t.TempDir(), "fetlife-export.zip")
+	writeTestFile(t, archivePath, "")
+	sync = &SyncCmd{DataDir: []string{archivePath}, Watch: true}
+	assert.Error(t, sync.Validate())
+}
+
+func TestSyncCmd_ResyncRoutesByNotes(t *testing.T) {
+	tempVault := t.TempDir()
+	dataDir := writeTestData(t, "", "")
+
+	sync := &SyncCmd{
+		DataDir:         []string{dataDir},
+		CreatePeopleIn:  []string{"People"},
+		CreateBlockedIn: []string{"Bad People", "Event Bans:event"},
+		NoCache:         true,
+	}
+	assert.NoError(t, sync.Validate())
+	vault := loadTestVault(t, tempVault)
+	assert.NoError(t, sync.run(vault))
+
+	// Syncing only blockeds.txt again still routes the new blocked user by its note
+	writeTestFile(t, filepath.Join(dataDir, "blockeds.txt"),
+		"blocked_user_id,created_at,updated_at,blocked_nickname\n99999,2024-03-01,2024-03-01,Mallory\n")
+	writeTestFile(t, filepath.Join(dataDir, "private_notes.txt"),
+		"member_id,created_at,updated_at,private_note\n99999,2024-03-01,2024-03-01,Trouble at the event\n")
+	assert.NoError(t, sync.resync(vault, "blocked"))
+	assert.FileExists(t, filepath.Join(tempVault, "Event Bans", "Mallory.md"))
+}